@@ -33,7 +33,9 @@ const (
 	ChannelID
 	// BlockHeight is a *types.BlockHeight
 	BlockHeight
-	// Integer is a *big.Int
+	// Integer is a *big.Int. Non-negative values are encoded as their big
+	// endian bytes, which never start with a zero byte, and negative values as
+	// a zero byte followed by the bytes of their absolute value.
 	Integer
 	// Bytes is a []byte
 	Bytes
@@ -179,6 +181,9 @@ func (av *Value) Serialize() ([]byte, error) {
 		if !ok {
 			return nil, &typeError{&big.Int{}, av.Val}
 		}
+		if intgr.Sign() < 0 {
+			return append([]byte{0}, intgr.Bytes()...), nil
+		}
 		return intgr.Bytes(), nil
 	case Bytes:
 		b, ok := av.Val.([]byte)
@@ -330,6 +335,12 @@ func Deserialize(data []byte, t Type) (*Value, error) {
 			Val:  types.NewBlockHeightFromBytes(data),
 		}, nil
 	case Integer:
+		if len(data) > 0 && data[0] == 0 {
+			return &Value{
+				Type: t,
+				Val:  big.NewInt(0).Neg(big.NewInt(0).SetBytes(data[1:])),
+			}, nil
+		}
 		return &Value{
 			Type: t,
 			Val:  big.NewInt(0).SetBytes(data),
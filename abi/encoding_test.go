@@ -18,6 +18,7 @@ func TestBasicEncodingRoundTrip(t *testing.T) {
 	cases := map[string][]interface{}{
 		"empty":      nil,
 		"one-int":    {big.NewInt(579)},
+		"neg-int":    {big.NewInt(-579)},
 		"one addr":   {addrGetter()},
 		"two addrs":  {addrGetter(), addrGetter()},
 		"one []byte": {[]byte("foo")},
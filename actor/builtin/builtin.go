@@ -2,6 +2,9 @@
 package builtin
 
 import (
+	"reflect"
+	"strings"
+
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
@@ -24,3 +27,12 @@ func init() {
 	Actors[types.MinerActorCodeCid] = &miner.Actor{}
 	Actors[types.BootstrapMinerActorCodeCid] = &miner.Actor{Bootstrap: true}
 }
+
+// ActorType names the type of a builtin actor, e.g. "MinerActor" for
+// *miner.Actor.
+func ActorType(act exec.ExecutableActor) string {
+	t := reflect.TypeOf(act).Elem()
+	prefixes := strings.Split(t.PkgPath(), "/")
+
+	return strings.Title(prefixes[len(prefixes)-1]) + t.Name()
+}
@@ -3,6 +3,7 @@ package miner
 import (
 	"math/big"
 	"os"
+	"sort"
 	"strconv"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
@@ -23,6 +24,7 @@ import (
 func init() {
 	cbor.RegisterCborType(State{})
 	cbor.RegisterCborType(Ask{})
+	cbor.RegisterCborType(KeyChange{})
 }
 
 // MaximumPublicKeySize is a limit on how big a public key can be.
@@ -33,12 +35,37 @@ const MaximumPublicKeySize = 100
 // https://github.com/filecoin-project/go-filecoin/issues/966
 var ProvingPeriodBlocks = types.NewBlockHeight(20000)
 
+// SectorLifetimeBlocks is the number of blocks a sector is committed for. A
+// miner storing data for longer extends its sectors with extendSectors before
+// they expire.
+// TODO: what is a sensible value for this? Value is arbitrary right now.
+var SectorLifetimeBlocks = types.NewBlockHeight(100000)
+
+// MinimumCollateralPerSector is the minimum amount of collateral required per
+// sector. Collateral above the minimum for the committed sectors of a miner
+// can be withdrawn.
+var MinimumCollateralPerSector, _ = types.NewAttoFILFromFILString("0.001")
+
+// SectorFaultFeeDivisor sets the fee for declaring a sector faulty: a miner
+// pays this fraction of the collateral backing each newly faulted sector. It
+// is smaller than the whole collateral forfeited for missing a PoSt.
+// TODO: what is a sensible value for this? Value is arbitrary right now.
+const SectorFaultFeeDivisor = 10
+
 // GracePeriodBlocks is the number of blocks after a proving period over
-// which a miner can still submit a post at a penalty.
+// which a miner can still submit a post at a penalty, see LatePoStFee. The
+// grace period of a proving period ending at height end is [end, end+grace).
+// A miner that has not submitted its post by the end of the grace period can
+// be slashed by anyone with slashStorageFault.
 // TODO: what is a secure value for this?  Value is arbitrary right now.
 // See https://github.com/filecoin-project/go-filecoin/issues/1887
 var GracePeriodBlocks = types.NewBlockHeight(100)
 
+// KeyChangeDelayBlocks is the number of blocks after which a change of the
+// owner or worker of a miner takes effect.
+// TODO: what is a sensible value for this? Value is arbitrary right now.
+var KeyChangeDelayBlocks = types.NewBlockHeight(100)
+
 const (
 	// ErrPublicKeyTooBig indicates an invalid public key.
 	ErrPublicKeyTooBig = 33
@@ -58,6 +85,19 @@ const (
 	ErrAskNotFound = 40
 	// ErrInvalidSealProof signals that the passed in seal proof was invalid.
 	ErrInvalidSealProof = 41
+	// ErrPoStTooLate signals that the grace period to submit a PoSt is over.
+	ErrPoStTooLate = 42
+	// ErrNoStorageFault signals that the miner has not missed a PoSt and may
+	// not be slashed.
+	ErrNoStorageFault = 43
+	// ErrSectorNotFaulty signals that a sector declared recovered was not
+	// declared faulty.
+	ErrSectorNotFaulty = 44
+	// ErrInsufficientCollateral signals that the collateral of the miner
+	// would not cover its committed sectors.
+	ErrInsufficientCollateral = 45
+	// ErrSectorExpired signals that a sector to extend has already expired.
+	ErrSectorExpired = 46
 )
 
 // Errors map error codes to revert errors this actor may return.
@@ -71,6 +111,11 @@ var Errors = map[uint8]error{
 	ErrInvalidPoSt:             errors.NewCodedRevertErrorf(ErrInvalidPoSt, "PoSt proof did not validate"),
 	ErrAskNotFound:             errors.NewCodedRevertErrorf(ErrAskNotFound, "no ask was found"),
 	ErrInvalidSealProof:        errors.NewCodedRevertErrorf(ErrInvalidSealProof, "seal proof was invalid"),
+	ErrPoStTooLate:             errors.NewCodedRevertErrorf(ErrPoStTooLate, "PoSt submitted after the grace period"),
+	ErrNoStorageFault:          errors.NewCodedRevertErrorf(ErrNoStorageFault, "miner has no storage fault to slash"),
+	ErrSectorNotFaulty:         errors.NewCodedRevertErrorf(ErrSectorNotFaulty, "sector is not faulty"),
+	ErrInsufficientCollateral:  errors.NewCodedRevertErrorf(ErrInsufficientCollateral, "collateral must be at least %s FIL per committed sector", MinimumCollateralPerSector),
+	ErrSectorExpired:           errors.NewCodedRevertErrorf(ErrSectorExpired, "sector has expired"),
 }
 
 // Actor is the miner actor.
@@ -94,10 +139,28 @@ type Ask struct {
 	ID     *big.Int
 }
 
+// KeyChange is a change of the owner or worker of a miner that takes effect
+// at a given block height.
+type KeyChange struct {
+	Address     address.Address
+	EffectiveAt *types.BlockHeight
+}
+
 // State is the miner actors storage.
 type State struct {
+	// Owner controls the funds of the miner. Only the owner can withdraw
+	// collateral and change the keys of the miner.
 	Owner address.Address
 
+	// Worker operates the miner: it commits sectors, submits PoSts and
+	// manages asks along with the owner, without holding its funds.
+	Worker address.Address
+
+	// PendingOwner and PendingWorker are changes of the owner and worker
+	// that have not necessarily taken effect yet, see KeyChangeDelayBlocks.
+	PendingOwner  *KeyChange
+	PendingWorker *KeyChange
+
 	// PeerID references the libp2p identity that the miner is operating.
 	PeerID peer.ID
 
@@ -122,6 +185,25 @@ type State struct {
 	// See also: https://github.com/polydawn/refmt/issues/35
 	SectorCommitments map[string]types.Commitments
 
+	// FaultySectors maps the id of committed sectors that the miner declared
+	// faulty with a PoSt, and has not declared recovered since, to the height
+	// of the declaration. They do not count towards the power of the miner.
+	// The sector id-keys are stringified like those of SectorCommitments.
+	FaultySectors map[string]*types.BlockHeight
+
+	// RecoveringSectors maps the id of faulty sectors that the miner declared
+	// recovered with declareRecovery to the height of the declaration. They
+	// stay faulty until the next PoSt proves them.
+	// The sector id-keys are stringified like those of SectorCommitments.
+	RecoveringSectors map[string]*types.BlockHeight
+
+	// SectorExpirations maps the id of committed sectors to the height at
+	// which they expire. Expired sectors are dropped at the start of the
+	// first proving period they are expired at, after which they no longer
+	// count towards the power of the miner nor are challenged by its PoSts.
+	// The sector id-keys are stringified like those of SectorCommitments.
+	SectorExpirations map[string]*types.BlockHeight
+
 	LastUsedSectorID uint64
 
 	ProvingPeriodStart *types.BlockHeight
@@ -139,11 +221,15 @@ func NewActor() *actor.Actor {
 func NewState(owner address.Address, key []byte, pledge *big.Int, pid peer.ID, collateral *types.AttoFIL) *State {
 	return &State{
 		Owner:             owner,
+		Worker:            owner,
 		PeerID:            pid,
 		PublicKey:         key,
 		PledgeSectors:     pledge,
 		Collateral:        collateral,
 		SectorCommitments: make(map[string]types.Commitments),
+		FaultySectors:     make(map[string]*types.BlockHeight),
+		RecoveringSectors: make(map[string]*types.BlockHeight),
+		SectorExpirations: make(map[string]*types.BlockHeight),
 		Power:             big.NewInt(0),
 		NextAskID:         big.NewInt(0),
 	}
@@ -194,6 +280,18 @@ var minerExports = exec.Exports{
 		Params: nil,
 		Return: []abi.Type{abi.Address},
 	},
+	"getWorker": &exec.FunctionSignature{
+		Params: nil,
+		Return: []abi.Type{abi.Address},
+	},
+	"changeOwner": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Address},
+		Return: []abi.Type{},
+	},
+	"changeWorker": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Address},
+		Return: []abi.Type{},
+	},
 	"getLastUsedSectorID": &exec.FunctionSignature{
 		Params: nil,
 		Return: []abi.Type{abi.SectorID},
@@ -223,9 +321,37 @@ var minerExports = exec.Exports{
 		Return: []abi.Type{abi.Integer},
 	},
 	"submitPoSt": &exec.FunctionSignature{
-		Params: []abi.Type{abi.PoStProofs},
+		Params: []abi.Type{abi.PoStProofs, abi.UintArray},
+		Return: []abi.Type{},
+	},
+	"declareRecovery": &exec.FunctionSignature{
+		Params: []abi.Type{abi.UintArray},
+		Return: []abi.Type{},
+	},
+	"getFaultySectors": &exec.FunctionSignature{
+		Params: []abi.Type{},
+		Return: []abi.Type{abi.UintArray},
+	},
+	"extendSectors": &exec.FunctionSignature{
+		Params: []abi.Type{abi.UintArray, abi.BlockHeight},
 		Return: []abi.Type{},
 	},
+	"getSectorExpiration": &exec.FunctionSignature{
+		Params: []abi.Type{abi.SectorID},
+		Return: []abi.Type{abi.BlockHeight},
+	},
+	"addCollateral": &exec.FunctionSignature{
+		Params: []abi.Type{},
+		Return: []abi.Type{},
+	},
+	"withdrawCollateral": &exec.FunctionSignature{
+		Params: []abi.Type{abi.AttoFIL},
+		Return: []abi.Type{},
+	},
+	"getCollateral": &exec.FunctionSignature{
+		Params: []abi.Type{},
+		Return: []abi.Type{abi.AttoFIL},
+	},
 	"getProvingPeriodStart": &exec.FunctionSignature{
 		Params: []abi.Type{},
 		Return: []abi.Type{abi.BlockHeight},
@@ -234,6 +360,10 @@ var minerExports = exec.Exports{
 		Params: nil,
 		Return: []abi.Type{abi.CommitmentsMap},
 	},
+	"slashStorageFault": &exec.FunctionSignature{
+		Params: []abi.Type{},
+		Return: []abi.Type{},
+	},
 }
 
 // Exports returns the miner actors exported functions.
@@ -250,7 +380,7 @@ func (ma *Actor) AddAsk(ctx exec.VMContext, price *types.AttoFIL, expiry *big.In
 
 	var state State
 	out, err := actor.WithState(ctx, &state, func() (interface{}, error) {
-		if ctx.Message().From != state.Owner {
+		if !state.isOperator(ctx.Message().From, ctx.BlockHeight()) {
 			return nil, Errors[ErrCallerUnauthorized]
 		}
 
@@ -360,7 +490,7 @@ func (ma *Actor) GetAsk(ctx exec.VMContext, askid *big.Int) ([]byte, uint8, erro
 	return ask, 0, nil
 }
 
-// GetOwner returns the miners owner.
+// GetOwner returns the miners owner at the current block height.
 func (ma *Actor) GetOwner(ctx exec.VMContext) (address.Address, uint8, error) {
 	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
 		return address.Address{}, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
@@ -368,7 +498,29 @@ func (ma *Actor) GetOwner(ctx exec.VMContext) (address.Address, uint8, error) {
 
 	var state State
 	out, err := actor.WithState(ctx, &state, func() (interface{}, error) {
-		return state.Owner, nil
+		return state.ownerAt(ctx.BlockHeight()), nil
+	})
+	if err != nil {
+		return address.Address{}, errors.CodeError(err), err
+	}
+
+	a, ok := out.(address.Address)
+	if !ok {
+		return address.Address{}, 1, errors.NewFaultErrorf("expected an Address return value from call, but got %T instead", out)
+	}
+
+	return a, 0, nil
+}
+
+// GetWorker returns the miners worker at the current block height.
+func (ma *Actor) GetWorker(ctx exec.VMContext) (address.Address, uint8, error) {
+	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+		return address.Address{}, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	out, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		return state.workerAt(ctx.BlockHeight()), nil
 	})
 	if err != nil {
 		return address.Address{}, errors.CodeError(err), err
@@ -382,6 +534,98 @@ func (ma *Actor) GetOwner(ctx exec.VMContext) (address.Address, uint8, error) {
 	return a, 0, nil
 }
 
+// ChangeOwner makes addr the owner of the miner after KeyChangeDelayBlocks.
+// It replaces any change of owner that has not taken effect yet.
+func (ma *Actor) ChangeOwner(ctx exec.VMContext, addr address.Address) (uint8, error) {
+	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		h := ctx.BlockHeight()
+		state.applyKeyChanges(h)
+		if ctx.Message().From != state.Owner {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		state.PendingOwner = &KeyChange{Address: addr, EffectiveAt: h.Add(KeyChangeDelayBlocks)}
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// ChangeWorker makes addr the worker of the miner after
+// KeyChangeDelayBlocks. It replaces any change of worker that has not taken
+// effect yet. Only the owner can change the worker.
+func (ma *Actor) ChangeWorker(ctx exec.VMContext, addr address.Address) (uint8, error) {
+	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		h := ctx.BlockHeight()
+		state.applyKeyChanges(h)
+		if ctx.Message().From != state.Owner {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		state.PendingWorker = &KeyChange{Address: addr, EffectiveAt: h.Add(KeyChangeDelayBlocks)}
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// ownerAt returns the owner of the miner at height h, which is the pending
+// owner once its change took effect. Queries without a height see the owner
+// before any pending change.
+func (st *State) ownerAt(h *types.BlockHeight) address.Address {
+	if st.PendingOwner != nil && h != nil && h.GreaterEqual(st.PendingOwner.EffectiveAt) {
+		return st.PendingOwner.Address
+	}
+	return st.Owner
+}
+
+// workerAt returns the worker of the miner at height h, which is the pending
+// worker once its change took effect. Miners created before workers existed
+// are operated by their owner.
+func (st *State) workerAt(h *types.BlockHeight) address.Address {
+	if st.PendingWorker != nil && h != nil && h.GreaterEqual(st.PendingWorker.EffectiveAt) {
+		return st.PendingWorker.Address
+	}
+	if st.Worker.Empty() {
+		return st.ownerAt(h)
+	}
+	return st.Worker
+}
+
+// applyKeyChanges makes the pending owner and worker that took effect at
+// height h the owner and worker of the miner.
+func (st *State) applyKeyChanges(h *types.BlockHeight) {
+	st.Owner, st.Worker = st.ownerAt(h), st.workerAt(h)
+	if st.PendingOwner != nil && h.GreaterEqual(st.PendingOwner.EffectiveAt) {
+		st.PendingOwner = nil
+	}
+	if st.PendingWorker != nil && h.GreaterEqual(st.PendingWorker.EffectiveAt) {
+		st.PendingWorker = nil
+	}
+}
+
+// isOperator returns whether addr can operate the miner at height h, which
+// both its owner and its worker can.
+func (st *State) isOperator(addr address.Address, h *types.BlockHeight) bool {
+	return addr == st.ownerAt(h) || addr == st.workerAt(h)
+}
+
 // GetLastUsedSectorID returns the last used sector id.
 func (ma *Actor) GetLastUsedSectorID(ctx exec.VMContext) (uint64, uint8, error) {
 	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
@@ -426,7 +670,7 @@ func (ma *Actor) GetSectorCommitments(ctx exec.VMContext) (map[string]types.Comm
 }
 
 // CommitSector adds a commitment to the specified sector. The sector must not
-// already be committed.
+// already be committed. It expires after SectorLifetimeBlocks.
 func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR, commRStar, proof []byte) (uint8, error) {
 	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
@@ -479,7 +723,7 @@ func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR,
 	var state State
 	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
 		// verify that the caller is authorized to perform update
-		if ctx.Message().From != state.Owner {
+		if !state.isOperator(ctx.Message().From, ctx.BlockHeight()) {
 			return nil, Errors[ErrCallerUnauthorized]
 		}
 
@@ -488,7 +732,11 @@ func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR,
 			return nil, Errors[ErrSectorCommitted]
 		}
 
-		if state.Power.Cmp(big.NewInt(0)) == 0 {
+		if state.Collateral.LessThan(MinimumCollateral(big.NewInt(int64(len(state.SectorCommitments) + 1)))) {
+			return nil, Errors[ErrInsufficientCollateral]
+		}
+
+		if len(state.SectorCommitments) == 0 {
 			state.ProvingPeriodStart = ctx.BlockHeight()
 		}
 		inc := big.NewInt(1)
@@ -503,6 +751,10 @@ func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR,
 		copy(comms.CommRStar[:], commRStar)
 		state.LastUsedSectorID = sectorID
 		state.SectorCommitments[sectorIDstr] = comms
+		if state.SectorExpirations == nil {
+			state.SectorExpirations = make(map[string]*types.BlockHeight)
+		}
+		state.SectorExpirations[sectorIDstr] = ctx.BlockHeight().Add(SectorLifetimeBlocks)
 		_, ret, err := ctx.Send(address.StorageMarketAddress, "updatePower", nil, []interface{}{inc})
 		if err != nil {
 			return nil, err
@@ -570,7 +822,7 @@ func (ma *Actor) UpdatePeerID(ctx exec.VMContext, pid peer.ID) (uint8, error) {
 	var storage State
 	_, err := actor.WithState(ctx, &storage, func() (interface{}, error) {
 		// verify that the caller is authorized to perform update
-		if ctx.Message().From != storage.Owner {
+		if !storage.isOperator(ctx.Message().From, ctx.BlockHeight()) {
 			return nil, Errors[ErrCallerUnauthorized]
 		}
 
@@ -630,8 +882,18 @@ func (ma *Actor) GetPower(ctx exec.VMContext) (*big.Int, uint8, error) {
 }
 
 // SubmitPoSt is used to submit a coalesced PoST to the chain to convince the chain
-// that you have been actually storing the files you claim to be.
-func (ma *Actor) SubmitPoSt(ctx exec.VMContext, postProofs []proofs.PoStProof) (uint8, error) {
+// that you have been actually storing the files you claim to be. A PoSt
+// submitted after the end of the proving period but within the grace period
+// is accepted, and the miner pays LatePoStFee from its collateral.
+//
+// faults are the ids of the committed sectors the PoSt does not prove. Those
+// not already faulty are added to the faulty sectors of the miner, which loses
+// their power and pays SectorFaultFee for them. Faulty sectors declared
+// recovered with declareRecovery regain their power if the PoSt proves them.
+//
+// Sectors expired at the start of the next proving period are dropped, so
+// they are no longer challenged nor count towards the power of the miner.
+func (ma *Actor) SubmitPoSt(ctx exec.VMContext, postProofs []proofs.PoStProof, faults []uint64) (uint8, error) {
 	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
@@ -639,22 +901,37 @@ func (ma *Actor) SubmitPoSt(ctx exec.VMContext, postProofs []proofs.PoStProof) (
 	var state State
 	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
 		// verify that the caller is authorized to perform update
-		if ctx.Message().From != state.Owner {
+		if !state.isOperator(ctx.Message().From, ctx.BlockHeight()) {
 			return nil, Errors[ErrCallerUnauthorized]
 		}
 
 		// Check if we submitted it in time
 		provingPeriodEnd := state.ProvingPeriodStart.Add(ProvingPeriodBlocks)
-		if ctx.BlockHeight().GreaterThan(provingPeriodEnd) {
-			// Not great.
-			// TODO: charge penalty
-			return nil, errors.NewRevertErrorf("submitted PoSt late, need to pay a fee")
+		if ctx.BlockHeight().GreaterEqual(provingPeriodEnd.Add(GracePeriodBlocks)) {
+			return nil, Errors[ErrPoStTooLate]
 		}
 
-		// reach in to actor storage to grab comm-r for each committed sector
+		faulty := make(map[uint64]bool)
+		for _, sectorID := range faults {
+			if _, ok := state.SectorCommitments[strconv.FormatUint(sectorID, 10)]; !ok {
+				return nil, Errors[ErrInvalidSector]
+			}
+			faulty[sectorID] = true
+		}
+
+		// reach in to actor storage to grab comm-r for each committed sector,
+		// in order of sector id, and the indexes of the faulty ones
+		sectorIDs, err := committedSectorIDs(state)
+		if err != nil {
+			return nil, err
+		}
 		var commRs []proofs.CommR
-		for _, v := range state.SectorCommitments {
-			commRs = append(commRs, v.CommR)
+		faultIndexes := []uint64{}
+		for i, sectorID := range sectorIDs {
+			commRs = append(commRs, state.SectorCommitments[strconv.FormatUint(sectorID, 10)].CommR)
+			if faulty[sectorID] {
+				faultIndexes = append(faultIndexes, uint64(i))
+			}
 		}
 
 		// See comment above, in CommitSector.
@@ -675,7 +952,7 @@ func (ma *Actor) SubmitPoSt(ctx exec.VMContext, postProofs []proofs.PoStProof) (
 		req := proofs.VerifyPoSTRequest{
 			ChallengeSeed: seed,
 			CommRs:        commRs,
-			Faults:        []uint64{},
+			Faults:        faultIndexes,
 			Proofs:        postProofs,
 			StoreType:     sectorStoreType,
 		}
@@ -688,10 +965,75 @@ func (ma *Actor) SubmitPoSt(ctx exec.VMContext, postProofs []proofs.PoStProof) (
 			return nil, Errors[ErrInvalidPoSt]
 		}
 
+		if err := recoverSectors(ctx, &state, faulty); err != nil {
+			return nil, err
+		}
+		if err := declareFaults(ctx, &state, faulty); err != nil {
+			return nil, err
+		}
+
+		fee := LatePoStFee(state.Collateral, provingPeriodEnd, ctx.BlockHeight(), GracePeriodBlocks)
+		if fee.IsPositive() {
+			state.Collateral = state.Collateral.Sub(fee)
+			if _, _, err := ctx.Send(address.NetworkAddress, "", fee, nil); err != nil {
+				return nil, err
+			}
+		}
+
 		// transition to the next proving period
 		state.ProvingPeriodStart = provingPeriodEnd
 		state.LastPoSt = ctx.BlockHeight()
 
+		if err := dropExpiredSectors(ctx, &state, state.ProvingPeriodStart); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// SlashStorageFault slashes a miner that has not submitted a PoSt by the end
+// of the grace period of its proving period: its collateral is forfeited to
+// the network, and its power is zeroed and its sectors are dropped, as it can
+// no longer be trusted to store them. Anyone can call it.
+func (ma *Actor) SlashStorageFault(ctx exec.VMContext) (uint8, error) {
+	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		if !isLate(state, ctx.BlockHeight()) {
+			return nil, Errors[ErrNoStorageFault]
+		}
+
+		power := big.NewInt(0).Neg(state.Power)
+		_, ret, err := ctx.Send(address.StorageMarketAddress, "updatePower", nil, []interface{}{power})
+		if err != nil {
+			return nil, err
+		}
+		if ret != 0 {
+			return nil, Errors[ErrStoragemarketCallFailed]
+		}
+
+		if state.Collateral.IsPositive() {
+			if _, _, err := ctx.Send(address.NetworkAddress, "", state.Collateral, nil); err != nil {
+				return nil, err
+			}
+		}
+
+		state.Collateral = types.NewZeroAttoFIL()
+		state.Power = big.NewInt(0)
+		state.SectorCommitments = make(map[string]types.Commitments)
+		state.FaultySectors = make(map[string]*types.BlockHeight)
+		state.RecoveringSectors = make(map[string]*types.BlockHeight)
+		state.SectorExpirations = make(map[string]*types.BlockHeight)
+
 		return nil, nil
 	})
 	if err != nil {
@@ -701,6 +1043,405 @@ func (ma *Actor) SubmitPoSt(ctx exec.VMContext, postProofs []proofs.PoStProof) (
 	return 0, nil
 }
 
+// isLate returns true if the miner has sectors to prove and the grace period
+// to submit the PoSt of its current proving period is over at height h.
+func isLate(state State, h *types.BlockHeight) bool {
+	if len(state.SectorCommitments) == 0 || state.ProvingPeriodStart == nil {
+		return false
+	}
+	deadline := state.ProvingPeriodStart.Add(ProvingPeriodBlocks).Add(GracePeriodBlocks)
+	return h.GreaterEqual(deadline)
+}
+
+// LatePoStFee returns the fee a miner with the given collateral pays for a
+// PoSt submitted at height h for a proving period ending at provingPeriodEnd.
+// It is zero for a PoSt submitted in time, and grows with every block late,
+// rounding up, to the whole collateral at the end of the grace period, where
+// the PoSt is no longer accepted.
+func LatePoStFee(collateral *types.AttoFIL, provingPeriodEnd, h, gracePeriod *types.BlockHeight) *types.AttoFIL {
+	if h.LessEqual(provingPeriodEnd) {
+		return types.NewZeroAttoFIL()
+	}
+	late := h.Sub(provingPeriodEnd)
+	if late.GreaterEqual(gracePeriod) {
+		return collateral
+	}
+	return collateral.MulBigInt(late.AsBigInt()).DivCeil(types.NewAttoFIL(gracePeriod.AsBigInt()))
+}
+
+// DeclareRecovery declares that faulty sectors of the miner are stored again.
+// They stay faulty and regain their power once the next PoSt proves them.
+func (ma *Actor) DeclareRecovery(ctx exec.VMContext, sectorIDs []uint64) (uint8, error) {
+	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		// verify that the caller is authorized to perform update
+		if !state.isOperator(ctx.Message().From, ctx.BlockHeight()) {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		for _, sectorID := range sectorIDs {
+			if _, ok := state.FaultySectors[strconv.FormatUint(sectorID, 10)]; !ok {
+				return nil, Errors[ErrSectorNotFaulty]
+			}
+		}
+
+		if state.RecoveringSectors == nil {
+			state.RecoveringSectors = make(map[string]*types.BlockHeight)
+		}
+		for _, sectorID := range sectorIDs {
+			state.RecoveringSectors[strconv.FormatUint(sectorID, 10)] = ctx.BlockHeight()
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// GetFaultySectors returns the ids of the sectors of the miner that are
+// declared faulty, in ascending order.
+func (ma *Actor) GetFaultySectors(ctx exec.VMContext) ([]uint64, uint8, error) {
+	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	out, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		var keys []string
+		for k := range state.FaultySectors {
+			keys = append(keys, k)
+		}
+		return parseSectorIDs(keys)
+	})
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	sectorIDs, ok := out.([]uint64)
+	if !ok {
+		return nil, 1, errors.NewFaultErrorf("expected a []uint64 return value from call, but got %T instead", out)
+	}
+
+	return sectorIDs, 0, nil
+}
+
+// declareFaults adds the faulty sectors that are not already to the faulty
+// sectors of the miner, reducing its power and charging SectorFaultFee for
+// them.
+func declareFaults(ctx exec.VMContext, state *State, faulty map[uint64]bool) error {
+	if state.FaultySectors == nil {
+		state.FaultySectors = make(map[string]*types.BlockHeight)
+	}
+
+	var newFaults int64
+	for sectorID := range faulty {
+		sectorIDstr := strconv.FormatUint(sectorID, 10)
+		if _, ok := state.FaultySectors[sectorIDstr]; ok {
+			continue
+		}
+		state.FaultySectors[sectorIDstr] = ctx.BlockHeight()
+		newFaults++
+	}
+	if newFaults == 0 {
+		return nil
+	}
+
+	fee := SectorFaultFee(state.Collateral, newFaults, int64(len(state.SectorCommitments)))
+	dec := big.NewInt(-newFaults)
+	state.Power = state.Power.Add(state.Power, dec)
+	_, ret, err := ctx.Send(address.StorageMarketAddress, "updatePower", nil, []interface{}{dec})
+	if err != nil {
+		return err
+	}
+	if ret != 0 {
+		return Errors[ErrStoragemarketCallFailed]
+	}
+
+	if fee.IsPositive() {
+		state.Collateral = state.Collateral.Sub(fee)
+		if _, _, err := ctx.Send(address.NetworkAddress, "", fee, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recoverSectors restores the power of the sectors declared recovered that
+// are proven by a PoSt with the given faults. Those that are not stay faulty,
+// and must be declared recovered again.
+func recoverSectors(ctx exec.VMContext, state *State, faulty map[uint64]bool) error {
+	var recovered int64
+	for sectorIDstr := range state.RecoveringSectors {
+		delete(state.RecoveringSectors, sectorIDstr)
+		sectorID, err := strconv.ParseUint(sectorIDstr, 10, 64)
+		if err != nil {
+			return errors.FaultErrorWrapf(err, "invalid sector id %s", sectorIDstr)
+		}
+		if faulty[sectorID] {
+			continue
+		}
+		delete(state.FaultySectors, sectorIDstr)
+		recovered++
+	}
+	if recovered == 0 {
+		return nil
+	}
+
+	inc := big.NewInt(recovered)
+	state.Power = state.Power.Add(state.Power, inc)
+	_, ret, err := ctx.Send(address.StorageMarketAddress, "updatePower", nil, []interface{}{inc})
+	if err != nil {
+		return err
+	}
+	if ret != 0 {
+		return Errors[ErrStoragemarketCallFailed]
+	}
+	return nil
+}
+
+// dropExpiredSectors drops the sectors of the miner that are expired at
+// height h, reducing its power by the ones that are not faulty.
+func dropExpiredSectors(ctx exec.VMContext, state *State, h *types.BlockHeight) error {
+	var dropped int64
+	for sectorIDstr, expiration := range state.SectorExpirations {
+		if expiration.GreaterThan(h) {
+			continue
+		}
+		delete(state.SectorCommitments, sectorIDstr)
+		delete(state.SectorExpirations, sectorIDstr)
+		delete(state.RecoveringSectors, sectorIDstr)
+		if _, ok := state.FaultySectors[sectorIDstr]; ok {
+			delete(state.FaultySectors, sectorIDstr)
+			continue
+		}
+		dropped++
+	}
+	if dropped == 0 {
+		return nil
+	}
+
+	dec := big.NewInt(-dropped)
+	state.Power = state.Power.Add(state.Power, dec)
+	_, ret, err := ctx.Send(address.StorageMarketAddress, "updatePower", nil, []interface{}{dec})
+	if err != nil {
+		return err
+	}
+	if ret != 0 {
+		return Errors[ErrStoragemarketCallFailed]
+	}
+	return nil
+}
+
+// ExtendSectors extends committed sectors of the miner that have not expired
+// yet to expire at the given height, which must not be earlier than their
+// current expiration.
+func (ma *Actor) ExtendSectors(ctx exec.VMContext, sectorIDs []uint64, expiration *types.BlockHeight) (uint8, error) {
+	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		// verify that the caller is authorized to perform update
+		if !state.isOperator(ctx.Message().From, ctx.BlockHeight()) {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		if state.SectorExpirations == nil {
+			state.SectorExpirations = make(map[string]*types.BlockHeight)
+		}
+		for _, sectorID := range sectorIDs {
+			sectorIDstr := strconv.FormatUint(sectorID, 10)
+			if _, ok := state.SectorCommitments[sectorIDstr]; !ok {
+				return nil, Errors[ErrInvalidSector]
+			}
+
+			// sectors committed before expirations existed never expire
+			current, ok := state.SectorExpirations[sectorIDstr]
+			if !ok {
+				continue
+			}
+			if current.LessEqual(ctx.BlockHeight()) {
+				return nil, Errors[ErrSectorExpired]
+			}
+			if expiration.LessThan(current) {
+				return nil, errors.NewRevertErrorf("cannot shorten the lifetime of sector %d", sectorID)
+			}
+			state.SectorExpirations[sectorIDstr] = expiration
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// GetSectorExpiration returns the height at which a committed sector of the
+// miner expires.
+func (ma *Actor) GetSectorExpiration(ctx exec.VMContext, sectorID uint64) (*types.BlockHeight, uint8, error) {
+	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	ret, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		expiration, ok := state.SectorExpirations[strconv.FormatUint(sectorID, 10)]
+		if !ok {
+			return nil, Errors[ErrInvalidSector]
+		}
+		return expiration, nil
+	})
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	expiration, ok := ret.(*types.BlockHeight)
+	if !ok {
+		return nil, 1, errors.NewFaultErrorf("expected *types.BlockHeight to be returned, but got %T instead", ret)
+	}
+
+	return expiration, 0, nil
+}
+
+// SectorFaultFee returns the fee a miner with the given collateral and number
+// of committed sectors pays for declaring faulted of them faulty: a
+// SectorFaultFeeDivisor-th of the collateral backing them, rounding up.
+func SectorFaultFee(collateral *types.AttoFIL, faulted, sectors int64) *types.AttoFIL {
+	if faulted == 0 || sectors == 0 {
+		return types.NewZeroAttoFIL()
+	}
+	divisor := big.NewInt(sectors)
+	divisor.Mul(divisor, big.NewInt(SectorFaultFeeDivisor))
+	return collateral.MulBigInt(big.NewInt(faulted)).DivCeil(types.NewAttoFIL(divisor))
+}
+
+// committedSectorIDs returns the ids of the committed sectors of the miner in
+// ascending order. The comm-rs of a PoSt are in this order.
+func committedSectorIDs(state State) ([]uint64, error) {
+	var keys []string
+	for k := range state.SectorCommitments {
+		keys = append(keys, k)
+	}
+	return parseSectorIDs(keys)
+}
+
+// parseSectorIDs parses stringified sector ids, returning them in ascending
+// order.
+func parseSectorIDs(keys []string) ([]uint64, error) {
+	sectorIDs := []uint64{}
+	for _, k := range keys {
+		sectorID, err := strconv.ParseUint(k, 10, 64)
+		if err != nil {
+			return nil, errors.FaultErrorWrapf(err, "invalid sector id %s", k)
+		}
+		sectorIDs = append(sectorIDs, sectorID)
+	}
+	sort.Slice(sectorIDs, func(i, j int) bool { return sectorIDs[i] < sectorIDs[j] })
+	return sectorIDs, nil
+}
+
+// AddCollateral adds the value of the message to the collateral of the miner.
+// Anyone can add collateral to a miner, though only its owner can withdraw it.
+func (ma *Actor) AddCollateral(ctx exec.VMContext) (uint8, error) {
+	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		state.Collateral = state.Collateral.Add(ctx.Message().Value)
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// WithdrawCollateral sends amount of the collateral of the miner to its
+// owner. Only collateral not required for the committed sectors of the miner
+// can be withdrawn, see UnencumberedCollateral.
+func (ma *Actor) WithdrawCollateral(ctx exec.VMContext, amount *types.AttoFIL) (uint8, error) {
+	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		// verify that the caller is authorized to perform update
+		owner := state.ownerAt(ctx.BlockHeight())
+		if ctx.Message().From != owner {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		if amount.IsNegative() {
+			return nil, errors.NewRevertError("cannot withdraw a negative amount")
+		}
+		if amount.GreaterThan(UnencumberedCollateral(&state)) {
+			return nil, Errors[ErrInsufficientCollateral]
+		}
+
+		state.Collateral = state.Collateral.Sub(amount)
+		if _, _, err := ctx.Send(owner, "", amount, nil); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// GetCollateral returns the collateral of the miner.
+func (ma *Actor) GetCollateral(ctx exec.VMContext) (*types.AttoFIL, uint8, error) {
+	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	ret, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		return state.Collateral, nil
+	})
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	collateral, ok := ret.(*types.AttoFIL)
+	if !ok {
+		return nil, 1, errors.NewFaultErrorf("expected *types.AttoFIL to be returned, but got %T instead", ret)
+	}
+
+	return collateral, 0, nil
+}
+
+// MinimumCollateral returns the minimum required amount of collateral for a
+// given number of sectors.
+func MinimumCollateral(sectors *big.Int) *types.AttoFIL {
+	return MinimumCollateralPerSector.MulBigInt(sectors)
+}
+
+// UnencumberedCollateral returns the collateral of the miner above the
+// minimum required for its committed sectors, faulty or not, which its owner
+// may withdraw.
+func UnencumberedCollateral(state *State) *types.AttoFIL {
+	required := MinimumCollateral(big.NewInt(int64(len(state.SectorCommitments))))
+	if state.Collateral.LessEqual(required) {
+		return types.NewZeroAttoFIL()
+	}
+	return state.Collateral.Sub(required)
+}
+
 // GetProvingPeriodStart returns the current ProvingPeriodStart value.
 func (ma *Actor) GetProvingPeriodStart(ctx exec.VMContext) (*types.BlockHeight, uint8, error) {
 	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
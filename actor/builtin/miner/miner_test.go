@@ -7,6 +7,7 @@ import (
 
 	peer "gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
 
+	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	. "github.com/filecoin-project/go-filecoin/actor/builtin/miner"
@@ -329,7 +330,7 @@ func TestMinerSubmitPoSt(t *testing.T) {
 
 	// submit post
 	proof := th.MakeRandomPoSTProofForTest()
-	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 8, "submitPoSt", ancestors, []proofs.PoStProof{proof})
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 8, "submitPoSt", ancestors, []proofs.PoStProof{proof}, []uint64{})
 	require.NoError(err)
 	require.NoError(res.ExecutionError)
 	require.Equal(uint8(0), res.Receipt.ExitCode)
@@ -340,9 +341,400 @@ func TestMinerSubmitPoSt(t *testing.T) {
 	require.NoError(res.ExecutionError)
 	require.Equal(types.NewBlockHeightFromBytes(res.Receipt.Return[0]), types.NewBlockHeight(20003))
 
-	// fail to submit inside the proving period
+	// submit late, within the grace period, paying a fee from the collateral
 	proof = th.MakeRandomPoSTProofForTest()
-	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 40008, "submitPoSt", ancestors, []proofs.PoStProof{proof})
+	ancestors = requireTipSetsAt(t, 20003, 0)
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 40008, "submitPoSt", ancestors, []proofs.PoStProof{proof}, []uint64{})
 	require.NoError(err)
-	require.EqualError(res.ExecutionError, "submitted PoSt late, need to pay a fee")
+	require.NoError(res.ExecutionError)
+	require.Equal(uint8(0), res.Receipt.ExitCode)
+
+	minerState := requireMinerState(ctx, t, st, vms, minerAddr)
+	require.True(types.NewAttoFILFromFIL(95).Equal(minerState.Collateral))
+	require.Equal(types.NewBlockHeight(40003), minerState.ProvingPeriodStart)
+
+	// fail to submit once the grace period is over
+	proof = th.MakeRandomPoSTProofForTest()
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 60103, "submitPoSt", ancestors, []proofs.PoStProof{proof}, []uint64{})
+	require.NoError(err)
+	require.EqualError(res.ExecutionError, "PoSt submitted after the grace period")
+	require.Equal(uint8(ErrPoStTooLate), res.Receipt.ExitCode)
+}
+
+func TestMinerSlashStorageFault(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	st, vms := core.CreateStorages(ctx, t)
+
+	ancestors := th.RequireTipSetChain(t, 10)
+	minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+	res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", ancestors, uint64(1), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)))
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+
+	require.Equal(big.NewInt(1), requireTotalStorage(ctx, t, st, vms))
+
+	// cannot slash within the grace period
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 20102, "slashStorageFault", ancestors)
+	require.NoError(err)
+	require.EqualError(res.ExecutionError, "miner has no storage fault to slash")
+	require.Equal(uint8(ErrNoStorageFault), res.Receipt.ExitCode)
+
+	networkBefore, err := st.GetActor(ctx, address.NetworkAddress)
+	require.NoError(err)
+	networkBalance := networkBefore.Balance
+
+	// anyone can slash once it is over
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 20103, "slashStorageFault", ancestors)
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+	require.Equal(uint8(0), res.Receipt.ExitCode)
+
+	minerState := requireMinerState(ctx, t, st, vms, minerAddr)
+	require.True(minerState.Collateral.IsZero())
+	require.Equal(big.NewInt(0), minerState.Power)
+	require.Empty(minerState.SectorCommitments)
+	require.Equal(big.NewInt(0), requireTotalStorage(ctx, t, st, vms))
+
+	network, err := st.GetActor(ctx, address.NetworkAddress)
+	require.NoError(err)
+	require.True(networkBalance.Add(types.NewAttoFILFromFIL(100)).Equal(network.Balance))
+
+	// a slashed miner has nothing more to slash
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 20105, "slashStorageFault", ancestors)
+	require.NoError(err)
+	require.Equal(uint8(ErrNoStorageFault), res.Receipt.ExitCode)
+}
+
+func TestMinerSectorFaults(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	st, vms := core.CreateStorages(ctx, t)
+
+	ancestors := th.RequireTipSetChain(t, 10)
+	minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+	for _, sectorID := range []uint64{1, 2} {
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", ancestors, sectorID, th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)))
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+	}
+
+	// fail to declare a sector that is not committed faulty
+	proof := th.MakeRandomPoSTProofForTest()
+	res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 8, "submitPoSt", ancestors, []proofs.PoStProof{proof}, []uint64{3})
+	require.NoError(err)
+	require.EqualError(res.ExecutionError, "sectorID out of range")
+
+	// declare a fault with the PoSt, losing power and paying a fee
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 8, "submitPoSt", ancestors, []proofs.PoStProof{proof}, []uint64{2})
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+	require.Equal(uint8(0), res.Receipt.ExitCode)
+
+	minerState := requireMinerState(ctx, t, st, vms, minerAddr)
+	require.Equal(big.NewInt(1), minerState.Power)
+	require.Contains(minerState.FaultySectors, "2")
+	require.True(types.NewAttoFILFromFIL(95).Equal(minerState.Collateral))
+	require.Equal(big.NewInt(1), requireTotalStorage(ctx, t, st, vms))
+
+	faulty := callQueryMethodSuccess("getFaultySectors", ctx, t, st, vms, address.TestAddress, minerAddr)
+	faultyVal, err := abi.Deserialize(faulty[0], abi.UintArray)
+	require.NoError(err)
+	require.Equal([]uint64{2}, faultyVal.Val)
+
+	// fail to recover a sector that is not faulty
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 9, "declareRecovery", ancestors, []uint64{1})
+	require.NoError(err)
+	require.EqualError(res.ExecutionError, "sector is not faulty")
+	require.Equal(uint8(ErrSectorNotFaulty), res.Receipt.ExitCode)
+
+	// declare the faulty sector recovered, which does not restore its power
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 9, "declareRecovery", ancestors, []uint64{2})
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+
+	minerState = requireMinerState(ctx, t, st, vms, minerAddr)
+	require.Equal(big.NewInt(1), minerState.Power)
+	require.Contains(minerState.FaultySectors, "2")
+	require.Contains(minerState.RecoveringSectors, "2")
+
+	// a PoSt that does not prove it leaves it faulty, without another fee
+	ancestors = requireTipSetsAt(t, 20003, 0)
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 20008, "submitPoSt", ancestors, []proofs.PoStProof{proof}, []uint64{2})
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+
+	minerState = requireMinerState(ctx, t, st, vms, minerAddr)
+	require.Equal(big.NewInt(1), minerState.Power)
+	require.Contains(minerState.FaultySectors, "2")
+	require.Empty(minerState.RecoveringSectors)
+	require.True(types.NewAttoFILFromFIL(95).Equal(minerState.Collateral))
+
+	// declared recovered again and proven by the next PoSt, it regains its power
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 20009, "declareRecovery", ancestors, []uint64{2})
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+
+	ancestors = requireTipSetsAt(t, 40003, 0)
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 40008, "submitPoSt", ancestors, []proofs.PoStProof{proof}, []uint64{})
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+
+	minerState = requireMinerState(ctx, t, st, vms, minerAddr)
+	require.Equal(big.NewInt(2), minerState.Power)
+	require.Empty(minerState.FaultySectors)
+	require.Empty(minerState.RecoveringSectors)
+	require.Equal(big.NewInt(2), requireTotalStorage(ctx, t, st, vms))
+}
+
+func TestMinerSectorExpiration(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	st, vms := core.CreateStorages(ctx, t)
+
+	ancestors := th.RequireTipSetChain(t, 10)
+	minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+	for _, sectorID := range []uint64{1, 2} {
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", ancestors, sectorID, th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)))
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+	}
+
+	// sectors expire after their lifetime
+	res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 4, "getSectorExpiration", ancestors, uint64(1))
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+	require.Equal(types.NewBlockHeight(3).Add(SectorLifetimeBlocks), types.NewBlockHeightFromBytes(res.Receipt.Return[0]))
+
+	// fail to extend a sector that is not committed
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 4, "extendSectors", ancestors, []uint64{3}, types.NewBlockHeight(200003))
+	require.NoError(err)
+	require.Equal(uint8(ErrInvalidSector), res.Receipt.ExitCode)
+
+	// fail to shorten the lifetime of a sector
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 4, "extendSectors", ancestors, []uint64{1}, types.NewBlockHeight(50000))
+	require.NoError(err)
+	require.EqualError(res.ExecutionError, "cannot shorten the lifetime of sector 1")
+
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 4, "extendSectors", ancestors, []uint64{2}, types.NewBlockHeight(200003))
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+
+	minerState := requireMinerState(ctx, t, st, vms, minerAddr)
+	require.Equal(types.NewBlockHeight(200003), minerState.SectorExpirations["2"])
+
+	// prove both sectors until the first one expires at the end of a proving
+	// period
+	for start := uint64(3); start < 80003; start += 20000 {
+		proof := th.MakeRandomPoSTProofForTest()
+		res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, start+5, "submitPoSt", requireTipSetsAt(t, start, 0), []proofs.PoStProof{proof}, []uint64{})
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+	}
+
+	// fail to extend an expired sector
+	ancestors = requireTipSetsAt(t, 80003, 0)
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 100003, "extendSectors", ancestors, []uint64{1}, types.NewBlockHeight(200003))
+	require.NoError(err)
+	require.EqualError(res.ExecutionError, "sector has expired")
+	require.Equal(uint8(ErrSectorExpired), res.Receipt.ExitCode)
+
+	// the expired sector is dropped with the PoSt of its last proving period
+	proof := th.MakeRandomPoSTProofForTest()
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 100003, "submitPoSt", ancestors, []proofs.PoStProof{proof}, []uint64{})
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+
+	minerState = requireMinerState(ctx, t, st, vms, minerAddr)
+	require.Equal(big.NewInt(1), minerState.Power)
+	require.NotContains(minerState.SectorCommitments, "1")
+	require.NotContains(minerState.SectorExpirations, "1")
+	require.Contains(minerState.SectorCommitments, "2")
+	require.Equal(big.NewInt(1), requireTotalStorage(ctx, t, st, vms))
+	require.True(types.NewAttoFILFromFIL(100).Equal(minerState.Collateral))
+}
+
+func TestMinerCollateral(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	st, vms := core.CreateStorages(ctx, t)
+
+	minerAddr := createTestMinerWith(100, 1, assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+	getCollateral := func() *types.AttoFIL {
+		res := callQueryMethodSuccess("getCollateral", ctx, t, st, vms, address.TestAddress, minerAddr)
+		return types.NewAttoFILFromBytes(res[0])
+	}
+	require.True(types.NewAttoFILFromFIL(1).Equal(getCollateral()))
+
+	// add collateral with the value of the message
+	res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 2, 1, "addCollateral", nil)
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+	require.True(types.NewAttoFILFromFIL(3).Equal(getCollateral()))
+
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 2, "commitSector", nil, uint64(1), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)))
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+
+	// fail to withdraw collateral required by the committed sector
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "withdrawCollateral", nil, types.NewAttoFILFromFIL(3))
+	require.NoError(err)
+	require.Error(res.ExecutionError)
+	require.Equal(uint8(ErrInsufficientCollateral), res.Receipt.ExitCode)
+
+	// withdraw the unencumbered collateral to the owner
+	owner, err := st.GetActor(ctx, address.TestAddress)
+	require.NoError(err)
+	ownerBalance := owner.Balance
+
+	unencumbered, ok := types.NewAttoFILFromFILString("2.999")
+	require.True(ok)
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "withdrawCollateral", nil, unencumbered)
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+	require.True(MinimumCollateral(big.NewInt(1)).Equal(getCollateral()))
+
+	owner, err = st.GetActor(ctx, address.TestAddress)
+	require.NoError(err)
+	require.True(ownerBalance.Add(unencumbered).Equal(owner.Balance))
+
+	// fail to commit a sector without collateral for it
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 4, "commitSector", nil, uint64(2), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)))
+	require.NoError(err)
+	require.Error(res.ExecutionError)
+	require.Equal(uint8(ErrInsufficientCollateral), res.Receipt.ExitCode)
+}
+
+func TestMinerKeys(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	st, vms := core.CreateStorages(ctx, t)
+
+	minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+	sendFrom := func(from address.Address, h uint64, method string, params ...interface{}) *consensus.ApplicationResult {
+		msg := types.NewMessage(from, minerAddr, core.MustGetNonce(st, from), nil, method, actor.MustConvertParams(params...))
+		res, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(h))
+		require.NoError(err)
+		return res
+	}
+	getKey := func(method string, h uint64) address.Address {
+		res, code, err := consensus.CallQueryMethod(ctx, st, vms, minerAddr, method, []byte{}, address.TestAddress, types.NewBlockHeight(h))
+		require.NoError(err)
+		require.Equal(uint8(0), code)
+		addr, err := address.NewFromBytes(res[0])
+		require.NoError(err)
+		return addr
+	}
+
+	// the owner is the worker of a new miner
+	require.Equal(address.TestAddress, getKey("getWorker", 0))
+
+	// only the owner can change the worker
+	res := sendFrom(address.TestAddress2, 1, "changeWorker", address.TestAddress2)
+	require.Equal(Errors[ErrCallerUnauthorized], res.ExecutionError)
+
+	res = sendFrom(address.TestAddress, 1, "changeWorker", address.TestAddress2)
+	require.NoError(res.ExecutionError)
+
+	// the new worker operates the miner once the change took effect
+	require.Equal(address.TestAddress, getKey("getWorker", 100))
+	require.Equal(address.TestAddress2, getKey("getWorker", 101))
+
+	commitFrom := func(from address.Address, h uint64, sectorID uint64) *consensus.ApplicationResult {
+		return sendFrom(from, h, "commitSector", sectorID, th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)))
+	}
+	res = commitFrom(address.TestAddress2, 100, 1)
+	require.Equal(Errors[ErrCallerUnauthorized], res.ExecutionError)
+
+	res = commitFrom(address.TestAddress2, 101, 1)
+	require.NoError(res.ExecutionError)
+
+	// the owner can still operate the miner
+	res = commitFrom(address.TestAddress, 101, 2)
+	require.NoError(res.ExecutionError)
+
+	// the worker cannot act as the owner
+	res = sendFrom(address.TestAddress2, 101, "changeOwner", address.TestAddress2)
+	require.Equal(Errors[ErrCallerUnauthorized], res.ExecutionError)
+
+	res = sendFrom(address.TestAddress2, 101, "withdrawCollateral", types.NewAttoFILFromFIL(1))
+	require.Equal(Errors[ErrCallerUnauthorized], res.ExecutionError)
+
+	// the owner hands the miner over after a delay
+	res = sendFrom(address.TestAddress, 102, "changeOwner", address.TestAddress2)
+	require.NoError(res.ExecutionError)
+
+	require.Equal(address.TestAddress, getKey("getOwner", 201))
+	require.Equal(address.TestAddress2, getKey("getOwner", 202))
+
+	res = sendFrom(address.TestAddress, 202, "changeWorker", address.TestAddress)
+	require.Equal(Errors[ErrCallerUnauthorized], res.ExecutionError)
+
+	res = sendFrom(address.TestAddress2, 202, "changeWorker", address.TestAddress)
+	require.NoError(res.ExecutionError)
+
+	state := requireMinerState(ctx, t, st, vms, minerAddr)
+	require.Equal(address.TestAddress2, state.Owner)
+	require.Equal(address.TestAddress2, state.Worker)
+	require.Equal(address.TestAddress, state.PendingWorker.Address)
+}
+
+func TestSectorFaultFee(t *testing.T) {
+	assert := assert.New(t)
+
+	collateral := types.NewAttoFILFromFIL(100)
+	assert.True(SectorFaultFee(collateral, 0, 10).IsZero())
+	assert.True(SectorFaultFee(collateral, 1, 0).IsZero())
+	assert.True(types.NewAttoFILFromFIL(1).Equal(SectorFaultFee(collateral, 1, 10)))
+	assert.True(types.NewAttoFILFromFIL(10).Equal(SectorFaultFee(collateral, 10, 10)))
+}
+
+func TestLatePoStFee(t *testing.T) {
+	assert := assert.New(t)
+
+	collateral := types.NewAttoFILFromFIL(100)
+	end := types.NewBlockHeight(1000)
+	grace := types.NewBlockHeight(100)
+
+	assert.True(LatePoStFee(collateral, end, types.NewBlockHeight(999), grace).IsZero())
+	assert.True(LatePoStFee(collateral, end, end, grace).IsZero())
+	assert.True(types.NewAttoFILFromFIL(1).Equal(LatePoStFee(collateral, end, types.NewBlockHeight(1001), grace)))
+	assert.True(types.NewAttoFILFromFIL(50).Equal(LatePoStFee(collateral, end, types.NewBlockHeight(1050), grace)))
+	assert.True(types.NewAttoFILFromFIL(99).Equal(LatePoStFee(collateral, end, types.NewBlockHeight(1099), grace)))
+	assert.True(collateral.Equal(LatePoStFee(collateral, end, types.NewBlockHeight(1100), grace)))
+	assert.True(collateral.Equal(LatePoStFee(collateral, end, types.NewBlockHeight(2000), grace)))
+}
+
+func requireMinerState(ctx context.Context, t *testing.T, st state.Tree, vms vm.StorageMap, minerAddr address.Address) *State {
+	minerActor, err := st.GetActor(ctx, minerAddr)
+	require.NoError(t, err)
+	chunk, err := vms.NewStorage(minerAddr, minerActor).Get(minerActor.Head)
+	require.NoError(t, err)
+	var minerState State
+	require.NoError(t, actor.UnmarshalStorage(chunk, &minerState))
+	return &minerState
+}
+
+// requireTipSetsAt returns a tipset at each of the given heights, which should
+// be in descending order, to sample chain randomness from.
+func requireTipSetsAt(t *testing.T, heights ...uint64) []types.TipSet {
+	var tipSets []types.TipSet
+	for _, h := range heights {
+		blk := types.NewBlockForTest(nil, h)
+		blk.Height = types.Uint64(h)
+		tipSets = append(tipSets, types.RequireNewTipSet(require.New(t), blk))
+	}
+	return tipSets
+}
+
+func requireTotalStorage(ctx context.Context, t *testing.T, st state.Tree, vms vm.StorageMap) *big.Int {
+	res, code, err := consensus.CallQueryMethod(ctx, st, vms, address.StorageMarketAddress, "getTotalStorage", nil, address.TestAddress, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint8(0), code)
+	return big.NewInt(0).SetBytes(res[0])
 }
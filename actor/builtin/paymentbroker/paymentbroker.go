@@ -628,3 +628,45 @@ func findByChannelLookup(ctx context.Context, storage exec.Storage, byPayer exec
 
 	return actor.LoadTypedLookup(ctx, storage, byChannelCID, &PaymentChannel{})
 }
+
+// AllChannels returns the payment channels held in the storage of a payment
+// broker actor, by payer and channel id. It is meant for inspecting the state
+// of the broker from outside the VM.
+func AllChannels(ctx context.Context, storage exec.Storage) (map[string]map[string]*PaymentChannel, error) {
+	channels := make(map[string]map[string]*PaymentChannel)
+	err := actor.WithLookupForReading(ctx, storage, storage.Head(), func(byPayer exec.Lookup) error {
+		payers, err := byPayer.Values(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, payer := range payers {
+			byChannelCID, ok := payer.Value.(cid.Cid)
+			if !ok {
+				return errors.NewFaultError("Paymentbroker payer is not a Cid")
+			}
+			byChannelID, err := actor.LoadTypedLookup(ctx, storage, byChannelCID, &PaymentChannel{})
+			if err != nil {
+				return err
+			}
+			kvs, err := byChannelID.Values(ctx)
+			if err != nil {
+				return err
+			}
+
+			channels[payer.Key] = make(map[string]*PaymentChannel)
+			for _, kv := range kvs {
+				pc, ok := kv.Value.(*PaymentChannel)
+				if !ok {
+					return errors.NewFaultError("Expected PaymentChannel from channel lookup")
+				}
+				channels[payer.Key][kv.Key] = pc
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
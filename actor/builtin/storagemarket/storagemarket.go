@@ -23,7 +23,7 @@ import (
 var MinimumPledge = big.NewInt(10)
 
 // MinimumCollateralPerSector is the minimum amount of collateral required per sector
-var MinimumCollateralPerSector, _ = types.NewAttoFILFromFILString("0.001")
+var MinimumCollateralPerSector = miner.MinimumCollateralPerSector
 
 const (
 	// ErrPledgeTooLow is the error code for a pledge under the MinimumPledge.
@@ -220,5 +220,39 @@ func (sma *Actor) GetTotalStorage(vmctx exec.VMContext) (*big.Int, uint8, error)
 
 // MinimumCollateral returns the minimum required amount of collateral for a given pledge
 func MinimumCollateral(sectors *big.Int) *types.AttoFIL {
-	return MinimumCollateralPerSector.MulBigInt(sectors)
+	return miner.MinimumCollateral(sectors)
+}
+
+// AllMiners returns the addresses of the miners created by the storage market
+// actor whose storage is given. It is meant for inspecting the state of the
+// market from outside the VM.
+func AllMiners(ctx context.Context, storage exec.Storage) ([]address.Address, error) {
+	chunk, err := storage.Get(storage.Head())
+	if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := actor.UnmarshalStorage(chunk, &state); err != nil {
+		return nil, err
+	}
+
+	var miners []address.Address
+	err = actor.WithLookupForReading(ctx, storage, state.Miners, func(lookup exec.Lookup) error {
+		kvs, err := lookup.Values(ctx)
+		if err != nil {
+			return err
+		}
+		for _, kv := range kvs {
+			addr, err := address.NewFromString(kv.Key)
+			if err != nil {
+				return errors.FaultErrorWrapf(err, "invalid miner address %s", kv.Key)
+			}
+			miners = append(miners, addr)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return miners, nil
 }
@@ -21,5 +21,5 @@ type Address interface {
 type Addrs interface {
 	New(ctx context.Context) (address.Address, error)
 	Ls(ctx context.Context) ([]address.Address, error)
-	Lookup(ctx context.Context, addr address.Address) (peer.ID, error)
+	Lookup(ctx context.Context, addr address.Address, at types.SortedCidSet) (peer.ID, error)
 }
@@ -20,6 +20,10 @@ type Daemon interface {
 type DaemonInitConfig struct {
 	// GenesisFile, path to a file containing archive of genesis block DAG data
 	GenesisFile string
+	// ImportChainFile, path to a CAR file containing a chain exported with chain export.
+	ImportChainFile string
+	// TrustImportedChain, if set, skips validating the state transitions of the imported chain.
+	TrustImportedChain bool
 	// RepoDir, path to the repo of the node on disk.
 	RepoDir string
 	// PeerKeyFile is the path to a file containing a libp2p peer id key
@@ -47,6 +51,20 @@ func GenesisFile(p string) DaemonInitOpt {
 	}
 }
 
+// ImportChainFile defines a chain file to initialize the node's chain from.
+func ImportChainFile(p string) DaemonInitOpt {
+	return func(dc *DaemonInitConfig) {
+		dc.ImportChainFile = p
+	}
+}
+
+// TrustImportedChain sets the TrustImportedChain option.
+func TrustImportedChain(doit bool) DaemonInitOpt {
+	return func(dc *DaemonInitConfig) {
+		dc.TrustImportedChain = doit
+	}
+}
+
 // RepoDir defines the location on disk of the repo.
 func RepoDir(p string) DaemonInitOpt {
 	return func(dc *DaemonInitConfig) {
@@ -2,10 +2,9 @@ package impl
 
 import (
 	"context"
-	"reflect"
-	"strings"
 
 	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
@@ -67,7 +66,7 @@ func makeActorView(act *actor.Actor, addr string, actType exec.ExecutableActor)
 	if actType == nil {
 		actorType = "UnknownActor"
 	} else {
-		actorType = getActorType(actType)
+		actorType = builtin.ActorType(actType)
 		exports = presentExports(actType.Exports())
 	}
 
@@ -103,10 +102,3 @@ func presentExports(e exec.Exports) api.ReadableExports {
 	}
 	return rdx
 }
-
-func getActorType(actType exec.ExecutableActor) string {
-	t := reflect.TypeOf(actType).Elem()
-	prefixes := strings.Split(t.PkgPath(), "/")
-
-	return strings.Title(prefixes[len(prefixes)-1]) + t.Name()
-}
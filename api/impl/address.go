@@ -53,8 +53,8 @@ func (api *nodeAddrs) Ls(ctx context.Context) ([]address.Address, error) {
 	return api.api.node.Wallet.Addresses(), nil
 }
 
-func (api *nodeAddrs) Lookup(ctx context.Context, addr address.Address) (peer.ID, error) {
-	id, err := api.api.node.Lookup().GetPeerIDByMinerAddress(ctx, addr)
+func (api *nodeAddrs) Lookup(ctx context.Context, addr address.Address, at types.SortedCidSet) (peer.ID, error) {
+	id, err := api.api.node.Lookup().GetPeerIDByMinerAddressAt(ctx, addr, at)
 	if err != nil {
 		return peer.ID(""), errors.Wrapf(err, "failed to find miner with address %s", addr.String())
 	}
@@ -12,12 +12,15 @@ import (
 	hamt "gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	blockstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	offline "gx/ipfs/QmSz8kAe2JCKp2dWSG8gHSWnwSmne8YfRXTeK5HBmc9L7t/go-ipfs-exchange-offline"
 	crypto "gx/ipfs/QmTW4SdgBWq9GjsBsHeUx8WuGxzhgzAf88UMH2w62PC8yK/go-libp2p-crypto"
 	car "gx/ipfs/QmUGpiTCKct5s1F7jaAnY9KJmoo7Qm1R2uhSjq5iHDSUMn/go-car"
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
 
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/api"
+	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/config"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/fixtures"
@@ -144,7 +147,22 @@ func (nd *nodeDaemon) Init(ctx context.Context, opts ...api.DaemonInitOpt) error
 		}
 	}
 
+	if cfg.GenesisFile != "" && cfg.ImportChainFile != "" {
+		return fmt.Errorf(`cannot use both "--genesisfile" and "--import-chain" options`)
+	}
+
+	var snapshot *chain.Snapshot
 	switch {
+	case cfg.ImportChainFile != "":
+		var genesis *types.Block
+		snapshot, genesis, err = loadChainFile(ctx, rep, cfg.ImportChainFile)
+		if err != nil {
+			return err
+		}
+
+		gif = func(cst *hamt.CborIpldStore, bs blockstore.Blockstore) (*types.Block, error) {
+			return genesis, nil
+		}
 	case cfg.GenesisFile != "":
 		// TODO: this feels a little wonky, I think the InitGenesis interface might need some tweaking
 		genCid, err := LoadGenesis(rep, cfg.GenesisFile)
@@ -164,7 +182,70 @@ func (nd *nodeDaemon) Init(ctx context.Context, opts ...api.DaemonInitOpt) error
 	}
 
 	// TODO: don't create the repo if this fails
-	return node.Init(ctx, rep, gif, initopts...)
+	if err := node.Init(ctx, rep, gif, initopts...); err != nil {
+		return err
+	}
+
+	if snapshot != nil {
+		return importChain(ctx, rep, snapshot, cfg.TrustImportedChain)
+	}
+	return nil
+}
+
+// loadChainFile loads a chain exported with chain export into the repo's
+// blockstore and returns its snapshot and genesis block.
+func loadChainFile(ctx context.Context, rep repo.Repo, fname string) (*chain.Snapshot, *types.Block, error) {
+	file, err := os.Open(fname)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close() // nolint: errcheck
+
+	bs := blockstore.NewBlockstore(rep.Datastore())
+	snapshot, err := chain.LoadSnapshot(bs, file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cst := &hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
+	genesis, err := snapshot.Genesis(ctx, cst)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshot, genesis, nil
+}
+
+// importChain adds the chain of a loaded snapshot to the chain store of an
+// initialized repo, using an offline node to validate it.
+func importChain(ctx context.Context, rep repo.Repo, snapshot *chain.Snapshot, trust bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	opts, err := node.OptionsFromRepo(rep)
+	if err != nil {
+		return err
+	}
+	nd, err := node.New(ctx, append(opts, node.OfflineMode(true))...)
+	if err != nil {
+		return err
+	}
+	if err := nd.ChainReader.Load(ctx); err != nil {
+		return err
+	}
+	defer nd.ChainReader.Stop()
+
+	if err := nd.Syncer.HandleSnapshot(ctx, snapshot, trust); err != nil {
+		return err
+	}
+	if !trust {
+		return nil
+	}
+
+	// A trusted chain is final: pin its head so that the node never
+	// reorgs below it.
+	newConfig := rep.Config()
+	newConfig.Chain.Checkpoint = snapshot.Head
+	return rep.ReplaceConfig(newConfig)
 }
 
 func loadPeerKey(fname string) (crypto.PrivKey, error) {
@@ -64,7 +64,12 @@ func (api *nodeMining) Once(ctx context.Context) (*types.Block, error) {
 		return nil, err
 	}
 
-	minerPubKey, err := nd.PorcelainAPI.MinerGetKey(ctx, minerAddr)
+	// tickets are signed by the worker of the miner
+	minerWorkerAddr, err := nd.PorcelainAPI.MinerGetWorkerAddress(ctx, minerAddr)
+	if err != nil {
+		return nil, err
+	}
+	workerPubKey, err := nd.Wallet.GetPubKeyForAddress(minerWorkerAddr)
 	if err != nil {
 		return nil, err
 	}
@@ -74,7 +79,7 @@ func (api *nodeMining) Once(ctx context.Context) (*types.Block, error) {
 	}
 
 	worker := mining.NewDefaultWorker(nd.MsgPool, getState, getWeight, getAncestors, consensus.NewDefaultProcessor(),
-		nd.PowerTable, nd.Blockstore, nd.CborStore(), minerAddr, minerOwnerAddr, minerPubKey, nd.Wallet, blockTime)
+		nd.PowerTable, nd.Blockstore, nd.CborStore(), minerAddr, minerOwnerAddr, workerPubKey, nd.Wallet, blockTime)
 
 	res, err := mining.MineOnce(ctx, worker, mineDelay, ts)
 	if err != nil {
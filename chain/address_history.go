@@ -0,0 +1,279 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/query"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+var addrHistoryHeadKey = datastore.NewKey("/chain/addrhistory/head")
+
+// AddressHistoryEntry is a message or value transfer in the history of an
+// address.
+type AddressHistoryEntry struct {
+	consensus.HistoryEntry
+	// TipSet is the key of the tipset whose processing produced the entry.
+	TipSet types.SortedCidSet `json:"tipSet"`
+	// Height is the height of that tipset.
+	Height uint64 `json:"height"`
+}
+
+// pendingHistoryDepth is how many blocks below the indexed head the entries
+// of processed tipsets that are not in the chain are kept, in case a reorg
+// brings them into it.
+const pendingHistoryDepth = 100
+
+// AddressHistory indexes by address the history entries that the processor
+// records for the tipsets in the chain ending at the indexed head. As a
+// consensus.HistoryRecorder it receives the entries of every processed
+// tipset, which it holds in memory. Entries are only persisted and added to
+// the index once their tipset becomes part of the chain, and are removed again
+// if it is reorganized out.
+//
+// Tipsets that were processed while the index was not recording, such as
+// those synced before it was enabled or before a restart, have no entries in
+// the index.
+type AddressHistory struct {
+	ds        repo.Datastore
+	getBlocks getBlocksFunc
+	// Serializes updates and queries.
+	mu sync.Mutex
+	// pending holds the entries of processed tipsets that are not in the
+	// indexed chain, by tipset key.
+	pending map[string]*pendingHistory
+}
+
+// pendingHistory is the recorded history of a tipset that is not indexed.
+type pendingHistory struct {
+	height  uint64
+	entries []*consensus.HistoryEntry
+}
+
+var _ consensus.HistoryRecorder = (*AddressHistory)(nil)
+
+// NewAddressHistory returns an AddressHistory persisted in ds that loads
+// blocks with getBlocks.
+func NewAddressHistory(ds repo.Datastore, getBlocks getBlocksFunc) *AddressHistory {
+	return &AddressHistory{ds: ds, getBlocks: getBlocks, pending: make(map[string]*pendingHistory)}
+}
+
+// RecordTipSet holds the history entries produced by processing the tipset
+// with the given key and height until the tipset joins the chain.
+func (ah *AddressHistory) RecordTipSet(ctx context.Context, key types.SortedCidSet, height uint64, entries []*consensus.HistoryEntry) error {
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+
+	ah.pending[key.String()] = &pendingHistory{height: height, entries: entries}
+	return nil
+}
+
+// Update moves the index from its current head to newHead, removing the
+// entries of tipsets that left the chain and adding those of tipsets that
+// joined it.
+func (ah *AddressHistory) Update(ctx context.Context, newHead types.TipSet) error {
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+
+	var oldHead types.TipSet
+	bb, err := ah.ds.Get(addrHistoryHeadKey)
+	if err != nil && err != datastore.ErrNotFound {
+		return errors.Wrap(err, "failed to read address history head")
+	} else if err == nil {
+		var oldKey types.SortedCidSet
+		if err := json.Unmarshal(bb, &oldKey); err != nil {
+			return errors.Wrap(err, "failed to decode address history head")
+		}
+		if oldHead, err = loadTipSet(ctx, ah.getBlocks, oldKey); err != nil {
+			return errors.Wrap(err, "failed to load indexed head")
+		}
+	}
+
+	removed, added, err := divergeTipSets(ctx, ah.getBlocks, oldHead, newHead)
+	if err != nil {
+		return err
+	}
+
+	for _, ts := range removed {
+		if err := ah.unindexTipSet(ts); err != nil {
+			return err
+		}
+	}
+	for i := len(added) - 1; i >= 0; i-- {
+		if err := ah.indexTipSet(added[i]); err != nil {
+			return err
+		}
+	}
+
+	val, err := json.Marshal(newHead.ToSortedCidSet())
+	if err != nil {
+		return err
+	}
+	if err := ah.ds.Put(addrHistoryHeadKey, val); err != nil {
+		return err
+	}
+
+	// Forget the history of tipsets too far below the head to be reorganized
+	// into the chain.
+	height := tipSetHeight(newHead)
+	for key, p := range ah.pending {
+		if p.height+pendingHistoryDepth < height {
+			delete(ah.pending, key)
+		}
+	}
+	return nil
+}
+
+// History returns the entries in the history of addr between fromHeight and
+// toHeight inclusive, oldest first. A toHeight of zero means no upper bound.
+func (ah *AddressHistory) History(ctx context.Context, addr address.Address, fromHeight, toHeight uint64) ([]*AddressHistoryEntry, error) {
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+
+	prefix := addrHistoryAddrPrefix(addr)
+	results, err := ah.ds.Query(query.Query{Prefix: prefix.String()})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query address history")
+	}
+
+	var keys []string
+	byKey := make(map[string]*AddressHistoryEntry)
+	for result := range results.Next() {
+		if result.Error != nil {
+			return nil, errors.Wrap(result.Error, "failed to read address history")
+		}
+		var entry AddressHistoryEntry
+		if err := json.Unmarshal(result.Value, &entry); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode address history entry %s", result.Key)
+		}
+		if entry.Height < fromHeight || (toHeight != 0 && entry.Height > toHeight) {
+			continue
+		}
+		keys = append(keys, result.Key)
+		byKey[result.Key] = &entry
+	}
+
+	// Keys sort by height and then position in the tipset.
+	sort.Strings(keys)
+	out := make([]*AddressHistoryEntry, len(keys))
+	for i, k := range keys {
+		out[i] = byKey[k]
+	}
+	return out, nil
+}
+
+// indexTipSet persists the pending entries of a tipset that joined the chain
+// and adds them to the index of each address they involve.
+func (ah *AddressHistory) indexTipSet(ts types.TipSet) error {
+	key := ts.ToSortedCidSet()
+	p, ok := ah.pending[key.String()]
+	if !ok {
+		// The genesis tipset and tipsets processed while history was not
+		// being recorded have no entries.
+		return nil
+	}
+
+	val, err := json.Marshal(p.entries)
+	if err != nil {
+		return err
+	}
+	if err := ah.ds.Put(addrHistoryTipSetKey(key), val); err != nil {
+		return errors.Wrapf(err, "failed to record history of tipset %s", key.String())
+	}
+	if err := ah.updateAddresses(key, tipSetHeight(ts), p.entries, true); err != nil {
+		return err
+	}
+	delete(ah.pending, key.String())
+	return nil
+}
+
+// unindexTipSet removes the entries of a tipset that left the chain from the
+// index of each address they involve, and holds them as pending again in case
+// the tipset rejoins the chain.
+func (ah *AddressHistory) unindexTipSet(ts types.TipSet) error {
+	key := ts.ToSortedCidSet()
+	bb, err := ah.ds.Get(addrHistoryTipSetKey(key))
+	if err == datastore.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to read history of tipset %s", key.String())
+	}
+	var entries []*consensus.HistoryEntry
+	if err := json.Unmarshal(bb, &entries); err != nil {
+		return errors.Wrapf(err, "failed to decode history of tipset %s", key.String())
+	}
+
+	height := tipSetHeight(ts)
+	if err := ah.updateAddresses(key, height, entries, false); err != nil {
+		return err
+	}
+	if err := ah.ds.Delete(addrHistoryTipSetKey(key)); err != nil {
+		return errors.Wrapf(err, "failed to remove history of tipset %s", key.String())
+	}
+	ah.pending[key.String()] = &pendingHistory{height: height, entries: entries}
+	return nil
+}
+
+// updateAddresses adds the entries of the tipset with the given key and height
+// to the index of each address they involve, or removes them if add is false.
+func (ah *AddressHistory) updateAddresses(key types.SortedCidSet, height uint64, entries []*consensus.HistoryEntry, add bool) error {
+	for i, e := range entries {
+		addrs := []address.Address{e.From}
+		if e.To != e.From {
+			addrs = append(addrs, e.To)
+		}
+
+		val, err := json.Marshal(&AddressHistoryEntry{HistoryEntry: *e, TipSet: key, Height: height})
+		if err != nil {
+			return err
+		}
+		for _, addr := range addrs {
+			k := addrHistoryEntryKey(addr, height, i)
+			if add {
+				err = ah.ds.Put(k, val)
+			} else {
+				err = ah.ds.Delete(k)
+			}
+			if err != nil && err != datastore.ErrNotFound {
+				return errors.Wrapf(err, "failed to update history of address %s", addr)
+			}
+		}
+	}
+	return nil
+}
+
+func addrHistoryTipSetKey(key types.SortedCidSet) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{"chain", "addrhistory", "tipset", joinTipSetKey(key)})
+}
+
+// joinTipSetKey returns the CIDs of a tipset key joined by commas, for use
+// in datastore keys.
+func joinTipSetKey(key types.SortedCidSet) string {
+	var ids []string
+	for it := key.Iter(); !it.Complete(); it.Next() {
+		ids = append(ids, it.Value().String())
+	}
+	return strings.Join(ids, ",")
+}
+
+func addrHistoryAddrPrefix(addr address.Address) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{"chain", "addrhistory", "addr", addr.String()})
+}
+
+// addrHistoryEntryKey returns the key of the entry at position i in the
+// history of the tipset at the given height. Only one tipset per height is
+// ever indexed, and padding makes the keys sort by height and position.
+func addrHistoryEntryKey(addr address.Address, height uint64, i int) datastore.Key {
+	return addrHistoryAddrPrefix(addr).ChildString(fmt.Sprintf("%020d", height)).ChildString(fmt.Sprintf("%06d", i))
+}
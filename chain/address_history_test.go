@@ -0,0 +1,135 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/query"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestAddressHistory(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	newAddress := address.NewForTestGetter()
+	alice, bob, carol := newAddress(), newAddress(), newAddress()
+
+	transfer := func(from, to address.Address, fil int64) *consensus.HistoryEntry {
+		return &consensus.HistoryEntry{
+			Kind:  consensus.HistoryTransfer,
+			From:  from,
+			To:    to,
+			Value: types.NewAttoFILFromFIL(uint64(fil)),
+		}
+	}
+
+	t.Run("indexes recorded entries of tipsets in the chain", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		blocks := fakeIndexBlocks{}
+		ds := repo.NewInMemoryRepo().ChainDatastore()
+		hist := chain.NewAddressHistory(ds, blocks.GetBlocks)
+
+		gen := types.NewBlockForTest(nil, 0)
+		b1 := types.NewBlockForTest(gen, 1)
+		b2 := types.NewBlockForTest(b1, 2)
+		blocks.add(gen, b1, b2)
+
+		ts1, ts2 := types.RequireNewTipSet(require, b1), types.RequireNewTipSet(require, b2)
+		require.NoError(hist.RecordTipSet(ctx, ts1.ToSortedCidSet(), 1, []*consensus.HistoryEntry{transfer(alice, bob, 1)}))
+		require.NoError(hist.RecordTipSet(ctx, ts2.ToSortedCidSet(), 2, []*consensus.HistoryEntry{transfer(bob, carol, 2)}))
+
+		// Nothing is indexed or persisted before the tipsets join the chain.
+		entries, err := hist.History(ctx, bob, 0, 0)
+		require.NoError(err)
+		assert.Empty(entries)
+		results, err := ds.Query(query.Query{Prefix: "/chain/addrhistory", KeysOnly: true})
+		require.NoError(err)
+		persisted, err := results.Rest()
+		require.NoError(err)
+		assert.Empty(persisted)
+
+		require.NoError(hist.Update(ctx, ts2))
+
+		entries, err = hist.History(ctx, bob, 0, 0)
+		require.NoError(err)
+		require.Len(entries, 2)
+		assert.Equal(uint64(1), entries[0].Height)
+		assert.Equal(alice, entries[0].From)
+		assert.True(entries[0].TipSet.Equals(ts1.ToSortedCidSet()))
+		assert.Equal(uint64(2), entries[1].Height)
+		assert.Equal(carol, entries[1].To)
+		assert.True(types.NewAttoFILFromFIL(2).Equal(entries[1].Value))
+
+		entries, err = hist.History(ctx, alice, 0, 0)
+		require.NoError(err)
+		assert.Len(entries, 1)
+
+		entries, err = hist.History(ctx, bob, 2, 0)
+		require.NoError(err)
+		require.Len(entries, 1)
+		assert.Equal(uint64(2), entries[0].Height)
+
+		entries, err = hist.History(ctx, bob, 0, 1)
+		require.NoError(err)
+		require.Len(entries, 1)
+		assert.Equal(uint64(1), entries[0].Height)
+	})
+
+	t.Run("reorgs remove entries of abandoned tipsets", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		blocks := fakeIndexBlocks{}
+		hist := chain.NewAddressHistory(repo.NewInMemoryRepo().ChainDatastore(), blocks.GetBlocks)
+
+		gen := types.NewBlockForTest(nil, 0)
+		b1 := types.NewBlockForTest(gen, 1)
+		fork := types.NewBlockForTest(b1, 2)
+		main1 := types.NewBlockForTest(b1, 3)
+		main2 := types.NewBlockForTest(main1, 4)
+		blocks.add(gen, b1, fork, main1, main2)
+
+		forkTs, mainTs := types.RequireNewTipSet(require, fork), types.RequireNewTipSet(require, main1)
+		require.NoError(hist.RecordTipSet(ctx, forkTs.ToSortedCidSet(), 2, []*consensus.HistoryEntry{transfer(alice, bob, 1)}))
+		require.NoError(hist.RecordTipSet(ctx, mainTs.ToSortedCidSet(), 2, []*consensus.HistoryEntry{transfer(alice, carol, 3)}))
+
+		require.NoError(hist.Update(ctx, forkTs))
+		entries, err := hist.History(ctx, bob, 0, 0)
+		require.NoError(err)
+		assert.Len(entries, 1)
+
+		require.NoError(hist.Update(ctx, types.RequireNewTipSet(require, main2)))
+
+		entries, err = hist.History(ctx, bob, 0, 0)
+		require.NoError(err)
+		assert.Empty(entries)
+
+		entries, err = hist.History(ctx, alice, 0, 0)
+		require.NoError(err)
+		require.Len(entries, 1)
+		assert.Equal(carol, entries[0].To)
+		assert.True(entries[0].TipSet.Equals(mainTs.ToSortedCidSet()))
+
+		// The abandoned tipset's entries come back if it rejoins the chain.
+		require.NoError(hist.Update(ctx, forkTs))
+
+		entries, err = hist.History(ctx, bob, 0, 0)
+		require.NoError(err)
+		require.Len(entries, 1)
+		assert.True(entries[0].TipSet.Equals(forkTs.ToSortedCidSet()))
+
+		entries, err = hist.History(ctx, carol, 0, 0)
+		require.NoError(err)
+		assert.Empty(entries)
+	})
+}
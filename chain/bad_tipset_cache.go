@@ -1,42 +1,240 @@
 package chain
 
 import (
+	"encoding/json"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/query"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/repo"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
+// badTipSetMaxAge is how long a bad tipset is remembered. Older entries are
+// pruned so that the cache does not grow forever.
+var badTipSetMaxAge = 7 * 24 * time.Hour
+
+var badTipSetPrefix = datastore.NewKey("/chain/badtipsets")
+
+// BadTipSet is a tipset the syncer found to be invalid, or that descends from
+// one.
+type BadTipSet struct {
+	// TipSet is the key of the bad tipset.
+	TipSet types.SortedCidSet `json:"tipSet"`
+	// Height is the height of the tipset.
+	Height uint64 `json:"height"`
+	// Cause is the key of the tipset that failed validation. It is TipSet
+	// itself unless the tipset is bad because it descends from Cause.
+	Cause types.SortedCidSet `json:"cause"`
+	// Reason is the validation error.
+	Reason string `json:"reason"`
+	// Time is when the tipset was found to be bad.
+	Time time.Time `json:"time"`
+}
+
 // badTipSetCache keeps track of bad tipsets that the syncer should not try to
 // download. Readers and writers grab a lock. The purpose of this cache is to
 // prevent a node from having to repeatedly invalidate a block (and its children)
-// in the event that the tipset does not conform to the rules of consensus. Note
-// that the cache is only in-memory, so it is reset whenever the node is restarted.
-// TODO: this needs to be limited.
+// in the event that the tipset does not conform to the rules of consensus. The
+// cache is persisted in the chain datastore, so it survives restarts, and
+// entries are pruned after badTipSetMaxAge.
 type badTipSetCache struct {
 	mu  sync.Mutex
-	bad map[string]struct{}
+	bad map[string]*BadTipSet
+	// ds persists the cache. If it is nil the cache is only in memory.
+	ds repo.Datastore
 }
 
-// AddChain adds the chain of tipsets to the badTipSetCache.  For now it just
-// does the simplest thing and adds all blocks of the chain to the cache.
-// TODO: might want to cache a random subset once cache size is limited.
-func (cache *badTipSetCache) AddChain(chain []types.TipSet) {
-	for _, ts := range chain {
-		cache.Add(ts.String())
+// newBadTipSetCache returns a badTipSetCache persisted in ds, loaded with
+// the unexpired entries already stored there.
+func newBadTipSetCache(ds repo.Datastore) *badTipSetCache {
+	cache := &badTipSetCache{
+		bad: make(map[string]*BadTipSet),
+		ds:  ds,
+	}
+	if ds == nil {
+		return cache
 	}
+
+	results, err := ds.Query(query.Query{Prefix: badTipSetPrefix.String()})
+	if err != nil {
+		logSyncer.Warningf("failed to load bad tipsets: %s", err)
+		return cache
+	}
+	for result := range results.Next() {
+		if result.Error != nil {
+			logSyncer.Warningf("failed to load bad tipsets: %s", result.Error)
+			break
+		}
+		var entry BadTipSet
+		if err := json.Unmarshal(result.Value, &entry); err != nil {
+			logSyncer.Warningf("failed to decode bad tipset %s: %s", result.Key, err)
+			continue
+		}
+		cache.bad[entry.TipSet.String()] = &entry
+	}
+	cache.pruneLocked(time.Now())
+	return cache
 }
 
-// Add adds a single tipset key to the badTipSetCache.
-func (cache *badTipSetCache) Add(tsKey string) {
+// Add records the tipset with the given key and height as bad because it
+// failed validation with reason, along with the tipsets in descendants,
+// which are bad because they descend from it.
+func (cache *badTipSetCache) Add(key types.SortedCidSet, height uint64, reason error, descendants []types.TipSet) {
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
-	cache.bad[tsKey] = struct{}{}
+
+	now := time.Now()
+	cache.putLocked(&BadTipSet{
+		TipSet: key,
+		Height: height,
+		Cause:  key,
+		Reason: reason.Error(),
+		Time:   now,
+	})
+	for _, ts := range descendants {
+		cache.putLocked(&BadTipSet{
+			TipSet: ts.ToSortedCidSet(),
+			Height: tipSetHeight(ts),
+			Cause:  key,
+			Reason: fmt.Sprintf("descends from bad tipset %s", key.String()),
+			Time:   now,
+		})
+	}
 }
 
 // Has checks for membership in the badTipSetCache.
 func (cache *badTipSetCache) Has(tsKey string) bool {
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
-	_, ok := cache.bad[tsKey]
+	entry, ok := cache.bad[tsKey]
+	if ok && time.Since(entry.Time) > badTipSetMaxAge {
+		if err := cache.deleteLocked(entry); err != nil {
+			logSyncer.Warningf("failed to prune bad tipset: %s", err)
+		}
+		return false
+	}
 	return ok
 }
+
+// List returns the unexpired entries of the cache, highest first.
+func (cache *badTipSetCache) List() []*BadTipSet {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.pruneLocked(time.Now())
+
+	out := make([]*BadTipSet, 0, len(cache.bad))
+	for _, entry := range cache.bad {
+		e := *entry
+		out = append(out, &e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Height != out[j].Height {
+			return out[i].Height > out[j].Height
+		}
+		return out[i].TipSet.String() < out[j].TipSet.String()
+	})
+	return out
+}
+
+// Remove removes the tipset with the given key from the cache, along with
+// the tipsets that were marked bad because they descend from it. It returns
+// the number of entries removed.
+func (cache *badTipSetCache) Remove(key types.SortedCidSet) (int, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	removed := 0
+	for _, entry := range cache.bad {
+		if !entry.TipSet.Equals(key) && !entry.Cause.Equals(key) {
+			continue
+		}
+		if err := cache.deleteLocked(entry); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Clear removes every entry from the cache and returns the number removed.
+func (cache *badTipSetCache) Clear() (int, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	removed := 0
+	for _, entry := range cache.bad {
+		if err := cache.deleteLocked(entry); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// putLocked adds entry to the cache. Persisting is best effort; the entry
+// stays in memory if it fails.
+func (cache *badTipSetCache) putLocked(entry *BadTipSet) {
+	cache.bad[entry.TipSet.String()] = entry
+	if cache.ds == nil {
+		return
+	}
+	val, err := json.Marshal(entry)
+	if err == nil {
+		err = cache.ds.Put(badTipSetKey(entry.TipSet), val)
+	}
+	if err != nil {
+		logSyncer.Warningf("failed to persist bad tipset %s: %s", entry.TipSet.String(), err)
+	}
+}
+
+func (cache *badTipSetCache) deleteLocked(entry *BadTipSet) error {
+	delete(cache.bad, entry.TipSet.String())
+	if cache.ds == nil {
+		return nil
+	}
+	if err := cache.ds.Delete(badTipSetKey(entry.TipSet)); err != nil && err != datastore.ErrNotFound {
+		return errors.Wrapf(err, "failed to remove bad tipset %s", entry.TipSet.String())
+	}
+	return nil
+}
+
+// pruneLocked removes the entries that are older than badTipSetMaxAge.
+func (cache *badTipSetCache) pruneLocked(now time.Time) {
+	for _, entry := range cache.bad {
+		if now.Sub(entry.Time) <= badTipSetMaxAge {
+			continue
+		}
+		if err := cache.deleteLocked(entry); err != nil {
+			logSyncer.Warningf("failed to prune bad tipset: %s", err)
+		}
+	}
+}
+
+func badTipSetKey(key types.SortedCidSet) datastore.Key {
+	return badTipSetPrefix.ChildString(joinTipSetKey(key))
+}
+
+// BadTipSets returns the tipsets the syncer has found to be bad, highest
+// first.
+func (syncer *DefaultSyncer) BadTipSets() []*BadTipSet {
+	return syncer.badTipSets.List()
+}
+
+// RemoveBadTipSet forgets that the tipset with the given key is bad, along
+// with the tipsets marked bad because they descend from it, so that they are
+// synced again when they are next seen. It returns the number of tipsets
+// forgotten.
+func (syncer *DefaultSyncer) RemoveBadTipSet(key types.SortedCidSet) (int, error) {
+	return syncer.badTipSets.Remove(key)
+}
+
+// ClearBadTipSets forgets all bad tipsets and returns their number.
+func (syncer *DefaultSyncer) ClearBadTipSets() (int, error) {
+	return syncer.badTipSets.Clear()
+}
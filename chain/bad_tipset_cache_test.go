@@ -0,0 +1,68 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestBadTipSetCache(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("bad tipsets survive a restart until removed", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		syncer, _, cst, r := initSyncTestDefault(require)
+
+		_ = requirePutBlocks(require, cst, link1.ToSlice()...)
+		_ = requirePutBlocks(require, cst, link2.ToSlice()...)
+		badCids := []cid.Cid{link1blk1.Cid(), link2blk1.Cid()}
+		badKey := types.NewSortedCidSet(badCids...)
+		require.Error(syncer.HandleNewBlocks(ctx, badCids))
+
+		bad := syncer.BadTipSets()
+		require.Len(bad, 1)
+		assert.True(bad[0].TipSet.Equals(badKey))
+		assert.True(bad[0].Cause.Equals(badKey))
+		assert.Equal(uint64(link1blk1.Height), bad[0].Height)
+		assert.NotEmpty(bad[0].Reason)
+
+		restarted, _ := loadSyncerFromRepo(require, r)
+		require.Len(restarted.BadTipSets(), 1)
+		assert.Equal(chain.ErrChainHasBadTipSet, restarted.HandleNewBlocks(ctx, badCids))
+
+		removed, err := restarted.RemoveBadTipSet(badKey)
+		require.NoError(err)
+		assert.Equal(1, removed)
+		assert.Empty(restarted.BadTipSets())
+
+		restarted, _ = loadSyncerFromRepo(require, r)
+		assert.Empty(restarted.BadTipSets())
+	})
+
+	t.Run("clear forgets all bad tipsets", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		syncer, _, cst, r := initSyncTestDefault(require)
+
+		_ = requirePutBlocks(require, cst, link1.ToSlice()...)
+		_ = requirePutBlocks(require, cst, link2.ToSlice()...)
+		require.Error(syncer.HandleNewBlocks(ctx, []cid.Cid{link1blk1.Cid(), link2blk1.Cid()}))
+		require.Error(syncer.HandleNewBlocks(ctx, []cid.Cid{link1blk2.Cid(), link2blk2.Cid()}))
+		require.Len(syncer.BadTipSets(), 2)
+
+		cleared, err := syncer.ClearBadTipSets()
+		require.NoError(err)
+		assert.Equal(2, cleared)
+		assert.Empty(syncer.BadTipSets())
+
+		restarted, _ := loadSyncerFromRepo(require, r)
+		assert.Empty(restarted.BadTipSets())
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"runtime/debug"
 	"sync"
+	"time"
 
 	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
@@ -26,6 +27,10 @@ var logStore = logging.Logger("chain.store")
 
 var headKey = datastore.NewKey("/chain/heaviestTipSet")
 
+// messageIndexWaitTimeout bounds how long a message lookup waits for the
+// message index to catch up with the head before searching the chain.
+const messageIndexWaitTimeout = time.Second
+
 // DefaultStore is a generic implementation of the Store interface.
 // It works(tm) for now.
 type DefaultStore struct {
@@ -62,6 +67,9 @@ type DefaultStore struct {
 	// Tracks tipsets by height/parentset for use by expected consensus.
 	tipIndex *TipIndex
 
+	// Tracks where the messages in the chain ending at head were included.
+	msgIndex *MessageIndex
+
 	// TODO block cache should go here
 }
 
@@ -72,7 +80,7 @@ var _ Store = (*DefaultStore)(nil)
 func NewDefaultStore(ds repo.Datastore, stateStore *hamt.CborIpldStore, genesisCid cid.Cid) *DefaultStore {
 	bs := bstore.NewBlockstore(ds)
 	priv := hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
-	return &DefaultStore{
+	store := &DefaultStore{
 		privateStore: &priv,
 		stateStore:   stateStore,
 		headEvents:   pubsub.New(128),
@@ -80,6 +88,8 @@ func NewDefaultStore(ds repo.Datastore, stateStore *hamt.CborIpldStore, genesisC
 		tipIndex:     NewTipIndex(),
 		genesis:      genesisCid,
 	}
+	store.msgIndex = NewMessageIndex(ds, store.GetBlocks)
+	return store
 }
 
 // Load rebuilds the DefaultStore's caches by traversing backwards from the
@@ -254,6 +264,12 @@ func (store *DefaultStore) HasTipSetAndStatesWithParentsAndHeight(ctx context.Co
 	return store.tipIndex.HasByParentsAndHeight(pTsKey, h)
 }
 
+// GetTipSetAndStatesFromHeight returns the tipsets and states tracked by the
+// default store's tipIndex whose height is at least h.
+func (store *DefaultStore) GetTipSetAndStatesFromHeight(ctx context.Context, h uint64) ([]*TipSetAndState, error) {
+	return store.tipIndex.GetFromHeight(h)
+}
+
 // GetBlocks retrieves the blocks referenced in the input cid set.
 func (store *DefaultStore) GetBlocks(ctx context.Context, ids types.SortedCidSet) ([]*types.Block, error) {
 	var blks []*types.Block
@@ -317,6 +333,11 @@ func (store *DefaultStore) SetHead(ctx context.Context, ts types.TipSet) error {
 		return err
 	}
 
+	// Indexing may walk far back through the chain, e.g. to genesis the first
+	// time, so it runs in the background. Until it catches up the message index
+	// is stale and lookups search the chain instead.
+	store.msgIndex.UpdateAsync(ts)
+
 	// Publish an event that we have a new head.
 	store.HeadEvents().Pub(ts, NewHeadTopic)
 
@@ -379,13 +400,46 @@ func (store *DefaultStore) LatestState(ctx context.Context) (state.Tree, error)
 	if h == nil {
 		return nil, errors.New("Unset head")
 	}
-	tsas, err := store.GetTipSetAndState(ctx, h.String())
+	return store.StateAt(ctx, h.String())
+}
+
+// StateAt returns the state after the tipset with the given key.
+func (store *DefaultStore) StateAt(ctx context.Context, tsKey string) (state.Tree, error) {
+	tsas, err := store.GetTipSetAndState(ctx, tsKey)
 	if err != nil {
 		return nil, err
 	}
 	return state.LoadStateTree(ctx, store.stateStore, tsas.TipSetStateRoot, builtin.Actors)
 }
 
+// GetMessageLocation returns where the message with the given CID was
+// included in the chain ending at the current head, or nil if it is not in
+// that chain. If the message index is being updated it waits briefly for the
+// update to finish; if the index is still behind the head, the chain is
+// searched instead.
+func (store *DefaultStore) GetMessageLocation(ctx context.Context, msgCid cid.Cid) (*MessageLocation, error) {
+	head := store.Head()
+	if head == nil {
+		return nil, nil
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, messageIndexWaitTimeout)
+	defer cancel()
+	if err := store.msgIndex.Wait(waitCtx); err == nil {
+		indexed, err := store.msgIndex.Head()
+		if err != nil {
+			return nil, err
+		}
+		if indexed.Equals(head.ToSortedCidSet()) {
+			return store.msgIndex.Get(msgCid)
+		}
+	} else if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return FindMessageLocation(ctx, store.GetBlocks, head, msgCid)
+}
+
 // BlockHistory returns a channel of block pointers (or errors), starting with the input tipset
 // followed by each subsequent parent and ending with the genesis block, after which the channel
 // is closed. If an error is encountered while fetching a block, the error is sent, and the channel is closed.
@@ -12,6 +12,7 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/repo"
 	"github.com/filecoin-project/go-filecoin/sampling"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -20,6 +21,15 @@ import (
 // The amount of time the syncer will wait while fetching the blocks of a
 // tipset over the network.
 var blkWaitTime = time.Second // TODO set this parameter in an informed way too
+
+// The number of tipsets the syncer asks its fetcher for at a time. Fetchers
+// may return fewer, e.g. to keep a response within a message size limit.
+var fetchBatchSize uint64 = 200
+
+// The number of distinct chains the syncer collects at once. Further calls to
+// HandleNewBlocks with new heads fail until one of them completes.
+var maxPendingSyncs = 16
+
 var (
 	// ErrChainHasBadTipSet is returned when the syncer traverses a chain with a cached bad tipset.
 	ErrChainHasBadTipSet = errors.New("input chain contains a cached bad tipset")
@@ -27,6 +37,12 @@ var (
 	ErrNewChainTooLong = errors.New("input chain forked from best chain too far in the past")
 	// ErrUnexpectedStoreState indicates that the syncer's chain store is violating expected invariants.
 	ErrUnexpectedStoreState = errors.New("the chain store is in an unexpected state")
+	// ErrUnknownGenesis is returned when a chain does not descend from the genesis block of the syncer's store.
+	ErrUnknownGenesis = errors.New("chain does not descend from the genesis block of the store")
+	// ErrSyncQueueFull is returned when too many new heads are already being synced.
+	ErrSyncQueueFull = errors.New("too many chains are pending sync")
+	// ErrReorgBelowCheckpoint is returned when a chain does not include the syncer's checkpoint.
+	ErrReorgBelowCheckpoint = errors.New("input chain does not include the checkpoint tipset")
 )
 
 var logSyncer = logging.Logger("chain.syncer")
@@ -45,15 +61,25 @@ var logSyncer = logging.Logger("chain.syncer")
 // tipset in the incoming chain, and assumptions regarding the existence of
 // grandparent state in the store.
 type DefaultSyncer struct {
-	// This mutex ensures at most one call to HandleNewBlocks executes at
-	// any time.  This is important because at least two sections of the
-	// code otherwise have races:
+	// This mutex ensures at most one call to HandleNewBlocks validates and
+	// adds tipsets to the store at any time; collecting chains from the
+	// network happens outside of it.  This is important because at least
+	// two sections of the code otherwise have races:
 	// 1. syncOne assumes that chainStore.Head() does not change when
 	// comparing tipset weights and updating the store
 	// 2. HandleNewBlocks assumes that calls to widen and then syncOne
 	// are not run concurrently with other calls to widen to ensure
 	// that the syncer always finds the heaviest existing tipset.
 	mu sync.Mutex
+	// pending holds the heads currently being synced by key, so that
+	// callers asking for a head that is already pending wait for its result
+	// instead of collecting its chain again. It is guarded by pendingMu.
+	pendingMu sync.Mutex
+	pending   map[string]*pendingSync
+	// progress tracks validation, announced heads and errors for Status.
+	// It is guarded by statusMu.
+	statusMu sync.Mutex
+	progress syncProgress
 	// cstOnline is the online storage for fetching blocks.  It should be connected to the network with bitswap.
 	cstOnline *hamt.CborIpldStore
 	// cstOffline is the node's shared offline storage.
@@ -62,23 +88,101 @@ type DefaultSyncer struct {
 	badTipSets *badTipSetCache
 	consensus  consensus.Protocol
 	chainStore Store
+	// fetcher, if set, fetches tipsets that are not available locally in
+	// bulk before falling back to cstOnline.
+	fetcher TipSetFetcher
+	// stateGuard, if set, is held while a tipset's state is computed from
+	// its parent's and stored.
+	stateGuard StateGuard
+	// checkpoint, if set, is a tipset that every new head must descend from
+	// or be an ancestor of. It is guarded by mu.
+	checkpoint types.TipSet
+	// finalityDepth, if not zero, is the largest number of tipsets a reorg
+	// may remove from the chain. It is guarded by mu.
+	finalityDepth uint64
 }
 
 var _ Syncer = (*DefaultSyncer)(nil)
 
-// NewDefaultSyncer constructs a DefaultSyncer ready for use.
-func NewDefaultSyncer(online, offline *hamt.CborIpldStore, c consensus.Protocol, s Store) *DefaultSyncer {
+// NewDefaultSyncer constructs a DefaultSyncer ready for use. The syncer
+// persists the tipsets it finds bad in ds.
+func NewDefaultSyncer(online, offline *hamt.CborIpldStore, c consensus.Protocol, s Store, ds repo.Datastore) *DefaultSyncer {
 	return &DefaultSyncer{
 		cstOnline:  online,
 		cstOffline: offline,
-		badTipSets: &badTipSetCache{
-			bad: make(map[string]struct{}),
-		},
+		badTipSets: newBadTipSetCache(ds),
+		pending:    make(map[string]*pendingSync),
 		consensus:  c,
 		chainStore: s,
 	}
 }
 
+// pendingSync is the sync of a head requested by HandleNewBlocks. done is
+// closed once err holds its result. The sync runs on its own context, which
+// is canceled once none of the calls waiting for it remain.
+type pendingSync struct {
+	done chan struct{}
+	err  error
+	// waiters is the number of calls waiting for the sync. It is guarded by
+	// the syncer's pendingMu.
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// SetTipSetFetcher sets the fetcher used to fetch tipsets missing from local
+// storage in bulk while collecting a chain.
+func (syncer *DefaultSyncer) SetTipSetFetcher(fetcher TipSetFetcher) {
+	syncer.fetcher = fetcher
+}
+
+// SetStateGuard sets the guard held while computing and storing the state of
+// a tipset, which keeps a state pruner from deleting the blocks it shares
+// with its parent state.
+func (syncer *DefaultSyncer) SetStateGuard(guard StateGuard) {
+	syncer.stateGuard = guard
+}
+
+// SetFinalityDepth sets the largest number of tipsets a change of head may
+// remove from the current chain. Heavier chains forking off further back are
+// refused with ErrNewChainTooLong. Zero means no limit.
+func (syncer *DefaultSyncer) SetFinalityDepth(depth uint64) {
+	syncer.mu.Lock()
+	defer syncer.mu.Unlock()
+	syncer.finalityDepth = depth
+}
+
+// SetCheckpoint pins the tipset with the given key, which must be on the
+// current chain, as final. From then on the syncer refuses chains that do not
+// include it, with ErrReorgBelowCheckpoint.
+func (syncer *DefaultSyncer) SetCheckpoint(ctx context.Context, key types.SortedCidSet) error {
+	blks, err := syncer.chainStore.GetBlocks(ctx, key)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load checkpoint %s", key.String())
+	}
+	ts, err := types.NewTipSet(blks...)
+	if err != nil {
+		return err
+	}
+	h, err := ts.Height()
+	if err != nil {
+		return err
+	}
+
+	// The head only changes under the lock, so the checkpoint cannot be
+	// reorged out of the chain between the check and pinning it.
+	syncer.mu.Lock()
+	defer syncer.mu.Unlock()
+	onChain, err := GetTipSetAtHeight(ctx, syncer.chainStore, h)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get tipset at height %d", h)
+	}
+	if !onChain.Equals(ts) {
+		return errors.Errorf("tipset %s is not on the current chain", key.String())
+	}
+	syncer.checkpoint = ts
+	return nil
+}
+
 // getBlksMaybeFromNet resolves cids of blocks.  It gets blocks from local
 // storage if they are available there, and otherwise resolves blocks over
 // the network.  This function will timeout if blocks are unavailable.
@@ -113,10 +217,42 @@ func (syncer *DefaultSyncer) getBlksMaybeFromNet(ctx context.Context, blkCids []
 	return blks, nil
 }
 
+// haveBlksLocally returns true if all blocks with the given cids are in the
+// chain store or the node's local offline storage.
+func (syncer *DefaultSyncer) haveBlksLocally(ctx context.Context, blkCids []cid.Cid) bool {
+	for _, blkCid := range blkCids {
+		if _, err := syncer.chainStore.GetBlock(ctx, blkCid); err == nil {
+			continue
+		}
+		var blk types.Block
+		if err := syncer.cstOffline.Get(ctx, blkCid, &blk); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchAhead fetches the tipset with the given block cids and a batch of its
+// ancestors with the syncer's fetcher and adds them to fetched by key.
+// Failures are only logged; the caller falls back to resolving blocks one
+// tipset at a time.
+func (syncer *DefaultSyncer) fetchAhead(ctx context.Context, blkCids []cid.Cid, fetched map[string]types.TipSet) {
+	tipsets, err := syncer.fetcher.FetchTipSets(ctx, types.NewSortedCidSet(blkCids...), fetchBatchSize)
+	if err != nil {
+		logSyncer.Infof("failed to fetch tipsets in bulk, falling back to bitswap: %s", err)
+		return
+	}
+	for _, ts := range tipsets {
+		fetched[ts.String()] = ts
+	}
+}
+
 // collectChain resolves the cids of the head tipset and its ancestors to blocks
 // until it resolves blocks contained in the Store. collectChain may resolve cids
-// from the Store, the node's local offline cborstore, or the syncer's online
-// cbor store that is networked under the hood. collectChain errors if any
+// from the Store, the node's local offline cborstore, the syncer's fetcher, or
+// the syncer's online cbor store that is networked under the hood. When a
+// tipset is not available locally and the syncer has a fetcher, collectChain
+// fetches it and a batch of its ancestors at once. collectChain errors if any
 // set of cids in the chain resolves to blocks that do not form a tipset, if
 // the chain is too long, or if any tipset has already been recorded as the
 // head of an invalid chain.
@@ -125,6 +261,8 @@ func (syncer *DefaultSyncer) getBlksMaybeFromNet(ctx context.Context, blkCids []
 // It does NOT add tipsets to the store.
 func (syncer *DefaultSyncer) collectChain(ctx context.Context, blkCids []cid.Cid) ([]types.TipSet, types.TipSet, error) {
 	var chain []types.TipSet
+	// fetched holds tipsets fetched in bulk ahead of the traversal.
+	fetched := make(map[string]types.TipSet)
 	defer logSyncer.Info("chain synced")
 	for {
 		var blks []*types.Block
@@ -137,15 +275,27 @@ func (syncer *DefaultSyncer) collectChain(ctx context.Context, blkCids []cid.Cid
 			return nil, nil, ErrChainHasBadTipSet
 		}
 
-		blks, err := syncer.getBlksMaybeFromNet(ctx, blkCids)
-		if err != nil {
-			return nil, nil, err
+		if _, ok := fetched[tsKey]; !ok && syncer.fetcher != nil && !syncer.haveBlksLocally(ctx, blkCids) {
+			syncer.fetchAhead(ctx, blkCids, fetched)
+		}
+		if fetchedTs, ok := fetched[tsKey]; ok {
+			blks = fetchedTs.ToSlice()
+		} else {
+			var err error
+			if blks, err = syncer.getBlksMaybeFromNet(ctx, blkCids); err != nil {
+				return nil, nil, err
+			}
 		}
 
 		ts, err := syncer.consensus.NewValidTipSet(ctx, blks)
 		if err != nil {
-			syncer.badTipSets.Add(tsKey)
-			syncer.badTipSets.AddChain(chain)
+			if consensus.IsValidationError(err) {
+				var height uint64
+				if len(blks) > 0 {
+					height = uint64(blks[0].Height)
+				}
+				syncer.badTipSets.Add(types.NewSortedCidSet(blkCids...), height, err, chain)
+			}
 			return nil, nil, err
 		}
 
@@ -195,6 +345,11 @@ func (syncer *DefaultSyncer) tipSetState(ctx context.Context, tsKey string) (sta
 // Precondition: the caller of syncOne must hold the syncer's lock (syncer.mu) to
 // ensure head is not modified by another goroutine during run.
 func (syncer *DefaultSyncer) syncOne(ctx context.Context, parent, next types.TipSet) error {
+	if syncer.stateGuard != nil {
+		release := syncer.stateGuard.Hold()
+		defer release()
+	}
+
 	// Lookup parent state. It is guaranteed by the syncer that it is in
 	// the store
 	st, err := syncer.tipSetState(ctx, parent.String())
@@ -233,8 +388,14 @@ func (syncer *DefaultSyncer) syncOne(ctx context.Context, parent, next types.Tip
 	logSyncer.Debugf("Successfully updated store with %s", next.String())
 
 	// TipSet is validated and added to store, now check if it is the heaviest.
-	// If it is the heaviest update the chainStore.
-	nextParentSt, err := syncer.tipSetState(ctx, parent.String()) // call again to get a copy
+	return syncer.maybeSetHead(ctx, parent, next)
+}
+
+// maybeSetHead updates the head of the chain store to next if it is heavier
+// than the current head. Precondition: next and its parent must be in the
+// store, and the caller must hold the syncer's lock.
+func (syncer *DefaultSyncer) maybeSetHead(ctx context.Context, parent, next types.TipSet) error {
+	nextParentSt, err := syncer.tipSetState(ctx, parent.String())
 	if err != nil {
 		return err
 	}
@@ -263,6 +424,15 @@ func (syncer *DefaultSyncer) syncOne(ctx context.Context, parent, next types.Tip
 			return err
 		}
 		newChain = append(newChain, next)
+		if err := syncer.checkFinality(ctx, newChain); err != nil {
+			logSyncer.Warningf("refusing to switch head from %s to %s: %s", syncer.chainStore.Head().String(), next.String(), err)
+			syncer.chainStore.HeadEvents().Pub(RefusedReorg{
+				Head:    syncer.chainStore.Head(),
+				NewHead: next,
+				Reason:  err,
+			}, RefusedReorgTopic)
+			return err
+		}
 		if IsReorg(syncer.chainStore.Head(), newChain) {
 			logSyncer.Infof("reorg occurring while switching from %s to %s", syncer.chainStore.Head().String(), next.String())
 		}
@@ -274,6 +444,54 @@ func (syncer *DefaultSyncer) syncOne(ctx context.Context, parent, next types.Tip
 	return nil
 }
 
+// checkFinality returns an error if switching the head to the end of
+// newChain, the chain from genesis to a new head, would replace a part of the
+// chain considered final: one that does not include the checkpoint, or that
+// removes more tipsets than the finality depth allows. The caller must hold
+// the syncer's lock.
+func (syncer *DefaultSyncer) checkFinality(ctx context.Context, newChain []types.TipSet) error {
+	head := syncer.chainStore.Head()
+	newHead := newChain[len(newChain)-1]
+
+	if len(syncer.checkpoint) > 0 {
+		if tipSetHeight(newHead) >= tipSetHeight(syncer.checkpoint) {
+			included := false
+			for _, ts := range newChain {
+				if ts.Equals(syncer.checkpoint) {
+					included = true
+					break
+				}
+			}
+			if !included {
+				return ErrReorgBelowCheckpoint
+			}
+		} else {
+			// The new head must be an ancestor of the checkpoint.
+			ts := syncer.checkpoint
+			for len(ts) > 0 && tipSetHeight(ts) > tipSetHeight(newHead) {
+				var err error
+				if ts, err = parentTipSet(ctx, syncer.chainStore.GetBlocks, ts); err != nil {
+					return err
+				}
+			}
+			if !ts.Equals(newHead) {
+				return ErrReorgBelowCheckpoint
+			}
+		}
+	}
+
+	if syncer.finalityDepth > 0 && IsReorg(head, newChain) {
+		removed, _, err := divergeTipSets(ctx, syncer.chainStore.GetBlocks, head, newHead)
+		if err != nil {
+			return err
+		}
+		if uint64(len(removed)) > syncer.finalityDepth {
+			return ErrNewChainTooLong
+		}
+	}
+	return nil
+}
+
 // widen computes a tipset implied by the input tipset and the store that
 // could potentially be the heaviest tipset. In the context of EC, widen
 // returns the union of the input tipset and the biggest tipset with the same
@@ -324,27 +542,159 @@ func (syncer *DefaultSyncer) widen(ctx context.Context, ts types.TipSet) (types.
 	return wts, nil
 }
 
+// HandleSnapshot extends the Syncer's chain store by the chain of a snapshot
+// whose objects have been loaded into the node's local storage, for instance
+// with LoadSnapshot. Unless trust is set the chain is validated like any
+// other new chain with HandleNewBlocks. Otherwise the state transitions of
+// its tipsets are not run and their states are taken from the snapshot; only
+// the chain's structure is checked and its weight compared to the head's.
+// Either way the chain must descend from the genesis block of the store.
+func (syncer *DefaultSyncer) HandleSnapshot(ctx context.Context, snapshot *Snapshot, trust bool) error {
+	if !trust {
+		return syncer.HandleNewBlocks(ctx, snapshot.Head.ToSlice())
+	}
+
+	syncer.mu.Lock()
+	defer syncer.mu.Unlock()
+	if syncer.chainStore.HasTipSetAndState(ctx, snapshot.Head.String()) {
+		return nil
+	}
+
+	// Walk back from the head to a tipset in the store.
+	var chain []types.TipSet
+	var parent types.TipSet
+	blkCids := snapshot.Head.ToSlice()
+	for {
+		var blks []*types.Block
+		for _, blkCid := range blkCids {
+			var blk types.Block
+			if err := syncer.cstOffline.Get(ctx, blkCid, &blk); err != nil {
+				return errors.Wrapf(err, "failed to load block %s of snapshot", blkCid.String())
+			}
+			blks = append(blks, &blk)
+		}
+		ts, err := syncer.consensus.NewValidTipSet(ctx, blks)
+		if err != nil {
+			return err
+		}
+		if syncer.chainStore.HasTipSetAndState(ctx, ts.String()) {
+			parent = ts
+			break
+		}
+
+		parentCidSet, err := ts.Parents()
+		if err != nil {
+			return err
+		}
+		if parentCidSet.Empty() {
+			return ErrUnknownGenesis
+		}
+		chain = append([]types.TipSet{ts}, chain...)
+		blkCids = parentCidSet.ToSlice()
+	}
+
+	for i, ts := range chain {
+		root, err := snapshot.stateRoot(ts)
+		if err != nil {
+			return err
+		}
+		err = syncer.chainStore.PutTipSetAndState(ctx, &TipSetAndState{
+			TipSet:          ts,
+			TipSetStateRoot: root,
+		})
+		if err != nil {
+			return err
+		}
+		if i < len(chain)-1 {
+			parent = ts
+		}
+	}
+	return syncer.maybeSetHead(ctx, parent, chain[len(chain)-1])
+}
+
 // HandleNewBlocks extends the Syncer's chain store by the given blocks if they
 // represent a valid extension. It limits the length of new chains it will
 // attempt to validate and caches invalid blocks it has encountered to
 // help prevent DOS.
+//
+// Chains are collected from the network concurrently, outside the syncer's
+// lock, and then validated and added to the store one at a time. Calls for a
+// head that is already being synced wait for and return the result of that
+// sync, and at most maxPendingSyncs distinct heads are synced at once. A sync
+// is not tied to the context of the call that started it; it continues while
+// any call waits for it and is canceled when the last one returns.
 func (syncer *DefaultSyncer) HandleNewBlocks(ctx context.Context, blkCids []cid.Cid) error {
-	// ********** WARNING **********
-	//
-	// This concurrency model is flawed.  The mutex is held during a possibly
-	// long call to the network.  TODO: re-evaluate / re-design the concurrency
-	// model to allow for collectChain to be called outside the lock.
-	// FYI the two biggest concurrency concerns at present would be addressed
-	// by locking after collectChain completes, so my hunch is this can be
-	// fixed by simply moving the lock call below collectChain.
-
-	syncer.mu.Lock()
-	defer syncer.mu.Unlock()
 	// If the store already has all these blocks the syncer is finished.
 	if syncer.chainStore.HasAllBlocks(ctx, blkCids) {
 		return nil
 	}
 
+	key := types.NewSortedCidSet(blkCids...).String()
+	syncer.pendingMu.Lock()
+	p, ok := syncer.pending[key]
+	if !ok {
+		if len(syncer.pending) >= maxPendingSyncs {
+			syncer.pendingMu.Unlock()
+			return ErrSyncQueueFull
+		}
+		syncCtx, cancel := context.WithCancel(context.Background())
+		p = &pendingSync{done: make(chan struct{}), cancel: cancel}
+		syncer.pending[key] = p
+		go syncer.runPendingSync(syncCtx, key, p, blkCids)
+	}
+	p.waiters++
+	syncer.pendingMu.Unlock()
+	defer syncer.leavePendingSync(key, p)
+
+	select {
+	case <-p.done:
+		return p.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runPendingSync syncs the head with the given blocks for the calls waiting
+// on p.
+func (syncer *DefaultSyncer) runPendingSync(ctx context.Context, key string, p *pendingSync, blkCids []cid.Cid) {
+	err := syncer.collectAndSync(ctx, blkCids)
+	if err != nil && ctx.Err() == nil {
+		syncer.setLastError(err)
+	}
+	if err != nil && syncer.badTipSets.Has(key) {
+		syncer.dropTarget(key)
+	}
+
+	syncer.pendingMu.Lock()
+	if syncer.pending[key] == p {
+		delete(syncer.pending, key)
+	}
+	syncer.pendingMu.Unlock()
+	p.err = err
+	close(p.done)
+	p.cancel()
+}
+
+// leavePendingSync records that a call stopped waiting for p. When no calls
+// wait for it any longer the sync is canceled and forgotten, so that later
+// calls for the same head start a new one.
+func (syncer *DefaultSyncer) leavePendingSync(key string, p *pendingSync) {
+	syncer.pendingMu.Lock()
+	defer syncer.pendingMu.Unlock()
+
+	p.waiters--
+	if p.waiters > 0 {
+		return
+	}
+	if syncer.pending[key] == p {
+		delete(syncer.pending, key)
+	}
+	p.cancel()
+}
+
+// collectAndSync collects the chain ending in the given blocks and then, under
+// the syncer's lock, adds its tipsets to the store.
+func (syncer *DefaultSyncer) collectAndSync(ctx context.Context, blkCids []cid.Cid) error {
 	// Walk the chain given by the input blocks back to a known tipset in
 	// the store. This is the only code that may go to the network to
 	// resolve cids to blocks.
@@ -353,9 +703,42 @@ func (syncer *DefaultSyncer) HandleNewBlocks(ctx context.Context, blkCids []cid.
 		return err
 	}
 
+	syncer.mu.Lock()
+	defer syncer.mu.Unlock()
+
+	// Other calls may have added a prefix of the chain to the store, or
+	// found part of it bad, while it was being collected.
+	for len(chain) > 0 && syncer.chainStore.HasTipSetAndState(ctx, chain[0].String()) {
+		parent, chain = chain[0], chain[1:]
+	}
+	for _, ts := range chain {
+		if syncer.badTipSets.Has(ts.String()) {
+			return ErrChainHasBadTipSet
+		}
+	}
+
+	// Refuse chains that cross the height of the checkpoint without
+	// including it before validating them. The checkpoint is local policy
+	// rather than consensus, so such chains are not recorded as bad: they
+	// become acceptable if the checkpoint is corrected.
+	if len(syncer.checkpoint) > 0 {
+		cpHeight := tipSetHeight(syncer.checkpoint)
+		prev := parent
+		for _, ts := range chain {
+			if tipSetHeight(prev) < cpHeight && tipSetHeight(ts) >= cpHeight && !ts.Equals(syncer.checkpoint) {
+				return ErrReorgBelowCheckpoint
+			}
+			prev = ts
+		}
+	}
+
+	syncer.setValidating(true, 0, len(chain))
+	defer syncer.setValidating(false, 0, 0)
+
 	// Try adding the tipsets of the chain to the store, checking for new
 	// heaviest tipsets.
 	for i, ts := range chain {
+		syncer.setValidating(true, i, len(chain))
 		// TODO: this "i==0" leaks EC specifics into syncer abstraction
 		// for the sake of efficiency, consider plugging up this leak.
 		if i == 0 {
@@ -372,12 +755,12 @@ func (syncer *DefaultSyncer) HandleNewBlocks(ctx context.Context, blkCids []cid.
 			}
 		}
 		if err = syncer.syncOne(ctx, parent, ts); err != nil {
-			// While `syncOne` can indeed fail for reasons other than consensus,
-			// adding to the badTipSets at this point is the simplest, since we
-			// have access to the chain. If syncOne fails for non-consensus reasons,
-			// there is no assumption that the running node's data is valid at all,
-			// so we don't really lose anything with this simplification.
-			syncer.badTipSets.AddChain(chain[i:])
+			// Only tipsets that consensus finds invalid are known to be
+			// bad. Other failures, like a canceled sync or a storage fault,
+			// say nothing about the chain and may not recur.
+			if ctx.Err() == nil && consensus.IsValidationError(err) {
+				syncer.badTipSets.Add(ts.ToSortedCidSet(), tipSetHeight(ts), err, chain[i+1:])
+			}
 			return err
 		}
 		parent = ts
@@ -2,12 +2,15 @@ package chain_test
 
 import (
 	"context"
+	"sync"
 	"testing"
+	"time"
 
 	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
 	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/address"
@@ -221,7 +224,7 @@ func initSyncTest(require *require.Assertions, con consensus.Protocol, genFunc f
 	chainDS := r.ChainDatastore()
 	chainStore := chain.NewDefaultStore(chainDS, cst, calcGenBlk.Cid())
 
-	syncer := chain.NewDefaultSyncer(cst, cst, con, chainStore) // note we use same cst for on and offline for tests
+	syncer := chain.NewDefaultSyncer(cst, cst, con, chainStore, chainDS) // note we use same cst for on and offline for tests
 
 	// Initialize stores to contain genesis block and state
 	calcGenTS := testhelpers.RequireNewTipSet(require, calcGenBlk)
@@ -430,6 +433,184 @@ func TestSyncChainHead(t *testing.T) {
 	assertHead(assert, chainStore, link4)
 }
 
+// fakeTipSetFetcher serves tipsets from memory and counts its calls. If
+// release is set, calls until it is closed signal started and then block
+// until it is closed or their context is done.
+type fakeTipSetFetcher struct {
+	tipsets map[string]types.TipSet
+	started chan struct{}
+	release chan struct{}
+
+	mu    sync.Mutex
+	calls int
+}
+
+func newFakeTipSetFetcher(tipsets ...types.TipSet) *fakeTipSetFetcher {
+	f := &fakeTipSetFetcher{tipsets: make(map[string]types.TipSet)}
+	for _, ts := range tipsets {
+		f.tipsets[ts.String()] = ts
+	}
+	return f
+}
+
+func (f *fakeTipSetFetcher) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func (f *fakeTipSetFetcher) FetchTipSets(ctx context.Context, start types.SortedCidSet, length uint64) ([]types.TipSet, error) {
+	f.mu.Lock()
+	f.calls++
+	f.mu.Unlock()
+	if f.release != nil {
+		select {
+		case <-f.release:
+		default:
+			f.started <- struct{}{}
+			select {
+			case <-f.release:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	var out []types.TipSet
+	for key := start; uint64(len(out)) < length; {
+		ts, ok := f.tipsets[key.String()]
+		if !ok {
+			break
+		}
+		out = append(out, ts)
+		parents, err := ts.Parents()
+		if err != nil {
+			return nil, err
+		}
+		key = parents
+	}
+	if len(out) == 0 {
+		return nil, errors.New("not found")
+	}
+	return out, nil
+}
+
+// Syncer fetches tipsets missing locally in bulk from its fetcher.
+func TestSyncChainHeadFromFetcher(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	syncer, chainStore, _, _ := initSyncTestDefault(require)
+	ctx := context.Background()
+
+	fetcher := newFakeTipSetFetcher(link1, link2, link3, link4)
+	syncer.SetTipSetFetcher(fetcher)
+
+	err := syncer.HandleNewBlocks(ctx, link4.ToSortedCidSet().ToSlice())
+	assert.NoError(err)
+	assertTsAdded(assert, chainStore, link4)
+	assertTsAdded(assert, chainStore, link3)
+	assertTsAdded(assert, chainStore, link2)
+	assertTsAdded(assert, chainStore, link1)
+	assertHead(assert, chainStore, link4)
+	// The first request fetches the whole chain; the genesis tipset is
+	// available locally.
+	assert.Equal(1, fetcher.callCount())
+}
+
+// Syncer collects a head only once when it is requested again while pending.
+func TestSyncDedupsPendingHeads(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	syncer, chainStore, _, _ := initSyncTestDefault(require)
+	ctx := context.Background()
+
+	fetcher := newFakeTipSetFetcher(link1, link2, link3, link4)
+	fetcher.started = make(chan struct{}, 1)
+	fetcher.release = make(chan struct{})
+	syncer.SetTipSetFetcher(fetcher)
+
+	errs := make(chan error, 2)
+	go func() { errs <- syncer.HandleNewBlocks(ctx, link4.ToSortedCidSet().ToSlice()) }()
+	<-fetcher.started
+	go func() { errs <- syncer.HandleNewBlocks(ctx, link4.ToSortedCidSet().ToSlice()) }()
+	close(fetcher.release)
+
+	assert.NoError(<-errs)
+	assert.NoError(<-errs)
+	assertHead(assert, chainStore, link4)
+	assert.Equal(1, fetcher.callCount())
+}
+
+// Syncer keeps collecting a pending head for other callers when the caller
+// that requested it first gives up.
+func TestSyncPendingHeadOutlivesFirstCaller(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	syncer, chainStore, _, _ := initSyncTestDefault(require)
+
+	fetcher := newFakeTipSetFetcher(link1, link2, link3, link4)
+	fetcher.started = make(chan struct{}, 1)
+	fetcher.release = make(chan struct{})
+	syncer.SetTipSetFetcher(fetcher)
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() { first <- syncer.HandleNewBlocks(firstCtx, link4.ToSortedCidSet().ToSlice()) }()
+	<-fetcher.started
+	second := make(chan error, 1)
+	go func() { second <- syncer.HandleNewBlocks(context.Background(), link4.ToSortedCidSet().ToSlice()) }()
+	// Give the second call time to join the pending sync.
+	time.Sleep(50 * time.Millisecond)
+
+	cancelFirst()
+	assert.Equal(context.Canceled, <-first)
+	close(fetcher.release)
+
+	assert.NoError(<-second)
+	assertHead(assert, chainStore, link4)
+	assert.Equal(1, fetcher.callCount())
+}
+
+// Syncer refuses new heads while too many are pending.
+func TestSyncLimitsPendingHeads(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	syncer, chainStore, _, _ := initSyncTestDefault(require)
+	ctx := context.Background()
+
+	fetcher := newFakeTipSetFetcher(link1)
+	fetcher.started = make(chan struct{})
+	fetcher.release = make(chan struct{})
+	syncer.SetTipSetFetcher(fetcher)
+
+	// Request unknown heads until the syncer refuses one; the others block
+	// in the fetcher.
+	errs := make(chan error)
+	pending := 0
+	for full := false; !full; {
+		require.True(pending < 100, "syncer does not limit pending heads")
+		unknown := types.NewBlockForTest(nil, uint64(1000+pending))
+		go func() { errs <- syncer.HandleNewBlocks(ctx, []cid.Cid{unknown.Cid()}) }()
+		select {
+		case <-fetcher.started:
+			pending++
+		case err := <-errs:
+			assert.Equal(chain.ErrSyncQueueFull, err)
+			full = true
+		}
+	}
+	assert.True(pending > 0)
+
+	close(fetcher.release)
+	for i := 0; i < pending; i++ {
+		assert.Error(<-errs)
+	}
+
+	// Completed syncs leave room for new heads.
+	assert.NoError(syncer.HandleNewBlocks(ctx, link1.ToSortedCidSet().ToSlice()))
+	assertHead(assert, chainStore, link1)
+}
+
 // Syncer determines the heavier fork.
 func TestSyncIgnoreLightFork(t *testing.T) {
 	assert := assert.New(t)
@@ -921,7 +1102,7 @@ func TestTipSetWeightDeep(t *testing.T) {
 	// Now sync the chainStore with consensus using a MarketView.
 	verifier = proofs.NewFakeVerifier(true, nil)
 	con = consensus.NewExpected(cst, bs, testhelpers.NewTestProcessor(), &consensus.MarketView{}, calcGenBlk.Cid(), verifier)
-	syncer := chain.NewDefaultSyncer(cst, cst, con, chainStore)
+	syncer := chain.NewDefaultSyncer(cst, cst, con, chainStore, r.ChainDatastore())
 	baseTS := chainStore.Head() // this is the last block of the bootstrapping chain creating miners
 	require.Equal(1, len(baseTS))
 	bootstrapStateRoot := baseTS.ToSlice()[0].StateRoot
@@ -1047,3 +1228,104 @@ func initGenesis(cst *hamt.CborIpldStore, bs bstore.Blockstore) (*types.Block, e
 		consensus.MinerActor(minerAddress, minerOwnerAddress, []byte{}, 1000, minerPeerID, types.ZeroAttoFIL),
 	)(cst, bs)
 }
+
+// requireMkHeavierFork returns a chain forking off link2blk1 that is heavier
+// than link1 through link4.
+func requireMkHeavierFork(require *require.Assertions) (forklink1, forklink2, forklink3 types.TipSet) {
+	signer, ki := types.NewMockSignersAndKeyInfo(2)
+	fakeChildParams := chain.FakeChildParams{
+		Parent:      testhelpers.RequireNewTipSet(require, link2blk1),
+		GenesisCid:  genCid,
+		StateRoot:   genStateRoot,
+		MinerAddr:   minerAddress,
+		Signer:      signer,
+		MinerPubKey: ki[0].PublicKey(),
+	}
+
+	mkTipSet := func(nonces ...uint64) types.TipSet {
+		var blks []*types.Block
+		for _, nonce := range nonces {
+			fakeChildParams.Nonce = nonce
+			blks = append(blks, chain.RequireMkFakeChild(require, fakeChildParams))
+		}
+		ts := testhelpers.RequireNewTipSet(require, blks...)
+		fakeChildParams.Parent = ts
+		return ts
+	}
+	forklink1 = mkTipSet(1, 2, 3)
+	forklink2 = mkTipSet(0, 1, 2)
+	forklink3 = mkTipSet(0, 1)
+	return forklink1, forklink2, forklink3
+}
+
+func TestCheckpointRefusesFork(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(require *require.Assertions) (*chain.DefaultSyncer, chain.Store, types.TipSet) {
+		syncer, chainStore, cst, _ := initSyncTestDefault(require)
+		forklink1, forklink2, forklink3 := requireMkHeavierFork(require)
+
+		_ = requirePutBlocks(require, cst, link1.ToSlice()...)
+		_ = requirePutBlocks(require, cst, link2.ToSlice()...)
+		_ = requirePutBlocks(require, cst, link3.ToSlice()...)
+		cids4 := requirePutBlocks(require, cst, link4.ToSlice()...)
+		_ = requirePutBlocks(require, cst, forklink1.ToSlice()...)
+		_ = requirePutBlocks(require, cst, forklink2.ToSlice()...)
+		_ = requirePutBlocks(require, cst, forklink3.ToSlice()...)
+
+		require.NoError(syncer.HandleNewBlocks(ctx, cids4))
+		requireHead(require, chainStore, link4)
+		return syncer, chainStore, forklink3
+	}
+
+	t.Run("fork without the checkpoint is refused", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		syncer, chainStore, fork := setup(require)
+		forkHead := fork.ToSortedCidSet().ToSlice()
+
+		require.NoError(syncer.SetCheckpoint(ctx, link3.ToSortedCidSet()))
+		assert.Equal(chain.ErrReorgBelowCheckpoint, syncer.HandleNewBlocks(ctx, forkHead))
+		assertHead(assert, chainStore, link4)
+
+		// The fork is refused by policy, not recorded as bad, so correcting
+		// the checkpoint allows it.
+		assert.Equal(chain.ErrReorgBelowCheckpoint, syncer.HandleNewBlocks(ctx, forkHead))
+		require.NoError(syncer.SetCheckpoint(ctx, link1.ToSortedCidSet()))
+		assert.NoError(syncer.HandleNewBlocks(ctx, forkHead))
+		assertHead(assert, chainStore, fork)
+	})
+
+	t.Run("checkpoint must be on the current chain", func(t *testing.T) {
+		require := require.New(t)
+		syncer, _, fork := setup(require)
+
+		require.Error(syncer.SetCheckpoint(ctx, fork.ToSortedCidSet()))
+	})
+
+	t.Run("checkpoint below the fork allows it", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		syncer, chainStore, fork := setup(require)
+
+		require.NoError(syncer.SetCheckpoint(ctx, link1.ToSortedCidSet()))
+		assert.NoError(syncer.HandleNewBlocks(ctx, fork.ToSortedCidSet().ToSlice()))
+		assertHead(assert, chainStore, fork)
+	})
+
+	t.Run("reorg deeper than the finality depth is refused", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		syncer, chainStore, fork := setup(require)
+		refused := chainStore.HeadEvents().Sub(chain.RefusedReorgTopic)
+		defer chainStore.HeadEvents().Unsub(refused, chain.RefusedReorgTopic)
+
+		syncer.SetFinalityDepth(1)
+		assert.Equal(chain.ErrNewChainTooLong, syncer.HandleNewBlocks(ctx, fork.ToSortedCidSet().ToSlice()))
+		assertHead(assert, chainStore, link4)
+
+		event := (<-refused).(chain.RefusedReorg)
+		assert.True(event.Head.Equals(link4))
+		assert.Equal(chain.ErrNewChainTooLong, event.Reason)
+	})
+}
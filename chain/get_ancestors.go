@@ -143,3 +143,30 @@ func CollectAtMostNTipSets(ctx context.Context, ch <-chan interface{}, n uint) (
 	}
 	return ret, nil
 }
+
+// GetTipSetAtHeight returns the tipset of the heaviest chain with the
+// greatest height at most h. When h falls in a run of null rounds this is the
+// last tipset before them, whose state is the state of the chain at h.
+func GetTipSetAtHeight(ctx context.Context, chainReader ReadStore, h uint64) (types.TipSet, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for raw := range chainReader.BlockHistory(ctx, chainReader.Head()) {
+		switch v := raw.(type) {
+		case error:
+			return nil, v
+		case types.TipSet:
+			height, err := v.Height()
+			if err != nil {
+				return nil, err
+			}
+			if height <= h {
+				return v, nil
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.Errorf("no tipset at height %d", h)
+}
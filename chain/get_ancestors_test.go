@@ -267,3 +267,25 @@ func TestGetRecentAncestorsStartingEpochIsNull(t *testing.T) {
 	require.NoError(err)
 	assert.Equal(uint64(25), lastBlockHeight)
 }
+
+func TestGetTipSetAtHeight(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx, cst, chainStore := setupGetAncestorTests(require)
+	requireGrowChain(ctx, require, cst, chainStore, 5)
+
+	ts, err := chain.GetTipSetAtHeight(ctx, chainStore, 3)
+	require.NoError(err)
+	h, err := ts.Height()
+	require.NoError(err)
+	assert.Equal(uint64(3), h)
+
+	// heights above the head resolve to the head
+	ts, err = chain.GetTipSetAtHeight(ctx, chainStore, 100)
+	require.NoError(err)
+	assert.Equal(chainStore.Head(), ts)
+
+	ts, err = chain.GetTipSetAtHeight(ctx, chainStore, 0)
+	require.NoError(err)
+	assert.Equal(genCid, ts.ToSlice()[0].Cid())
+}
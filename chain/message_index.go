@@ -0,0 +1,400 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+var msgIndexHeadKey = datastore.NewKey("/chain/msgindex/head")
+
+// getBlocksFunc loads the blocks with the given CIDs.
+type getBlocksFunc func(ctx context.Context, ids types.SortedCidSet) ([]*types.Block, error)
+
+// MessageLocation records where a message was included in the chain.
+type MessageLocation struct {
+	// TipSet is the key of the tipset that included the message.
+	TipSet types.SortedCidSet `json:"tipSet"`
+	// Height is the height of that tipset.
+	Height uint64 `json:"height"`
+	// Block is the CID of the block that included the message.
+	Block cid.Cid `json:"block"`
+	// Index is the position of the message in the block's messages.
+	Index int `json:"index"`
+	// Receipt is the receipt of the message. It is only recorded for messages
+	// in single block tipsets; the receipts of messages in larger tipsets
+	// depend on how conflicts between the blocks are resolved and have to be
+	// computed by processing the tipset.
+	Receipt *types.MessageReceipt `json:"receipt"`
+}
+
+// MessageIndex maps the CIDs of the messages in the chain ending at the
+// indexed head to the places they were included. It is kept up to date by the
+// DefaultStore as its head changes and persists in the chain datastore, so it
+// survives restarts.
+type MessageIndex struct {
+	ds        repo.Datastore
+	getBlocks getBlocksFunc
+	// Serializes updates.
+	mu sync.Mutex
+
+	// Coalesces background updates, see UpdateAsync.
+	pendingMu sync.Mutex
+	pending   types.TipSet
+	updating  bool
+	// Closed when the background updates in progress finish.
+	updated chan struct{}
+}
+
+// NewMessageIndex returns a MessageIndex persisted in ds that loads blocks
+// with getBlocks.
+func NewMessageIndex(ds repo.Datastore, getBlocks getBlocksFunc) *MessageIndex {
+	return &MessageIndex{ds: ds, getBlocks: getBlocks}
+}
+
+// Head returns the key of the tipset the index reflects. It is empty if
+// nothing has been indexed.
+func (mi *MessageIndex) Head() (types.SortedCidSet, error) {
+	var head types.SortedCidSet
+	bb, err := mi.ds.Get(msgIndexHeadKey)
+	if err == datastore.ErrNotFound {
+		return head, nil
+	} else if err != nil {
+		return head, errors.Wrap(err, "failed to read message index head")
+	}
+	if err := json.Unmarshal(bb, &head); err != nil {
+		return head, errors.Wrap(err, "failed to decode message index head")
+	}
+	return head, nil
+}
+
+// Get returns the location of the first inclusion of the message with the
+// given CID, or nil if it is not in the indexed chain.
+func (mi *MessageIndex) Get(msgCid cid.Cid) (*MessageLocation, error) {
+	locs, err := mi.getAll(msgCid)
+	if err != nil || len(locs) == 0 {
+		return nil, err
+	}
+	return &locs[0], nil
+}
+
+// getAll returns every location of the message with the given CID in the
+// indexed chain, ordered by height.
+func (mi *MessageIndex) getAll(msgCid cid.Cid) ([]MessageLocation, error) {
+	bb, err := mi.ds.Get(msgIndexKey(msgCid))
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to read location of message %s", msgCid)
+	}
+
+	var locs []MessageLocation
+	if err := json.Unmarshal(bb, &locs); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode location of message %s", msgCid)
+	}
+	return locs, nil
+}
+
+// putAll records the locations of the message with the given CID, removing
+// it from the index if there are none.
+func (mi *MessageIndex) putAll(msgCid cid.Cid, locs []MessageLocation) error {
+	if len(locs) == 0 {
+		if err := mi.ds.Delete(msgIndexKey(msgCid)); err != nil {
+			return errors.Wrapf(err, "failed to remove message %s from index", msgCid)
+		}
+		return nil
+	}
+
+	val, err := json.Marshal(locs)
+	if err != nil {
+		return err
+	}
+	if err := mi.ds.Put(msgIndexKey(msgCid), val); err != nil {
+		return errors.Wrapf(err, "failed to index message %s", msgCid)
+	}
+	return nil
+}
+
+// UpdateAsync moves the index to newHead in the background. Updates requested
+// while one is in progress are coalesced into a single update to the latest
+// requested head. Failures are logged; until an update succeeds the index is
+// stale.
+func (mi *MessageIndex) UpdateAsync(newHead types.TipSet) {
+	mi.pendingMu.Lock()
+	defer mi.pendingMu.Unlock()
+
+	mi.pending = newHead
+	if mi.updating {
+		return
+	}
+	mi.updating = true
+	mi.updated = make(chan struct{})
+	go mi.runUpdates()
+}
+
+// Wait blocks until background updates in progress finish or ctx is done.
+func (mi *MessageIndex) Wait(ctx context.Context) error {
+	mi.pendingMu.Lock()
+	if !mi.updating {
+		mi.pendingMu.Unlock()
+		return nil
+	}
+	updated := mi.updated
+	mi.pendingMu.Unlock()
+
+	select {
+	case <-updated:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (mi *MessageIndex) runUpdates() {
+	for {
+		mi.pendingMu.Lock()
+		ts := mi.pending
+		mi.pending = nil
+		if ts == nil {
+			mi.updating = false
+			close(mi.updated)
+			mi.pendingMu.Unlock()
+			return
+		}
+		mi.pendingMu.Unlock()
+
+		if err := mi.Update(context.Background(), ts); err != nil {
+			logStore.Errorf("failed to index messages of new head %s: %s", ts.String(), err)
+		}
+	}
+}
+
+// Update moves the index from its current head to newHead. Messages in
+// tipsets that are no longer in the chain are removed from the index and
+// messages in tipsets that joined it are added.
+func (mi *MessageIndex) Update(ctx context.Context, newHead types.TipSet) error {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	oldKey, err := mi.Head()
+	if err != nil {
+		return err
+	}
+	var oldHead types.TipSet
+	if !oldKey.Empty() {
+		if oldHead, err = loadTipSet(ctx, mi.getBlocks, oldKey); err != nil {
+			return errors.Wrap(err, "failed to load indexed head")
+		}
+	}
+
+	removed, added, err := divergeTipSets(ctx, mi.getBlocks, oldHead, newHead)
+	if err != nil {
+		return err
+	}
+
+	for _, ts := range removed {
+		if err := mi.unindexTipSet(ts); err != nil {
+			return err
+		}
+	}
+	for i := len(added) - 1; i >= 0; i-- {
+		if err := mi.indexTipSet(added[i]); err != nil {
+			return err
+		}
+	}
+
+	val, err := json.Marshal(newHead.ToSortedCidSet())
+	if err != nil {
+		return err
+	}
+	return mi.ds.Put(msgIndexHeadKey, val)
+}
+
+// divergeTipSets returns the tipsets that are ancestors of (or equal to)
+// oldHead but not newHead, and those that are ancestors of (or equal to)
+// newHead but not oldHead, both ordered from the heads backwards.
+func divergeTipSets(ctx context.Context, getBlocks getBlocksFunc, oldHead, newHead types.TipSet) (removed, added []types.TipSet, err error) {
+	oldTs, newTs := oldHead, newHead
+	for len(oldTs) > 0 || len(newTs) > 0 {
+		if len(oldTs) > 0 && len(newTs) > 0 && oldTs.Equals(newTs) {
+			break
+		}
+
+		oldHeight, newHeight := tipSetHeight(oldTs), tipSetHeight(newTs)
+		if len(newTs) > 0 && (len(oldTs) == 0 || newHeight >= oldHeight) {
+			added = append(added, newTs)
+			if newTs, err = parentTipSet(ctx, getBlocks, newTs); err != nil {
+				return nil, nil, err
+			}
+		}
+		if len(oldTs) > 0 && (len(newTs) == 0 || oldHeight >= newHeight) {
+			removed = append(removed, oldTs)
+			if oldTs, err = parentTipSet(ctx, getBlocks, oldTs); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return removed, added, nil
+}
+
+func (mi *MessageIndex) indexTipSet(ts types.TipSet) error {
+	key := ts.ToSortedCidSet()
+	return forEachMessageLocation(ts, func(c cid.Cid, loc MessageLocation) error {
+		locs, err := mi.getAll(c)
+		if err != nil {
+			return err
+		}
+		if indexOfLocation(locs, key) >= 0 {
+			return nil
+		}
+
+		locs = append(locs, loc)
+		sort.SliceStable(locs, func(i, j int) bool { return locs[i].Height < locs[j].Height })
+		return mi.putAll(c, locs)
+	})
+}
+
+func (mi *MessageIndex) unindexTipSet(ts types.TipSet) error {
+	key := ts.ToSortedCidSet()
+	for _, blk := range ts {
+		for _, msg := range blk.Messages {
+			c, err := msg.Cid()
+			if err != nil {
+				return err
+			}
+			locs, err := mi.getAll(c)
+			if err != nil {
+				return err
+			}
+			i := indexOfLocation(locs, key)
+			if i < 0 {
+				continue
+			}
+			if err := mi.putAll(c, append(locs[:i], locs[i+1:]...)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// indexOfLocation returns the position of the location in the given tipset,
+// or -1 if there is none.
+func indexOfLocation(locs []MessageLocation, key types.SortedCidSet) int {
+	for i, loc := range locs {
+		if loc.TipSet.Equals(key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// parentTipSet returns the parent of ts, or nil if ts is the genesis tipset.
+// forEachMessageLocation calls f with the CID and location of each message in
+// ts. A message may appear in more than one block of the tipset; only its first
+// appearance is reported.
+func forEachMessageLocation(ts types.TipSet, f func(c cid.Cid, loc MessageLocation) error) error {
+	key := ts.ToSortedCidSet()
+	height := tipSetHeight(ts)
+	blks := ts.ToSlice()
+	types.SortBlocks(blks)
+
+	var indexed types.SortedCidSet
+	for _, blk := range blks {
+		// Receipts of single block tipsets are the block's receipts for its
+		// messages without duplicates.
+		var seen types.SortedCidSet
+		for i, msg := range blk.Messages {
+			c, err := msg.Cid()
+			if err != nil {
+				return err
+			}
+			receiptIndex := seen.Len()
+			if !(&seen).Add(c) || !(&indexed).Add(c) {
+				continue
+			}
+
+			loc := MessageLocation{
+				TipSet: key,
+				Height: height,
+				Block:  blk.Cid(),
+				Index:  i,
+			}
+			if len(ts) == 1 && receiptIndex < len(blk.MessageReceipts) {
+				loc.Receipt = blk.MessageReceipts[receiptIndex]
+			}
+			if err := f(c, loc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FindMessageLocation searches the chain ending at head, without the index,
+// for the first inclusion of the message with the given CID. It returns nil if
+// the message is not in that chain.
+func FindMessageLocation(ctx context.Context, getBlocks getBlocksFunc, head types.TipSet, msgCid cid.Cid) (*MessageLocation, error) {
+	// The chain is walked from the head, so the last match is the first
+	// inclusion.
+	var found *MessageLocation
+	ts := head
+	for len(ts) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		err := forEachMessageLocation(ts, func(c cid.Cid, loc MessageLocation) error {
+			if c.Equals(msgCid) {
+				found = &loc
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if ts, err = parentTipSet(ctx, getBlocks, ts); err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
+
+func parentTipSet(ctx context.Context, getBlocks getBlocksFunc, ts types.TipSet) (types.TipSet, error) {
+	ids, err := ts.Parents()
+	if err != nil {
+		return nil, err
+	}
+	if ids.Empty() {
+		return nil, nil
+	}
+	return loadTipSet(ctx, getBlocks, ids)
+}
+
+func loadTipSet(ctx context.Context, getBlocks getBlocksFunc, ids types.SortedCidSet) (types.TipSet, error) {
+	blks, err := getBlocks(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewTipSet(blks...)
+}
+
+// tipSetHeight returns the height of ts, or zero for the empty tipset.
+func tipSetHeight(ts types.TipSet) uint64 {
+	h, err := ts.Height()
+	if err != nil {
+		return 0
+	}
+	return h
+}
+
+func msgIndexKey(c cid.Cid) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{"chain", "msgindex", "msg", c.String()})
+}
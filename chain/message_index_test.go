@@ -0,0 +1,289 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+type fakeIndexBlocks map[cid.Cid]*types.Block
+
+func (f fakeIndexBlocks) add(blks ...*types.Block) {
+	for _, b := range blks {
+		f[b.Cid()] = b
+	}
+}
+
+func (f fakeIndexBlocks) GetBlocks(ctx context.Context, ids types.SortedCidSet) ([]*types.Block, error) {
+	var blks []*types.Block
+	for it := ids.Iter(); !it.Complete(); it.Next() {
+		b, ok := f[it.Value()]
+		if !ok {
+			return nil, errors.Errorf("block %s not found", it.Value())
+		}
+		blks = append(blks, b)
+	}
+	return blks, nil
+}
+
+func newIndexTestChild(parent *types.Block, nonce uint64, msgs ...*types.SignedMessage) *types.Block {
+	blk := types.NewBlockForTest(parent, nonce)
+	blk.Messages = msgs
+	for range msgs {
+		blk.MessageReceipts = append(blk.MessageReceipts, &types.MessageReceipt{ExitCode: uint8(nonce)})
+	}
+	return blk
+}
+
+func requireMsgCid(require *require.Assertions, msg *types.SignedMessage) cid.Cid {
+	c, err := msg.Cid()
+	require.NoError(err)
+	return c
+}
+
+func TestMessageIndex(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mockSigner, _ := types.NewMockSignersAndKeyInfo(1)
+	newMsg := types.NewSignedMessageForTestGetter(mockSigner)
+
+	t.Run("indexes messages as the head advances", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		blocks := fakeIndexBlocks{}
+		idx := chain.NewMessageIndex(repo.NewInMemoryRepo().ChainDatastore(), blocks.GetBlocks)
+
+		m1, m2, m3 := newMsg(), newMsg(), newMsg()
+		gen := types.NewBlockForTest(nil, 0)
+		b1 := newIndexTestChild(gen, 1, m1, m2)
+		b2 := newIndexTestChild(b1, 2, m3)
+		blocks.add(gen, b1, b2)
+
+		require.NoError(idx.Update(ctx, types.RequireNewTipSet(require, b1)))
+		loc, err := idx.Get(requireMsgCid(require, m3))
+		require.NoError(err)
+		assert.Nil(loc)
+
+		ts2 := types.RequireNewTipSet(require, b2)
+		require.NoError(idx.Update(ctx, ts2))
+
+		head, err := idx.Head()
+		require.NoError(err)
+		assert.True(head.Equals(ts2.ToSortedCidSet()))
+
+		loc, err = idx.Get(requireMsgCid(require, m2))
+		require.NoError(err)
+		require.NotNil(loc)
+		assert.Equal(uint64(1), loc.Height)
+		assert.True(loc.Block.Equals(b1.Cid()))
+		assert.Equal(1, loc.Index)
+		require.NotNil(loc.Receipt)
+		assert.Equal(uint8(1), loc.Receipt.ExitCode)
+
+		loc, err = idx.Get(requireMsgCid(require, m3))
+		require.NoError(err)
+		require.NotNil(loc)
+		assert.True(loc.TipSet.Equals(ts2.ToSortedCidSet()))
+		assert.Equal(0, loc.Index)
+	})
+
+	t.Run("reorgs remove messages of abandoned tipsets", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		blocks := fakeIndexBlocks{}
+		idx := chain.NewMessageIndex(repo.NewInMemoryRepo().ChainDatastore(), blocks.GetBlocks)
+
+		m1, m2, m3 := newMsg(), newMsg(), newMsg()
+		gen := types.NewBlockForTest(nil, 0)
+		b1 := newIndexTestChild(gen, 1, m1)
+		fork := newIndexTestChild(b1, 2, m2, m3)
+		main1 := newIndexTestChild(b1, 3, m3)
+		main2 := newIndexTestChild(main1, 4)
+		blocks.add(gen, b1, fork, main1, main2)
+
+		require.NoError(idx.Update(ctx, types.RequireNewTipSet(require, fork)))
+		loc, err := idx.Get(requireMsgCid(require, m2))
+		require.NoError(err)
+		assert.NotNil(loc)
+
+		require.NoError(idx.Update(ctx, types.RequireNewTipSet(require, main2)))
+
+		loc, err = idx.Get(requireMsgCid(require, m2))
+		require.NoError(err)
+		assert.Nil(loc)
+
+		loc, err = idx.Get(requireMsgCid(require, m3))
+		require.NoError(err)
+		require.NotNil(loc)
+		assert.True(loc.Block.Equals(main1.Cid()))
+
+		loc, err = idx.Get(requireMsgCid(require, m1))
+		require.NoError(err)
+		require.NotNil(loc)
+		assert.True(loc.Block.Equals(b1.Cid()))
+	})
+
+	t.Run("keeps messages included in more than one tipset until all are abandoned", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		blocks := fakeIndexBlocks{}
+		idx := chain.NewMessageIndex(repo.NewInMemoryRepo().ChainDatastore(), blocks.GetBlocks)
+
+		m1 := newMsg()
+		gen := types.NewBlockForTest(nil, 0)
+		b1 := newIndexTestChild(gen, 1, m1)
+		b2 := newIndexTestChild(b1, 2, m1)
+		fork2 := newIndexTestChild(b1, 3)
+		fork3 := newIndexTestChild(fork2, 4)
+		other1 := newIndexTestChild(gen, 5)
+		other2 := newIndexTestChild(other1, 6)
+		other3 := newIndexTestChild(other2, 7)
+		other4 := newIndexTestChild(other3, 8)
+		blocks.add(gen, b1, b2, fork2, fork3, other1, other2, other3, other4)
+
+		require.NoError(idx.Update(ctx, types.RequireNewTipSet(require, b2)))
+
+		// Abandoning the second inclusion keeps the first.
+		require.NoError(idx.Update(ctx, types.RequireNewTipSet(require, fork3)))
+		loc, err := idx.Get(requireMsgCid(require, m1))
+		require.NoError(err)
+		require.NotNil(loc)
+		assert.True(loc.Block.Equals(b1.Cid()))
+
+		// Coming back to the chain with both inclusions still reports the first.
+		require.NoError(idx.Update(ctx, types.RequireNewTipSet(require, b2)))
+		loc, err = idx.Get(requireMsgCid(require, m1))
+		require.NoError(err)
+		require.NotNil(loc)
+		assert.True(loc.Block.Equals(b1.Cid()))
+
+		// Abandoning both removes the message.
+		require.NoError(idx.Update(ctx, types.RequireNewTipSet(require, other4)))
+		loc, err = idx.Get(requireMsgCid(require, m1))
+		require.NoError(err)
+		assert.Nil(loc)
+	})
+
+	t.Run("updates in the background", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		blocks := fakeIndexBlocks{}
+		idx := chain.NewMessageIndex(repo.NewInMemoryRepo().ChainDatastore(), blocks.GetBlocks)
+
+		m1 := newMsg()
+		gen := types.NewBlockForTest(nil, 0)
+		b1 := newIndexTestChild(gen, 1, m1)
+		b2 := newIndexTestChild(b1, 2)
+		blocks.add(gen, b1, b2)
+
+		idx.UpdateAsync(types.RequireNewTipSet(require, b1))
+		ts2 := types.RequireNewTipSet(require, b2)
+		idx.UpdateAsync(ts2)
+		require.NoError(idx.Wait(ctx))
+
+		head, err := idx.Head()
+		require.NoError(err)
+		assert.True(head.Equals(ts2.ToSortedCidSet()))
+		loc, err := idx.Get(requireMsgCid(require, m1))
+		require.NoError(err)
+		require.NotNil(loc)
+		assert.True(loc.Block.Equals(b1.Cid()))
+	})
+
+	t.Run("records the first inclusion without receipts for multi-block tipsets", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		blocks := fakeIndexBlocks{}
+		idx := chain.NewMessageIndex(repo.NewInMemoryRepo().ChainDatastore(), blocks.GetBlocks)
+
+		m1, m2 := newMsg(), newMsg()
+		gen := types.NewBlockForTest(nil, 0)
+		b1a := newIndexTestChild(gen, 1, m1)
+		b1b := newIndexTestChild(gen, 2, m2)
+		b2 := newIndexTestChild(b1a, 3, m1)
+		b2.Parents = types.NewSortedCidSet(b1a.Cid(), b1b.Cid())
+		blocks.add(gen, b1a, b1b, b2)
+
+		ts1 := types.RequireNewTipSet(require, b1a, b1b)
+		require.NoError(idx.Update(ctx, types.RequireNewTipSet(require, b2)))
+
+		loc, err := idx.Get(requireMsgCid(require, m1))
+		require.NoError(err)
+		require.NotNil(loc)
+		assert.True(loc.TipSet.Equals(ts1.ToSortedCidSet()))
+		assert.True(loc.Block.Equals(b1a.Cid()))
+		assert.Nil(loc.Receipt)
+	})
+}
+
+func TestDefaultStoreGetMessageLocation(t *testing.T) {
+	ctx := context.Background()
+	initStoreTest(ctx, require.New(t))
+	assert := assert.New(t)
+	require := require.New(t)
+	chainStore := newChainStore()
+	requirePutTestChain(require, chainStore)
+
+	someCid := types.SomeCid()
+
+	// No message is in the chain before the head is set.
+	loc, err := chainStore.GetMessageLocation(ctx, someCid)
+	require.NoError(err)
+	assert.Nil(loc)
+
+	assertSetHead(assert, chainStore, link4)
+	loc, err = chainStore.GetMessageLocation(ctx, someCid)
+	require.NoError(err)
+	assert.Nil(loc)
+}
+
+func TestFindMessageLocation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	assert := assert.New(t)
+	require := require.New(t)
+	mockSigner, _ := types.NewMockSignersAndKeyInfo(1)
+	newMsg := types.NewSignedMessageForTestGetter(mockSigner)
+
+	m1, m2, m3 := newMsg(), newMsg(), newMsg()
+	blocks := fakeIndexBlocks{}
+	gen := types.NewBlockForTest(nil, 0)
+	b1 := newIndexTestChild(gen, 1, m1)
+	b2 := newIndexTestChild(b1, 2, m2, m1)
+	blocks.add(gen, b1, b2)
+	head := types.RequireNewTipSet(require, b2)
+
+	// The first inclusion of a message is found without an index.
+	loc, err := chain.FindMessageLocation(ctx, blocks.GetBlocks, head, requireMsgCid(require, m1))
+	require.NoError(err)
+	require.NotNil(loc)
+	assert.Equal(uint64(1), loc.Height)
+	assert.True(loc.Block.Equals(b1.Cid()))
+	require.NotNil(loc.Receipt)
+	assert.Equal(uint8(1), loc.Receipt.ExitCode)
+
+	loc, err = chain.FindMessageLocation(ctx, blocks.GetBlocks, head, requireMsgCid(require, m2))
+	require.NoError(err)
+	require.NotNil(loc)
+	assert.True(loc.TipSet.Equals(head.ToSortedCidSet()))
+	assert.Equal(0, loc.Index)
+
+	loc, err = chain.FindMessageLocation(ctx, blocks.GetBlocks, head, requireMsgCid(require, m3))
+	require.NoError(err)
+	assert.Nil(loc)
+}
@@ -4,6 +4,16 @@ import (
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
+// RefusedReorg is published on the store's head events under
+// RefusedReorgTopic when the syncer refuses to switch from Head to the
+// heavier NewHead because the switch would replace final tipsets: those at or
+// below the checkpoint, or deeper than the finality depth.
+type RefusedReorg struct {
+	Head    types.TipSet
+	NewHead types.TipSet
+	Reason  error
+}
+
 // IsReorg determines if choosing the end of the newChain as the new head
 // would cause a "reorg" given the current head is at curHead.
 // A reorg occurs when curHead is not a member of newChain AND curHead is not
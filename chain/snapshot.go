@@ -0,0 +1,189 @@
+package chain
+
+import (
+	"context"
+	"io"
+
+	dag "gx/ipfs/QmNRAuGmvnVw8urHkUZQirhu42VTiZjVWASa2aTznEMmpP/go-merkledag"
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmSz8kAe2JCKp2dWSG8gHSWnwSmne8YfRXTeK5HBmc9L7t/go-ipfs-exchange-offline"
+	car "gx/ipfs/QmUGpiTCKct5s1F7jaAnY9KJmoo7Qm1R2uhSjq5iHDSUMn/go-car"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func init() {
+	cbor.RegisterCborType(Snapshot{})
+	cbor.RegisterCborType(SnapshotState{})
+}
+
+// Snapshot is the root object of a CAR file holding an exported chain. Every
+// tipset of the chain from its head back to genesis is reachable through its
+// head, and every state tree of the chain through its blocks' state roots or
+// States.
+type Snapshot struct {
+	// Head is the key of the tipset at the head of the exported chain.
+	Head types.SortedCidSet `json:"head"`
+	// States holds the state roots of the head and of the tipsets with more
+	// than one block. The state of any other tipset is the state root of its
+	// only block.
+	States []SnapshotState `json:"states"`
+}
+
+// SnapshotState is the root of the state resulting from applying a tipset.
+type SnapshotState struct {
+	TipSet    types.SortedCidSet `json:"tipSet"`
+	StateRoot cid.Cid            `json:"stateRoot"`
+}
+
+// stateRoot returns the root of the state of ts recorded in the snapshot.
+func (s *Snapshot) stateRoot(ts types.TipSet) (cid.Cid, error) {
+	key := ts.ToSortedCidSet()
+	for _, st := range s.States {
+		if st.TipSet.Equals(key) {
+			return st.StateRoot, nil
+		}
+	}
+	if len(ts) != 1 || key.Equals(s.Head) {
+		return cid.Undef, errors.Errorf("snapshot does not record the state of tipset %s", ts.String())
+	}
+	return ts.ToSlice()[0].StateRoot, nil
+}
+
+// Genesis returns the genesis block of the snapshot's chain, loading blocks
+// from cst.
+func (s *Snapshot) Genesis(ctx context.Context, cst *hamt.CborIpldStore) (*types.Block, error) {
+	next := s.Head.ToSlice()[0]
+	for {
+		var blk types.Block
+		if err := cst.Get(ctx, next, &blk); err != nil {
+			return nil, errors.Wrapf(err, "failed to load block %s of snapshot", next.String())
+		}
+		if blk.Parents.Empty() {
+			return &blk, nil
+		}
+		next = blk.Parents.ToSlice()[0]
+	}
+}
+
+// Export writes the chain of store ending at head to out as a CAR file whose
+// only root is a Snapshot. The file holds the blocks of every tipset back to
+// genesis, which embed their messages and receipts, and every state tree of
+// the chain along with the actor storage it references, which are read from
+// bs.
+func Export(ctx context.Context, store ReadStore, bs bstore.Blockstore, head types.TipSet, out io.Writer) error {
+	snapshot := Snapshot{Head: head.ToSortedCidSet()}
+	for ts := head; ; {
+		if len(ts) > 1 || ts.Equals(head) {
+			tsas, err := store.GetTipSetAndState(ctx, ts.String())
+			if err != nil {
+				return errors.Wrapf(err, "failed to get state of tipset %s", ts.String())
+			}
+			snapshot.States = append(snapshot.States, SnapshotState{
+				TipSet:    ts.ToSortedCidSet(),
+				StateRoot: tsas.TipSetStateRoot,
+			})
+		}
+
+		parents, err := ts.Parents()
+		if err != nil {
+			return err
+		}
+		if parents.Empty() {
+			break
+		}
+		var blks []*types.Block
+		for it := parents.Iter(); !it.Complete(); it.Next() {
+			blk, err := store.GetBlock(ctx, it.Value())
+			if err != nil {
+				return err
+			}
+			blks = append(blks, blk)
+		}
+		if ts, err = types.NewTipSet(blks...); err != nil {
+			return err
+		}
+	}
+
+	root, err := cbor.WrapObject(snapshot, types.DefaultHashFunction, -1)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode snapshot")
+	}
+
+	ebs := &exportBlockstore{
+		Blockstore: bs,
+		ctx:        ctx,
+		chain:      store,
+		extra:      map[cid.Cid]blocks.Block{root.Cid(): root},
+	}
+	for _, obj := range []blocks.Block{
+		types.AccountActorCodeObj,
+		types.StorageMarketActorCodeObj,
+		types.PaymentBrokerActorCodeObj,
+		types.MinerActorCodeObj,
+		types.BootstrapMinerActorCodeObj,
+	} {
+		ebs.extra[obj.Cid()] = obj
+	}
+	dserv := dag.NewDAGService(bserv.New(ebs, offline.Exchange(ebs)))
+
+	return car.WriteCar(ctx, dserv, []cid.Cid{root.Cid()}, out)
+}
+
+// exportBlockstore reads the objects of an exported chain. States and actor
+// storage come from the embedded blockstore and blocks from the chain store.
+// Objects that are referenced by the chain but not necessarily stored, like
+// the snapshot itself and the code of builtin actors, are kept in extra.
+type exportBlockstore struct {
+	bstore.Blockstore
+	ctx   context.Context
+	chain ReadStore
+	extra map[cid.Cid]blocks.Block
+}
+
+// Get returns the object with the given CID.
+func (ebs *exportBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	if blk, ok := ebs.extra[c]; ok {
+		return blk, nil
+	}
+	if blk, err := ebs.Blockstore.Get(c); err == nil {
+		return blk, nil
+	}
+	blk, err := ebs.chain.GetBlock(ebs.ctx, c)
+	if err != nil {
+		return nil, bstore.ErrNotFound
+	}
+	return blk.ToNode(), nil
+}
+
+// LoadSnapshot reads a CAR file written by Export into bs and returns its
+// Snapshot. It does not add anything to the chain store; see
+// DefaultSyncer.HandleSnapshot.
+func LoadSnapshot(bs bstore.Blockstore, in io.Reader) (*Snapshot, error) {
+	header, err := car.LoadCar(bs, in)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load chain car")
+	}
+	if len(header.Roots) != 1 {
+		return nil, errors.New("expected chain car with only a single root")
+	}
+
+	raw, err := bs.Get(header.Roots[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read snapshot")
+	}
+	var snapshot Snapshot
+	if err := cbor.DecodeInto(raw.RawData(), &snapshot); err != nil {
+		return nil, errors.Wrap(err, "failed to decode snapshot")
+	}
+	if snapshot.Head.Empty() {
+		return nil, errors.New("snapshot has an empty head")
+	}
+	return &snapshot, nil
+}
@@ -0,0 +1,113 @@
+package chain_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmSz8kAe2JCKp2dWSG8gHSWnwSmne8YfRXTeK5HBmc9L7t/go-ipfs-exchange-offline"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// initSnapshotTest creates a syncer and chain store whose state store shares
+// the blockstore holding actor storage, as in a node, so that the states they
+// export are complete. It sets the test chain if setChain is true.
+func initSnapshotTest(require *require.Assertions, setChain bool) (*chain.DefaultSyncer, chain.Store, bstore.Blockstore, *hamt.CborIpldStore) {
+	r := repo.NewInMemoryRepo()
+	bs := bstore.NewBlockstore(r.Datastore())
+	cst := &hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
+	verifier := proofs.NewFakeVerifier(true, nil)
+	con := consensus.NewExpected(cst, bs, testhelpers.NewTestProcessor(), &testhelpers.TestView{}, genCid, verifier)
+	if setChain {
+		requireSetTestChain(require, con, false)
+	}
+	syncer, chainStore, cst, _ := initSyncTest(require, con, initGenesis, cst, bs, r)
+	return syncer, chainStore, bs, cst
+}
+
+// requireExportTestChain syncs the test chain and exports it. It returns the
+// exported CAR and the store it was exported from.
+func requireExportTestChain(require *require.Assertions) (*bytes.Buffer, chain.Store) {
+	ctx := context.Background()
+	syncer, chainStore, bs, cst := initSnapshotTest(require, true)
+
+	_ = requirePutBlocks(require, cst, link1.ToSlice()...)
+	_ = requirePutBlocks(require, cst, link2.ToSlice()...)
+	_ = requirePutBlocks(require, cst, link3.ToSlice()...)
+	cids4 := requirePutBlocks(require, cst, link4.ToSlice()...)
+	require.NoError(syncer.HandleNewBlocks(ctx, cids4))
+	requireHead(require, chainStore, link4)
+
+	var buf bytes.Buffer
+	require.NoError(chain.Export(ctx, chainStore, bs, link4, &buf))
+	return &buf, chainStore
+}
+
+func TestSnapshotExportImport(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("import validates the exported chain", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		car, _ := requireExportTestChain(require)
+
+		syncer, chainStore, bs, _ := initSnapshotTest(require, false)
+		snapshot, err := chain.LoadSnapshot(bs, car)
+		require.NoError(err)
+		assert.True(snapshot.Head.Equals(link4.ToSortedCidSet()))
+
+		require.NoError(syncer.HandleSnapshot(ctx, snapshot, false))
+		assertTsAdded(assert, chainStore, link1)
+		assertTsAdded(assert, chainStore, link2)
+		assertTsAdded(assert, chainStore, link3)
+		assertTsAdded(assert, chainStore, link4)
+		assertHead(assert, chainStore, link4)
+	})
+
+	t.Run("trusted import takes states from the snapshot", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		car, exported := requireExportTestChain(require)
+
+		syncer, chainStore, bs, cst := initSnapshotTest(require, false)
+		snapshot, err := chain.LoadSnapshot(bs, car)
+		require.NoError(err)
+
+		genesis, err := snapshot.Genesis(ctx, cst)
+		require.NoError(err)
+		assert.Equal(genCid, genesis.Cid())
+
+		require.NoError(syncer.HandleSnapshot(ctx, snapshot, true))
+		assertTsAdded(assert, chainStore, link1)
+		assertTsAdded(assert, chainStore, link2)
+		assertTsAdded(assert, chainStore, link3)
+		assertTsAdded(assert, chainStore, link4)
+		assertHead(assert, chainStore, link4)
+
+		for _, ts := range []types.TipSet{link1, link2, link3, link4} {
+			want, err := exported.GetTipSetAndState(ctx, ts.String())
+			require.NoError(err)
+			got, err := chainStore.GetTipSetAndState(ctx, ts.String())
+			require.NoError(err)
+			assert.True(want.TipSetStateRoot.Equals(got.TipSetStateRoot))
+		}
+	})
+
+	t.Run("load rejects a car without a snapshot root", func(t *testing.T) {
+		require := require.New(t)
+
+		_, err := chain.LoadSnapshot(bstore.NewBlockstore(repo.NewInMemoryRepo().Datastore()), bytes.NewReader([]byte("not a car")))
+		require.Error(err)
+	})
+}
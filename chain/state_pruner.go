@@ -0,0 +1,330 @@
+package chain
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+var logPruner = logging.Logger("chain.pruner")
+
+// StateGuard is held by code that derives a state from another, from
+// loading the parent state until the new state is stored, so that a
+// StatePruner does not delete the blocks the new state shares with its
+// parent.
+type StateGuard interface {
+	// Hold holds the guard until the returned function is called.
+	Hold() (release func())
+}
+
+// GuardedBlockstore is a blockstore that a StatePruner can sweep while the
+// node keeps using it. While a prune is running it records every block that
+// is read or written, and the pruner does not delete those: they may have
+// become reachable again after the pruner marked the live blocks.
+//
+// A state loaded before a prune started may be flushed during it without
+// reading or writing the blocks it shares with its parent, so prunes do not
+// start while the blockstore is held as a StateGuard.
+type GuardedBlockstore struct {
+	bstore.Blockstore
+
+	// transitions is held for reading by holders of the guard and for
+	// writing while a prune starts.
+	transitions sync.RWMutex
+
+	mu sync.Mutex
+	// used holds the blocks read or written during a prune. It is nil
+	// when no prune is running.
+	used *cid.Set
+}
+
+var _ StateGuard = (*GuardedBlockstore)(nil)
+
+// NewGuardedBlockstore wraps bs in a GuardedBlockstore.
+func NewGuardedBlockstore(bs bstore.Blockstore) *GuardedBlockstore {
+	return &GuardedBlockstore{Blockstore: bs}
+}
+
+// Has implements Blockstore.
+func (bs *GuardedBlockstore) Has(c cid.Cid) (bool, error) {
+	bs.use(c)
+	return bs.Blockstore.Has(c)
+}
+
+// Get implements Blockstore.
+func (bs *GuardedBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	bs.use(c)
+	return bs.Blockstore.Get(c)
+}
+
+// GetSize implements Blockstore.
+func (bs *GuardedBlockstore) GetSize(c cid.Cid) (int, error) {
+	bs.use(c)
+	return bs.Blockstore.GetSize(c)
+}
+
+// Put implements Blockstore.
+func (bs *GuardedBlockstore) Put(blk blocks.Block) error {
+	bs.use(blk.Cid())
+	return bs.Blockstore.Put(blk)
+}
+
+// PutMany implements Blockstore.
+func (bs *GuardedBlockstore) PutMany(blks []blocks.Block) error {
+	for _, blk := range blks {
+		bs.use(blk.Cid())
+	}
+	return bs.Blockstore.PutMany(blks)
+}
+
+// Hold implements StateGuard. A prune waits for holders to release the guard
+// before it starts recording used blocks.
+func (bs *GuardedBlockstore) Hold() func() {
+	bs.transitions.RLock()
+	return bs.transitions.RUnlock
+}
+
+func (bs *GuardedBlockstore) use(c cid.Cid) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if bs.used != nil {
+		bs.used.Add(c)
+	}
+}
+
+func (bs *GuardedBlockstore) startGuard() {
+	bs.transitions.Lock()
+	defer bs.transitions.Unlock()
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	bs.used = cid.NewSet()
+}
+
+func (bs *GuardedBlockstore) stopGuard() {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	bs.used = nil
+}
+
+// deleteUnlessUsed deletes the block with the given cid unless it was used
+// since the guard started. The lock is held while deleting so that a block
+// is either recorded as used before the check, or used after it is gone.
+func (bs *GuardedBlockstore) deleteUnlessUsed(c cid.Cid) (bool, error) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if bs.used != nil && bs.used.Has(c) {
+		return false, nil
+	}
+	if err := bs.Blockstore.DeleteBlock(c); err != nil && err != bstore.ErrNotFound {
+		return false, err
+	}
+	return true, nil
+}
+
+// PruneResult reports the outcome of a prune.
+type PruneResult struct {
+	// RetainedTipSets is the number of tipsets whose state was kept.
+	RetainedTipSets int `json:"retainedTipSets"`
+	// Kept is the number of state blocks that were kept and Removed the
+	// number that were deleted.
+	Kept    int `json:"kept"`
+	Removed int `json:"removed"`
+}
+
+// StatePruner deletes state that is no longer needed from a node's
+// blockstore. It keeps the state of every tipset in the store near the head,
+// whether or not it is in the chain, of the genesis tipset and of the
+// checkpoint, along with every node reachable from these state roots,
+// including the storage of the actors they hold. The blocks of every tipset
+// in the store are kept, including those of forks below the retained
+// heights. Only dag-cbor blocks, which hold chain and state data, are
+// candidates for deletion: other data such as imported client files is left
+// alone.
+type StatePruner struct {
+	// mu makes sure a single prune runs at a time.
+	mu         sync.Mutex
+	bs         *GuardedBlockstore
+	chainStore Store
+	// checkpoint returns the key of the checkpoint tipset, which may be
+	// empty.
+	checkpoint func() types.SortedCidSet
+}
+
+// NewStatePruner returns a StatePruner sweeping bs, which must be the
+// blockstore holding the states of the tipsets in chainStore.
+func NewStatePruner(bs *GuardedBlockstore, chainStore Store, checkpoint func() types.SortedCidSet) *StatePruner {
+	return &StatePruner{
+		bs:         bs,
+		chainStore: chainStore,
+		checkpoint: checkpoint,
+	}
+}
+
+// Prune deletes the state blocks that are not reachable from the states of
+// the tipsets in the store at most keep below the height of the head, the
+// genesis tipset or the checkpoint. The state of the head is always kept.
+// It is safe to call while the node is running.
+func (p *StatePruner) Prune(ctx context.Context, keep uint64) (*PruneResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Blocks used from here on are kept, so the candidates must be listed
+	// after the guard starts: the blocks of states produced while pruning
+	// are either used or not candidates.
+	p.bs.startGuard()
+	defer p.bs.stopGuard()
+
+	keys, err := p.bs.Blockstore.AllKeysChan(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list blocks")
+	}
+	var candidates []cid.Cid
+	for c := range keys {
+		if c.Prefix().Codec == cid.DagCBOR {
+			candidates = append(candidates, c)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	marked := cid.NewSet()
+	retained, err := p.markLive(ctx, keep, marked)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PruneResult{RetainedTipSets: retained}
+	for _, c := range candidates {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if marked.Has(c) {
+			result.Kept++
+			continue
+		}
+		deleted, err := p.bs.deleteUnlessUsed(c)
+		if err != nil {
+			return result, errors.Wrapf(err, "failed to delete block %s", c.String())
+		}
+		if deleted {
+			result.Removed++
+		} else {
+			result.Kept++
+		}
+	}
+	logPruner.Infof("pruned %d state blocks, kept %d for %d tipsets", result.Removed, result.Kept, retained)
+	return result, nil
+}
+
+// Run prunes every period, keeping the state of the last keep tipsets, until
+// ctx is done.
+func (p *StatePruner) Run(ctx context.Context, period time.Duration, keep uint64) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := p.Prune(ctx, keep); err != nil && ctx.Err() == nil {
+				logPruner.Errorf("failed to prune state: %s", err)
+			}
+		}
+	}
+}
+
+// markLive adds to marked the blocks of the tipsets in the store and the
+// blocks reachable from the states to retain, and returns the number of
+// tipsets whose state is retained.
+func (p *StatePruner) markLive(ctx context.Context, keep uint64, marked *cid.Set) (int, error) {
+	var checkpoint types.SortedCidSet
+	if p.checkpoint != nil {
+		checkpoint = p.checkpoint()
+	}
+
+	retained := 0
+	retain := func(tsas *TipSetAndState) error {
+		roots := []cid.Cid{tsas.TipSetStateRoot}
+		for _, blk := range tsas.TipSet.ToSlice() {
+			roots = append(roots, blk.StateRoot)
+		}
+		for _, root := range roots {
+			if err := p.markFrom(root, marked); err != nil {
+				return err
+			}
+		}
+		retained++
+		return nil
+	}
+
+	// Forks near the head may still become the chain, so the states of all
+	// tipsets there are kept for them to be extended. The blocks of older
+	// tipsets are kept too, since the store still refers to them.
+	minHeight := uint64(0)
+	if h := tipSetHeight(p.chainStore.Head()); h > keep {
+		minHeight = h - keep
+	}
+	all, err := p.chainStore.GetTipSetAndStatesFromHeight(ctx, 0)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list tipsets")
+	}
+	for _, tsas := range all {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		for _, blk := range tsas.TipSet.ToSlice() {
+			marked.Add(blk.Cid())
+		}
+
+		parents, err := tsas.TipSet.Parents()
+		if err != nil {
+			return 0, err
+		}
+		if tipSetHeight(tsas.TipSet) >= minHeight || parents.Empty() || tsas.TipSet.ToSortedCidSet().Equals(checkpoint) {
+			if err := retain(tsas); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return retained, nil
+}
+
+// markFrom adds to marked the blocks reachable from root. Blocks that are
+// not in the blockstore are skipped, along with everything below them.
+func (p *StatePruner) markFrom(root cid.Cid, marked *cid.Set) error {
+	stack := []cid.Cid{root}
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !c.Defined() || !marked.Visit(c) || c.Prefix().Codec != cid.DagCBOR {
+			continue
+		}
+
+		blk, err := p.bs.Blockstore.Get(c)
+		if err == bstore.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to get block %s", c.String())
+		}
+		nd, err := cbor.DecodeBlock(blk)
+		if err != nil {
+			return errors.Wrapf(err, "failed to decode block %s", c.String())
+		}
+		for _, link := range nd.Links() {
+			stack = append(stack, link.Cid)
+		}
+	}
+	return nil
+}
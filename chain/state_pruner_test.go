@@ -0,0 +1,210 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// prunerTestChain is a chain of four single block tipsets whose states are
+// stored in bs. The state after tipset i is states[i] and links to the
+// storage of an actor, storages[i], and to a node shared by all states.
+type prunerTestChain struct {
+	bs       *chain.GuardedBlockstore
+	store    chain.Store
+	tipsets  []types.TipSet
+	states   []cid.Cid
+	storages []cid.Cid
+	shared   cid.Cid
+}
+
+func requirePutNode(require *require.Assertions, bs bstore.Blockstore, obj interface{}) cid.Cid {
+	nd, err := cbor.WrapObject(obj, types.DefaultHashFunction, -1)
+	require.NoError(err)
+	require.NoError(bs.Put(nd))
+	return nd.Cid()
+}
+
+func newPrunerTestChain(ctx context.Context, require *require.Assertions) *prunerTestChain {
+	bs := chain.NewGuardedBlockstore(bstore.NewBlockstore(datastore.NewMapDatastore()))
+	c := &prunerTestChain{bs: bs}
+	c.shared = requirePutNode(require, bs, map[string]interface{}{"shared": true})
+
+	var parent *types.Block
+	for i := 0; i < 4; i++ {
+		storage := requirePutNode(require, bs, map[string]interface{}{"value": i})
+		state := requirePutNode(require, bs, map[string]interface{}{
+			"height":  i,
+			"storage": storage,
+			"shared":  c.shared,
+		})
+		c.storages = append(c.storages, storage)
+		c.states = append(c.states, state)
+
+		blk := types.NewBlockForTest(parent, uint64(i))
+		if parent == nil {
+			blk.StateRoot = state
+		} else {
+			blk.StateRoot = c.states[i-1]
+		}
+		c.tipsets = append(c.tipsets, types.RequireNewTipSet(require, blk))
+		require.NoError(bs.Put(blk.ToNode()))
+		parent = blk
+	}
+
+	c.store = chain.NewDefaultStore(repo.NewInMemoryRepo().ChainDatastore(), hamt.NewCborStore(), c.tipsets[0].ToSlice()[0].Cid())
+	for i, ts := range c.tipsets {
+		chain.RequirePutTsas(ctx, require, c.store, &chain.TipSetAndState{
+			TipSet:          ts,
+			TipSetStateRoot: c.states[i],
+		})
+	}
+	require.NoError(c.store.SetHead(ctx, c.tipsets[3]))
+	return c
+}
+
+func (c *prunerTestChain) has(require *require.Assertions, ids ...cid.Cid) bool {
+	for _, id := range ids {
+		has, err := c.bs.Has(id)
+		require.NoError(err)
+		if !has {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStatePruner(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("keeps recent, genesis and unrelated blocks", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		c := newPrunerTestChain(ctx, require)
+
+		garbage := requirePutNode(require, c.bs, map[string]interface{}{"garbage": true})
+		file := blocks.NewBlock([]byte("not chain state"))
+		require.NoError(c.bs.Put(file))
+
+		pruner := chain.NewStatePruner(c.bs, c.store, nil)
+		result, err := pruner.Prune(ctx, 0)
+		require.NoError(err)
+		assert.Equal(2, result.RetainedTipSets)
+		assert.Equal(3, result.Removed)
+
+		// The head needs the states before and after it.
+		assert.True(c.has(require, c.states[3], c.storages[3], c.states[2], c.storages[2], c.shared))
+		assert.True(c.has(require, c.states[0], c.storages[0]))
+		assert.True(c.has(require, file.Cid()))
+		assert.False(c.has(require, c.states[1]))
+		assert.False(c.has(require, c.storages[1]))
+		assert.False(c.has(require, garbage))
+	})
+
+	t.Run("keeps the checkpoint", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		c := newPrunerTestChain(ctx, require)
+
+		pruner := chain.NewStatePruner(c.bs, c.store, func() types.SortedCidSet {
+			return c.tipsets[1].ToSortedCidSet()
+		})
+		result, err := pruner.Prune(ctx, 0)
+		require.NoError(err)
+		assert.Equal(3, result.RetainedTipSets)
+		assert.Equal(0, result.Removed)
+		assert.True(c.has(require, c.states[1], c.storages[1]))
+	})
+	t.Run("keeps the state of forks near the head so they can be extended", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		c := newPrunerTestChain(ctx, require)
+
+		// A fork off tipset 2 that is not the head.
+		forkStorage := requirePutNode(require, c.bs, map[string]interface{}{"value": "fork"})
+		forkState := requirePutNode(require, c.bs, map[string]interface{}{
+			"storage": forkStorage,
+			"shared":  c.shared,
+		})
+		forkBlk := types.NewBlockForTest(c.tipsets[2].ToSlice()[0], 10)
+		forkBlk.StateRoot = c.states[2]
+		fork := types.RequireNewTipSet(require, forkBlk)
+		chain.RequirePutTsas(ctx, require, c.store, &chain.TipSetAndState{TipSet: fork, TipSetStateRoot: forkState})
+
+		pruner := chain.NewStatePruner(c.bs, c.store, nil)
+		result, err := pruner.Prune(ctx, 0)
+		require.NoError(err)
+		assert.Equal(3, result.RetainedTipSets)
+		assert.True(c.has(require, forkState, forkStorage))
+		assert.False(c.has(require, c.states[1]))
+
+		// The fork can be extended from its state and become the head.
+		childStorage := requirePutNode(require, c.bs, map[string]interface{}{"value": "child"})
+		childState := requirePutNode(require, c.bs, map[string]interface{}{
+			"storage":       childStorage,
+			"parentStorage": forkStorage,
+			"shared":        c.shared,
+		})
+		childBlk := types.NewBlockForTest(forkBlk, 11)
+		childBlk.StateRoot = forkState
+		child := types.RequireNewTipSet(require, childBlk)
+		chain.RequirePutTsas(ctx, require, c.store, &chain.TipSetAndState{TipSet: child, TipSetStateRoot: childState})
+		require.NoError(c.store.SetHead(ctx, child))
+
+		_, err = pruner.Prune(ctx, 0)
+		require.NoError(err)
+		assert.True(c.has(require, childState, childStorage, forkState, forkStorage, c.shared))
+		// The old head is now a fork below the retained heights. Its state
+		// is gone, but its block is kept as the store still refers to it.
+		assert.False(c.has(require, c.states[3], c.storages[3]))
+		assert.True(c.has(require, c.tipsets[3].ToSlice()[0].Cid()))
+		assert.True(c.has(require, c.tipsets[1].ToSlice()[0].Cid()))
+	})
+
+	t.Run("does not start while the blockstore is held", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		c := newPrunerTestChain(ctx, require)
+
+		release := c.bs.Hold()
+		pruner := chain.NewStatePruner(c.bs, c.store, nil)
+		done := make(chan error, 1)
+		go func() {
+			_, err := pruner.Prune(ctx, 0)
+			done <- err
+		}()
+
+		// A state sharing storage with a state the pruner would otherwise
+		// delete is computed and stored while the blockstore is held.
+		select {
+		case <-done:
+			require.Fail("prune started while the blockstore was held")
+		case <-time.After(50 * time.Millisecond):
+		}
+		derived := requirePutNode(require, c.bs, map[string]interface{}{"storage": c.storages[1]})
+		blk := types.NewBlockForTest(c.tipsets[3].ToSlice()[0], 20)
+		blk.StateRoot = c.states[3]
+		chain.RequirePutTsas(ctx, require, c.store, &chain.TipSetAndState{
+			TipSet:          types.RequireNewTipSet(require, blk),
+			TipSetStateRoot: derived,
+		})
+		release()
+		require.NoError(<-done)
+
+		assert.True(c.has(require, derived, c.storages[1]))
+	})
+}
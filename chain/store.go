@@ -14,6 +14,10 @@ import (
 // NewHeadTopic is the topic used to publish new heads.
 const NewHeadTopic = "new-head"
 
+// RefusedReorgTopic is the topic used to publish a RefusedReorg each time a
+// heavier chain is not made the head because it would replace final tipsets.
+const RefusedReorgTopic = "refused-reorg"
+
 // GenesisKey is the key at which the genesis Cid is written in the datastore.
 var GenesisKey = datastore.NewKey("/consensus/genesisCid")
 
@@ -39,9 +43,15 @@ type ReadStore interface {
 	Head() types.TipSet
 	// LatestState returns the latest state of the head
 	LatestState(ctx context.Context) (state.Tree, error)
+	// StateAt returns the state after the tipset with the given key.
+	StateAt(ctx context.Context, tsKey string) (state.Tree, error)
 
 	BlockHistory(ctx context.Context, tips types.TipSet) <-chan interface{}
 
+	// GetMessageLocation returns where a message was included in the chain
+	// ending at the head, or nil if it is not in that chain.
+	GetMessageLocation(ctx context.Context, msgCid cid.Cid) (*MessageLocation, error)
+
 	GenesisCid() cid.Cid
 }
 
@@ -65,6 +75,8 @@ type Store interface {
 	GetTipSetAndStatesByParentsAndHeight(ctx context.Context, pTsKey string, h uint64) ([]*TipSetAndState, error)
 	// HasTipSetsWithParentsAndHeight indicates whether tipsets with these parents and this height are in the store.
 	HasTipSetAndStatesWithParentsAndHeight(ctx context.Context, pTsKey string, h uint64) bool
+	// GetTipSetAndStatesFromHeight returns all tipsets in the store whose height is at least h.
+	GetTipSetAndStatesFromHeight(ctx context.Context, h uint64) ([]*TipSetAndState, error)
 
 	// GetBlocks gets several blocks by cid. In the future there is caching here
 	GetBlocks(ctx context.Context, ids types.SortedCidSet) ([]*types.Block, error)
@@ -0,0 +1,152 @@
+package chain
+
+import (
+	"time"
+
+	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// SyncStage describes what a syncer is doing.
+type SyncStage string
+
+const (
+	// SyncIdle means that no chains are being synced.
+	SyncIdle = SyncStage("idle")
+	// SyncFetching means that chains are being collected from the network.
+	SyncFetching = SyncStage("fetching")
+	// SyncValidating means that the tipsets of a collected chain are being
+	// validated and added to the store.
+	SyncValidating = SyncStage("validating")
+)
+
+// SyncStatus reports the progress of a syncer.
+type SyncStatus struct {
+	Stage SyncStage `json:"stage"`
+	// Head is the key of the head of the chain store and HeadHeight its
+	// height.
+	Head       types.SortedCidSet `json:"head"`
+	HeadHeight uint64             `json:"headHeight"`
+	// TargetHead is the key of the highest head announced by connected
+	// peers and TargetHeight its height. They are empty until a peer
+	// announces a head. The node is caught up once HeadHeight reaches
+	// TargetHeight.
+	TargetHead   types.SortedCidSet `json:"targetHead"`
+	TargetHeight uint64             `json:"targetHeight"`
+	// PendingHeads is the number of heads whose chains are being synced.
+	PendingHeads int `json:"pendingHeads"`
+	// Validated is the number of tipsets of the chain being validated that
+	// have been added to the store so far, out of ToValidate.
+	Validated  int `json:"validated"`
+	ToValidate int `json:"toValidate"`
+	// LastError is the error of the last failed sync, if any, and
+	// LastErrorTime when it happened.
+	LastError     string    `json:"lastError,omitempty"`
+	LastErrorTime time.Time `json:"lastErrorTime"`
+}
+
+// syncProgress holds the parts of a syncer's status that are not derived
+// from its store or pending syncs. It is guarded by the syncer's statusMu.
+type syncProgress struct {
+	validating    bool
+	validated     int
+	toValidate    int
+	targets       map[peer.ID]syncTarget
+	lastError     string
+	lastErrorTime time.Time
+}
+
+// syncTarget is the head last announced by a peer.
+type syncTarget struct {
+	head   types.SortedCidSet
+	height uint64
+}
+
+// AnnounceHead records the head announced by peer p, for instance through
+// the hello protocol, replacing any head it announced before. The highest
+// announced head is reported as the target of the sync.
+func (syncer *DefaultSyncer) AnnounceHead(p peer.ID, key types.SortedCidSet, height uint64) {
+	syncer.statusMu.Lock()
+	defer syncer.statusMu.Unlock()
+	if syncer.progress.targets == nil {
+		syncer.progress.targets = make(map[peer.ID]syncTarget)
+	}
+	syncer.progress.targets[p] = syncTarget{head: key, height: height}
+}
+
+// DropPeer forgets the head announced by peer p, for instance because it
+// disconnected.
+func (syncer *DefaultSyncer) DropPeer(p peer.ID) {
+	syncer.statusMu.Lock()
+	defer syncer.statusMu.Unlock()
+	delete(syncer.progress.targets, p)
+}
+
+// dropTarget forgets the head with the given key wherever peers announced
+// it, because it failed validation.
+func (syncer *DefaultSyncer) dropTarget(key string) {
+	syncer.statusMu.Lock()
+	defer syncer.statusMu.Unlock()
+	for p, target := range syncer.progress.targets {
+		if target.head.String() == key {
+			delete(syncer.progress.targets, p)
+		}
+	}
+}
+
+// Status returns the current status of the syncer.
+func (syncer *DefaultSyncer) Status() SyncStatus {
+	syncer.pendingMu.Lock()
+	pending := len(syncer.pending)
+	syncer.pendingMu.Unlock()
+
+	syncer.statusMu.Lock()
+	progress := syncer.progress
+	var target syncTarget
+	for _, t := range progress.targets {
+		if target.head.Empty() || t.height > target.height {
+			target = t
+		}
+	}
+	syncer.statusMu.Unlock()
+
+	head := syncer.chainStore.Head()
+	status := SyncStatus{
+		Stage:         SyncIdle,
+		Head:          head.ToSortedCidSet(),
+		HeadHeight:    tipSetHeight(head),
+		TargetHead:    target.head,
+		TargetHeight:  target.height,
+		PendingHeads:  pending,
+		LastError:     progress.lastError,
+		LastErrorTime: progress.lastErrorTime,
+	}
+	if progress.validating {
+		status.Stage = SyncValidating
+		status.Validated = progress.validated
+		status.ToValidate = progress.toValidate
+	} else if pending > 0 {
+		status.Stage = SyncFetching
+	}
+	return status
+}
+
+// setValidating records that validated of the toValidate tipsets of a chain
+// have been added to the store, or that no chain is being validated if
+// validating is false.
+func (syncer *DefaultSyncer) setValidating(validating bool, validated, toValidate int) {
+	syncer.statusMu.Lock()
+	defer syncer.statusMu.Unlock()
+	syncer.progress.validating = validating
+	syncer.progress.validated = validated
+	syncer.progress.toValidate = toValidate
+}
+
+// setLastError records the error of a failed sync.
+func (syncer *DefaultSyncer) setLastError(err error) {
+	syncer.statusMu.Lock()
+	defer syncer.statusMu.Unlock()
+	syncer.progress.lastError = err.Error()
+	syncer.progress.lastErrorTime = time.Now()
+}
@@ -0,0 +1,109 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestSyncStatus(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("reports head and announced target", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		syncer, chainStore, cst, _ := initSyncTestDefault(require)
+
+		status := syncer.Status()
+		assert.Equal(chain.SyncIdle, status.Stage)
+		assert.True(status.Head.Equals(chainStore.Head().ToSortedCidSet()))
+		assert.Equal(uint64(0), status.HeadHeight)
+		assert.True(status.TargetHead.Empty())
+
+		syncer.AnnounceHead(peer.ID("peer1"), link2.ToSortedCidSet(), 2)
+		syncer.AnnounceHead(peer.ID("peer2"), link1.ToSortedCidSet(), 1)
+
+		_ = requirePutBlocks(require, cst, link1.ToSlice()...)
+		cids2 := requirePutBlocks(require, cst, link2.ToSlice()...)
+		require.NoError(syncer.HandleNewBlocks(ctx, cids2))
+
+		status = syncer.Status()
+		assert.Equal(chain.SyncIdle, status.Stage)
+		assert.True(status.Head.Equals(link2.ToSortedCidSet()))
+		assert.Equal(uint64(2), status.HeadHeight)
+		assert.True(status.TargetHead.Equals(link2.ToSortedCidSet()))
+		assert.Equal(uint64(2), status.TargetHeight)
+		assert.Equal(0, status.PendingHeads)
+		assert.Empty(status.LastError)
+	})
+
+	t.Run("tracks the head announced by each peer", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		syncer, _, cst, _ := initSyncTestDefault(require)
+
+		syncer.AnnounceHead(peer.ID("peer1"), link3.ToSortedCidSet(), 3)
+		syncer.AnnounceHead(peer.ID("peer2"), link2.ToSortedCidSet(), 2)
+		assert.Equal(uint64(3), syncer.Status().TargetHeight)
+
+		// A peer's new head replaces its old one, even if it is lower.
+		syncer.AnnounceHead(peer.ID("peer1"), link1.ToSortedCidSet(), 1)
+		status := syncer.Status()
+		assert.True(status.TargetHead.Equals(link2.ToSortedCidSet()))
+		assert.Equal(uint64(2), status.TargetHeight)
+
+		// Disconnected peers no longer count.
+		syncer.DropPeer(peer.ID("peer2"))
+		assert.Equal(uint64(1), syncer.Status().TargetHeight)
+		syncer.DropPeer(peer.ID("peer1"))
+		assert.True(syncer.Status().TargetHead.Empty())
+
+		// Nor do heads that fail validation.
+		_ = requirePutBlocks(require, cst, link1.ToSlice()...)
+		_ = requirePutBlocks(require, cst, link2.ToSlice()...)
+		badCids := []cid.Cid{link1blk1.Cid(), link2blk1.Cid()}
+		syncer.AnnounceHead(peer.ID("peer1"), link1.ToSortedCidSet(), 1)
+		syncer.AnnounceHead(peer.ID("peer3"), types.NewSortedCidSet(badCids...), 5)
+		assert.Equal(uint64(5), syncer.Status().TargetHeight)
+		require.Error(syncer.HandleNewBlocks(ctx, badCids))
+		status = syncer.Status()
+		assert.True(status.TargetHead.Equals(link1.ToSortedCidSet()))
+		assert.Equal(uint64(1), status.TargetHeight)
+	})
+
+	t.Run("reports fetching and the last error", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		syncer, _, _, _ := initSyncTestDefault(require)
+
+		fetcher := newFakeTipSetFetcher()
+		fetcher.started = make(chan struct{})
+		fetcher.release = make(chan struct{})
+		syncer.SetTipSetFetcher(fetcher)
+
+		unknown := types.NewBlockForTest(nil, 1000)
+		errs := make(chan error)
+		go func() { errs <- syncer.HandleNewBlocks(ctx, []cid.Cid{unknown.Cid()}) }()
+		<-fetcher.started
+
+		status := syncer.Status()
+		assert.Equal(chain.SyncFetching, status.Stage)
+		assert.Equal(1, status.PendingHeads)
+
+		close(fetcher.release)
+		err := <-errs
+		require.Error(err)
+
+		status = syncer.Status()
+		assert.Equal(chain.SyncIdle, status.Stage)
+		assert.Equal(err.Error(), status.LastError)
+		assert.False(status.LastErrorTime.IsZero())
+	})
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
+
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 // Syncer handles new blocks, either from the network or the local node's
@@ -19,4 +22,20 @@ import (
 // after too many blocks.
 type Syncer interface {
 	HandleNewBlocks(ctx context.Context, blkCids []cid.Cid) error
+	HandleSnapshot(ctx context.Context, snapshot *Snapshot, trust bool) error
+	AnnounceHead(p peer.ID, key types.SortedCidSet, height uint64)
+	DropPeer(p peer.ID)
+	Status() SyncStatus
+	SetCheckpoint(ctx context.Context, key types.SortedCidSet) error
+	BadTipSets() []*BadTipSet
+	RemoveBadTipSet(key types.SortedCidSet) (int, error)
+	ClearBadTipSets() (int, error)
+}
+
+// TipSetFetcher fetches runs of tipsets from the network in bulk.
+type TipSetFetcher interface {
+	// FetchTipSets returns the tipset with key start and up to length-1 of
+	// its ancestors, ordered from start backwards. The blocks returned are
+	// complete but not validated.
+	FetchTipSets(ctx context.Context, start types.SortedCidSet, length uint64) ([]types.TipSet, error)
 }
@@ -112,6 +112,24 @@ func (ti *TipIndex) GetByParentsAndHeight(pKey string, h uint64) ([]*TipSetAndSt
 	return ret, nil
 }
 
+// GetFromHeight returns all tipsets and states stored in the TipIndex whose
+// height is at least h.
+func (ti *TipIndex) GetFromHeight(h uint64) ([]*TipSetAndState, error) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	var ret []*TipSetAndState
+	for _, tsas := range ti.tsasByID {
+		tsHeight, err := tsas.TipSet.Height()
+		if err != nil {
+			return nil, err
+		}
+		if tsHeight >= h {
+			ret = append(ret, tsas)
+		}
+	}
+	return ret, nil
+}
+
 // HasByParentsAndHeight returns true iff there exist tipsets, and states,
 // tracked in the TipIndex such that the parent ID of these tipsets equals the
 // input.
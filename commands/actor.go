@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"io"
 
+	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/api"
+	"github.com/filecoin-project/go-filecoin/plumbing/actrstate"
 
 	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
@@ -15,7 +17,8 @@ var actorCmd = &cmds.Command{
 		Tagline: "Interact with actors. Actors are built-in smart contracts.",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"ls": actorLsCmd,
+		"ls":   actorLsCmd,
+		"show": actorShowCmd,
 	},
 }
 
@@ -49,3 +52,47 @@ var actorLsCmd = &cmds.Command{
 		}),
 	},
 }
+
+var actorShowCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show an actor with its decoded state",
+		ShortDescription: `
+Shows the actor at <address> in the state of the head, of the tipset given
+with --at as the comma separated CIDs of its blocks, or of the chain at
+--height. The storage of builtin miner, storage market and payment broker
+actors is decoded.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("address", true, false, "address of the actor"),
+	},
+	Options: atOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		addr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		at, err := stateAt(req, env)
+		if err != nil {
+			return err
+		}
+
+		view, err := GetPorcelainAPI(env).ActorShow(req.Context, addr, at)
+		if err != nil {
+			return err
+		}
+		return re.Emit(view)
+	},
+	Type: actrstate.View{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, view *actrstate.View) error {
+			marshaled, err := json.MarshalIndent(view, "", "  ")
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(append(marshaled, '\n'))
+			return err
+		}),
+	},
+}
@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/api"
+	"github.com/filecoin-project/go-filecoin/fixtures"
 	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
 
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
@@ -48,4 +51,37 @@ func TestActorDaemon(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("actor show decodes the state of builtin actors", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		d := th.NewDaemon(t,
+			th.KeyFile(fixtures.KeyFilePaths()[0]),
+			th.WithMiner(fixtures.TestMiners[0])).Start()
+		defer d.ShutdownSuccess()
+
+		var genesis []types.Block
+		require.NoError(json.Unmarshal([]byte(d.RunSuccess("chain", "head", "--enc", "json").ReadStdoutTrimNewlines()), &genesis))
+		require.Len(genesis, 1)
+		d.RunSuccess("mining", "once")
+
+		var view struct {
+			ActorType string
+			State     map[string]interface{}
+		}
+		out := d.RunSuccess("actor", "show", fixtures.TestMiners[0], "--enc", "json").ReadStdoutTrimNewlines()
+		require.NoError(json.Unmarshal([]byte(out), &view))
+		assert.Equal("MinerActor", view.ActorType)
+		assert.NotEmpty(view.State["Owner"])
+
+		out = d.RunSuccess("actor", "show", address.StorageMarketAddress.String(), "--enc", "json").ReadStdoutTrimNewlines()
+		require.NoError(json.Unmarshal([]byte(out), &view))
+		assert.Equal("StoragemarketActor", view.ActorType)
+		assert.Contains(view.State["miners"], fixtures.TestMiners[0])
+
+		// the state of a past tipset can be shown
+		d.RunSuccess("actor", "show", fixtures.TestMiners[0], "--at", genesis[0].Cid().String())
+		d.RunFail("failed to get actor", "actor", "show", address.NewForTestGetter()().String())
+	})
 }
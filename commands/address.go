@@ -2,15 +2,18 @@ package commands
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 
 	"gx/ipfs/QmQmhotPUzVrMEWNK3x1R5jQ5ZHWyL7tVUrmRPjrBrvyCb/go-ipfs-files"
 	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/api/impl"
+	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -31,9 +34,10 @@ var addrsCmd = &cmds.Command{
 		Tagline: "Interact with addresses",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"ls":     addrsLsCmd,
-		"new":    addrsNewCmd,
-		"lookup": addrsLookupCmd,
+		"history": addrsHistoryCmd,
+		"ls":      addrsLsCmd,
+		"new":     addrsNewCmd,
+		"lookup":  addrsLookupCmd,
 	},
 }
 
@@ -95,13 +99,18 @@ var addrsLookupCmd = &cmds.Command{
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("address", true, false, "Miner address to find peerId for"),
 	},
+	Options: atOptions,
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		addr, err := address.NewFromString(req.Arguments[0])
 		if err != nil {
 			return err
 		}
+		at, err := stateAt(req, env)
+		if err != nil {
+			return err
+		}
 
-		v, err := GetAPI(env).Address().Addrs().Lookup(req.Context, addr)
+		v, err := GetAPI(env).Address().Addrs().Lookup(req.Context, addr, at)
 		if err != nil {
 			return err
 		}
@@ -116,6 +125,59 @@ var addrsLookupCmd = &cmds.Command{
 	},
 }
 
+var addrsHistoryCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the messages and value transfers involving an address",
+		ShortDescription: `
+Prints, oldest first and one JSON object per line, the messages sent from or to
+the address and the value it sent or received through actors, block rewards and
+gas. Requires chain.addressHistory to be enabled in the config; only tipsets
+processed since it was enabled are included.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("address", true, false, "Address to show the history of"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.Uint64Option("from-height", "Only show entries at or above this height"),
+		cmdkit.Uint64Option("to-height", "Only show entries at or below this height"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		addr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		fromHeight, _ := req.Options["from-height"].(uint64)
+		toHeight, _ := req.Options["to-height"].(uint64)
+		if toHeight != 0 && toHeight < fromHeight {
+			return errors.New("to-height must not be below from-height")
+		}
+
+		entries, err := GetPorcelainAPI(env).AddressHistory(req.Context, addr, fromHeight, toHeight)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := re.Emit(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: &chain.AddressHistoryEntry{},
+	Encoders: cmds.EncoderMap{
+		cmds.JSON: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, entry *chain.AddressHistoryEntry) error {
+			marshaled, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(append(marshaled, '\n'))
+			return err
+		}),
+	},
+}
+
 var balanceCmd = &cmds.Command{
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("address", true, false, "Address to get balance for"),
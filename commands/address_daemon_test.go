@@ -99,6 +99,10 @@ func TestAddrLookupAndUpdate(t *testing.T) {
 	lookupOutB := th.RunSuccessFirstLine(d, "address", "lookup", minerAddr)
 	assert.Equal(minerPidForUpdate.Pretty(), lookupOutB)
 	assert.NotEqual(lookupOutA, lookupOutB)
+
+	// the peer ID before the update can still be looked up at genesis
+	lookupOutGenesis := th.RunSuccessFirstLine(d, "address", "lookup", "--height", "0", minerAddr)
+	assert.Equal(lookupOutA, lookupOutGenesis)
 }
 
 func TestWalletLoadFromFile(t *testing.T) {
@@ -162,3 +166,34 @@ func TestWalletExportPrivateKeyConsistentDisplay(t *testing.T) {
 
 	assert.Contains(exportJSON, exportTextPrivateKey)
 }
+
+func TestAddressHistory(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	d.RunFail("address history is not enabled", "address", "history", fixtures.TestAddresses[1])
+
+	d.RunSuccess("config", "chain.addressHistory", "true")
+	d.Restart()
+
+	msgCid := d.RunSuccess("message", "send",
+		"--from", fixtures.TestAddresses[0],
+		"--price", "0", "--limit", "300",
+		"--value=10",
+		fixtures.TestAddresses[1],
+	).ReadStdoutTrimNewlines()
+	d.RunSuccess("mining", "once")
+	d.RunSuccess("message", "wait", "--return=false", msgCid)
+
+	history := d.RunSuccess("address", "history", fixtures.TestAddresses[1]).ReadStdout()
+	assert.Contains(history, msgCid)
+	assert.Contains(history, `"kind":"message"`)
+
+	history = d.RunSuccess("address", "history", fixtures.TestAddresses[1], "--from-height", "100000").ReadStdout()
+	assert.NotContains(history, msgCid)
+
+	d.RunFail("to-height must not be below from-height", "address", "history", fixtures.TestAddresses[1], "--from-height", "2", "--to-height", "1")
+}
@@ -6,11 +6,14 @@ import (
 	"io"
 	"strconv"
 	"strings"
+	"time"
 
+	"gx/ipfs/QmQmhotPUzVrMEWNK3x1R5jQ5ZHWyL7tVUrmRPjrBrvyCb/go-ipfs-files"
 	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 
+	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -19,8 +22,13 @@ var chainCmd = &cmds.Command{
 		Tagline: "Inspect the filecoin blockchain",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"head": chainHeadCmd,
-		"ls":   chainLsCmd,
+		"bad":         chainBadCmd,
+		"checkpoint":  chainCheckpointCmd,
+		"export":      chainExportCmd,
+		"head":        chainHeadCmd,
+		"import":      chainImportCmd,
+		"ls":          chainLsCmd,
+		"sync-status": chainSyncStatusCmd,
 	},
 }
 
@@ -95,3 +103,244 @@ var chainLsCmd = &cmds.Command{
 		}),
 	},
 }
+
+var chainExportCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Export the blockchain as a CAR file",
+		ShortDescription: `
+Writes the chain ending at the head to stdout as a CAR file. The file holds
+every tipset back to genesis with their messages and receipts, and every state
+tree of the chain. It can be loaded with the chain import command or with the
+--import-chain option of init.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.Uint64Option("height", "export the chain ending at the highest tipset at or below this height instead of the head"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		var height *types.BlockHeight
+		if h, ok := req.Options["height"].(uint64); ok {
+			height = types.NewBlockHeight(h)
+		}
+
+		r, w := io.Pipe()
+		go func() {
+			w.CloseWithError(GetPorcelainAPI(env).ChainExport(req.Context, height, w)) // nolint: errcheck
+		}()
+
+		return re.Emit(r)
+	},
+}
+
+var chainImportCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Import a blockchain exported as a CAR file",
+		ShortDescription: `
+Loads a chain written by the chain export command into the node and switches
+the head to it if it is heavier than the current head. The chain must descend
+from the node's genesis block. Unless --trust is given, every tipset of the
+chain that the node does not already have is validated by running its state
+transition, which can take a long time for long chains. Prints the CIDs of the
+blocks at the head of the imported chain.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.FileArg("file", true, false, "Path of the CAR file to import").EnableStdin(),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption("trust", "skip validating the state transitions of the imported chain"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		trust, _ := req.Options["trust"].(bool)
+
+		iter := req.Files.Entries()
+		if !iter.Next() {
+			return fmt.Errorf("no file given: %s", iter.Err())
+		}
+
+		fi, ok := iter.Node().(files.File)
+		if !ok {
+			return fmt.Errorf("given file was not a files.File")
+		}
+
+		head, err := GetPorcelainAPI(env).ChainImport(req.Context, fi, trust)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(head.ToSortedCidSet().ToSlice())
+	},
+	Type: []cid.Cid{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, cids []cid.Cid) error {
+			for _, c := range cids {
+				if _, err := fmt.Fprintln(w, c.String()); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	},
+}
+
+var chainSyncStatusCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the progress of syncing the blockchain",
+		ShortDescription: `
+Shows what the chain syncer is doing: idle, fetching chains from peers, or
+validating a fetched chain. The target is the highest head announced by peers;
+the node is caught up once the height of its head reaches the target height.
+`,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		return re.Emit(GetPorcelainAPI(env).ChainSyncStatus())
+	},
+	Type: chain.SyncStatus{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, status *chain.SyncStatus) error {
+			if _, err := fmt.Fprintf(w, "stage: %s\nhead: %s\nheight: %d\n", status.Stage, status.Head.String(), status.HeadHeight); err != nil {
+				return err
+			}
+			if !status.TargetHead.Empty() {
+				if _, err := fmt.Fprintf(w, "target: %s\ntarget height: %d\n", status.TargetHead.String(), status.TargetHeight); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintf(w, "pending heads: %d\n", status.PendingHeads); err != nil {
+				return err
+			}
+			if status.Stage == chain.SyncValidating {
+				if _, err := fmt.Fprintf(w, "validated: %d/%d\n", status.Validated, status.ToValidate); err != nil {
+					return err
+				}
+			}
+			if status.LastError != "" {
+				_, err := fmt.Fprintf(w, "last error: %s (%s)\n", status.LastError, status.LastErrorTime.Format(time.RFC3339))
+				return err
+			}
+			return nil
+		}),
+	},
+}
+
+var chainBadCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Inspect and clear tipsets the node found to be invalid",
+		ShortDescription: `
+The node remembers tipsets that failed validation, and the tipsets descending
+from them, so that it does not download and validate them again. Entries are
+kept for a week.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls": chainBadLsCmd,
+		"rm": chainBadRmCmd,
+	},
+}
+
+var chainBadLsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List tipsets the node found to be invalid",
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		for _, bad := range GetPorcelainAPI(env).ChainBadTipSets() {
+			if err := re.Emit(bad); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: chain.BadTipSet{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, bad *chain.BadTipSet) error {
+			_, err := fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", bad.TipSet.String(), bad.Height, bad.Time.Format(time.RFC3339), bad.Reason)
+			return err
+		}),
+	},
+}
+
+var chainBadRmCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Forget that a tipset is invalid",
+		ShortDescription: `
+Removes the tipset made of the given blocks from the node's bad tipsets, along
+with the tipsets marked bad because they descend from it, so that the node
+syncs them again the next time they are seen. With --all, forgets every bad
+tipset. Use this to recover when a valid chain was wrongly marked bad.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cids", false, true, "CIDs of the blocks of the tipset"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption("all", "forget all bad tipsets"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		all, _ := req.Options["all"].(bool)
+		if all == (len(req.Arguments) > 0) {
+			return fmt.Errorf("give either the CIDs of a tipset or --all")
+		}
+
+		var removed int
+		var err error
+		if all {
+			removed, err = GetPorcelainAPI(env).ChainClearBadTipSets()
+		} else {
+			var key types.SortedCidSet
+			for _, arg := range req.Arguments {
+				c, err := cid.Decode(arg)
+				if err != nil {
+					return err
+				}
+				key.Add(c)
+			}
+			removed, err = GetPorcelainAPI(env).ChainRemoveBadTipSet(key)
+		}
+		if err != nil {
+			return err
+		}
+		return re.Emit(removed)
+	},
+	Type: 0,
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, removed int) error {
+			_, err := fmt.Fprintf(w, "removed %d bad tipsets\n", removed)
+			return err
+		}),
+	},
+}
+
+var chainCheckpointCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Manage the tipset the node considers final",
+		ShortDescription: `
+The node refuses to sync chains that do not include its checkpoint tipset, so
+it never reorgs below it. The checkpoint is kept in chain.checkpoint in the
+config. Separately, chain.finalityDepth limits how many tipsets any reorg may
+remove from the chain.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"set": chainCheckpointSetCmd,
+	},
+}
+
+var chainCheckpointSetCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Pin a tipset of the current chain as final",
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cids", true, true, "CIDs of the blocks of the tipset"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		var key types.SortedCidSet
+		for _, arg := range req.Arguments {
+			c, err := cid.Decode(arg)
+			if err != nil {
+				return err
+			}
+			key.Add(c)
+		}
+		return GetPorcelainAPI(env).ChainSetCheckpoint(req.Context, key)
+	},
+}
@@ -4,10 +4,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 
+	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/fixtures"
 	th "github.com/filecoin-project/go-filecoin/testhelpers"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -111,3 +115,126 @@ func TestChainDaemon(t *testing.T) {
 		assert.Contains(chainLsResult, "0")
 	})
 }
+
+func TestChainSyncStatus(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	d.RunSuccess("mining", "once")
+
+	out := d.RunSuccess("chain", "sync-status", "--enc", "json").ReadStdoutTrimNewlines()
+	var status chain.SyncStatus
+	require.NoError(json.Unmarshal([]byte(out), &status))
+	assert.Equal(chain.SyncIdle, status.Stage)
+	assert.Equal(uint64(1), status.HeadHeight)
+	assert.Equal(0, status.PendingHeads)
+
+	text := d.RunSuccess("chain", "sync-status").ReadStdout()
+	assert.Contains(text, "stage: idle")
+	assert.Contains(text, "height: 1")
+}
+
+func TestChainBad(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	d := th.NewDaemon(t).Start()
+	defer d.ShutdownSuccess()
+
+	assert.Empty(d.RunSuccess("chain", "bad", "ls").ReadStdoutTrimNewlines())
+
+	d.RunFail("either the CIDs of a tipset or --all", "chain", "bad", "rm")
+	out := d.RunSuccess("chain", "bad", "rm", "--all").ReadStdoutTrimNewlines()
+	assert.Equal("removed 0 bad tipsets", out)
+}
+
+func TestChainCheckpoint(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	d.RunSuccess("mining", "once")
+	var blks []types.Block
+	require.NoError(json.Unmarshal([]byte(d.RunSuccess("chain", "head", "--enc", "json").ReadStdoutTrimNewlines()), &blks))
+	require.Len(blks, 1)
+
+	d.RunFail("failed to get block", "chain", "checkpoint", "set", types.NewBlockForTest(&blks[0], 1).Cid().String())
+	assert.Equal("null", d.RunSuccess("config", "chain.checkpoint").ReadStdoutTrimNewlines())
+
+	d.RunSuccess("chain", "checkpoint", "set", blks[0].Cid().String())
+	assert.Contains(d.RunSuccess("config", "chain.checkpoint").ReadStdoutTrimNewlines(), blks[0].Cid().String())
+
+	// the chain still grows past the checkpoint
+	d.RunSuccess("mining", "once")
+}
+
+func TestChainExportImport(t *testing.T) {
+	t.Parallel()
+
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	d.RunSuccess("mining", "once")
+	d.RunSuccess("mining", "once")
+	head := d.RunSuccess("chain", "head", "--enc", "json").ReadStdoutTrimNewlines()
+
+	dir, err := ioutil.TempDir("", "chain-export")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	chainFile := filepath.Join(dir, "chain.car")
+	require.NoError(t, ioutil.WriteFile(chainFile, []byte(d.RunSuccess("chain", "export").ReadStdout()), 0644))
+
+	initFromChainFile := func(t *testing.T, file string) *th.TestDaemon {
+		repoDir, err := ioutil.TempDir("", "go-fil-test")
+		require.NoError(t, err)
+
+		d := th.NewDaemon(t, th.ShouldInit(false), th.RepoDir(repoDir))
+		out, err := th.RunInit(d, fmt.Sprintf("--repodir=%s", repoDir), fmt.Sprintf("--import-chain=%s", file), "--trust-imported-chain")
+		require.NoError(t, err, string(out))
+		return d.Start()
+	}
+
+	t.Run("chain import validates and switches to the exported chain", func(t *testing.T) {
+		assert := assert.New(t)
+
+		d2 := th.NewDaemon(t).Start()
+		defer d2.ShutdownSuccess()
+
+		d2.RunSuccess("chain", "import", chainFile)
+		assert.Equal(head, d2.RunSuccess("chain", "head", "--enc", "json").ReadStdoutTrimNewlines())
+	})
+
+	t.Run("init --import-chain initializes the chain from the export", func(t *testing.T) {
+		assert := assert.New(t)
+
+		d2 := initFromChainFile(t, chainFile)
+		defer d2.ShutdownSuccess()
+
+		assert.Equal(head, d2.RunSuccess("chain", "head", "--enc", "json").ReadStdoutTrimNewlines())
+		assert.NotEqual("null", d2.RunSuccess("config", "chain.checkpoint").ReadStdoutTrimNewlines())
+	})
+
+	t.Run("chain export --height exports the chain ending at that height", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		file := filepath.Join(dir, "chain-1.car")
+		require.NoError(ioutil.WriteFile(file, []byte(d.RunSuccess("chain", "export", "--height", "1").ReadStdout()), 0644))
+
+		d2 := initFromChainFile(t, file)
+		defer d2.ShutdownSuccess()
+
+		var blks []types.Block
+		require.NoError(json.Unmarshal([]byte(d2.RunSuccess("chain", "head", "--enc", "json").ReadStdoutTrimNewlines()), &blks))
+		require.Len(blks, 1)
+		assert.Equal(types.Uint64(1), blks[0].Height)
+	})
+}
@@ -18,6 +18,8 @@ var initCmd = &cmds.Command{
 	},
 	Options: []cmdkit.Option{
 		cmdkit.StringOption(GenesisFile, "path of file or HTTP(S) URL containing archive of genesis block DAG data"),
+		cmdkit.StringOption(ImportChain, "path of a file containing a chain exported with chain export to initialize the node's chain from, replaces --genesisfile"),
+		cmdkit.BoolOption(TrustImportedChain, "when set, skips validating the state transitions of the chain given with --import-chain and makes its head the chain checkpoint"),
 		cmdkit.StringOption(PeerKeyFile, "path of file containing key to use for new node's libp2p identity"),
 		cmdkit.StringOption(WithMiner, "when set, creates a custom genesis block with a pre generated miner account, requires running the daemon using dev mode (--dev)"),
 		cmdkit.StringOption(DefaultAddress, "when set, sets the daemons's default address to the provided address"),
@@ -33,6 +35,8 @@ var initCmd = &cmds.Command{
 		}
 
 		genesisFile, _ := req.Options[GenesisFile].(string)
+		importChain, _ := req.Options[ImportChain].(string)
+		trustImportedChain, _ := req.Options[TrustImportedChain].(bool)
 		peerKeyFile, _ := req.Options[PeerKeyFile].(string)
 		autoSealIntervalSeconds, _ := req.Options[AutoSealIntervalSeconds].(uint)
 		devnetTest, _ := req.Options[DevnetTest].(bool)
@@ -61,6 +65,8 @@ var initCmd = &cmds.Command{
 			req.Context,
 			api.RepoDir(repoDir),
 			api.GenesisFile(genesisFile),
+			api.ImportChainFile(importChain),
+			api.TrustImportedChain(trustImportedChain),
 			api.PeerKeyFile(peerKeyFile),
 			api.WithMiner(withMiner),
 			api.DevnetTest(devnetTest),
@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"syscall"
 
 	ma "gx/ipfs/QmNTCey11oxhb1AxDnQBRHtdhap6Ctud872NjAYPYYXPuc/go-multiaddr"
@@ -68,6 +69,12 @@ const (
 	// GenesisFile is the path of file containing archive of genesis block DAG data
 	GenesisFile = "genesisfile"
 
+	// ImportChain is the path of a CAR file containing a chain exported with chain export
+	ImportChain = "import-chain"
+
+	// TrustImportedChain skips validating the state transitions of the chain given with ImportChain
+	TrustImportedChain = "trust-imported-chain"
+
 	// DevnetTest populates config bootstrap addrs with the dns multiaddrs of the test devnet and other test devnet specific bootstrap parameters
 	DevnetTest = "devnet-test"
 
@@ -106,6 +113,7 @@ VIEW DATA STRUCTURES
   go-filecoin chain                  - Inspect the filecoin blockchain
   go-filecoin dag                    - Interact with IPLD DAG objects
   go-filecoin show                   - Get human-readable representations of filecoin objects
+  go-filecoin state                  - Inspect the state of the chain
 
 NETWORK COMMANDS
   go-filecoin bootstrap              - Interact with bootstrap addresses
@@ -125,6 +133,7 @@ MESSAGE COMMANDS
 
 TOOL COMMANDS
   go-filecoin log                    - Interact with the daemon event log output.
+  go-filecoin repo                   - Manage the node's repo
   go-filecoin version                - Show go-filecoin version information
 `,
 	},
@@ -167,8 +176,10 @@ var rootSubcmdsDaemon = map[string]*cmds.Command{
 	"mpool":            mpoolCmd,
 	"paych":            paymentChannelCmd,
 	"ping":             pingCmd,
+	"repo":             repoCmd,
 	"retrieval-client": retrievalClientCmd,
 	"show":             showCmd,
+	"state":            stateCmd,
 	"stats":            statsCmd,
 	"swarm":            swarmCmd,
 	"version":          versionCmd,
@@ -321,33 +332,74 @@ func isConnectionRefused(err error) bool {
 	return syscallErr.Err == syscall.ECONNREFUSED
 }
 
-var priceOption = cmdkit.StringOption("price", "Price (FIL e.g. 0.00013) to pay for each GasUnits consumed mining this message")
+var priceOption = cmdkit.StringOption("price", "Price (FIL e.g. 0.00013) to pay for each GasUnits consumed mining this message (defaults to the estimated medium gas price)")
 var limitOption = cmdkit.Uint64Option("limit", "Maximum number of GasUnits this message is allowed to consume")
+var gasLimitOption = cmdkit.StringOption("gas-limit", "Maximum number of GasUnits this message is allowed to consume, or \"auto\" to derive it from a preview of the message")
 var previewOption = cmdkit.BoolOption("preview", "Preview the Gas cost of this command without actually executing it")
 
-func parseGasOptions(req *cmds.Request) (types.AttoFIL, types.GasUnits, bool, error) {
+// parseGasOptions reads the gas price, gas limit and preview options. The
+// returned auto flag is true if --gas-limit is "auto", in which case the gas
+// limit should be derived from a preview of the message.
+func parseGasOptions(req *cmds.Request, env cmds.Environment) (types.AttoFIL, types.GasUnits, bool, bool, error) {
+	var price *types.AttoFIL
 	priceOption := req.Options["price"]
 	if priceOption == nil {
-		return types.AttoFIL{}, types.NewGasUnits(0), false, errors.New("price option is required")
+		// No price given; use the current estimate.
+		estimate, err := GetPorcelainAPI(env).MessageEstimateGasPrice(req.Context)
+		if err != nil {
+			return types.AttoFIL{}, types.NewGasUnits(0), false, false, errors.Wrap(err, "could not estimate gas price")
+		}
+		price = &estimate.Medium
+	} else {
+		var ok bool
+		price, ok = types.NewAttoFILFromFILString(priceOption.(string))
+		if !ok {
+			return types.AttoFIL{}, types.NewGasUnits(0), false, false, errors.New("invalid gas price (specify FIL as a decimal number)")
+		}
 	}
 
-	price, ok := types.NewAttoFILFromFILString(priceOption.(string))
-	if !ok {
-		return types.AttoFIL{}, types.NewGasUnits(0), false, errors.New("invalid gas price (specify FIL as a decimal number)")
+	gasLimit, autoGasLimit, err := parseGasLimitOptions(req)
+	if err != nil {
+		return types.AttoFIL{}, types.NewGasUnits(0), false, false, err
 	}
 
+	preview, _ := req.Options["preview"].(bool)
+
+	return *price, gasLimit, autoGasLimit, preview, nil
+}
+
+// parseGasLimitOptions reads the gas limit from either --limit or --gas-limit.
+// The returned auto flag is true if --gas-limit is "auto".
+func parseGasLimitOptions(req *cmds.Request) (types.GasUnits, bool, error) {
 	limitOption := req.Options["limit"]
+	gasLimitOption := req.Options["gas-limit"]
+	if limitOption != nil && gasLimitOption != nil {
+		return types.NewGasUnits(0), false, errors.New("only one of limit and gas-limit may be given")
+	}
+
+	if gasLimitOption != nil {
+		gasLimitStr, ok := gasLimitOption.(string)
+		if !ok {
+			return types.NewGasUnits(0), false, fmt.Errorf("invalid gas limit: %v", gasLimitOption)
+		}
+		if gasLimitStr == "auto" {
+			return types.NewGasUnits(0), true, nil
+		}
+		gasLimitInt, err := strconv.ParseUint(gasLimitStr, 10, 64)
+		if err != nil {
+			return types.NewGasUnits(0), false, fmt.Errorf("invalid gas limit: %s", gasLimitStr)
+		}
+		return types.NewGasUnits(gasLimitInt), false, nil
+	}
+
 	if limitOption == nil {
-		return types.AttoFIL{}, types.NewGasUnits(0), false, errors.New("limit option is required")
+		return types.NewGasUnits(0), false, errors.New("limit option is required")
 	}
 
 	gasLimitInt, ok := limitOption.(uint64)
 	if !ok {
 		msg := fmt.Sprintf("invalid gas limit: %s", limitOption)
-		return types.AttoFIL{}, types.NewGasUnits(0), false, errors.New(msg)
+		return types.NewGasUnits(0), false, errors.New(msg)
 	}
-
-	preview, _ := req.Options["preview"].(bool)
-
-	return *price, types.NewGasUnits(gasLimitInt), preview, nil
+	return types.NewGasUnits(gasLimitInt), false, nil
 }
@@ -14,8 +14,11 @@ import (
 	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/plumbing/msg"
 	"github.com/filecoin-project/go-filecoin/plumbing/mthdsig"
+	"github.com/filecoin-project/go-filecoin/porcelain"
 	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
 )
 
 var msgCmd = &cmds.Command{
@@ -24,8 +27,14 @@ var msgCmd = &cmds.Command{
 		Tagline: "Manage messages",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"send": msgSendCmd,
-		"wait": msgWaitCmd,
+		"cancel":             msgCancelCmd,
+		"estimate-gas-price": msgEstimateGasPriceCmd,
+		"query":              msgQueryCmd,
+		"replace":            msgReplaceCmd,
+		"replay":             msgReplayCmd,
+		"send":               msgSendCmd,
+		"status":             msgStatusCmd,
+		"wait":               msgWaitCmd,
 	},
 }
 
@@ -48,6 +57,7 @@ var msgSendCmd = &cmds.Command{
 		cmdkit.StringOption("from", "Address to send message from"),
 		priceOption,
 		limitOption,
+		gasLimitOption,
 		previewOption,
 		// TODO: (per dignifiedquire) add an option to set the nonce and method explicitly
 	},
@@ -72,7 +82,7 @@ var msgSendCmd = &cmds.Command{
 			}
 		}
 
-		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		gasPrice, gasLimit, autoGasLimit, preview, err := parseGasOptions(req, env)
 		if err != nil {
 			return err
 		}
@@ -106,6 +116,7 @@ var msgSendCmd = &cmds.Command{
 			types.NewAttoFILFromFIL(uint64(val)),
 			gasPrice,
 			gasLimit,
+			autoGasLimit,
 			method,
 		)
 		if err != nil {
@@ -220,6 +231,342 @@ var msgWaitCmd = &cmds.Command{
 	},
 }
 
+var msgEstimateGasPriceCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Suggest gas prices for new messages",
+		ShortDescription: `
+Suggests low, medium and high priority gas prices based on the prices paid by
+messages in recent blocks and by messages waiting in the message pool. Commands
+that take a --price option use the medium price when none is given.
+`,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		estimate, err := GetPorcelainAPI(env).MessageEstimateGasPrice(req.Context)
+		if err != nil {
+			return err
+		}
+		return re.Emit(estimate)
+	},
+	Type: porcelain.GasPriceEstimate{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, estimate *porcelain.GasPriceEstimate) error {
+			_, err := fmt.Fprintf(w, "low: %s\nmedium: %s\nhigh: %s\n", estimate.Low.String(), estimate.Medium.String(), estimate.High.String())
+			return err
+		}),
+	},
+}
+
+var replacePriceOption = cmdkit.StringOption("price", "Price (FIL e.g. 0.00013) to pay for each GasUnits consumed mining the replacement (defaults to the original price plus 10%)")
+
+var msgReplaceCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Replace a pending message with a higher gas price",
+		ShortDescription: `
+Re-sends a message that is waiting in the message pool with the same nonce and
+a higher gas price, so that miners prefer it over the original. Prints the CID
+of the replacement.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cid", true, false, "The CID of the pending message to replace"),
+	},
+	Options: []cmdkit.Option{
+		replacePriceOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		msgCid, err := cid.Parse(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid message cid")
+		}
+
+		gasPrice, err := optionalGasPrice(req.Options["price"])
+		if err != nil {
+			return err
+		}
+
+		c, err := GetPorcelainAPI(env).MessageReplace(req.Context, msgCid, gasPrice)
+		if err != nil {
+			return err
+		}
+		return re.Emit(c)
+	},
+	Type: cid.Cid{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, c cid.Cid) error {
+			return PrintString(w, c)
+		}),
+	},
+}
+
+var msgCancelCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Cancel a pending message",
+		ShortDescription: `
+Replaces a message that is waiting in the message pool with a zero-value
+transfer from its sender to itself with the same nonce and a higher gas price.
+Once the replacement is mined the original can no longer be. Prints the CID of
+the replacement.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cid", true, false, "The CID of the pending message to cancel"),
+	},
+	Options: []cmdkit.Option{
+		replacePriceOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		msgCid, err := cid.Parse(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid message cid")
+		}
+
+		gasPrice, err := optionalGasPrice(req.Options["price"])
+		if err != nil {
+			return err
+		}
+
+		c, err := GetPorcelainAPI(env).MessageCancel(req.Context, msgCid, gasPrice)
+		if err != nil {
+			return err
+		}
+		return re.Emit(c)
+	},
+	Type: cid.Cid{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, c cid.Cid) error {
+			return PrintString(w, c)
+		}),
+	},
+}
+
+var msgQueryCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Call a method of an actor without sending a message",
+		ShortDescription: `
+Runs the method of the target actor against the state after the head, or the
+state selected with --at or --height, and prints its return values, one per
+line. Nothing is sent and the state is not changed.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("target", true, false, "Address of the actor to query"),
+		cmdkit.StringArg("method", true, false, "The method to call on the target actor"),
+	},
+	Options: append([]cmdkit.Option{
+		cmdkit.StringOption("from", "Address to query from"),
+	}, atOptions...),
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		target, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		var fromAddr address.Address
+		if o, ok := req.Options["from"].(string); ok {
+			fromAddr, err = address.NewFromString(o)
+			if err != nil {
+				return errors.Wrap(err, "invalid from address")
+			}
+		}
+
+		at, err := stateAt(req, env)
+		if err != nil {
+			return err
+		}
+
+		rets, sig, err := GetPorcelainAPI(env).MessageQueryAt(req.Context, at, fromAddr, target, req.Arguments[1])
+		if err != nil {
+			return err
+		}
+
+		var values []string
+		for i, ret := range rets {
+			if sig == nil || i >= len(sig.Return) {
+				return errors.Errorf("unexpected return value %d of %s", i, req.Arguments[1])
+			}
+			val, err := abi.Deserialize(ret, sig.Return[i])
+			if err != nil {
+				return errors.Wrap(err, "unable to deserialize return value")
+			}
+			values = append(values, val.String())
+		}
+		return re.Emit(values)
+	},
+	Type: []string{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, values []string) error {
+			for _, v := range values {
+				if _, err := fmt.Fprintln(w, v); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	},
+}
+
+var msgStatusCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show whether a message is pending or where it was mined",
+		ShortDescription: `
+Reports whether the message with the given CID is waiting in the message pool
+and, if it has been included in the chain, the tipset, block and position it
+was included at and its receipt. The receipt is only known without processing
+the tipset for messages mined in tipsets of a single block.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cid", true, false, "The CID of the message to look up"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		msgCid, err := cid.Parse(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid message cid")
+		}
+
+		status, err := GetPorcelainAPI(env).MessageStatus(req.Context, msgCid)
+		if err != nil {
+			return err
+		}
+		return re.Emit(status)
+	},
+	Type: porcelain.MessageStatusResponse{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, status *porcelain.MessageStatusResponse) error {
+			switch {
+			case status.Location != nil:
+				loc := status.Location
+				if _, err := fmt.Fprintf(w, "mined\nheight: %d\ntipset: %s\nblock: %s\nindex: %d\n", loc.Height, loc.TipSet.String(), loc.Block.String(), loc.Index); err != nil {
+					return err
+				}
+				if loc.Receipt == nil {
+					return nil
+				}
+				if _, err := fmt.Fprintf(w, "exit code: %d\n", loc.Receipt.ExitCode); err != nil {
+					return err
+				}
+				if loc.Receipt.GasAttoFIL != nil {
+					_, err := fmt.Fprintf(w, "gas charge: %s\n", loc.Receipt.GasAttoFIL.String())
+					return err
+				}
+				return nil
+			case status.InPool:
+				return PrintString(w, "pending")
+			default:
+				return PrintString(w, "unknown")
+			}
+		}),
+	},
+}
+
+var msgReplayCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Replay a mined message and show the trace of its execution",
+		ShortDescription: `
+Applies the message with the given CID again over the state it was applied to
+when the tipset including it was processed, and shows what happened in the VM:
+the messages actors sent, with their return values and exit codes, the gas
+charged and the actor storage read and written, as a tree. Use --enc=json for
+the full trace. The chain and its state are not changed.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cid", true, false, "The CID of the message to replay"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		msgCid, err := cid.Parse(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid message cid")
+		}
+
+		replay, err := GetPorcelainAPI(env).MessageReplay(req.Context, msgCid)
+		if err != nil {
+			return err
+		}
+		return re.Emit(replay)
+	},
+	Type: msg.Replay{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, replay *msg.Replay) error {
+			if replay.ApplyError != "" {
+				if _, err := fmt.Fprintf(w, "not applied: %s\n", replay.ApplyError); err != nil {
+					return err
+				}
+			}
+			if replay.Receipt != nil {
+				if _, err := fmt.Fprintf(w, "exit code: %d\ngas charge: %s\n", replay.Receipt.ExitCode, replay.Receipt.GasAttoFIL.String()); err != nil {
+					return err
+				}
+			}
+			if replay.ExecutionError != "" {
+				if _, err := fmt.Fprintf(w, "error: %s\n", replay.ExecutionError); err != nil {
+					return err
+				}
+			}
+			return printTrace(w, replay.Trace, "")
+		}),
+	},
+}
+
+// printTrace writes trace as a tree, each line prefixed with indent.
+func printTrace(w io.Writer, trace *vm.Trace, indent string) error {
+	if trace == nil {
+		return nil
+	}
+	line := fmt.Sprintf("%s%s -> %s", indent, trace.From.String(), trace.To.String())
+	if trace.Method != "" {
+		line += " " + trace.Method
+	}
+	line += fmt.Sprintf(" value %s exit %d", trace.Value.String(), trace.ExitCode)
+	if trace.Error != "" {
+		line += fmt.Sprintf(" (%s)", trace.Error)
+	}
+	if _, err := fmt.Fprintln(w, line); err != nil {
+		return err
+	}
+
+	indent += "  "
+	for _, event := range trace.Events {
+		if event.Kind == vm.TraceSend {
+			if err := printTrace(w, event.Call, indent); err != nil {
+				return err
+			}
+			continue
+		}
+
+		line := indent + string(event.Kind)
+		switch {
+		case event.Kind == vm.TraceCharge:
+			line += fmt.Sprintf(" %d", event.Gas)
+		case event.Address != nil:
+			line += " " + event.Address.String()
+		}
+		if event.Cid != nil {
+			line += " " + event.Cid.String()
+		}
+		if event.Error != "" {
+			line += fmt.Sprintf(" (%s)", event.Error)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// optionalGasPrice parses a gas price option given in FIL, returning nil if the
+// option was not given.
+func optionalGasPrice(opt interface{}) (*types.AttoFIL, error) {
+	if opt == nil {
+		return nil, nil
+	}
+	price, ok := types.NewAttoFILFromFILString(opt.(string))
+	if !ok {
+		return nil, errors.New("invalid gas price (specify FIL as a decimal number)")
+	}
+	return price, nil
+}
+
 func appendJSON(val interface{}, out []byte) ([]byte, error) {
 	m, err := json.MarshalIndent(val, "", "\t")
 	if err != nil {
@@ -11,6 +11,7 @@ import (
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
 
 	"github.com/filecoin-project/go-filecoin/fixtures"
+	"github.com/filecoin-project/go-filecoin/porcelain"
 	th "github.com/filecoin-project/go-filecoin/testhelpers"
 	"github.com/filecoin-project/go-filecoin/types"
 )
@@ -57,6 +58,35 @@ func TestMessageSend(t *testing.T) {
 		"--value=10",
 		fixtures.TestAddresses[3],
 	)
+	t.Log("[success] with automatic gas limit")
+	d.RunSuccess("message", "send",
+		"--from", from,
+		"--price", "0",
+		"--gas-limit", "auto",
+		"--value=10",
+		fixtures.TestAddresses[3],
+	)
+
+	t.Log("[failure] with invalid gas limit")
+	d.RunFail(
+		"invalid gas limit",
+		"message", "send",
+		"--from", from,
+		"--price", "0",
+		"--gas-limit", "lots",
+		fixtures.TestAddresses[3],
+	)
+
+	t.Log("[failure] with both limit options")
+	d.RunFail(
+		"only one of limit and gas-limit",
+		"message", "send",
+		"--from", from,
+		"--price", "0",
+		"--limit", "300",
+		"--gas-limit", "auto",
+		fixtures.TestAddresses[3],
+	)
 }
 
 func TestMessageWait(t *testing.T) {
@@ -144,3 +174,176 @@ func TestMessageSendBlockGasLimit(t *testing.T) {
 		assert.NotEmpty(t, result.Messages, "msg under the block gas limit passes validation and is run in the block")
 	})
 }
+
+func TestMessageEstimateGasPrice(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d := th.NewDaemon(
+		t,
+		th.DefaultAddress(fixtures.TestAddresses[0]),
+		th.KeyFile(fixtures.KeyFilePaths()[1]),
+		th.WithMiner(fixtures.TestMiners[0]),
+		th.KeyFile(fixtures.KeyFilePaths()[0]),
+	).Start()
+	defer d.ShutdownSuccess()
+
+	t.Log("[success] estimate without any messages")
+	out := d.RunSuccess("message", "estimate-gas-price", "--enc=json").ReadStdoutTrimNewlines()
+	var estimate porcelain.GasPriceEstimate
+	require.NoError(json.Unmarshal([]byte(out), &estimate))
+	assert.Equal(0, estimate.Samples)
+	assert.True(estimate.Medium.Equal(porcelain.DefaultGasPrice))
+
+	t.Log("[success] send without a price uses the estimate")
+	c := d.RunSuccess("message", "send",
+		"--from", d.GetDefaultAddress(),
+		"--limit", "300",
+		fixtures.TestAddresses[3],
+	).ReadStdoutTrimNewlines()
+	show := d.RunSuccess("mpool", "show", c).ReadStdout()
+	assert.Contains(show, "Gas price: "+porcelain.DefaultGasPrice.String())
+}
+
+func TestMessageReplaceAndCancel(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	orig := d.RunSuccess("message", "send",
+		"--from", fixtures.TestAddresses[0],
+		"--price", "0", "--limit", "300",
+		"--value=10",
+		fixtures.TestAddresses[1],
+	).ReadStdoutTrimNewlines()
+
+	t.Log("[failure] replacement must raise the price")
+	d.RunFail("gas price must be higher", "message", "replace", orig, "--price", "0")
+
+	t.Log("[success] replace supersedes the original")
+	replacement := d.RunSuccess("message", "replace", orig, "--price", "0.0001").ReadStdoutTrimNewlines()
+	pending := d.RunSuccess("mpool", "ls").ReadStdout()
+	assert.NotContains(pending, orig)
+	assert.Contains(pending, replacement)
+
+	t.Log("[success] cancel supersedes the replacement")
+	cancel := d.RunSuccess("message", "cancel", replacement).ReadStdoutTrimNewlines()
+	pending = d.RunSuccess("mpool", "ls").ReadStdout()
+	assert.NotContains(pending, replacement)
+	assert.Contains(pending, cancel)
+
+	t.Log("[success] cancellation is mined")
+	d.RunSuccess("mining", "once")
+	d.RunSuccess("message", "wait", "--return=false", cancel)
+
+	t.Log("[failure] mined message cannot be replaced")
+	d.RunFail("not pending", "message", "cancel", cancel)
+}
+
+func TestMessageStatus(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	msgCid := d.RunSuccess("message", "send",
+		"--from", fixtures.TestAddresses[0],
+		"--price", "0", "--limit", "300",
+		"--value=10",
+		fixtures.TestAddresses[1],
+	).ReadStdoutTrimNewlines()
+
+	t.Log("[success] unmined message is pending")
+	status := d.RunSuccess("message", "status", msgCid).ReadStdoutTrimNewlines()
+	assert.Equal("pending", status)
+
+	t.Log("[success] mined message reports its location")
+	d.RunSuccess("mining", "once")
+	d.RunSuccess("message", "wait", "--return=false", msgCid)
+	status = d.RunSuccess("message", "status", msgCid).ReadStdout()
+	assert.Contains(status, "mined")
+	assert.Contains(status, "exit code: 0")
+
+	t.Log("[success] unknown message")
+	status = d.RunSuccess("message", "status", types.SomeCid().String()).ReadStdoutTrimNewlines()
+	assert.Equal("unknown", status)
+
+	t.Log("[failure] invalid cid")
+	d.RunFail("invalid message cid", "message", "status", "notacid")
+}
+
+func TestMessageReplay(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	msgCid := d.RunSuccess("message", "send",
+		"--from", fixtures.TestAddresses[0],
+		"--price", "0", "--limit", "300",
+		"--value=10",
+		fixtures.TestAddresses[1],
+	).ReadStdoutTrimNewlines()
+
+	t.Log("[failure] unmined message")
+	d.RunFail("not in the chain", "message", "replay", msgCid)
+
+	d.RunSuccess("mining", "once")
+	d.RunSuccess("message", "wait", "--return=false", msgCid)
+
+	t.Log("[success] json trace of the message")
+	out := d.RunSuccess("message", "replay", "--enc=json", msgCid).ReadStdout()
+	var replay struct {
+		Receipt struct {
+			ExitCode uint8 `json:"exitCode"`
+		} `json:"receipt"`
+		Trace struct {
+			From  string `json:"from"`
+			To    string `json:"to"`
+			Value string `json:"value"`
+		} `json:"trace"`
+	}
+	require.NoError(json.Unmarshal([]byte(out), &replay))
+	assert.Equal(uint8(0), replay.Receipt.ExitCode)
+	assert.Equal(fixtures.TestAddresses[0], replay.Trace.From)
+	assert.Equal(fixtures.TestAddresses[1], replay.Trace.To)
+	assert.Equal("10", replay.Trace.Value)
+
+	t.Log("[success] tree of the message")
+	tree := d.RunSuccess("message", "replay", msgCid).ReadStdout()
+	assert.Contains(tree, "exit code: 0")
+	assert.Contains(tree, fixtures.TestAddresses[0]+" -> "+fixtures.TestAddresses[1])
+
+	t.Log("[failure] invalid cid")
+	d.RunFail("invalid message cid", "message", "replay", "notacid")
+}
+
+func TestMessageQuery(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	d.RunSuccess("mining", "once")
+
+	t.Log("[success] query at the head")
+	owner := d.RunSuccess("message", "query", fixtures.TestMiners[0], "getOwner").ReadStdoutTrimNewlines()
+	assert.Equal(fixtures.TestAddresses[0], owner)
+
+	t.Log("[success] query at a height")
+	owner = d.RunSuccess("message", "query", "--height", "0", fixtures.TestMiners[0], "getOwner").ReadStdoutTrimNewlines()
+	assert.Equal(fixtures.TestAddresses[0], owner)
+
+	t.Log("[failure] unknown method")
+	d.RunFail("unable to determine return type", "message", "query", fixtures.TestMiners[0], "notamethod")
+
+	t.Log("[failure] both --at and --height")
+	d.RunFail("only one of --at and --height", "message", "query", "--at", types.SomeCid().String(), "--height", "0", fixtures.TestMiners[0], "getOwner")
+}
@@ -12,6 +12,7 @@ import (
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 
+	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/porcelain"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -24,11 +25,16 @@ var minerCmd = &cmds.Command{
 	Subcommands: map[string]*cmds.Command{
 		"create":        minerCreateCmd,
 		"add-ask":       minerAddAskCmd,
+		"change-owner":  minerChangeOwnerCmd,
+		"change-worker": minerChangeWorkerCmd,
+		"collateral":    minerCollateralCmd,
 		"owner":         minerOwnerCmd,
 		"pledge":        minerPledgeCmd,
 		"power":         minerPowerCmd,
 		"set-price":     minerSetPriceCmd,
+		"slash":         minerSlashCmd,
 		"update-peerid": minerUpdatePeerIDCmd,
+		"worker":        minerWorkerCmd,
 	},
 }
 
@@ -40,6 +46,7 @@ var minerPledgeCmd = &cmds.Command{
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("miner", true, false, "The miner address"),
 	},
+	Options: atOptions,
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		var err error
 
@@ -47,9 +54,14 @@ var minerPledgeCmd = &cmds.Command{
 		if err != nil {
 			return err
 		}
+		at, err := stateAt(req, env)
+		if err != nil {
+			return err
+		}
 
-		bytes, _, err := GetPorcelainAPI(env).MessageQuery(
+		bytes, _, err := GetPorcelainAPI(env).MessageQueryAt(
 			req.Context,
+			at,
 			address.Address{},
 			minerAddr,
 			"getPledge",
@@ -88,6 +100,7 @@ Collateral must be greater than 0.001 FIL per pledged sector.`,
 		cmdkit.StringOption("peerid", "Base58-encoded libp2p peer ID that the miner will operate"),
 		priceOption,
 		limitOption,
+		gasLimitOption,
 		previewOption,
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
@@ -117,12 +130,12 @@ Collateral must be greater than 0.001 FIL per pledged sector.`,
 			return ErrInvalidCollateral
 		}
 
-		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		gasPrice, gasLimit, autoGasLimit, preview, err := parseGasOptions(req, env)
 		if err != nil {
 			return err
 		}
 
-		if preview {
+		if preview || autoGasLimit {
 			usedGas, err := GetPorcelainAPI(env).MinerPreviewCreate(
 				req.Context,
 				fromAddr,
@@ -133,11 +146,21 @@ Collateral must be greater than 0.001 FIL per pledged sector.`,
 			if err != nil {
 				return err
 			}
-			return re.Emit(&MinerCreateResult{
-				Address: address.Address{},
-				GasUsed: usedGas,
-				Preview: true,
-			})
+			if preview {
+				return re.Emit(&MinerCreateResult{
+					Address: address.Address{},
+					GasUsed: usedGas,
+					Preview: true,
+				})
+			}
+
+			// Miner creation doesn't go through MessageSendWithDefaultAddress so
+			// apply the margin here.
+			margin, err := porcelain.GasLimitMargin(GetPorcelainAPI(env))
+			if err != nil {
+				return err
+			}
+			gasLimit = porcelain.GasLimitWithMargin(usedGas, margin)
 		}
 
 		addr, err := GetAPI(env).Miner().Create(req.Context, fromAddr, gasPrice, gasLimit, pledge, pid, collateral)
@@ -185,6 +208,7 @@ This command waits for the ask to be mined.`,
 		cmdkit.StringOption("miner", "The address of the miner owning the ask"),
 		priceOption,
 		limitOption,
+		gasLimitOption,
 		previewOption,
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
@@ -211,7 +235,7 @@ This command waits for the ask to be mined.`,
 			return fmt.Errorf("expiry must be a valid integer")
 		}
 
-		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		gasPrice, gasLimit, autoGasLimit, preview, err := parseGasOptions(req, env)
 		if err != nil {
 			return err
 		}
@@ -239,6 +263,7 @@ This command waits for the ask to be mined.`,
 			minerAddr,
 			gasPrice,
 			gasLimit,
+			autoGasLimit,
 			price,
 			expiry)
 		if err != nil {
@@ -292,6 +317,7 @@ var minerUpdatePeerIDCmd = &cmds.Command{
 		cmdkit.StringOption("from", "Address to send from"),
 		priceOption,
 		limitOption,
+		gasLimitOption,
 		previewOption,
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
@@ -310,7 +336,7 @@ var minerUpdatePeerIDCmd = &cmds.Command{
 			return err
 		}
 
-		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		gasPrice, gasLimit, autoGasLimit, preview, err := parseGasOptions(req, env)
 		if err != nil {
 			return err
 		}
@@ -341,6 +367,7 @@ var minerUpdatePeerIDCmd = &cmds.Command{
 			nil,
 			gasPrice,
 			gasLimit,
+			autoGasLimit,
 			"updatePeerID",
 			newPid,
 		)
@@ -367,6 +394,324 @@ var minerUpdatePeerIDCmd = &cmds.Command{
 	},
 }
 
+var minerSlashCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Slash a miner that missed its PoSt",
+		ShortDescription: `Issues a new message to the network to slash a miner that has not submitted
+the PoSt of its proving period by the end of the grace period. Its collateral
+is forfeited and its power is zeroed. Anyone can slash a miner; the message
+fails if the miner is not late.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("address", true, false, "Address of the miner to slash"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("from", "Address to send from"),
+		priceOption,
+		limitOption,
+		gasLimitOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		fromAddr, err := optionalAddr(req.Options["from"])
+		if err != nil {
+			return err
+		}
+
+		gasPrice, gasLimit, autoGasLimit, _, err := parseGasOptions(req, env)
+		if err != nil {
+			return err
+		}
+
+		c, err := GetPorcelainAPI(env).MessageSendWithDefaultAddress(
+			req.Context,
+			fromAddr,
+			minerAddr,
+			nil,
+			gasPrice,
+			gasLimit,
+			autoGasLimit,
+			"slashStorageFault",
+		)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(c)
+	},
+	Type: cid.Cid{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, c cid.Cid) error {
+			return PrintString(w, c)
+		}),
+	},
+}
+
+var minerChangeOwnerCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Change the owner of a miner",
+		ShortDescription: `Issues a new message to the network to make <address> the owner of <miner>.
+The change takes effect after a delay, until which the current owner stays in
+control of the miner. Only the owner of the miner can change its owner.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("miner", true, false, "Address of the miner"),
+		cmdkit.StringArg("address", true, false, "Address of the new owner"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("from", "Address to send from, the owner of the miner"),
+		priceOption,
+		limitOption,
+		gasLimitOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		return sendKeyChangeMessage(req, re, env, "changeOwner")
+	},
+	Type: cid.Cid{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, c cid.Cid) error {
+			return PrintString(w, c)
+		}),
+	},
+}
+
+var minerChangeWorkerCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Change the worker of a miner",
+		ShortDescription: `Issues a new message to the network to make <address> the worker of <miner>,
+which commits sectors and submits PoSts for the miner. The change takes effect
+after a delay. Only the owner of the miner can change its worker.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("miner", true, false, "Address of the miner"),
+		cmdkit.StringArg("address", true, false, "Address of the new worker"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("from", "Address to send from, the owner of the miner"),
+		priceOption,
+		limitOption,
+		gasLimitOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		return sendKeyChangeMessage(req, re, env, "changeWorker")
+	},
+	Type: cid.Cid{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, c cid.Cid) error {
+			return PrintString(w, c)
+		}),
+	},
+}
+
+// sendKeyChangeMessage sends the changeOwner or changeWorker message for the
+// miner and address arguments of req, and emits its cid.
+func sendKeyChangeMessage(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment, method string) error {
+	minerAddr, err := address.NewFromString(req.Arguments[0])
+	if err != nil {
+		return err
+	}
+
+	addr, err := address.NewFromString(req.Arguments[1])
+	if err != nil {
+		return err
+	}
+
+	fromAddr, err := optionalAddr(req.Options["from"])
+	if err != nil {
+		return err
+	}
+
+	gasPrice, gasLimit, autoGasLimit, _, err := parseGasOptions(req, env)
+	if err != nil {
+		return err
+	}
+
+	c, err := GetPorcelainAPI(env).MessageSendWithDefaultAddress(
+		req.Context,
+		fromAddr,
+		minerAddr,
+		nil,
+		gasPrice,
+		gasLimit,
+		autoGasLimit,
+		method,
+		addr,
+	)
+	if err != nil {
+		return err
+	}
+
+	return re.Emit(c)
+}
+
+var minerCollateralCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Manage the collateral of a miner",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"add":      minerCollateralAddCmd,
+		"withdraw": minerCollateralWithdrawCmd,
+		"show":     minerCollateralShowCmd,
+	},
+}
+
+var minerCollateralAddCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline:          "Add collateral to a miner",
+		ShortDescription: `Issues a new message to the network to add <amount> FIL to the collateral of <miner>.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("miner", true, false, "Address of the miner"),
+		cmdkit.StringArg("amount", true, false, "Amount of FIL to add"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("from", "Address to send from"),
+		priceOption,
+		limitOption,
+		gasLimitOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		return sendCollateralMessage(req, re, env, "addCollateral")
+	},
+	Type: cid.Cid{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, c cid.Cid) error {
+			return PrintString(w, c)
+		}),
+	},
+}
+
+var minerCollateralWithdrawCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Withdraw collateral from a miner",
+		ShortDescription: `Issues a new message to the network to send <amount> FIL of the collateral of
+<miner> to its owner. Only collateral above the minimum required for the
+committed sectors of the miner can be withdrawn, see 'miner collateral show'.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("miner", true, false, "Address of the miner"),
+		cmdkit.StringArg("amount", true, false, "Amount of FIL to withdraw"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("from", "Address to send from, the owner of the miner"),
+		priceOption,
+		limitOption,
+		gasLimitOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		return sendCollateralMessage(req, re, env, "withdrawCollateral")
+	},
+	Type: cid.Cid{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, c cid.Cid) error {
+			return PrintString(w, c)
+		}),
+	},
+}
+
+// sendCollateralMessage sends the addCollateral or withdrawCollateral message
+// for the miner and amount arguments of req, and emits its cid.
+func sendCollateralMessage(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment, method string) error {
+	minerAddr, err := address.NewFromString(req.Arguments[0])
+	if err != nil {
+		return err
+	}
+
+	amount, ok := types.NewAttoFILFromFILString(req.Arguments[1])
+	if !ok {
+		return ErrInvalidAmount
+	}
+
+	fromAddr, err := optionalAddr(req.Options["from"])
+	if err != nil {
+		return err
+	}
+
+	gasPrice, gasLimit, autoGasLimit, _, err := parseGasOptions(req, env)
+	if err != nil {
+		return err
+	}
+
+	// collateral is added with the value of the message, and withdrawn with
+	// the amount as a parameter
+	value := amount
+	params := []interface{}{}
+	if method == "withdrawCollateral" {
+		value = nil
+		params = append(params, amount)
+	}
+
+	c, err := GetPorcelainAPI(env).MessageSendWithDefaultAddress(
+		req.Context,
+		fromAddr,
+		minerAddr,
+		value,
+		gasPrice,
+		gasLimit,
+		autoGasLimit,
+		method,
+		params...,
+	)
+	if err != nil {
+		return err
+	}
+
+	return re.Emit(c)
+}
+
+type minerCollateralShowResult struct {
+	Collateral   *types.AttoFIL `json:"collateral"`
+	Required     *types.AttoFIL `json:"required"`
+	Withdrawable *types.AttoFIL `json:"withdrawable"`
+}
+
+var minerCollateralShowCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the collateral of a miner",
+		ShortDescription: `Shows the collateral of <miner>, the minimum required for its committed
+sectors, and the amount above it that its owner can withdraw.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("miner", true, false, "Address of the miner"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		view, err := GetPorcelainAPI(env).ActorShow(req.Context, minerAddr, types.SortedCidSet{})
+		if err != nil {
+			return err
+		}
+		state, ok := view.State.(*miner.State)
+		if !ok {
+			return fmt.Errorf("%s is not a miner", minerAddr.String())
+		}
+
+		return re.Emit(&minerCollateralShowResult{
+			Collateral:   state.Collateral,
+			Required:     miner.MinimumCollateral(big.NewInt(int64(len(state.SectorCommitments)))),
+			Withdrawable: miner.UnencumberedCollateral(state),
+		})
+	},
+	Type: minerCollateralShowResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *minerCollateralShowResult) error {
+			_, err := fmt.Fprintf(w, "collateral: %s FIL\nrequired: %s FIL\nwithdrawable: %s FIL\n",
+				res.Collateral.String(),
+				res.Required.String(),
+				res.Withdrawable.String(),
+			)
+			return err
+		}),
+	},
+}
+
 type minerAddAskResult struct {
 	Cid     cid.Cid
 	GasUsed types.GasUnits
@@ -386,6 +731,7 @@ var minerAddAskCmd = &cmds.Command{
 		cmdkit.StringOption("from", "Address to send the ask from"),
 		priceOption,
 		limitOption,
+		gasLimitOption,
 		previewOption,
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
@@ -409,7 +755,7 @@ var minerAddAskCmd = &cmds.Command{
 			return fmt.Errorf("expiry must be a valid integer")
 		}
 
-		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		gasPrice, gasLimit, autoGasLimit, preview, err := parseGasOptions(req, env)
 		if err != nil {
 			return err
 		}
@@ -440,6 +786,7 @@ var minerAddAskCmd = &cmds.Command{
 			nil,
 			gasPrice,
 			gasLimit,
+			autoGasLimit,
 			"addAsk",
 			price,
 			expiry,
@@ -476,9 +823,14 @@ var minerOwnerCmd = &cmds.Command{
 		if err != nil {
 			return err
 		}
+		at, err := stateAt(req, env)
+		if err != nil {
+			return err
+		}
 
-		bytes, _, err := GetPorcelainAPI(env).MessageQuery(
+		bytes, _, err := GetPorcelainAPI(env).MessageQueryAt(
 			req.Context,
+			at,
 			address.Address{},
 			minerAddr,
 			"getOwner",
@@ -496,7 +848,53 @@ var minerOwnerCmd = &cmds.Command{
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("miner", true, false, "The address of the miner"),
 	},
-	Type: address.Address{},
+	Options: atOptions,
+	Type:    address.Address{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, a *address.Address) error {
+			return PrintString(w, a)
+		}),
+	},
+}
+
+var minerWorkerCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the worker address of <miner>",
+		ShortDescription: `Given <miner> miner address, output the address of the worker that commits
+sectors and submits PoSts for the miner on behalf of its owner.`,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := optionalAddr(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		at, err := stateAt(req, env)
+		if err != nil {
+			return err
+		}
+
+		bytes, _, err := GetPorcelainAPI(env).MessageQueryAt(
+			req.Context,
+			at,
+			address.Address{},
+			minerAddr,
+			"getWorker",
+		)
+		if err != nil {
+			return err
+		}
+		workerAddr, err := address.NewFromBytes(bytes[0])
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(&workerAddr)
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("miner", true, false, "The address of the miner"),
+	},
+	Options: atOptions,
+	Type:    address.Address{},
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, a *address.Address) error {
 			return PrintString(w, a)
@@ -515,9 +913,14 @@ Values will be output as a ratio where the first number is the miner power and s
 		if err != nil {
 			return err
 		}
+		at, err := stateAt(req, env)
+		if err != nil {
+			return err
+		}
 
-		bytes, _, err := GetPorcelainAPI(env).MessageQuery(
+		bytes, _, err := GetPorcelainAPI(env).MessageQueryAt(
 			req.Context,
+			at,
 			address.Address{},
 			minerAddr,
 			"getPower",
@@ -527,8 +930,9 @@ Values will be output as a ratio where the first number is the miner power and s
 		}
 		power := big.NewInt(0).SetBytes(bytes[0])
 
-		bytes, _, err = GetPorcelainAPI(env).MessageQuery(
+		bytes, _, err = GetPorcelainAPI(env).MessageQueryAt(
 			req.Context,
+			at,
 			address.Address{},
 			address.StorageMarketAddress,
 			"getTotalStorage",
@@ -544,6 +948,7 @@ Values will be output as a ratio where the first number is the miner power and s
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("miner", true, false, "The address of the miner"),
 	},
+	Options: atOptions,
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, a string) error {
 			_, err := fmt.Fprintln(w, a)
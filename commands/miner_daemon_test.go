@@ -36,12 +36,17 @@ func TestMinerHelp(t *testing.T) {
 
 		expected := []string{
 			"miner add-ask <miner> <price> <expiry>  - DEPRECATED: Use set-price",
+			"miner change-owner <miner> <address>    - Change the owner of a miner",
+			"miner change-worker <miner> <address>   - Change the worker of a miner",
+			"miner collateral                        - Manage the collateral of a miner",
 			"miner create <pledge> <collateral>      - Create a new file miner with <pledge> sectors and <collateral> FIL",
 			"miner owner <miner>                     - Show the actor address of <miner>",
 			"miner pledge <miner>                    - View number of pledged sectors for <miner>",
 			"miner power <miner>                     - Get the power of a miner versus the total storage market power",
 			"miner set-price <storageprice> <expiry> - Set the minimum price for storage",
+			"miner slash <address>                   - Slash a miner that missed its PoSt",
 			"miner update-peerid <address> <peerid>  - Change the libp2p identity that a miner is operating",
+			"miner worker <miner>                    - Show the worker address of <miner>",
 		}
 
 		result := runHelpSuccess(t, "miner", "--help")
@@ -306,6 +311,10 @@ func TestMinerSetPrice(t *testing.T) {
 	configuredPrice := d1.RunSuccess("config", "mining.storagePrice")
 
 	assert.Equal(`"62"`, configuredPrice.ReadStdoutTrimNewlines())
+
+	// The addAsk message runs actor code, so its gas limit is previewed.
+	setPrice = d1.RunSuccess("miner", "set-price", "63", "6", "--price", "0", "--gas-limit", "auto")
+	assert.Contains(setPrice.ReadStdoutTrimNewlines(), fmt.Sprintf("Set price for miner %s to 63.", fixtures.TestMiners[0]))
 }
 
 func TestMinerAddAskSuccess(t *testing.T) {
@@ -508,6 +517,14 @@ func TestMinerPower(t *testing.T) {
 
 	assert.NoError(err)
 	assert.Equal("3 / 6", power)
+
+	// the power at genesis can be queried by height or by tipset
+	assert.Equal("3 / 6", d.RunSuccess("miner", "power", addressStruct.Address, "--height", "0").ReadStdoutTrimNewlines())
+	var genesis []types.Block
+	require.NoError(t, json.Unmarshal([]byte(d.RunSuccess("chain", "head", "--enc", "json").ReadStdoutTrimNewlines()), &genesis))
+	require.Len(t, genesis, 1)
+	assert.Equal("3 / 6", d.RunSuccess("miner", "power", addressStruct.Address, "--at", genesis[0].Cid().String()).ReadStdoutTrimNewlines())
+	d.RunFail("only one of --at and --height", "miner", "power", addressStruct.Address, "--at", genesis[0].Cid().String(), "--height", "0")
 }
 
 var testConfig = &gengen.GenesisCfg{
@@ -527,3 +544,104 @@ var testConfig = &gengen.GenesisCfg{
 		},
 	},
 }
+
+func TestMinerSlash(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	t.Log("[failure] a miner that is not late cannot be slashed")
+	msgCid := d.RunSuccess("miner", "slash",
+		"--from", fixtures.TestAddresses[0],
+		"--price", "0", "--limit", "300",
+		fixtures.TestMiners[0],
+	).ReadStdoutTrimNewlines()
+
+	d.RunSuccess("mining", "once")
+	d.RunSuccess("message", "wait", "--return=false", msgCid)
+	status := d.RunSuccess("message", "status", msgCid).ReadStdout()
+	assert.Contains(status, "exit code: 43")
+
+	t.Log("[failure] invalid miner address")
+	d.RunFail("invalid checksum", "miner", "slash", "--from", fixtures.TestAddresses[0], "xyz")
+}
+
+func TestMinerCollateral(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	show := func() (collateral, withdrawable *types.AttoFIL) {
+		var res struct {
+			Collateral   *types.AttoFIL `json:"collateral"`
+			Withdrawable *types.AttoFIL `json:"withdrawable"`
+		}
+		out := d.RunSuccess("miner", "collateral", "show", "--enc=json", fixtures.TestMiners[0]).ReadStdout()
+		require.NoError(json.Unmarshal([]byte(out), &res))
+		return res.Collateral, res.Withdrawable
+	}
+	before, _ := show()
+
+	t.Log("[success] add collateral")
+	msgCid := d.RunSuccess("miner", "collateral", "add",
+		"--from", fixtures.TestAddresses[0],
+		"--price", "0", "--limit", "300",
+		fixtures.TestMiners[0], "10",
+	).ReadStdoutTrimNewlines()
+	d.RunSuccess("mining", "once")
+	d.RunSuccess("message", "wait", "--return=false", msgCid)
+
+	collateral, withdrawable := show()
+	assert.True(before.Add(types.NewAttoFILFromFIL(10)).Equal(collateral))
+	assert.True(withdrawable.GreaterEqual(types.NewAttoFILFromFIL(10)))
+
+	t.Log("[success] withdraw collateral")
+	msgCid = d.RunSuccess("miner", "collateral", "withdraw",
+		"--from", fixtures.TestAddresses[0],
+		"--price", "0", "--limit", "300",
+		fixtures.TestMiners[0], "5",
+	).ReadStdoutTrimNewlines()
+	d.RunSuccess("mining", "once")
+	d.RunSuccess("message", "wait", "--return=false", msgCid)
+
+	collateral, _ = show()
+	assert.True(before.Add(types.NewAttoFILFromFIL(5)).Equal(collateral))
+
+	t.Log("[failure] invalid amount")
+	d.RunFail("invalid amount", "miner", "collateral", "add", fixtures.TestMiners[0], "notanamount")
+}
+
+func TestMinerWorker(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	t.Log("[success] the worker of a new miner is its owner")
+	worker := d.RunSuccess("miner", "worker", fixtures.TestMiners[0]).ReadStdoutTrimNewlines()
+	assert.Equal(fixtures.TestAddresses[0], worker)
+
+	t.Log("[success] the owner changes the worker after a delay")
+	msgCid := d.RunSuccess("miner", "change-worker",
+		"--from", fixtures.TestAddresses[0],
+		"--price", "0", "--limit", "300",
+		fixtures.TestMiners[0], fixtures.TestAddresses[1],
+	).ReadStdoutTrimNewlines()
+
+	d.RunSuccess("mining", "once")
+	d.RunSuccess("message", "wait", "--return=false", msgCid)
+	status := d.RunSuccess("message", "status", msgCid).ReadStdout()
+	assert.Contains(status, "exit code: 0")
+
+	worker = d.RunSuccess("miner", "worker", fixtures.TestMiners[0]).ReadStdoutTrimNewlines()
+	assert.Equal(fixtures.TestAddresses[0], worker)
+
+	t.Log("[failure] invalid worker address")
+	d.RunFail("invalid checksum", "miner", "change-worker", "--from", fixtures.TestAddresses[0], fixtures.TestMiners[0], "xyz")
+}
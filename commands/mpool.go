@@ -11,6 +11,7 @@ import (
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 
+	"github.com/filecoin-project/go-filecoin/core"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -19,9 +20,10 @@ var mpoolCmd = &cmds.Command{
 		Tagline: "Manage the message pool",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"ls":   mpoolLsCmd,
-		"show": mpoolShowCmd,
-		"rm":   mpoolRemoveCmd,
+		"ls":     mpoolLsCmd,
+		"show":   mpoolShowCmd,
+		"rm":     mpoolRemoveCmd,
+		"status": mpoolStatusCmd,
 	},
 }
 
@@ -105,6 +107,52 @@ Signature: %s
 	},
 }
 
+var mpoolStatusCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show why outstanding messages have not been mined",
+		ShortDescription: `
+Lists the messages in the pool with the block height at which each was first
+seen, how many times this node has rebroadcast it, and why it is still pending.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption("local", "Only show messages sent from this node"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		localOnly, _ := req.Options["local"].(bool)
+
+		var statuses []core.MessageStatus
+		for _, status := range GetPorcelainAPI(env).MessagePoolStatus() {
+			if localOnly && !status.Local {
+				continue
+			}
+			statuses = append(statuses, status)
+		}
+
+		return re.Emit(statuses)
+	},
+	Type: []core.MessageStatus{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, statuses *[]core.MessageStatus) error {
+			for _, status := range *statuses {
+				_, err := fmt.Fprintf(w, "%s\tfrom: %s\tnonce: %d\tlocal: %t\tfirst seen: %d\trebroadcasts: %d\t%s\n",
+					status.Cid,
+					status.Message.From,
+					status.Message.Nonce,
+					status.Local,
+					status.AddedHeight,
+					status.Rebroadcasts,
+					status.Reason,
+				)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	},
+}
+
 var mpoolRemoveCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Delete a message from the message pool",
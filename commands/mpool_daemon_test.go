@@ -126,6 +126,23 @@ func TestMpoolRm(t *testing.T) {
 	})
 }
 
+func TestMpoolStatus(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	d := th.NewDaemon(t, th.KeyFile(fixtures.KeyFilePaths()[0])).Start()
+	defer d.ShutdownSuccess()
+
+	msgCid := sendMessage(d, fixtures.TestAddresses[0], fixtures.TestAddresses[2]).ReadStdoutTrimNewlines()
+
+	out := d.RunSuccess("mpool", "status", "--local").ReadStdoutTrimNewlines()
+	assert.Contains(out, msgCid)
+	assert.Contains(out, "from: "+fixtures.TestAddresses[0])
+	assert.Contains(out, "local: true")
+	assert.Contains(out, "rebroadcasts: 0")
+	assert.Contains(out, "awaiting inclusion in a block")
+}
+
 func sendMessage(d *th.TestDaemon, from string, to string) *th.Output {
 	return d.RunSuccess("message", "send",
 		"--from", from,
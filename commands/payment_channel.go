@@ -52,6 +52,7 @@ message to be mined to get the channelID.`,
 		cmdkit.StringOption("from", "Address to send from"),
 		priceOption,
 		limitOption,
+		gasLimitOption,
 		previewOption,
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
@@ -75,7 +76,7 @@ message to be mined to get the channelID.`,
 			return ErrInvalidBlockHeight
 		}
 
-		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		gasPrice, gasLimit, autoGasLimit, preview, err := parseGasOptions(req, env)
 		if err != nil {
 			return err
 		}
@@ -105,6 +106,7 @@ message to be mined to get the channelID.`,
 			amount,
 			gasPrice,
 			gasLimit,
+			autoGasLimit,
 			"createChannel",
 			target,
 			eol,
@@ -250,6 +252,7 @@ var redeemCmd = &cmds.Command{
 		cmdkit.StringOption("from", "Address of the channel target"),
 		priceOption,
 		limitOption,
+		gasLimitOption,
 		previewOption,
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
@@ -258,7 +261,7 @@ var redeemCmd = &cmds.Command{
 			return err
 		}
 
-		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		gasPrice, gasLimit, autoGasLimit, preview, err := parseGasOptions(req, env)
 		if err != nil {
 			return err
 		}
@@ -304,6 +307,7 @@ var redeemCmd = &cmds.Command{
 			types.NewAttoFILFromFIL(0),
 			gasPrice,
 			gasLimit,
+			autoGasLimit,
 			"redeem",
 			voucher.Payer, &voucher.Channel, &voucher.Amount, &voucher.ValidAt, []byte(voucher.Signature),
 		)
@@ -347,6 +351,7 @@ var reclaimCmd = &cmds.Command{
 		cmdkit.StringOption("from", "Address of the channel creator"),
 		priceOption,
 		limitOption,
+		gasLimitOption,
 		previewOption,
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
@@ -360,7 +365,7 @@ var reclaimCmd = &cmds.Command{
 			return fmt.Errorf("invalid channel id")
 		}
 
-		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		gasPrice, gasLimit, autoGasLimit, preview, err := parseGasOptions(req, env)
 		if err != nil {
 			return err
 		}
@@ -390,6 +395,7 @@ var reclaimCmd = &cmds.Command{
 			types.NewAttoFILFromFIL(0),
 			gasPrice,
 			gasLimit,
+			autoGasLimit,
 			"reclaim",
 			channel,
 		)
@@ -433,6 +439,7 @@ var closeCmd = &cmds.Command{
 		cmdkit.StringOption("from", "Address of the channel target"),
 		priceOption,
 		limitOption,
+		gasLimitOption,
 		previewOption,
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
@@ -441,7 +448,7 @@ var closeCmd = &cmds.Command{
 			return err
 		}
 
-		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		gasPrice, gasLimit, autoGasLimit, preview, err := parseGasOptions(req, env)
 		if err != nil {
 			return err
 		}
@@ -487,6 +494,7 @@ var closeCmd = &cmds.Command{
 			types.NewAttoFILFromFIL(0),
 			gasPrice,
 			gasLimit,
+			autoGasLimit,
 			"close",
 			voucher.Payer, &voucher.Channel, &voucher.Amount, &voucher.ValidAt, []byte(voucher.Signature),
 		)
@@ -532,6 +540,7 @@ var extendCmd = &cmds.Command{
 		cmdkit.StringOption("from", "Address of the channel creator"),
 		priceOption,
 		limitOption,
+		gasLimitOption,
 		previewOption,
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
@@ -555,7 +564,7 @@ var extendCmd = &cmds.Command{
 			return ErrInvalidBlockHeight
 		}
 
-		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		gasPrice, gasLimit, autoGasLimit, preview, err := parseGasOptions(req, env)
 		if err != nil {
 			return err
 		}
@@ -585,6 +594,7 @@ var extendCmd = &cmds.Command{
 			amount,
 			gasPrice,
 			gasLimit,
+			autoGasLimit,
 			"extend",
 			channel, eol,
 		)
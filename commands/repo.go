@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+
+	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
+	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+)
+
+var repoCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Manage the node's repo",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"gc": repoGCCmd,
+	},
+}
+
+var repoGCCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Delete old state from the repo",
+		ShortDescription: `
+Deletes the state trees and actor storage that are not reachable from the
+state of the last tipsets of the chain, of the genesis tipset or of the
+checkpoint. The number of tipsets is datastore.stateRetention unless given
+with --keep. Chain blocks and data that is not chain state, such as imported
+files, are kept. The daemon keeps running while the repo is collected; set
+datastore.gcPeriod to collect it in the background.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.Uint64Option("keep", "number of tipsets back from the head whose state is kept"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		keep, ok := req.Options["keep"].(uint64)
+		if !ok {
+			retention, err := GetPorcelainAPI(env).ConfigGet("datastore.stateRetention")
+			if err != nil {
+				return err
+			}
+			keep = retention.(uint64)
+		}
+
+		result, err := GetPorcelainAPI(env).RepoGC(req.Context, keep)
+		if err != nil {
+			return err
+		}
+		return re.Emit(result)
+	},
+	Type: chain.PruneResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, result *chain.PruneResult) error {
+			_, err := fmt.Fprintf(w, "removed %d blocks, kept %d blocks for the state of %d tipsets\n", result.Removed, result.Kept, result.RetainedTipSets)
+			return err
+		}),
+	},
+}
@@ -0,0 +1,28 @@
+package commands
+
+import (
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+)
+
+func TestRepoGC(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	d.RunSuccess("mining", "once")
+	d.RunSuccess("mining", "once")
+
+	out := d.RunSuccess("repo", "gc", "--keep", "1").ReadStdoutTrimNewlines()
+	assert.Contains(out, "for the state of 2 tipsets")
+
+	// the node keeps working on the retained state
+	d.RunSuccess("mining", "once")
+	d.RunSuccess("chain", "ls")
+
+	// without --keep the configured retention applies
+	d.RunSuccess("repo", "gc")
+}
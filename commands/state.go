@@ -0,0 +1,135 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+
+	"github.com/filecoin-project/go-filecoin/plumbing/stdiff"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+var stateCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Inspect the state of the chain",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"diff": stateDiffCmd,
+	},
+}
+
+var stateDiffCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the actors that differ between the states of two tipsets",
+		ShortDescription: `
+Compares the state after tipset <from> with the state after tipset <to> and
+lists the actors that were added, removed or changed, with the changes in
+their code, head, nonce and balance. A tipset is given as the comma separated
+CIDs of its blocks. With --storage, the storage of changed miner and payment
+broker actors is decoded and the fields that differ are shown.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("from", true, false, "CIDs of the blocks of the first tipset, separated by commas"),
+		cmdkit.StringArg("to", true, false, "CIDs of the blocks of the second tipset, separated by commas"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption("storage", "decode the storage of miner and payment broker actors"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		from, err := parseTipSetKey(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		to, err := parseTipSetKey(req.Arguments[1])
+		if err != nil {
+			return err
+		}
+		decodeStorage, _ := req.Options["storage"].(bool)
+
+		diff, err := GetPorcelainAPI(env).StateDiff(req.Context, from, to, decodeStorage)
+		if err != nil {
+			return err
+		}
+		return re.Emit(diff)
+	},
+	Type: stdiff.Diff{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, diff *stdiff.Diff) error {
+			for _, ad := range diff.Actors {
+				line := fmt.Sprintf("%-8s %s", ad.Change, ad.Address.String())
+				if len(ad.Fields) > 0 {
+					line += " " + strings.Join(ad.Fields, ",")
+				}
+				line += fmt.Sprintf(" balance %s nonce %+d", ad.BalanceDelta.String(), ad.NonceDelta)
+				if _, err := fmt.Fprintln(w, line); err != nil {
+					return err
+				}
+
+				for _, change := range ad.Storage {
+					before, err := json.Marshal(change.Before)
+					if err != nil {
+						return err
+					}
+					after, err := json.Marshal(change.After)
+					if err != nil {
+						return err
+					}
+					if _, err := fmt.Fprintf(w, "  %s: %s -> %s\n", change.Path, before, after); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}),
+	},
+}
+
+// parseTipSetKey parses a tipset key given as the comma separated CIDs of
+// its blocks.
+func parseTipSetKey(arg string) (types.SortedCidSet, error) {
+	var key types.SortedCidSet
+	for _, s := range strings.Split(arg, ",") {
+		c, err := cid.Decode(strings.TrimSpace(s))
+		if err != nil {
+			return types.SortedCidSet{}, errors.Wrapf(err, "invalid block cid %s", s)
+		}
+		key.Add(c)
+	}
+	return key, nil
+}
+
+// atOptions select the state a command reads: the state after the tipset
+// given with --at, the state of the chain at --height, or by default the
+// state after the head.
+var atOptions = []cmdkit.Option{
+	cmdkit.StringOption("at", "CIDs of the blocks of the tipset whose state to read, separated by commas"),
+	cmdkit.Uint64Option("height", "height of the chain whose state to read"),
+}
+
+// stateAt returns the key of the tipset selected by the atOptions of req, or
+// an empty key for the head.
+func stateAt(req *cmds.Request, env cmds.Environment) (types.SortedCidSet, error) {
+	arg, hasAt := req.Options["at"].(string)
+	height, hasHeight := req.Options["height"].(uint64)
+	switch {
+	case hasAt && hasHeight:
+		return types.SortedCidSet{}, errors.New("only one of --at and --height may be given")
+	case hasAt:
+		return parseTipSetKey(arg)
+	case hasHeight:
+		ts, err := GetPorcelainAPI(env).ChainTipSetAtHeight(req.Context, height)
+		if err != nil {
+			return types.SortedCidSet{}, err
+		}
+		return ts.ToSortedCidSet(), nil
+	default:
+		return types.SortedCidSet{}, nil
+	}
+}
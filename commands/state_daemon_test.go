@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/plumbing/stdiff"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestStateDiff(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	headKey := func() string {
+		var blks []types.Block
+		require.NoError(json.Unmarshal([]byte(d.RunSuccess("chain", "head", "--enc", "json").ReadStdoutTrimNewlines()), &blks))
+		require.Len(blks, 1)
+		return blks[0].Cid().String()
+	}
+
+	from := headKey()
+	d.RunSuccess("mining", "once")
+	to := headKey()
+
+	// the block reward changes at least one balance
+	var diff stdiff.Diff
+	require.NoError(json.Unmarshal([]byte(d.RunSuccess("state", "diff", from, to, "--enc", "json").ReadStdoutTrimNewlines()), &diff))
+	require.NotEmpty(diff.Actors)
+	assert.Equal(state.ActorChanged, diff.Actors[0].Change)
+	assert.Contains(diff.Actors[0].Fields, "balance")
+
+	assert.Contains(d.RunSuccess("state", "diff", from, to).ReadStdoutTrimNewlines(), "changed")
+	d.RunSuccess("state", "diff", from, to, "--storage")
+
+	// a tipset has no changes from itself
+	require.NoError(json.Unmarshal([]byte(d.RunSuccess("state", "diff", to, to, "--enc", "json").ReadStdoutTrimNewlines()), &diff))
+	assert.Empty(diff.Actors)
+
+	d.RunFail("invalid block cid", "state", "diff", "notacid", to)
+}
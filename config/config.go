@@ -17,13 +17,15 @@ import (
 
 // Config is an in memory representation of the filecoin configuration file
 type Config struct {
-	API       *APIConfig       `json:"api"`
-	Bootstrap *BootstrapConfig `json:"bootstrap"`
-	Datastore *DatastoreConfig `json:"datastore"`
-	Swarm     *SwarmConfig     `json:"swarm"`
-	Mining    *MiningConfig    `json:"mining"`
-	Wallet    *WalletConfig    `json:"wallet"`
-	Heartbeat *HeartbeatConfig `json:"heartbeat"`
+	API       *APIConfig         `json:"api"`
+	Bootstrap *BootstrapConfig   `json:"bootstrap"`
+	Datastore *DatastoreConfig   `json:"datastore"`
+	Swarm     *SwarmConfig       `json:"swarm"`
+	Mining    *MiningConfig      `json:"mining"`
+	Wallet    *WalletConfig      `json:"wallet"`
+	Heartbeat *HeartbeatConfig   `json:"heartbeat"`
+	Mpool     *MessagePoolConfig `json:"mpool"`
+	Chain     *ChainConfig       `json:"chain"`
 }
 
 // APIConfig holds all configuration options related to the api.
@@ -52,6 +54,14 @@ func newDefaultAPIConfig() *APIConfig {
 type DatastoreConfig struct {
 	Type string `json:"type"`
 	Path string `json:"path"`
+	// StateRetention is the number of tipsets back from the head whose state
+	// is kept when the repo is garbage collected. It must not be lower than
+	// chain.finalityDepth, or reorgs within it could not be validated.
+	StateRetention uint64 `json:"stateRetention"`
+	// GCPeriod is how often the daemon garbage collects the repo in the
+	// background, e.g. "24h". Background garbage collection is disabled if
+	// it is empty.
+	GCPeriod string `json:"gcPeriod"`
 }
 
 // Validators hold the list of validation functions for each configuration
@@ -65,8 +75,9 @@ var Validators = map[string]func(string, string) error{
 
 func newDefaultDatastoreConfig() *DatastoreConfig {
 	return &DatastoreConfig{
-		Type: "badgerds",
-		Path: "badger",
+		Type:           "badgerds",
+		Path:           "badger",
+		StateRetention: 2000,
 	}
 }
 
@@ -116,11 +127,15 @@ func newDefaultMiningConfig() *MiningConfig {
 // WalletConfig holds all configuration options related to the wallet.
 type WalletConfig struct {
 	DefaultAddress address.Address `json:"defaultAddress,omitempty"`
+	// GasLimitMargin is the percentage added to a message's previewed gas
+	// usage when its gas limit is determined automatically.
+	GasLimitMargin uint `json:"gasLimitMargin"`
 }
 
 func newDefaultWalletConfig() *WalletConfig {
 	return &WalletConfig{
 		DefaultAddress: address.Address{},
+		GasLimitMargin: 20,
 	}
 }
 
@@ -147,6 +162,57 @@ func newDefaultHeartbeatConfig() *HeartbeatConfig {
 	}
 }
 
+// MessagePoolConfig holds all configuration options related to the message pool.
+type MessagePoolConfig struct {
+	// MaxPoolSize is the maximum number of pending messages the pool will hold.
+	// When the pool is full the lowest priced messages are evicted to make room.
+	MaxPoolSize uint `json:"maxPoolSize"`
+	// MaxSenderMessages is the maximum number of pending messages the pool will
+	// hold from any single sender.
+	MaxSenderMessages uint `json:"maxSenderMessages"`
+	// MessageTTL is the number of blocks a message may stay in the pool before it is
+	// dropped. Zero means messages never expire.
+	MessageTTL uint64 `json:"messageTTL"`
+	// PersistAll causes all pending messages, not just those that originated at
+	// this node, to be persisted across restarts.
+	PersistAll bool `json:"persistAll"`
+	// RebroadcastInterval is the number of blocks after which a message sent by this
+	// node that has not been mined is published again. The interval doubles after
+	// each rebroadcast of a message. Zero disables rebroadcasting.
+	RebroadcastInterval uint64 `json:"rebroadcastInterval"`
+}
+
+func newDefaultMessagePoolConfig() *MessagePoolConfig {
+	return &MessagePoolConfig{
+		MaxPoolSize:         10000,
+		MaxSenderMessages:   1000,
+		MessageTTL:          100,
+		RebroadcastInterval: 3,
+	}
+}
+
+// ChainConfig holds all configuration options related to the chain.
+type ChainConfig struct {
+	// AddressHistory enables indexing the messages and value transfers
+	// involving each address as tipsets are processed. Only tipsets processed
+	// while it is enabled are indexed.
+	AddressHistory bool `json:"addressHistory"`
+	// FinalityDepth is the number of tipsets a reorganization of the chain
+	// may replace. The syncer refuses heavier chains that fork off the
+	// current chain further back. Zero means datastore.stateRetention, which
+	// it may not exceed.
+	FinalityDepth uint64 `json:"finalityDepth"`
+	// Checkpoint is the key of a tipset pinned as final. The syncer refuses
+	// chains that do not include it. Set it with the chain checkpoint set
+	// command; initializing a node with a trusted imported chain sets it to
+	// the head of that chain.
+	Checkpoint types.SortedCidSet `json:"checkpoint"`
+}
+
+func newDefaultChainConfig() *ChainConfig {
+	return &ChainConfig{}
+}
+
 // NewDefaultConfig returns a config object with all the fields filled out to
 // their default values
 func NewDefaultConfig() *Config {
@@ -158,6 +224,8 @@ func NewDefaultConfig() *Config {
 		Mining:    newDefaultMiningConfig(),
 		Wallet:    newDefaultWalletConfig(),
 		Heartbeat: newDefaultHeartbeatConfig(),
+		Mpool:     newDefaultMessagePoolConfig(),
+		Chain:     newDefaultChainConfig(),
 	}
 }
 
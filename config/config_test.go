@@ -58,7 +58,9 @@ func TestWriteFile(t *testing.T) {
 	},
 	"datastore": {
 		"type": "badgerds",
-		"path": "badger"
+		"path": "badger",
+		"stateRetention": 2000,
+		"gcPeriod": ""
 	},
 	"swarm": {
 		"address": "/ip4/0.0.0.0/tcp/6000"
@@ -69,13 +71,26 @@ func TestWriteFile(t *testing.T) {
 		"storagePrice": "0"
 	},
 	"wallet": {
-		"defaultAddress": ""
+		"defaultAddress": "",
+		"gasLimitMargin": 20
 	},
 	"heartbeat": {
 		"beatTarget": "",
 		"beatPeriod": "3s",
 		"reconnectPeriod": "10s",
 		"nickname": ""
+	},
+	"mpool": {
+		"maxPoolSize": 10000,
+		"maxSenderMessages": 1000,
+		"messageTTL": 100,
+		"persistAll": false,
+		"rebroadcastInterval": 3
+	},
+	"chain": {
+		"addressHistory": false,
+		"finalityDepth": 0,
+		"checkpoint": null
 	}
 }`,
 		string(content),
@@ -22,6 +22,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/vm"
+	vmerrors "github.com/filecoin-project/go-filecoin/vm/errors"
 )
 
 var (
@@ -119,10 +120,14 @@ func NewExpected(cs *hamt.CborIpldStore, bs blockstore.Blockstore, processor Pro
 func (c *Expected) NewValidTipSet(ctx context.Context, blks []*types.Block) (types.TipSet, error) {
 	for _, blk := range blks {
 		if err := c.validateBlockStructure(ctx, blk); err != nil {
-			return nil, err
+			return nil, NewValidationError(err)
 		}
 	}
-	return types.NewTipSet(blks...)
+	ts, err := types.NewTipSet(blks...)
+	if err != nil {
+		return nil, NewValidationError(err)
+	}
+	return ts, nil
 }
 
 // ValidateBlockStructure verifies that this block, on its own, is structurally and
@@ -284,11 +289,20 @@ func (c *Expected) validateMining(ctx context.Context, st state.Tree, ts types.T
 		// See https://github.com/filecoin-project/specs/blob/master/mining.md#ticket-checking
 		result, err := IsWinningTicket(ctx, c.bstore, c.PwrTableView, st, blk.Ticket, blk.Miner)
 		if err != nil {
+			// The power of a block's miner cannot be found if the miner does
+			// not exist, which makes the block invalid.
+			minerActor, getErr := st.GetActor(ctx, blk.Miner)
+			if state.IsActorNotFoundError(getErr) {
+				return NewValidationError(errors.Errorf("block mined by unknown miner %s", blk.Miner))
+			}
+			if getErr == nil && !minerActor.Code.Equals(types.MinerActorCodeCid) && !minerActor.Code.Equals(types.BootstrapMinerActorCodeCid) {
+				return NewValidationError(errors.Errorf("block mined by %s, which is not a miner", blk.Miner))
+			}
 			return errors.Wrap(err, "can't check for winning ticket")
 		}
 
 		if !result {
-			return errors.New("not a winning ticket")
+			return NewValidationError(errors.New("not a winning ticket"))
 		}
 	}
 	return nil
@@ -368,11 +382,15 @@ func (c *Expected) runMessages(ctx context.Context, st state.Tree, vms vm.Storag
 
 		receipts, err := c.processor.ProcessBlock(ctx, cpySt, vms, blk, ancestors)
 		if err != nil {
+			if vmerrors.IsApplyErrorPermanent(err) || vmerrors.IsApplyErrorTemporary(err) {
+				// The block includes a message that cannot be applied.
+				return nil, NewValidationError(errors.Wrap(err, "error validating block state"))
+			}
 			return nil, errors.Wrap(err, "error validating block state")
 		}
 		// TODO: check that receipts actually match
 		if len(receipts) != len(blk.MessageReceipts) {
-			return nil, fmt.Errorf("found invalid message receipts: %v %v", receipts, blk.MessageReceipts)
+			return nil, NewValidationError(fmt.Errorf("found invalid message receipts: %v %v", receipts, blk.MessageReceipts))
 		}
 
 		outCid, err := cpySt.Flush(ctx)
@@ -380,7 +398,7 @@ func (c *Expected) runMessages(ctx context.Context, st state.Tree, vms vm.Storag
 			return nil, errors.Wrap(err, "error validating block state")
 		}
 		if !outCid.Equals(blk.StateRoot) {
-			return nil, ErrStateRootMismatch
+			return nil, NewValidationError(ErrStateRootMismatch)
 		}
 	}
 	if len(ts) == 1 { // block validation state == aggregate parent state
@@ -392,7 +410,12 @@ func (c *Expected) runMessages(ctx context.Context, st state.Tree, vms vm.Storag
 	// for the tipSetProcessor.
 	_, err := c.processor.ProcessTipSet(ctx, st, vms, ts, ancestors)
 	if err != nil {
-		return nil, errors.Wrap(err, "error validating tipset")
+		if ctx.Err() != nil {
+			return nil, errors.Wrap(err, "error validating tipset")
+		}
+		// Each block applied on its own, so a tipset that cannot be applied
+		// as a whole is invalid.
+		return nil, NewValidationError(errors.Wrap(err, "error validating tipset"))
 	}
 	return st, nil
 }
@@ -89,6 +89,7 @@ func TestExpected_NewValidTipSet(t *testing.T) {
 
 		tipSet, err := exp.NewValidTipSet(ctx, blocks)
 		assert.Error(err, "Foo")
+		assert.True(consensus.IsValidationError(err))
 		assert.Nil(tipSet)
 	})
 }
@@ -185,6 +186,58 @@ func TestExpected_RunStateTransition_validateMining(t *testing.T) {
 
 		_, err = exp.RunStateTransition(ctx, tipSet, []types.TipSet{pTipSet}, stateTree)
 		assert.EqualError(err, "can't check for winning ticket: Couldn't get minerPower: something went wrong with the miner power")
+		// Failing to check the ticket does not make the tipset invalid.
+		assert.False(consensus.IsValidationError(err))
+	})
+
+	t.Run("returns a validation error when a block is mined by an unknown miner", func(t *testing.T) {
+
+		ptv := NewFailingMinerTestPowerTableView(1, 5)
+		exp := consensus.NewExpected(cistore, bstore, consensus.NewDefaultProcessor(), ptv, types.SomeCid(), verifier)
+
+		pTipSet, err := exp.NewValidTipSet(ctx, []*types.Block{genesisBlock})
+		require.NoError(err)
+
+		stateTree, err := state.LoadStateTree(ctx, cistore, genesisBlock.StateRoot, builtin.Actors)
+		require.NoError(err)
+
+		vms := vm.NewStorageMap(bstore)
+
+		blocks := requireMakeBlocks(ctx, require, pTipSet, stateTree, vms)
+		unknownMiner := address.NewForTestGetter()()
+		for _, blk := range blocks {
+			blk.Miner = unknownMiner
+		}
+
+		tipSet, err := exp.NewValidTipSet(ctx, blocks)
+		require.NoError(err)
+
+		_, err = exp.RunStateTransition(ctx, tipSet, []types.TipSet{pTipSet}, stateTree)
+		assert.EqualError(err, fmt.Sprintf("block mined by unknown miner %s", unknownMiner))
+		assert.True(consensus.IsValidationError(err))
+	})
+
+	t.Run("returns a validation error when a ticket does not win", func(t *testing.T) {
+
+		ptv := testhelpers.NewTestPowerTableView(0, 5)
+		exp := consensus.NewExpected(cistore, bstore, testhelpers.NewTestProcessor(), ptv, genesisBlock.Cid(), verifier)
+
+		pTipSet, err := exp.NewValidTipSet(ctx, []*types.Block{genesisBlock})
+		require.NoError(err)
+
+		stateTree, err := state.LoadStateTree(ctx, cistore, genesisBlock.StateRoot, builtin.Actors)
+		require.NoError(err)
+
+		vms := vm.NewStorageMap(bstore)
+
+		blocks := requireMakeBlocks(ctx, require, pTipSet, stateTree, vms)
+
+		tipSet, err := exp.NewValidTipSet(ctx, blocks)
+		require.NoError(err)
+
+		_, err = exp.RunStateTransition(ctx, tipSet, []types.TipSet{pTipSet}, stateTree)
+		assert.EqualError(err, "not a winning ticket")
+		assert.True(consensus.IsValidationError(err))
 	})
 }
 
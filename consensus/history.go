@@ -0,0 +1,140 @@
+package consensus
+
+import (
+	"context"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+// HistoryKind identifies what caused a HistoryEntry.
+type HistoryKind string
+
+const (
+	// HistoryMessage is a message included in a block.
+	HistoryMessage = HistoryKind("message")
+	// HistoryTransfer is a value transfer made by an actor while executing
+	// a message, for instance a payment channel redemption.
+	HistoryTransfer = HistoryKind("transfer")
+	// HistoryBlockReward is the reward paid to a miner's owner for a block.
+	HistoryBlockReward = HistoryKind("block-reward")
+	// HistoryGasReward is the gas paid by the sender of a message to the owner
+	// of the miner of the block including it.
+	HistoryGasReward = HistoryKind("gas-reward")
+)
+
+// HistoryEntry describes a message or value transfer between two addresses
+// that was applied while processing a block.
+type HistoryEntry struct {
+	Kind  HistoryKind     `json:"kind"`
+	From  address.Address `json:"from"`
+	To    address.Address `json:"to"`
+	Value *types.AttoFIL  `json:"value"`
+	// Block is the block whose processing produced the entry.
+	Block cid.Cid `json:"block"`
+	// Message is the message whose application produced the entry. It is nil
+	// for block rewards.
+	Message *cid.Cid `json:"message,omitempty"`
+	// Method and ExitCode are only set for HistoryMessage entries.
+	Method   string `json:"method,omitempty"`
+	ExitCode uint8  `json:"exitCode"`
+}
+
+// HistoryRecorder receives the history entries produced by processing tipsets
+// so that they can be indexed by address. Entries are recorded for every
+// tipset that is processed, whether or not it becomes part of the heaviest
+// chain.
+type HistoryRecorder interface {
+	RecordTipSet(ctx context.Context, key types.SortedCidSet, height uint64, entries []*HistoryEntry) error
+}
+
+// historyCollector accumulates the history entries of a tipset as it is
+// processed. A nil historyCollector collects nothing.
+type historyCollector struct {
+	// block is the block whose messages are being applied.
+	block   cid.Cid
+	entries []*HistoryEntry
+}
+
+func (h *historyCollector) add(entries ...*HistoryEntry) {
+	if h == nil {
+		return
+	}
+	h.entries = append(h.entries, entries...)
+}
+
+// transfers returns an observer that buffers the value transfers made by
+// actors while executing the message with the given CID, and a function
+// returning the buffered entries. The entries are not collected until they
+// are passed to add, so that they can be dropped if the message is reverted.
+func (h *historyCollector) transfers(msgCid cid.Cid) (vm.TransferObserver, func() []*HistoryEntry) {
+	if h == nil {
+		return nil, func() []*HistoryEntry { return nil }
+	}
+
+	var buf []*HistoryEntry
+	observe := func(from, to address.Address, value *types.AttoFIL) {
+		buf = append(buf, &HistoryEntry{
+			Kind:    HistoryTransfer,
+			From:    from,
+			To:      to,
+			Value:   value,
+			Block:   h.block,
+			Message: &msgCid,
+		})
+	}
+	return observe, func() []*HistoryEntry { return buf }
+}
+
+// addMessage collects the entries of an applied message: the message itself,
+// the transfers made by actors while executing it and the gas paid by its
+// sender to the owner of the block's miner. Transfers should be nil if the
+// message was reverted.
+func (h *historyCollector) addMessage(msgCid cid.Cid, msg *types.SignedMessage, receipt *types.MessageReceipt, transfers []*HistoryEntry, minerOwnerAddr address.Address) {
+	if h == nil {
+		return
+	}
+
+	value := msg.Value
+	if value == nil {
+		value = types.NewZeroAttoFIL()
+	}
+	h.add(&HistoryEntry{
+		Kind:     HistoryMessage,
+		From:     msg.From,
+		To:       msg.To,
+		Value:    value,
+		Block:    h.block,
+		Message:  &msgCid,
+		Method:   msg.Method,
+		ExitCode: receipt.ExitCode,
+	})
+	h.add(transfers...)
+	if receipt.GasAttoFIL.IsPositive() {
+		h.add(&HistoryEntry{
+			Kind:    HistoryGasReward,
+			From:    msg.From,
+			To:      minerOwnerAddr,
+			Value:   receipt.GasAttoFIL,
+			Block:   h.block,
+			Message: &msgCid,
+		})
+	}
+}
+
+// addBlockReward collects the reward paid to the owner of the block's miner.
+func (h *historyCollector) addBlockReward(minerOwnerAddr address.Address, reward *types.AttoFIL) {
+	if h == nil || !reward.IsPositive() {
+		return
+	}
+	h.add(&HistoryEntry{
+		Kind:  HistoryBlockReward,
+		From:  address.NetworkAddress,
+		To:    minerOwnerAddr,
+		Value: reward,
+		Block: h.block,
+	})
+}
@@ -45,6 +45,8 @@ type ProcessTipSetResponse struct {
 type DefaultProcessor struct {
 	signedMessageValidator SignedMessageValidator
 	blockRewarder          BlockRewarder
+	historyRecorder        HistoryRecorder
+	tracer                 MessageTracer
 }
 
 var _ Processor = (*DefaultProcessor)(nil)
@@ -65,6 +67,18 @@ func NewConfiguredProcessor(validator SignedMessageValidator, rewarder BlockRewa
 	}
 }
 
+// SetHistoryRecorder sets a recorder that receives the history entries of
+// the blocks and tipsets processed by ProcessBlock and ProcessTipSet.
+func (p *DefaultProcessor) SetHistoryRecorder(recorder HistoryRecorder) {
+	p.historyRecorder = recorder
+}
+
+// SetTracer sets a tracer that chooses which of the messages applied by
+// ProcessBlock, ProcessTipSet and ApplyMessagesAndPayRewards are traced.
+func (p *DefaultProcessor) SetTracer(tracer MessageTracer) {
+	p.tracer = tracer
+}
+
 // ProcessBlock is the entrypoint for validating the state transitions
 // of the messages in a block. When we receive a new block from the
 // network ProcessBlock applies the block's messages to the beginning
@@ -100,14 +114,20 @@ func (p *DefaultProcessor) ProcessBlock(ctx context.Context, st state.Tree, vms
 		log.Infof("[TIMER] DefaultProcessor.ProcessBlock BlkCID: %s - elapsed time: %s", blk.Cid(), time.Since(processBlkTimer).Round(time.Millisecond))
 	}()
 
+	bh := types.NewBlockHeight(uint64(blk.Height))
+
 	// find miner's owner address
-	minerOwnerAddr, err := minerOwnerAddress(ctx, st, vms, blk.Miner)
+	minerOwnerAddr, err := minerOwnerAddress(ctx, st, vms, blk.Miner, bh)
 	if err != nil {
 		return nil, err
 	}
 
-	bh := types.NewBlockHeight(uint64(blk.Height))
-	res, faultErr := p.ApplyMessagesAndPayRewards(ctx, st, vms, blk.Messages, minerOwnerAddr, bh, ancestors)
+	var hist *historyCollector
+	if p.historyRecorder != nil {
+		hist = &historyCollector{block: blk.Cid()}
+	}
+
+	res, faultErr := p.applyMessagesAndPayRewards(ctx, st, vms, blk.Messages, minerOwnerAddr, bh, ancestors, hist)
 	if faultErr != nil {
 		return emptyResults, faultErr
 	}
@@ -117,6 +137,10 @@ func (p *DefaultProcessor) ProcessBlock(ctx context.Context, st state.Tree, vms
 	if len(res.TemporaryErrors) > 0 {
 		return emptyResults, res.TemporaryErrors[0]
 	}
+
+	// Processing a block computes the same state transition as processing
+	// the tipset consisting of just that block.
+	p.recordHistory(ctx, types.NewSortedCidSet(blk.Cid()), uint64(blk.Height), hist)
 	return res.Results, nil
 }
 
@@ -139,6 +163,11 @@ func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms
 	bh := types.NewBlockHeight(h)
 	msgFilter := make(map[string]struct{})
 
+	var hist *historyCollector
+	if p.historyRecorder != nil {
+		hist = &historyCollector{}
+	}
+
 	tips := ts.ToSlice()
 	types.SortBlocks(tips)
 
@@ -147,7 +176,7 @@ func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms
 	// consensus functions).
 	for _, blk := range tips {
 		// find miner's owner address
-		minerOwnerAddr, err := minerOwnerAddress(ctx, st, vms, blk.Miner)
+		minerOwnerAddr, err := minerOwnerAddress(ctx, st, vms, blk.Miner, bh)
 		if err != nil {
 			return &emptyRes, err
 		}
@@ -167,7 +196,10 @@ func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms
 			// TODO is there ever a reason to try a duplicate failed message again within the same tipset?
 			msgFilter[mCid.String()] = struct{}{}
 		}
-		amRes, err := p.ApplyMessagesAndPayRewards(ctx, st, vms, msgs, minerOwnerAddr, bh, ancestors)
+		if hist != nil {
+			hist.block = blk.Cid()
+		}
+		amRes, err := p.applyMessagesAndPayRewards(ctx, st, vms, msgs, minerOwnerAddr, bh, ancestors, hist)
 		if err != nil {
 			return &emptyRes, err
 		}
@@ -195,9 +227,22 @@ func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms
 		}
 	}
 
+	p.recordHistory(ctx, ts.ToSortedCidSet(), h, hist)
 	return &res, nil
 }
 
+// recordHistory passes the history collected while processing the tipset
+// with the given key and height to the history recorder. Failing to record
+// history does not affect processing.
+func (p *DefaultProcessor) recordHistory(ctx context.Context, key types.SortedCidSet, height uint64, hist *historyCollector) {
+	if hist == nil {
+		return
+	}
+	if err := p.historyRecorder.RecordTipSet(ctx, key, height, hist.entries); err != nil {
+		log.Errorf("failed to record address history of tipset %s: %s", key.String(), err)
+	}
+}
+
 // ApplyMessage attempts to apply a message to a state tree. It is the
 // sole driver of state tree transitions in the system. Both block
 // validation and mining use this function and we should treat any changes
@@ -252,7 +297,8 @@ func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms
 //   - sender account does not exist: temporarily unapplyable (don't include, revert,
 //       keep in pool). There could be an account-creating message forthcoming.
 //   - send to self: permanently unapplyable (don't include in a block, revert changes,
-//       discard)
+//       discard), unless it is a cancellation (a zero-value transfer invoking no method),
+//       which is applied and only increments the sender's nonce
 //   - transfer negative value: permanently unapplyable (as above)
 //   - all other vmerrors: successfully applied! Include in the block and
 //       revert changes. Necessarily all vm errors that are not faults are
@@ -260,6 +306,12 @@ func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms
 //   - everything else: successfully applied (include, keep changes)
 //
 func (p *DefaultProcessor) ApplyMessage(ctx context.Context, st state.Tree, vms vm.StorageMap, msg *types.SignedMessage, minerOwnerAddr address.Address, bh *types.BlockHeight, gasTracker *vm.GasTracker, ancestors []types.TipSet) (*ApplicationResult, error) {
+	return p.applyMessage(ctx, st, vms, msg, minerOwnerAddr, bh, gasTracker, ancestors, nil, nil)
+}
+
+// applyMessage implements ApplyMessage, collecting the history of the message
+// in hist and recording its execution in trace if they are not nil.
+func (p *DefaultProcessor) applyMessage(ctx context.Context, st state.Tree, vms vm.StorageMap, msg *types.SignedMessage, minerOwnerAddr address.Address, bh *types.BlockHeight, gasTracker *vm.GasTracker, ancestors []types.TipSet, hist *historyCollector, trace *vm.Trace) (*ApplicationResult, error) {
 
 	// used for log timer call below
 	msgCid, err := msg.Cid()
@@ -274,7 +326,8 @@ func (p *DefaultProcessor) ApplyMessage(ctx context.Context, st state.Tree, vms
 
 	cachedStateTree := state.NewCachedStateTree(st)
 
-	r, err := p.attemptApplyMessage(ctx, cachedStateTree, vms, msg, bh, gasTracker, ancestors)
+	observeTransfer, transfers := hist.transfers(msgCid)
+	r, err := p.attemptApplyMessage(ctx, cachedStateTree, vms, msg, bh, gasTracker, ancestors, observeTransfer, trace)
 	if err == nil {
 		err = cachedStateTree.Commit(ctx)
 		if err != nil {
@@ -320,6 +373,14 @@ func (p *DefaultProcessor) ApplyMessage(ctx context.Context, st state.Tree, vms
 		return nil, errors.FaultErrorWrap(err, "could not set from actor after inc nonce")
 	}
 
+	// Transfers made by reverted messages were rolled back with the rest of
+	// their changes.
+	var applied []*HistoryEntry
+	if executionError == nil && r.ExitCode == 0 {
+		applied = transfers()
+	}
+	hist.addMessage(msgCid, msg, r, applied, minerOwnerAddr)
+
 	return &ApplicationResult{Receipt: r, ExecutionError: executionError}, nil
 }
 
@@ -420,7 +481,7 @@ func PreviewQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, t
 // should deal with trying to apply the message to the state tree whereas
 // ApplyMessage should deal with any side effects and how it should be presented
 // to the caller. attemptApplyMessage should only be called from ApplyMessage.
-func (p *DefaultProcessor) attemptApplyMessage(ctx context.Context, st *state.CachedTree, store vm.StorageMap, msg *types.SignedMessage, bh *types.BlockHeight, gasTracker *vm.GasTracker, ancestors []types.TipSet) (*types.MessageReceipt, error) {
+func (p *DefaultProcessor) attemptApplyMessage(ctx context.Context, st *state.CachedTree, store vm.StorageMap, msg *types.SignedMessage, bh *types.BlockHeight, gasTracker *vm.GasTracker, ancestors []types.TipSet, observeTransfer vm.TransferObserver, trace *vm.Trace) (*types.MessageReceipt, error) {
 	gasTracker.ResetForNewMessage(msg.MeteredMessage)
 	if err := blockGasLimitError(gasTracker); err != nil {
 		return &types.MessageReceipt{
@@ -474,6 +535,9 @@ func (p *DefaultProcessor) attemptApplyMessage(ctx context.Context, st *state.Ca
 		GasTracker:  gasTracker,
 		BlockHeight: bh,
 		Ancestors:   ancestors,
+
+		TransferObserver: observeTransfer,
+		Trace:            trace,
 	}
 	vmCtx := vm.NewVMContext(vmCtxParams)
 
@@ -515,19 +579,50 @@ type ApplyMessagesResponse struct {
 // ApplyMessages will return an error iff a fault message occurs.
 // Precondition: signatures of messages are checked by the caller.
 func (p *DefaultProcessor) ApplyMessagesAndPayRewards(ctx context.Context, st state.Tree, vms vm.StorageMap, messages []*types.SignedMessage, minerOwnerAddr address.Address, bh *types.BlockHeight, ancestors []types.TipSet) (ApplyMessagesResponse, error) {
+	return p.applyMessagesAndPayRewards(ctx, st, vms, messages, minerOwnerAddr, bh, ancestors, nil)
+}
+
+// applyMessagesAndPayRewards implements ApplyMessagesAndPayRewards, collecting
+// the history of the block in hist if it is not nil.
+func (p *DefaultProcessor) applyMessagesAndPayRewards(ctx context.Context, st state.Tree, vms vm.StorageMap, messages []*types.SignedMessage, minerOwnerAddr address.Address, bh *types.BlockHeight, ancestors []types.TipSet, hist *historyCollector) (ApplyMessagesResponse, error) {
 	var emptyRet ApplyMessagesResponse
 	var ret ApplyMessagesResponse
 
+	// The reward is whatever the rewarder credits the miner's owner with.
+	var balanceBeforeReward *types.AttoFIL
+	if hist != nil {
+		balance, err := actorBalance(ctx, st, minerOwnerAddr)
+		if err != nil {
+			return emptyRet, err
+		}
+		balanceBeforeReward = balance
+	}
+
 	// transfer block reward to miner's owner from network address.
 	if err := p.blockRewarder.BlockReward(ctx, st, minerOwnerAddr); err != nil {
 		return ApplyMessagesResponse{}, err
 	}
 
+	if hist != nil {
+		balance, err := actorBalance(ctx, st, minerOwnerAddr)
+		if err != nil {
+			return emptyRet, err
+		}
+		hist.addBlockReward(minerOwnerAddr, balance.Sub(balanceBeforeReward))
+	}
+
 	gasTracker := vm.NewGasTracker()
 
 	// process all messages
 	for _, smsg := range messages {
-		r, err := p.ApplyMessage(ctx, st, vms, smsg, minerOwnerAddr, bh, gasTracker, ancestors)
+		var trace *vm.Trace
+		if p.tracer != nil {
+			trace = p.tracer.StartMessage(smsg)
+		}
+		r, err := p.applyMessage(ctx, st, vms, smsg, minerOwnerAddr, bh, gasTracker, ancestors, hist, trace)
+		if trace != nil {
+			p.tracer.FinishMessage(smsg, r, err)
+		}
 		// If the message should not have been in the block, bail somehow.
 		switch {
 		case errors.IsFault(err):
@@ -600,6 +695,21 @@ func rewardTransfer(ctx context.Context, fromAddr, toAddr address.Address, value
 	return vm.Transfer(fromActor, toActor, value)
 }
 
+// actorBalance returns the balance of the actor at addr, or zero if there is
+// no actor at addr.
+func actorBalance(ctx context.Context, st state.Tree, addr address.Address) (*types.AttoFIL, error) {
+	a, err := st.GetActor(ctx, addr)
+	if state.IsActorNotFoundError(err) {
+		return types.NewZeroAttoFIL(), nil
+	} else if err != nil {
+		return nil, errors.FaultErrorWrapf(err, "failed to get actor %s", addr)
+	}
+	if a.Balance == nil {
+		return types.NewZeroAttoFIL(), nil
+	}
+	return a.Balance, nil
+}
+
 func blockGasLimitError(gasTracker *vm.GasTracker) error {
 	if gasTracker.GasAboveBlockLimit() {
 		return errGasAboveBlockLimit
@@ -625,9 +735,10 @@ func isPermanentError(err error) bool {
 		err == errGasAboveBlockLimit
 }
 
-// minerOwnerAddress finds the address of the owner of the given miner
-func minerOwnerAddress(ctx context.Context, st state.Tree, vms vm.StorageMap, minerAddr address.Address) (address.Address, error) {
-	ret, code, err := CallQueryMethod(ctx, st, vms, minerAddr, "getOwner", []byte{}, address.Address{}, types.NewBlockHeight(0))
+// minerOwnerAddress finds the address of the owner of the given miner at
+// block height bh, which receives the rewards of the blocks it mines.
+func minerOwnerAddress(ctx context.Context, st state.Tree, vms vm.StorageMap, minerAddr address.Address, bh *types.BlockHeight) (address.Address, error) {
+	ret, code, err := CallQueryMethod(ctx, st, vms, minerAddr, "getOwner", []byte{}, address.Address{}, bh)
 	if err != nil {
 		return address.Address{}, errors.FaultErrorWrap(err, "could not get miner owner")
 	}
@@ -315,6 +315,176 @@ func TestProcessBlockReward(t *testing.T) {
 	assert.Equal(minerBalance.Add(blockRewardAmount), minerOwnerActor.Balance)
 }
 
+type fakeHistoryRecorder struct {
+	keys    []types.SortedCidSet
+	entries [][]*HistoryEntry
+}
+
+func (r *fakeHistoryRecorder) RecordTipSet(ctx context.Context, key types.SortedCidSet, height uint64, entries []*HistoryEntry) error {
+	r.keys = append(r.keys, key)
+	r.entries = append(r.entries, entries)
+	return nil
+}
+
+func TestProcessBlockRecordsHistory(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	newAddress := address.NewForTestGetter()
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+	mockSigner, _ := types.NewMockSignersAndKeyInfo(1)
+	vms := th.VMStorage()
+
+	// Install the fake actor so it can send value on.
+	fakeActorCodeCid := types.NewCidForTestGetter()()
+	builtin.Actors[fakeActorCodeCid] = &actor.FakeActor{}
+	defer func() {
+		delete(builtin.Actors, fakeActorCodeCid)
+	}()
+
+	toAddr, fakeAddr1, fakeAddr2 := newAddress(), newAddress(), newAddress()
+	minerAddr, minerOwnerAddr := newAddress(), newAddress()
+	fromAddr := mockSigner.Addresses[0]
+	_, st := th.RequireMakeStateTree(require, cst, map[address.Address]*actor.Actor{
+		address.NetworkAddress: th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(10000000)),
+		minerOwnerAddr:         th.RequireNewAccountActor(require, types.ZeroAttoFIL),
+		fromAddr:               th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(10000)),
+		fakeAddr1:              th.RequireNewFakeActorWithTokens(require, vms, fakeAddr1, fakeActorCodeCid, types.NewAttoFILFromFIL(102)),
+		fakeAddr2:              th.RequireNewFakeActorWithTokens(require, vms, fakeAddr2, fakeActorCodeCid, types.NewAttoFILFromFIL(0)),
+	})
+	stCid, _ := mustCreateMiner(ctx, require, st, vms, minerAddr, minerOwnerAddr)
+
+	// A plain transfer, and a message that has fakeAddr1 send 100 to fakeAddr2.
+	msg1 := types.NewMessage(fromAddr, toAddr, 0, types.NewAttoFILFromFIL(550), "", nil)
+	smsg1, err := types.NewSignedMessage(*msg1, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(0))
+	require.NoError(err)
+	params, err := abi.ToEncodedValues(fakeAddr2)
+	require.NoError(err)
+	msg2 := types.NewMessage(fromAddr, fakeAddr1, 1, nil, "nestedBalance", params)
+	smsg2, err := types.NewSignedMessage(*msg2, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(0))
+	require.NoError(err)
+
+	blk := &types.Block{
+		Height:    20,
+		StateRoot: stCid,
+		Messages:  []*types.SignedMessage{smsg1, smsg2},
+		Miner:     minerAddr,
+	}
+
+	recorder := &fakeHistoryRecorder{}
+	processor := NewDefaultProcessor()
+	processor.SetHistoryRecorder(recorder)
+	_, err = processor.ProcessBlock(ctx, st, vms, blk, nil)
+	require.NoError(err)
+
+	require.Len(recorder.keys, 1)
+	assert.True(recorder.keys[0].Equals(types.NewSortedCidSet(blk.Cid())))
+
+	entries := recorder.entries[0]
+	require.Len(entries, 4)
+
+	assert.Equal(HistoryBlockReward, entries[0].Kind)
+	assert.Equal(address.NetworkAddress, entries[0].From)
+	assert.Equal(minerOwnerAddr, entries[0].To)
+	assert.True(NewDefaultBlockRewarder().BlockRewardAmount().Equal(entries[0].Value))
+	assert.Nil(entries[0].Message)
+
+	assert.Equal(HistoryMessage, entries[1].Kind)
+	assert.Equal(toAddr, entries[1].To)
+	assert.True(types.NewAttoFILFromFIL(550).Equal(entries[1].Value))
+
+	assert.Equal(HistoryMessage, entries[2].Kind)
+	assert.Equal("nestedBalance", entries[2].Method)
+	assert.Equal(uint8(0), entries[2].ExitCode)
+
+	assert.Equal(HistoryTransfer, entries[3].Kind)
+	assert.Equal(fakeAddr1, entries[3].From)
+	assert.Equal(fakeAddr2, entries[3].To)
+	assert.True(types.NewAttoFILFromFIL(100).Equal(entries[3].Value))
+	msg2Cid, err := smsg2.Cid()
+	require.NoError(err)
+	require.NotNil(entries[3].Message)
+	assert.True(msg2Cid.Equals(*entries[3].Message))
+
+	for _, e := range entries {
+		assert.True(blk.Cid().Equals(e.Block))
+	}
+}
+
+// fakeMessageTracer traces the message with the CID target.
+type fakeMessageTracer struct {
+	target   cid.Cid
+	trace    *vm.Trace
+	finished int
+	res      *ApplicationResult
+	err      error
+}
+
+func (t *fakeMessageTracer) StartMessage(msg *types.SignedMessage) *vm.Trace {
+	msgCid, err := msg.Cid()
+	if err != nil || !msgCid.Equals(t.target) {
+		return nil
+	}
+	t.trace = vm.NewTrace(&msg.Message)
+	return t.trace
+}
+
+func (t *fakeMessageTracer) FinishMessage(msg *types.SignedMessage, res *ApplicationResult, err error) {
+	t.finished++
+	t.res, t.err = res, err
+}
+
+func TestProcessTipSetTracesChosenMessages(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	newAddress := address.NewForTestGetter()
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+	mockSigner, _ := types.NewMockSignersAndKeyInfo(1)
+	vms := th.VMStorage()
+
+	toAddr, minerAddr, minerOwnerAddr := newAddress(), newAddress(), newAddress()
+	fromAddr := mockSigner.Addresses[0]
+	_, st := th.RequireMakeStateTree(require, cst, map[address.Address]*actor.Actor{
+		address.NetworkAddress: th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(10000000)),
+		minerOwnerAddr:         th.RequireNewAccountActor(require, types.ZeroAttoFIL),
+		fromAddr:               th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(10000)),
+	})
+	stCid, _ := mustCreateMiner(ctx, require, st, vms, minerAddr, minerOwnerAddr)
+
+	msg1 := types.NewMessage(fromAddr, toAddr, 0, types.NewAttoFILFromFIL(550), "", nil)
+	smsg1, err := types.NewSignedMessage(*msg1, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(0))
+	require.NoError(err)
+	msg2 := types.NewMessage(fromAddr, toAddr, 1, types.NewAttoFILFromFIL(50), "", nil)
+	smsg2, err := types.NewSignedMessage(*msg2, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(0))
+	require.NoError(err)
+	msg2Cid, err := smsg2.Cid()
+	require.NoError(err)
+
+	blk := &types.Block{
+		Height:    20,
+		StateRoot: stCid,
+		Messages:  []*types.SignedMessage{smsg1, smsg2},
+		Miner:     minerAddr,
+	}
+
+	tracer := &fakeMessageTracer{target: msg2Cid}
+	processor := NewDefaultProcessor()
+	processor.SetTracer(tracer)
+	_, err = processor.ProcessTipSet(ctx, st, vms, th.RequireNewTipSet(require, blk), nil)
+	require.NoError(err)
+
+	require.NotNil(tracer.trace)
+	assert.Equal(1, tracer.finished)
+	assert.Equal(toAddr, tracer.trace.To)
+	assert.True(types.NewAttoFILFromFIL(50).Equal(tracer.trace.Value))
+	assert.NoError(tracer.err)
+	require.NotNil(tracer.res)
+	assert.Equal(uint8(0), tracer.res.Receipt.ExitCode)
+}
+
 func TestProcessBlockVMErrors(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -596,6 +766,25 @@ func TestApplyMessagesValidation(t *testing.T) {
 		assert.Equal("cannot send to self", err.(*errors.ApplyErrorPermanent).Cause().Error())
 	})
 
+	t.Run("applies a zero-value send to self with no method", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+		ctx := context.Background()
+
+		addr1, _, addr2, _, st, mockSigner := mustSetup2Actors(t, types.NewAttoFILFromFIL(1000), types.NewAttoFILFromFIL(10000))
+		msg := types.NewMessage(addr1, addr1, 0, types.NewZeroAttoFIL(), "", []byte{})
+		smsg, err := types.NewSignedMessage(*msg, mockSigner, *types.NewAttoFILFromFIL(10), types.NewGasUnits(0))
+		require.NoError(err)
+
+		_, err = NewDefaultProcessor().ApplyMessage(ctx, st, th.VMStorage(), smsg, addr2, types.NewBlockHeight(0), vm.NewGasTracker(), nil)
+		require.NoError(err)
+
+		act1, err := st.GetActor(ctx, addr1)
+		require.NoError(err)
+		assert.Equal(types.Uint64(1), act1.Nonce)
+		assert.Equal(types.NewAttoFILFromFIL(1000), act1.Balance)
+	})
+
 	t.Run("errors when specifying a gas limit in excess of balance", func(t *testing.T) {
 		require := require.New(t)
 		assert := assert.New(t)
@@ -12,6 +12,8 @@ package consensus
 import (
 	"context"
 
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
 )
@@ -27,6 +29,7 @@ type Protocol interface {
 	// the same height, parent set, and parent weight.  The function does not
 	// check if a tipset constitutes a valid state transition or that its
 	// blocks were mined according to protocol rules (RunStateTransition does these checks).
+	// Invalid blocks are reported with a ValidationError.
 	NewValidTipSet(ctx context.Context, blks []*types.Block) (types.TipSet, error)
 	// Weight returns the weight given to the input ts by this consensus protocol.
 	Weight(ctx context.Context, ts types.TipSet, pSt state.Tree) (uint64, error)
@@ -34,6 +37,30 @@ type Protocol interface {
 	// tipset b is heavier than tipset a.
 	IsHeavier(ctx context.Context, a, b types.TipSet, aSt, bSt state.Tree) (bool, error)
 	// RunStateTransition returns the state resulting from applying the input ts to the parent
-	// state pSt.  It returns an error if the transition is invalid.
+	// state pSt.  It returns a ValidationError if the transition is invalid, and
+	// other errors if its validity could not be determined.
 	RunStateTransition(ctx context.Context, ts types.TipSet, ancestors []types.TipSet, pSt state.Tree) (state.Tree, error)
 }
+
+// ValidationError is returned by a Protocol when a tipset is invalid, as
+// opposed to when its validity could not be determined, for instance because
+// of a storage fault or a canceled context.
+type ValidationError struct {
+	err error
+}
+
+// NewValidationError returns a ValidationError for the reason err.
+func NewValidationError(err error) error {
+	return &ValidationError{err: err}
+}
+
+func (e *ValidationError) Error() string {
+	return e.err.Error()
+}
+
+// IsValidationError returns true if err, or the error it wraps, is a
+// ValidationError.
+func IsValidationError(err error) bool {
+	_, ok := errors.Cause(err).(*ValidationError)
+	return ok
+}
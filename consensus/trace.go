@@ -0,0 +1,18 @@
+package consensus
+
+import (
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+// MessageTracer chooses which of the messages applied while processing blocks
+// and tipsets have their execution traced, and receives the outcome of
+// applying them.
+type MessageTracer interface {
+	// StartMessage is called before msg is applied and returns the trace to
+	// record its execution in, or nil to not trace it.
+	StartMessage(msg *types.SignedMessage) *vm.Trace
+	// FinishMessage is called after a message StartMessage returned a trace
+	// for is applied, with the result and error of applying it.
+	FinishMessage(msg *types.SignedMessage, res *ApplicationResult, err error)
+}
@@ -41,7 +41,7 @@ func (v *defaultMessageValidator) Validate(ctx context.Context, msg *types.Signe
 		return errInvalidSignature
 	}
 
-	if msg.From == msg.To {
+	if msg.From == msg.To && !IsCancellation(&msg.Message) {
 		return errSelfSend
 	}
 
@@ -51,17 +51,18 @@ func (v *defaultMessageValidator) Validate(ctx context.Context, msg *types.Signe
 		return errNonAccountActor
 	}
 
+	// A message with a used nonce can never be applied, whatever the balance.
+	if msg.Nonce < fromActor.Nonce {
+		log.Info("Nonce too low: ", msg.Nonce, fromActor.Nonce, fromActor, msg)
+		return errNonceTooLow
+	}
+
 	// Avoid processing messages for actors that cannot pay.
 	if !canCoverGasLimit(msg, fromActor) {
 		log.Info("Insufficient funds to cover gas limit: ", fromActor, msg)
 		return errInsufficientGas
 	}
 
-	if msg.Nonce < fromActor.Nonce {
-		log.Info("Nonce too low: ", msg.Nonce, fromActor.Nonce, fromActor, msg)
-		return errNonceTooLow
-	}
-
 	if !v.allowHighNonce && msg.Nonce > fromActor.Nonce {
 		log.Info("Nonce too high: ", msg.Nonce, fromActor.Nonce, fromActor, msg)
 		return errNonceTooHigh
@@ -70,6 +71,22 @@ func (v *defaultMessageValidator) Validate(ctx context.Context, msg *types.Signe
 	return nil
 }
 
+// IsTemporaryValidationError returns true if err, as returned by a validator from this
+// package, describes a condition that may change as the chain advances (e.g. the
+// sender cannot currently cover the gas limit), as opposed to a message that can
+// never be valid.
+func IsTemporaryValidationError(err error) bool {
+	return err == errInsufficientGas || err == errNonceTooHigh
+}
+
+// IsCancellation returns true if msg is a zero-value transfer from an actor to
+// itself that invokes no method. Applying such a message changes nothing but the
+// sender's nonce, which makes it a way to cancel a pending message with the same
+// nonce.
+func IsCancellation(msg *types.Message) bool {
+	return msg.From == msg.To && msg.Method == "" && (msg.Value == nil || msg.Value.IsZero())
+}
+
 // Check's whether the maximum gas charge + message value is within the actor's balance.
 // Note that this is an imperfect test, since nested messages invoked by this one may transfer
 // more value from the actor's balance.
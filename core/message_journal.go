@@ -0,0 +1,133 @@
+package core
+
+import (
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/query"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+const (
+	// localMessagePrefix is the datastore prefix for messages that originated at this node.
+	localMessagePrefix = "local"
+	// remoteMessagePrefix is the datastore prefix for messages received from the network.
+	remoteMessagePrefix = "remote"
+)
+
+func init() {
+	cbor.RegisterCborType(journalRecord{})
+}
+
+// JournaledMessage is a message read back from a MessageJournal.
+type JournaledMessage struct {
+	Message *types.SignedMessage
+	// Local is true if the message originated at this node.
+	Local bool
+	// AddedHeight is the head height when the message entered the pool.
+	AddedHeight uint64
+}
+
+// journalRecord is the form in which a message is stored in the journal.
+type journalRecord struct {
+	Message     *types.SignedMessage
+	AddedHeight uint64
+}
+
+// MessageJournal persists pending messages in a datastore so that the message
+// pool can be restored after a restart.
+type MessageJournal struct {
+	ds repo.Datastore
+}
+
+// NewMessageJournal returns a new MessageJournal backed by the given datastore.
+func NewMessageJournal(ds repo.Datastore) *MessageJournal {
+	return &MessageJournal{ds: ds}
+}
+
+// journalOp is a queued write to the journal: msg is recorded under c along with
+// the height it was added at, or the record for c is removed if msg is nil.
+type journalOp struct {
+	c           cid.Cid
+	msg         *types.SignedMessage
+	addedHeight uint64
+	local       bool
+}
+
+// apply performs a sequence of journal writes in a single batch. Only the last
+// write to each record takes effect; removing a record that is not journaled
+// is not an error.
+func (j *MessageJournal) apply(ops []journalOp) error {
+	final := make(map[datastore.Key]journalOp, len(ops))
+	for _, op := range ops {
+		final[journalKey(op.c, op.local)] = op
+	}
+
+	batch, err := j.ds.Batch()
+	if err != nil {
+		return errors.Wrap(err, "failed to create journal batch")
+	}
+	for key, op := range final {
+		if op.msg == nil {
+			has, err := j.ds.Has(key)
+			if err != nil {
+				return errors.Wrapf(err, "failed to read journal record for message %s", op.c)
+			}
+			if has {
+				if err := batch.Delete(key); err != nil {
+					return errors.Wrapf(err, "failed to remove message %s from journal", op.c)
+				}
+			}
+			continue
+		}
+		data, err := cbor.DumpObject(journalRecord{Message: op.msg, AddedHeight: op.addedHeight})
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal message")
+		}
+		if err := batch.Put(key, data); err != nil {
+			return errors.Wrapf(err, "failed to journal message %s", op.c)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit message journal")
+	}
+	return nil
+}
+
+// Load returns all journaled messages.
+func (j *MessageJournal) Load() ([]JournaledMessage, error) {
+	var out []JournaledMessage
+	for _, local := range []bool{true, false} {
+		prefix := remoteMessagePrefix
+		if local {
+			prefix = localMessagePrefix
+		}
+
+		results, err := j.ds.Query(query.Query{Prefix: "/" + prefix})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to query message journal")
+		}
+		for entry := range results.Next() {
+			if entry.Error != nil {
+				return nil, errors.Wrap(entry.Error, "failed to read message journal")
+			}
+			var rec journalRecord
+			if err := cbor.DecodeInto(entry.Value, &rec); err != nil {
+				return nil, errors.Wrapf(err, "failed to unmarshal journaled message %s", entry.Key)
+			}
+			out = append(out, JournaledMessage{Message: rec.Message, Local: local, AddedHeight: rec.AddedHeight})
+		}
+	}
+	return out, nil
+}
+
+func journalKey(c cid.Cid, local bool) datastore.Key {
+	prefix := remoteMessagePrefix
+	if local {
+		prefix = localMessagePrefix
+	}
+	return datastore.KeyWithNamespaces([]string{prefix, c.String()})
+}
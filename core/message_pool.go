@@ -1,58 +1,321 @@
 package core
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"math/big"
+	"sort"
 	"sync"
 
 	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
 
+	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/config"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
-// MessagePool keeps an unordered, de-duplicated set of Messages and supports removal by CID.
-// By 'de-duplicated' we mean that insertion of a message by cid that already
-// exists is a nop. We use a MessagePool to store all messages received by this node
-// via network or directly created via user command that have yet to be included
-// in a block. Messages are removed as they are processed.
+var log = logging.Logger("core")
+
+var (
+	// ErrMessagePoolFull is returned when a message cannot be added because the pool is at
+	// capacity and the message does not pay more than the cheapest evictable message.
+	ErrMessagePoolFull = errors.New("message pool is full")
+	// ErrSenderMessageLimit is returned when a sender already has the maximum number of
+	// messages allowed in the pool.
+	ErrSenderMessageLimit = errors.New("too many pending messages from sender")
+	// ErrReplacementUnderpriced is returned when a message with the same sender and nonce
+	// as a pending message does not pay a higher gas price than the pending message.
+	ErrReplacementUnderpriced = errors.New("replacement message gas price must be higher than pending message")
+)
+
+// MessagePool keeps a de-duplicated set of Messages, indexed by CID and by
+// sender and nonce. By 'de-duplicated' we mean that insertion of a message by cid
+// that already exists is a nop. We use a MessagePool to store all messages received
+// by this node via network or directly created via user command that have yet to be
+// included in a block. Messages are removed as they are processed.
+//
+// At most one message per (sender, nonce) is kept. A message with the same sender
+// and nonce as a pending message replaces it only if it pays a higher gas price.
+// The pool is bounded both globally and per sender; when it is full, the lowest
+// priced message that is last in its sender's nonce order is evicted to make room
+// for a better paying one.
+//
+// Messages that originated at this node are tracked as local. If the pool has a
+// journal, local messages (and optionally all messages) are persisted to it so
+// that the pool can be restored after a restart.
+//
+// Each time the chain head changes the pool should be revalidated against the new
+// state. Messages that can never be applied or that have outlived their TTL are
+// dropped, while messages that may become valid later (e.g. the sender cannot yet
+// cover the gas) are parked: kept in the pool but withheld from mining. The
+// messages of senders whose state may have changed, and of senders with parked
+// messages, are revalidated.
 //
 // MessagePool is safe for concurrent access.
 type MessagePool struct {
 	lk sync.RWMutex
 
-	pending map[cid.Cid]*types.SignedMessage // all pending messages
+	cfg     *config.MessagePoolConfig
+	journal *MessageJournal
+
+	// journalOps are journal writes queued under lk. They are applied by
+	// flushJournal once lk is released so that the pool is not blocked on the
+	// datastore. journalLk orders flushes; it is never taken while holding lk.
+	journalLk  sync.Mutex
+	journalOps []journalOp
+
+	// height is the height of the head the pool was last revalidated against.
+	height uint64
+
+	pending  map[cid.Cid]*poolEntry                       // all pending messages
+	bySender map[address.Address]map[types.Uint64]cid.Cid // pending message cids by sender and nonce
+	touched  map[address.Address]struct{}                 // senders to recheck at the next revalidation
+
+	// stateNonces are the on-chain nonces of pending senders as of their last revalidation.
+	stateNonces map[address.Address]types.Uint64
+}
+
+// poolEntry is a pending message along with the pool's bookkeeping for it.
+type poolEntry struct {
+	msg *types.SignedMessage
+	// addedHeight is the head height when the message entered the pool.
+	addedHeight uint64
+	// parked is the reason a message is withheld from mining, nil if it is not.
+	parked error
+	// local is true if the message originated at this node.
+	local bool
+	// broadcastHeight is the head height when a local message was last published.
+	broadcastHeight uint64
+	// rebroadcasts counts how many times a local message has been republished.
+	rebroadcasts uint
+}
+
+// maxRebroadcastBackoff caps the exponential backoff between rebroadcasts of a
+// message at 2^maxRebroadcastBackoff rebroadcast intervals.
+const maxRebroadcastBackoff = 5
+
+// MessageStatus describes a pending message and why it is still in the pool.
+type MessageStatus struct {
+	Cid     cid.Cid              `json:"cid"`
+	Message *types.SignedMessage `json:"message"`
+	// Local is true if the message originated at this node.
+	Local bool `json:"local"`
+	// AddedHeight is the head height when the message was first seen.
+	AddedHeight uint64 `json:"addedHeight"`
+	// Rebroadcasts is the number of times this node has republished the message.
+	Rebroadcasts uint `json:"rebroadcasts"`
+	// Reason describes why the message has not been mined.
+	Reason string `json:"reason"`
 }
 
 // Add adds a message to the pool.
 func (pool *MessagePool) Add(msg *types.SignedMessage) (cid.Cid, error) {
+	defer pool.flushJournal()
 	pool.lk.Lock()
 	defer pool.lk.Unlock()
 
+	return pool.add(msg, false)
+}
+
+// AddLocal adds a message that originated at this node to the pool.
+func (pool *MessagePool) AddLocal(msg *types.SignedMessage) (cid.Cid, error) {
+	defer pool.flushJournal()
+	pool.lk.Lock()
+	defer pool.lk.Unlock()
+
+	return pool.add(msg, true)
+}
+
+// add adds a message to the pool. The caller must hold the lock.
+func (pool *MessagePool) add(msg *types.SignedMessage, local bool) (cid.Cid, error) {
 	c, err := msg.Cid()
 	if err != nil {
 		return cid.Undef, errors.Wrap(err, "failed to create CID")
 	}
 
+	if e, ok := pool.pending[c]; ok {
+		if local && !e.local {
+			e.local = true
+			e.broadcastHeight = pool.height
+			pool.journalPut(c, e)
+		}
+		return c, nil
+	}
+
 	// Reject messages with invalid signatires
 	if !msg.VerifySignature() {
 		return cid.Undef, errors.Errorf("failed to add message %s to pool: sig invalid", c.String())
 	}
 
-	pool.pending[c] = msg
+	nonces := pool.bySender[msg.From]
+	if existingCid, ok := nonces[msg.Nonce]; ok {
+		existing := pool.pending[existingCid].msg
+		if !msg.GasPrice.GreaterThan(&existing.GasPrice) {
+			return cid.Undef, errors.Wrapf(ErrReplacementUnderpriced, "failed to add message %s to pool", c.String())
+		}
+		pool.remove(existingCid)
+		pool.insert(c, msg, local)
+		return c, nil
+	}
+
+	if uint(len(nonces)) >= pool.cfg.MaxSenderMessages {
+		return cid.Undef, errors.Wrapf(ErrSenderMessageLimit, "failed to add message %s to pool", c.String())
+	}
+
+	if uint(len(pool.pending)) >= pool.cfg.MaxPoolSize {
+		evictCid, evictable := pool.cheapestEvictable(msg.From)
+		if !evictable || !msg.GasPrice.GreaterThan(&pool.pending[evictCid].msg.GasPrice) {
+			return cid.Undef, errors.Wrapf(ErrMessagePoolFull, "failed to add message %s to pool", c.String())
+		}
+		pool.remove(evictCid)
+	}
+
+	pool.insert(c, msg, local)
 	return c, nil
 }
 
-// Pending returns all pending messages.
+// Pending returns all pending messages, including parked ones.
 func (pool *MessagePool) Pending() []*types.SignedMessage {
 	pool.lk.Lock()
 	defer pool.lk.Unlock()
 	out := make([]*types.SignedMessage, 0, len(pool.pending))
-	for _, msg := range pool.pending {
-		out = append(out, msg)
+	for _, e := range pool.pending {
+		out = append(out, e.msg)
+	}
+
+	return out
+}
+
+// PendingBySender returns the pending messages that are candidates for mining,
+// grouped by sender. The messages for each sender are ordered by increasing nonce.
+// Parked messages, and any later messages from the same sender which cannot be
+// applied before them, are omitted.
+func (pool *MessagePool) PendingBySender() map[address.Address][]*types.SignedMessage {
+	pool.lk.Lock()
+	defer pool.lk.Unlock()
+	out := make(map[address.Address][]*types.SignedMessage, len(pool.bySender))
+	for from, nonces := range pool.bySender {
+		var mineable []*types.SignedMessage
+		for _, e := range pool.orderedBySender(nonces) {
+			if e.parked != nil {
+				break
+			}
+			mineable = append(mineable, e.msg)
+		}
+		if len(mineable) > 0 {
+			out[from] = mineable
+		}
+	}
+
+	return out
+}
+
+// PendingFrom returns the pending messages from a single sender, including parked
+// ones, ordered by increasing nonce.
+func (pool *MessagePool) PendingFrom(from address.Address) []*types.SignedMessage {
+	pool.lk.Lock()
+	defer pool.lk.Unlock()
+	entries := pool.orderedBySender(pool.bySender[from])
+	out := make([]*types.SignedMessage, len(entries))
+	for i, e := range entries {
+		out[i] = e.msg
+	}
+	return out
+}
+
+// PendingLocal returns the pending messages that originated at this node.
+func (pool *MessagePool) PendingLocal() []*types.SignedMessage {
+	pool.lk.Lock()
+	defer pool.lk.Unlock()
+	var out []*types.SignedMessage
+	for _, e := range pool.pending {
+		if e.local {
+			out = append(out, e.msg)
+		}
+	}
+
+	return out
+}
+
+// Status describes every pending message, ordered by sender and nonce.
+func (pool *MessagePool) Status() []MessageStatus {
+	pool.lk.Lock()
+	defer pool.lk.Unlock()
+
+	senders := make([]address.Address, 0, len(pool.bySender))
+	for from := range pool.bySender {
+		senders = append(senders, from)
+	}
+	sort.Slice(senders, func(i, j int) bool { return bytes.Compare(senders[i][:], senders[j][:]) < 0 })
+
+	out := make([]MessageStatus, 0, len(pool.pending))
+	for _, from := range senders {
+		var blocker string
+		// Gaps are measured from the sender's on-chain nonce if the sender has been
+		// revalidated, otherwise from its first pending message.
+		next, known := pool.stateNonces[from]
+		for _, e := range pool.orderedBySender(pool.bySender[from]) {
+			c := pool.bySender[from][e.msg.Nonce]
+			reason := "awaiting inclusion in a block"
+			switch {
+			case blocker != "":
+				reason = blocker
+			case known && e.msg.Nonce > next:
+				reason = fmt.Sprintf("nonce gap: waiting for nonce %d", next)
+				blocker = reason
+			case e.parked != nil:
+				reason = fmt.Sprintf("parked: %s", e.parked)
+				blocker = fmt.Sprintf("waiting for parked message with nonce %d", e.msg.Nonce)
+			}
+			next, known = e.msg.Nonce+1, true
+			out = append(out, MessageStatus{
+				Cid:          c,
+				Message:      e.msg,
+				Local:        e.local,
+				AddedHeight:  e.addedHeight,
+				Rebroadcasts: e.rebroadcasts,
+				Reason:       reason,
+			})
+		}
+	}
+	return out
+}
+
+// DueForRebroadcast returns the local messages that have not been mined and have
+// not been published for long enough that they should be published again, and
+// records that they were rebroadcast at the given height. The delay between
+// rebroadcasts of a message doubles each time it is rebroadcast.
+func (pool *MessagePool) DueForRebroadcast(height uint64) []*types.SignedMessage {
+	pool.lk.Lock()
+	defer pool.lk.Unlock()
+
+	if pool.cfg.RebroadcastInterval == 0 {
+		return nil
 	}
 
+	var out []*types.SignedMessage
+	for _, e := range pool.pending {
+		if !e.local || e.parked != nil {
+			continue
+		}
+		backoff := e.rebroadcasts
+		if backoff > maxRebroadcastBackoff {
+			backoff = maxRebroadcastBackoff
+		}
+		if height < e.broadcastHeight+pool.cfg.RebroadcastInterval<<backoff {
+			continue
+		}
+		e.broadcastHeight = height
+		e.rebroadcasts++
+		out = append(out, e.msg)
+	}
 	return out
 }
 
@@ -60,25 +323,297 @@ func (pool *MessagePool) Pending() []*types.SignedMessage {
 func (pool *MessagePool) Get(c cid.Cid) (value *types.SignedMessage, ok bool) {
 	pool.lk.Lock()
 	defer pool.lk.Unlock()
-	value, ok = pool.pending[c]
-	if ok && value == nil {
+	e, ok := pool.pending[c]
+	if ok && e.msg == nil {
 		panic("Found nil message for CID " + c.String())
 	}
+	if ok {
+		value = e.msg
+	}
 	return
 }
 
 // Remove removes the message by CID from the pending pool.
 func (pool *MessagePool) Remove(c cid.Cid) {
+	defer pool.flushJournal()
+	pool.lk.Lock()
+	defer pool.lk.Unlock()
+
+	pool.remove(c)
+}
+
+// Revalidate brings the pool up to a new head with state st at the given height.
+// Messages that entered the pool more than the configured TTL ago are dropped.
+// The messages of each sender with parked messages or touched since the last
+// revalidation, either by adding a message to the pool or by a message in the
+// chain segment passed to UpdateMessagePool, are then checked against st in
+// nonce order, each as though the sender's earlier messages had been applied and
+// had spent their value and gas limit. Since a parked sender's balance may grow
+// without a top-level message touching it (e.g. by a block reward), parked
+// senders are rechecked at every head. Messages that the validator
+// rejects permanently (e.g. a nonce that has already been used, or a sender that
+// is no longer an account actor) are dropped. Messages rejected for reasons that
+// may change as the chain advances (e.g. a nonce gap, or a sender that cannot
+// yet cover the gas) are parked until a later revalidation finds them valid.
+func (pool *MessagePool) Revalidate(ctx context.Context, st state.Tree, validator consensus.SignedMessageValidator, height uint64) error {
+	defer pool.flushJournal()
+	pool.lk.Lock()
+	defer pool.lk.Unlock()
+
+	pool.height = height
+
+	if pool.cfg.MessageTTL > 0 {
+		for c, e := range pool.pending {
+			if height > e.addedHeight+pool.cfg.MessageTTL {
+				log.Infof("dropping expired message %s from pool, added at height %d", c, e.addedHeight)
+				pool.remove(c)
+			}
+		}
+	}
+
+	for from, nonces := range pool.bySender {
+		for _, c := range nonces {
+			if pool.pending[c].parked != nil {
+				pool.touched[from] = struct{}{}
+				break
+			}
+		}
+	}
+
+	for from := range pool.touched {
+		nonces, ok := pool.bySender[from]
+		if !ok {
+			delete(pool.touched, from)
+			continue
+		}
+
+		fromActor, err := st.GetActor(ctx, from)
+		if err != nil {
+			if !state.IsActorNotFoundError(err) {
+				return errors.Wrapf(err, "failed to load actor %s", from)
+			}
+			// The sender may yet be created, treat it as an empty actor.
+			fromActor = &actor.Actor{}
+		}
+
+		pool.stateNonces[from] = fromActor.Nonce
+		expected := *fromActor
+		for _, e := range pool.orderedBySender(nonces) {
+			c := nonces[e.msg.Nonce]
+			err := validator.Validate(ctx, e.msg, &expected)
+			switch {
+			case err == nil:
+				e.parked = nil
+				expected.Nonce = e.msg.Nonce + 1
+				gasCharge := e.msg.GasPrice.MulBigInt(big.NewInt(int64(e.msg.GasLimit)))
+				expected.Balance = expected.Balance.Sub(e.msg.Value).Sub(gasCharge)
+			case consensus.IsTemporaryValidationError(err):
+				e.parked = err
+			default:
+				log.Infof("dropping invalid message %s from pool: %s", c, err)
+				pool.remove(c)
+			}
+		}
+		delete(pool.touched, from)
+	}
+	return nil
+}
+
+// Restore adds the messages recorded in the pool's journal back into the pool,
+// keeping the heights at which they were first added so that a restart does not
+// extend their TTL. Messages that can no longer be added are removed from the
+// journal. Restored messages should be revalidated against the current head
+// before use.
+func (pool *MessagePool) Restore() error {
+	if pool.journal == nil {
+		return nil
+	}
+
+	journaled, err := pool.journal.Load()
+	if err != nil {
+		return err
+	}
+
+	defer pool.flushJournal()
 	pool.lk.Lock()
 	defer pool.lk.Unlock()
 
+	for _, jm := range journaled {
+		c, err := pool.add(jm.Message, jm.Local)
+		if err != nil {
+			log.Infof("dropping journaled message: %s", err)
+			c, err := jm.Message.Cid()
+			if err != nil {
+				return err
+			}
+			pool.journalRemove(c)
+			continue
+		}
+		if e := pool.pending[c]; jm.AddedHeight < e.addedHeight {
+			e.addedHeight = jm.AddedHeight
+			pool.journalPut(c, e)
+		}
+	}
+	return nil
+}
+
+// insert indexes a message. The caller must hold the lock and have checked
+// that no message with the same sender and nonce is present.
+func (pool *MessagePool) insert(c cid.Cid, msg *types.SignedMessage, local bool) {
+	e := &poolEntry{msg: msg, addedHeight: pool.height, local: local, broadcastHeight: pool.height}
+	pool.pending[c] = e
+	nonces, ok := pool.bySender[msg.From]
+	if !ok {
+		nonces = make(map[types.Uint64]cid.Cid)
+		pool.bySender[msg.From] = nonces
+	}
+	nonces[msg.Nonce] = c
+	pool.touched[msg.From] = struct{}{}
+	pool.journalPut(c, e)
+}
+
+// touch marks the senders and recipients of the given messages, whose state
+// changes when the messages are applied or reverted, for revalidation.
+func (pool *MessagePool) touch(msgs []*types.SignedMessage) {
+	pool.lk.Lock()
+	defer pool.lk.Unlock()
+
+	for _, m := range msgs {
+		pool.touched[m.From] = struct{}{}
+		pool.touched[m.To] = struct{}{}
+	}
+}
+
+// journalPut queues a write of an entry to the journal if the pool has one and
+// the entry should be persisted. The caller must hold the lock.
+func (pool *MessagePool) journalPut(c cid.Cid, e *poolEntry) {
+	if pool.journal == nil || !(e.local || pool.cfg.PersistAll) {
+		return
+	}
+	pool.journalOps = append(pool.journalOps, journalOp{c: c, msg: e.msg, addedHeight: e.addedHeight, local: e.local})
+}
+
+// journalRemove queues the removal of a message from the journal if the pool
+// has one. The caller must hold the lock.
+func (pool *MessagePool) journalRemove(c cid.Cid) {
+	if pool.journal == nil {
+		return
+	}
+	pool.journalOps = append(pool.journalOps, journalOp{c: c, local: true}, journalOp{c: c, local: false})
+}
+
+// flushJournal applies the queued journal writes in a single batch. The caller
+// must not hold the lock. Journal failures are logged rather than returned: the
+// in-memory pool remains authoritative.
+func (pool *MessagePool) flushJournal() {
+	if pool.journal == nil {
+		return
+	}
+	pool.journalLk.Lock()
+	defer pool.journalLk.Unlock()
+
+	pool.lk.Lock()
+	ops := pool.journalOps
+	pool.journalOps = nil
+	pool.lk.Unlock()
+
+	if len(ops) == 0 {
+		return
+	}
+	if err := pool.journal.apply(ops); err != nil {
+		log.Warningf("failed to update message journal: %s", err)
+	}
+}
+
+// remove drops a message from all indexes. The caller must hold the lock.
+func (pool *MessagePool) remove(c cid.Cid) {
+	e, ok := pool.pending[c]
+	if !ok {
+		return
+	}
 	delete(pool.pending, c)
+	pool.journalRemove(c)
+
+	nonces := pool.bySender[e.msg.From]
+	if nonces[e.msg.Nonce].Equals(c) {
+		delete(nonces, e.msg.Nonce)
+	}
+	if len(nonces) == 0 {
+		delete(pool.bySender, e.msg.From)
+		delete(pool.stateNonces, e.msg.From)
+	}
+}
+
+// orderedBySender returns the entries for the given nonce index in increasing
+// nonce order. The caller must hold the lock.
+func (pool *MessagePool) orderedBySender(nonces map[types.Uint64]cid.Cid) []*poolEntry {
+	out := make([]*poolEntry, 0, len(nonces))
+	for _, c := range nonces {
+		out = append(out, pool.pending[c])
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].msg.Nonce < out[j].msg.Nonce })
+	return out
+}
+
+// cheapestEvictable returns the cid of the lowest priced message that can be
+// evicted without leaving a nonce gap, i.e. the lowest priced of each sender's
+// highest-nonce messages. Messages from the excluded sender are not considered
+// so that a sender cannot open a gap behind its own new message. The caller must
+// hold the lock.
+func (pool *MessagePool) cheapestEvictable(exclude address.Address) (cid.Cid, bool) {
+	var cheapest *types.SignedMessage
+	cheapestCid := cid.Undef
+	for from, nonces := range pool.bySender {
+		if from == exclude {
+			continue
+		}
+		var last *types.SignedMessage
+		lastCid := cid.Undef
+		for _, c := range nonces {
+			if m := pool.pending[c].msg; last == nil || m.Nonce > last.Nonce {
+				last, lastCid = m, c
+			}
+		}
+		if last == nil {
+			continue
+		}
+		if cheapest == nil || last.GasPrice.LessThan(&cheapest.GasPrice) {
+			cheapest, cheapestCid = last, lastCid
+		}
+	}
+	return cheapestCid, cheapest != nil
+}
+
+// largestNonce returns the largest nonce used by a message from address in the pool.
+func (pool *MessagePool) largestNonce(address address.Address) (largest uint64, found bool) {
+	pool.lk.Lock()
+	defer pool.lk.Unlock()
+
+	for nonce := range pool.bySender[address] {
+		found = true
+		if uint64(nonce) > largest {
+			largest = uint64(nonce)
+		}
+	}
+	return
 }
 
-// NewMessagePool constructs a new MessagePool.
-func NewMessagePool() *MessagePool {
+// NewMessagePool constructs a new in-memory MessagePool.
+func NewMessagePool(cfg *config.MessagePoolConfig) *MessagePool {
+	return NewMessagePoolWithJournal(cfg, nil)
+}
+
+// NewMessagePoolWithJournal constructs a new MessagePool that persists messages
+// to the given journal. Call Restore to load previously journaled messages.
+func NewMessagePoolWithJournal(cfg *config.MessagePoolConfig, journal *MessageJournal) *MessagePool {
 	return &MessagePool{
-		pending: make(map[cid.Cid]*types.SignedMessage),
+		cfg:      cfg,
+		journal:  journal,
+		pending:  make(map[cid.Cid]*poolEntry),
+		bySender: make(map[address.Address]map[types.Uint64]cid.Cid),
+		touched:  make(map[address.Address]struct{}),
+
+		stateNonces: make(map[address.Address]types.Uint64),
 	}
 }
 
@@ -210,10 +745,16 @@ func UpdateMessagePool(ctx context.Context, pool *MessagePool, store *hamt.CborI
 		}
 	}
 
-	// Now actually update the pool.
+	// The state of every actor sending or receiving these messages has changed.
+	pool.touch(addToPool)
+	pool.touch(removeFromPool)
+
+	// Now actually update the pool. Messages the pool declines by policy (e.g. a
+	// better paying message with the same nonce is already pending, or the pool
+	// is full) are dropped rather than failing the update.
 	for _, m := range addToPool {
 		_, err := pool.Add(m)
-		if err != nil {
+		if err != nil && !isPoolPolicyError(err) {
 			return err
 		}
 	}
@@ -233,16 +774,18 @@ func UpdateMessagePool(ctx context.Context, pool *MessagePool, store *hamt.CborI
 	return nil
 }
 
+// isPoolPolicyError returns true if err is a rejection due to the pool's
+// replacement or capacity rules rather than a problem with the message itself.
+func isPoolPolicyError(err error) bool {
+	switch errors.Cause(err) {
+	case ErrMessagePoolFull, ErrSenderMessageLimit, ErrReplacementUnderpriced:
+		return true
+	}
+	return false
+}
+
 // LargestNonce returns the largest nonce used by a message from address in the pool.
 // If no messages from address are found, found will be false.
 func LargestNonce(pool *MessagePool, address address.Address) (largest uint64, found bool) {
-	for _, m := range pool.Pending() {
-		if m.From == address {
-			found = true
-			if uint64(m.Nonce) > largest {
-				largest = uint64(m.Nonce)
-			}
-		}
-	}
-	return
+	return pool.largestNonce(address)
 }
@@ -9,8 +9,15 @@ import (
 	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 
+	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/config"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -20,7 +27,7 @@ var newSignedMessage = types.NewSignedMessageForTestGetter(mockSigner)
 func TestMessagePoolAddRemove(t *testing.T) {
 	assert := assert.New(t)
 
-	pool := NewMessagePool()
+	pool := NewMessagePool(config.NewDefaultConfig().Mpool)
 	msg1 := newSignedMessage()
 	msg2 := newSignedMessage()
 
@@ -57,7 +64,7 @@ func TestMessagePoolAddRemove(t *testing.T) {
 func TestMessagePoolAddBadSignature(t *testing.T) {
 	assert := assert.New(t)
 
-	pool := NewMessagePool()
+	pool := NewMessagePool(config.NewDefaultConfig().Mpool)
 	smsg := newSignedMessage()
 	smsg.Message.Nonce = types.Uint64(uint64(smsg.Message.Nonce) + uint64(1)) // invalidate message
 
@@ -74,7 +81,7 @@ func TestMessagePoolAddBadSignature(t *testing.T) {
 func TestMessagePoolDedup(t *testing.T) {
 	assert := assert.New(t)
 
-	pool := NewMessagePool()
+	pool := NewMessagePool(config.NewDefaultConfig().Mpool)
 	msg1 := newSignedMessage()
 
 	assert.Len(pool.Pending(), 0)
@@ -93,7 +100,7 @@ func TestMessagePoolAsync(t *testing.T) {
 	count := 400
 	msgs := types.NewSignedMsgs(count, mockSigner)
 
-	pool := NewMessagePool()
+	pool := NewMessagePool(config.NewDefaultConfig().Mpool)
 	var wg sync.WaitGroup
 
 	for i := 0; i < 4; i++ {
@@ -111,6 +118,398 @@ func TestMessagePoolAsync(t *testing.T) {
 	assert.Len(pool.Pending(), count)
 }
 
+func TestMessagePoolReplaceByFee(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	from := mockSigner.Addresses[0]
+	sign := func(nonce uint64, price int64, method string) *types.SignedMessage {
+		msg := types.NewMessage(from, address.TestAddress, nonce, nil, method, nil)
+		smsg, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(price), types.NewGasUnits(0))
+		require.NoError(err)
+		return smsg
+	}
+
+	t.Run("higher gas price replaces pending message", func(t *testing.T) {
+		pool := NewMessagePool(config.NewDefaultConfig().Mpool)
+		orig := sign(0, 1, "orig")
+		repl := sign(0, 2, "repl")
+		MustAdd(pool, orig, repl)
+
+		assertPoolEquals(assert, pool, repl)
+	})
+
+	t.Run("equal or lower gas price is rejected", func(t *testing.T) {
+		pool := NewMessagePool(config.NewDefaultConfig().Mpool)
+		orig := sign(0, 2, "orig")
+		MustAdd(pool, orig)
+
+		_, err := pool.Add(sign(0, 2, "same"))
+		assert.Equal(ErrReplacementUnderpriced, errors.Cause(err))
+		_, err = pool.Add(sign(0, 1, "lower"))
+		assert.Equal(ErrReplacementUnderpriced, errors.Cause(err))
+
+		assertPoolEquals(assert, pool, orig)
+	})
+}
+
+func TestMessagePoolLimits(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	sign := func(from address.Address, nonce uint64, price int64) *types.SignedMessage {
+		msg := types.NewMessage(from, address.TestAddress, nonce, nil, "", nil)
+		smsg, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(price), types.NewGasUnits(0))
+		require.NoError(err)
+		return smsg
+	}
+	a0, a1 := mockSigner.Addresses[0], mockSigner.Addresses[1]
+
+	t.Run("per sender limit", func(t *testing.T) {
+		pool := NewMessagePool(&config.MessagePoolConfig{MaxPoolSize: 10, MaxSenderMessages: 2})
+		MustAdd(pool, sign(a0, 0, 1), sign(a0, 1, 1))
+
+		_, err := pool.Add(sign(a0, 2, 1))
+		assert.Equal(ErrSenderMessageLimit, errors.Cause(err))
+
+		// Other senders are unaffected.
+		_, err = pool.Add(sign(a1, 0, 1))
+		assert.NoError(err)
+		assert.Len(pool.Pending(), 3)
+	})
+
+	t.Run("full pool evicts the cheapest last-nonce message", func(t *testing.T) {
+		pool := NewMessagePool(&config.MessagePoolConfig{MaxPoolSize: 3, MaxSenderMessages: 10})
+		// a0's nonce 0 message is the cheapest overall but evicting it would leave a gap,
+		// so a1's message is evicted instead.
+		m0, m1, m2 := sign(a0, 0, 1), sign(a0, 1, 5), sign(a1, 0, 3)
+		MustAdd(pool, m0, m1, m2)
+
+		m3 := sign(a1, 1, 4)
+		_, err := pool.Add(m3)
+		assert.Equal(ErrMessagePoolFull, errors.Cause(err))
+
+		m4 := sign(a0, 2, 4)
+		MustAdd(pool, m4)
+		assertPoolEquals(assert, pool, m0, m1, m4)
+	})
+
+	t.Run("full pool rejects messages that do not outbid", func(t *testing.T) {
+		pool := NewMessagePool(&config.MessagePoolConfig{MaxPoolSize: 1, MaxSenderMessages: 10})
+		m0 := sign(a0, 0, 2)
+		MustAdd(pool, m0)
+
+		_, err := pool.Add(sign(a1, 0, 2))
+		assert.Equal(ErrMessagePoolFull, errors.Cause(err))
+		assertPoolEquals(assert, pool, m0)
+	})
+}
+
+func TestMessagePoolPendingBySender(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	a0, a1 := mockSigner.Addresses[0], mockSigner.Addresses[1]
+	msgs := types.NewMsgsWithAddrs(5, []address.Address{a0, a1, a0, a1, a0})
+	for i, nonce := range []uint64{4, 1, 0, 0, 2} {
+		msgs[i].Nonce = types.Uint64(nonce)
+	}
+	smsgs, err := types.SignMsgs(mockSigner, msgs)
+	require.NoError(err)
+
+	pool := NewMessagePool(config.NewDefaultConfig().Mpool)
+	MustAdd(pool, smsgs...)
+
+	bySender := pool.PendingBySender()
+	assert.Len(bySender, 2)
+	assert.Equal([]*types.SignedMessage{smsgs[2], smsgs[4], smsgs[0]}, bySender[a0])
+	assert.Equal([]*types.SignedMessage{smsgs[3], smsgs[1]}, bySender[a1])
+	assert.Equal(bySender[a0], pool.PendingFrom(a0))
+
+	c, err := smsgs[4].Cid()
+	require.NoError(err)
+	pool.Remove(c)
+	assert.Equal([]*types.SignedMessage{smsgs[2], smsgs[0]}, pool.PendingFrom(a0))
+}
+
+func TestMessagePoolRevalidate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	a0, a1, a2 := mockSigner.Addresses[0], mockSigner.Addresses[1], mockSigner.Addresses[2]
+	sign := func(from address.Address, nonce uint64, price int64, limit uint64) *types.SignedMessage {
+		msg := types.NewMessage(from, address.TestAddress, nonce, nil, "", nil)
+		smsg, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(price), types.NewGasUnits(limit))
+		require.NoError(err)
+		return smsg
+	}
+
+	st := state.NewEmptyStateTree(hamt.NewCborStore())
+	rich, err := account.NewActor(types.NewAttoFILFromFIL(100))
+	require.NoError(err)
+	rich.Nonce = 1
+	state.MustSetActor(st, a0, rich)
+	poor, err := account.NewActor(types.NewAttoFILFromFIL(0))
+	require.NoError(err)
+	state.MustSetActor(st, a1, poor)
+	notAccount, err := storagemarket.NewActor()
+	require.NoError(err)
+	state.MustSetActor(st, a2, notAccount)
+
+	t.Run("drops permanently invalid and parks temporarily invalid messages", func(t *testing.T) {
+		pool := NewMessagePool(config.NewDefaultConfig().Mpool)
+
+		stale := sign(a0, 0, 1, 10)
+		valid := sign(a0, 1, 1, 10)
+		unfunded := sign(a1, 0, 1, 10)
+		afterUnfunded := sign(a1, 1, 0, 0)
+		fromNonAccount := sign(a2, 0, 0, 0)
+		MustAdd(pool, stale, valid, unfunded, afterUnfunded, fromNonAccount)
+
+		require.NoError(pool.Revalidate(ctx, st, consensus.NewOutboundMessageValidator(), 1))
+
+		assertPoolEquals(assert, pool, valid, unfunded, afterUnfunded)
+		// The unfunded message and the one queued behind it are withheld from mining.
+		bySender := pool.PendingBySender()
+		assert.Len(bySender, 1)
+		assert.Equal([]*types.SignedMessage{valid}, bySender[a0])
+	})
+
+	t.Run("parked messages are unparked once valid", func(t *testing.T) {
+		pool := NewMessagePool(config.NewDefaultConfig().Mpool)
+		unfunded := sign(a1, 0, 1, 10)
+		MustAdd(pool, unfunded)
+
+		require.NoError(pool.Revalidate(ctx, st, consensus.NewOutboundMessageValidator(), 1))
+		assert.Len(pool.PendingBySender(), 0)
+
+		funded := state.NewEmptyStateTree(hamt.NewCborStore())
+		act, err := account.NewActor(types.NewAttoFILFromFIL(100))
+		require.NoError(err)
+		state.MustSetActor(funded, a1, act)
+
+		// Parked senders are revalidated at every head, even if no message in the
+		// chain touched them (e.g. their balance grew by a block reward).
+		require.NoError(pool.Revalidate(ctx, funded, consensus.NewOutboundMessageValidator(), 2))
+		assert.Equal([]*types.SignedMessage{unfunded}, pool.PendingBySender()[a1])
+	})
+
+	t.Run("deducts the balance spent by earlier messages of a sender", func(t *testing.T) {
+		pool := NewMessagePool(config.NewDefaultConfig().Mpool)
+		send := func(nonce uint64, value uint64) *types.SignedMessage {
+			msg := types.NewMessage(a0, address.TestAddress, nonce, types.NewAttoFILFromFIL(value), "", nil)
+			smsg, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(0))
+			require.NoError(err)
+			return smsg
+		}
+		first := send(1, 60)
+		second := send(2, 60)
+		MustAdd(pool, first, second)
+
+		require.NoError(pool.Revalidate(ctx, st, consensus.NewOutboundMessageValidator(), 1))
+		assertPoolEquals(assert, pool, first, second)
+		assert.Equal([]*types.SignedMessage{first}, pool.PendingBySender()[a0])
+	})
+
+	t.Run("drops unfunded messages with a used nonce", func(t *testing.T) {
+		pool := NewMessagePool(config.NewDefaultConfig().Mpool)
+		stale := sign(a0, 0, 1000000000000000000, 1000)
+		MustAdd(pool, stale)
+
+		require.NoError(pool.Revalidate(ctx, st, consensus.NewOutboundMessageValidator(), 1))
+		assertPoolEquals(assert, pool)
+	})
+
+	t.Run("parks messages behind a nonce gap", func(t *testing.T) {
+		pool := NewMessagePool(config.NewDefaultConfig().Mpool)
+		next := sign(a0, 1, 0, 0)
+		afterNext := sign(a0, 2, 0, 0)
+		afterGap := sign(a0, 4, 0, 0)
+		MustAdd(pool, next, afterNext, afterGap)
+
+		require.NoError(pool.Revalidate(ctx, st, consensus.NewDefaultMessageValidator(), 1))
+		assertPoolEquals(assert, pool, next, afterNext, afterGap)
+		assert.Equal([]*types.SignedMessage{next, afterNext}, pool.PendingBySender()[a0])
+
+		// Filling the gap unparks the messages behind it.
+		MustAdd(pool, sign(a0, 3, 0, 0))
+		require.NoError(pool.Revalidate(ctx, st, consensus.NewDefaultMessageValidator(), 2))
+		assert.Len(pool.PendingBySender()[a0], 4)
+	})
+
+	t.Run("expires messages after the ttl", func(t *testing.T) {
+		cfg := config.NewDefaultConfig().Mpool
+		cfg.MessageTTL = 10
+		pool := NewMessagePool(cfg)
+
+		require.NoError(pool.Revalidate(ctx, st, consensus.NewOutboundMessageValidator(), 5))
+		old := sign(a0, 1, 0, 0)
+		MustAdd(pool, old)
+		require.NoError(pool.Revalidate(ctx, st, consensus.NewOutboundMessageValidator(), 10))
+		young := sign(a0, 2, 0, 0)
+		MustAdd(pool, young)
+
+		require.NoError(pool.Revalidate(ctx, st, consensus.NewOutboundMessageValidator(), 15))
+		assertPoolEquals(assert, pool, old, young)
+
+		require.NoError(pool.Revalidate(ctx, st, consensus.NewOutboundMessageValidator(), 16))
+		assertPoolEquals(assert, pool, young)
+	})
+}
+
+func TestMessagePoolJournal(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	t.Run("restores local messages", func(t *testing.T) {
+		ds := repo.NewInMemoryRepo().MessageDatastore()
+		pool := NewMessagePoolWithJournal(config.NewDefaultConfig().Mpool, NewMessageJournal(ds))
+
+		local, remote, mined := newSignedMessage(), newSignedMessage(), newSignedMessage()
+		_, err := pool.AddLocal(local)
+		require.NoError(err)
+		_, err = pool.AddLocal(mined)
+		require.NoError(err)
+		MustAdd(pool, remote)
+
+		minedCid, err := mined.Cid()
+		require.NoError(err)
+		pool.Remove(minedCid)
+
+		restored := NewMessagePoolWithJournal(config.NewDefaultConfig().Mpool, NewMessageJournal(ds))
+		require.NoError(restored.Restore())
+		assertPoolEquals(assert, restored, local)
+		assert.Equal([]*types.SignedMessage{local}, restored.PendingLocal())
+	})
+
+	t.Run("restores all messages when configured", func(t *testing.T) {
+		ds := repo.NewInMemoryRepo().MessageDatastore()
+		cfg := config.NewDefaultConfig().Mpool
+		cfg.PersistAll = true
+		pool := NewMessagePoolWithJournal(cfg, NewMessageJournal(ds))
+
+		local, remote := newSignedMessage(), newSignedMessage()
+		_, err := pool.AddLocal(local)
+		require.NoError(err)
+		MustAdd(pool, remote)
+
+		restored := NewMessagePoolWithJournal(cfg, NewMessageJournal(ds))
+		require.NoError(restored.Restore())
+		assertPoolEquals(assert, restored, local, remote)
+		assert.Equal([]*types.SignedMessage{local}, restored.PendingLocal())
+	})
+
+	t.Run("keeps the height messages were added at", func(t *testing.T) {
+		ds := repo.NewInMemoryRepo().MessageDatastore()
+		pool := NewMessagePoolWithJournal(config.NewDefaultConfig().Mpool, NewMessageJournal(ds))
+		pool.height = 5
+
+		local := newSignedMessage()
+		c, err := pool.AddLocal(local)
+		require.NoError(err)
+
+		// A restart does not reset the age of the message.
+		restored := NewMessagePoolWithJournal(config.NewDefaultConfig().Mpool, NewMessageJournal(ds))
+		restored.height = 20
+		require.NoError(restored.Restore())
+		assert.Equal(uint64(5), restored.Status()[0].AddedHeight)
+
+		again := NewMessagePoolWithJournal(config.NewDefaultConfig().Mpool, NewMessageJournal(ds))
+		again.height = 30
+		require.NoError(again.Restore())
+		assert.Equal(uint64(5), again.Status()[0].AddedHeight)
+		assert.Equal(c, again.Status()[0].Cid)
+	})
+}
+
+func TestMessagePoolRebroadcast(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	st := state.NewEmptyStateTree(hamt.NewCborStore())
+	validator := consensus.NewOutboundMessageValidator()
+	cfg := config.NewDefaultConfig().Mpool
+	cfg.RebroadcastInterval = 2
+	cfg.MessageTTL = 0
+	pool := NewMessagePool(cfg)
+
+	local, remote := newSignedMessage(), newSignedMessage()
+	_, err := pool.AddLocal(local)
+	require.NoError(err)
+	MustAdd(pool, remote)
+
+	// Only local messages are rebroadcast, first after the interval and then with
+	// a doubling backoff.
+	rebroadcastAt := func(height uint64) []*types.SignedMessage {
+		require.NoError(pool.Revalidate(ctx, st, validator, height))
+		return pool.DueForRebroadcast(height)
+	}
+	assert.Len(rebroadcastAt(1), 0)
+	assert.Equal([]*types.SignedMessage{local}, rebroadcastAt(2))
+	assert.Len(rebroadcastAt(3), 0)
+	assert.Equal([]*types.SignedMessage{local}, rebroadcastAt(6))
+	assert.Len(rebroadcastAt(13), 0)
+	assert.Equal([]*types.SignedMessage{local}, rebroadcastAt(14))
+
+	statuses := pool.Status()
+	require.Len(statuses, 2)
+	assert.Equal(local, statuses[0].Message)
+	assert.True(statuses[0].Local)
+	assert.Equal(uint(3), statuses[0].Rebroadcasts)
+	assert.Equal(uint64(0), statuses[0].AddedHeight)
+	assert.False(statuses[1].Local)
+	assert.Equal(uint(0), statuses[1].Rebroadcasts)
+}
+
+func TestMessagePoolStatusReasons(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	from := mockSigner.Addresses[0]
+	sign := func(nonce uint64, price int64) *types.SignedMessage {
+		msg := types.NewMessage(from, address.TestAddress, nonce, nil, "", nil)
+		smsg, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(price), types.NewGasUnits(1))
+		require.NoError(err)
+		return smsg
+	}
+
+	pool := NewMessagePool(config.NewDefaultConfig().Mpool)
+	MustAdd(pool, sign(0, 0), sign(1, 1), sign(2, 0), sign(4, 0))
+	// The sender has no funds so the message paying for gas is parked.
+	require.NoError(pool.Revalidate(ctx, state.NewEmptyStateTree(hamt.NewCborStore()), consensus.NewOutboundMessageValidator(), 1))
+
+	statuses := pool.Status()
+	require.Len(statuses, 4)
+	assert.Equal("awaiting inclusion in a block", statuses[0].Reason)
+	assert.Contains(statuses[1].Reason, "parked")
+	assert.Equal("waiting for parked message with nonce 1", statuses[2].Reason)
+	assert.Equal("waiting for parked message with nonce 1", statuses[3].Reason)
+
+	pool = NewMessagePool(config.NewDefaultConfig().Mpool)
+	MustAdd(pool, sign(0, 0), sign(2, 0))
+	statuses = pool.Status()
+	require.Len(statuses, 2)
+	assert.Equal("nonce gap: waiting for nonce 1", statuses[1].Reason)
+
+	// Once revalidated, gaps are measured from the sender's on-chain nonce.
+	st := state.NewEmptyStateTree(hamt.NewCborStore())
+	act, err := account.NewActor(types.NewAttoFILFromFIL(0))
+	require.NoError(err)
+	act.Nonce = 3
+	state.MustSetActor(st, from, act)
+
+	pool = NewMessagePool(config.NewDefaultConfig().Mpool)
+	MustAdd(pool, sign(5, 0), sign(6, 0))
+	require.NoError(pool.Revalidate(ctx, st, consensus.NewDefaultMessageValidator(), 1))
+	statuses = pool.Status()
+	require.Len(statuses, 2)
+	assert.Equal("nonce gap: waiting for nonce 3", statuses[0].Reason)
+	assert.Equal("nonce gap: waiting for nonce 3", statuses[1].Reason)
+}
+
 func msgAsString(msg *types.SignedMessage) string {
 	// When using NewMessageForTestGetter msg.Method is set
 	// to "msgN" so we print that (it will correspond
@@ -163,7 +562,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m0],     Chain: b[m1]
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool)
 
 		m := types.NewSignedMsgs(2, mockSigner)
 		MustAdd(p, m[0], m[1])
@@ -183,7 +582,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m0, m1], Chain: b[m2]
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool)
 
 		m := types.NewSignedMsgs(3, mockSigner)
 		MustAdd(p, m[0], m[1])
@@ -200,7 +599,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m1],         Chain: b[m2, m3] -> b[m4] -> b[m0] -> b[] -> b[m5, m6]
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool)
 
 		m := types.NewSignedMsgs(7, mockSigner)
 		MustAdd(p, m[2], m[5])
@@ -226,7 +625,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m1],         Chain: b[m2, m3] -> {b[m4], b[m0], b[], b[]} -> {b[], b[m6,m5]}
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool)
 
 		m := types.NewSignedMsgs(7, mockSigner)
 		MustAdd(p, m[2], m[5])
@@ -250,7 +649,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m1, m2],     Chain: b[m0] -> b[m3] -> b[m4, m5]
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool)
 
 		m := types.NewSignedMsgs(6, mockSigner)
 		MustAdd(p, m[3], m[5])
@@ -270,7 +669,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m6],         Chain: b[m0] -> b[m3] -> b[m4] -> b[m5] -> b[m1, m2]
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool)
 
 		m := types.NewSignedMsgs(7, mockSigner)
 		MustAdd(p, m[6])
@@ -299,7 +698,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m6],         Chain: {b[m0], b[m1]} -> b[m3] -> b[m4] -> {b[m5], b[m1, m2]}
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool)
 
 		m := types.NewSignedMsgs(7, mockSigner)
 		MustAdd(p, m[6])
@@ -326,7 +725,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m3, m5],     Chain: {b[m0], b[m1], b[m2]}
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool)
 
 		m := types.NewSignedMsgs(6, mockSigner)
 		MustAdd(p, m[3], m[5])
@@ -352,7 +751,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m2, m3],         Chain: b[m0] -> b[m1]
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool)
 		m := types.NewSignedMsgs(4, mockSigner)
 
 		oldChain := NewChainWithMessages(store, types.TipSet{},
@@ -373,7 +772,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m0],     Chain: b[] -> b[m1, m2]
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool)
 
 		m := types.NewSignedMsgs(3, mockSigner)
 		MustAdd(p, m[0], m[1])
@@ -393,7 +792,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [],           Chain: b[m0] -> b[m1] -> b[m2, m3] -> b[m4] -> b[m5, m6]
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool)
 
 		m := types.NewSignedMsgs(7, mockSigner)
 		MustAdd(p, m[2], m[5])
@@ -418,7 +817,7 @@ func TestLargestNonce(t *testing.T) {
 	require := require.New(t)
 
 	t.Run("No matches", func(t *testing.T) {
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool)
 
 		m := types.NewSignedMsgs(2, mockSigner)
 		MustAdd(p, m[0], m[1])
@@ -428,7 +827,7 @@ func TestLargestNonce(t *testing.T) {
 	})
 
 	t.Run("Match, largest is zero", func(t *testing.T) {
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool)
 
 		m := types.NewMsgsWithAddrs(1, mockSigner.Addresses)
 		m[0].Nonce = 0
@@ -444,7 +843,7 @@ func TestLargestNonce(t *testing.T) {
 	})
 
 	t.Run("Match", func(t *testing.T) {
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool)
 
 		m := types.NewMsgsWithAddrs(3, mockSigner.Addresses)
 		m[1].Nonce = 1
@@ -12,12 +12,15 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/vm"
 )
 
 // PeerLookupService provides an interface through which callers look up a miner's libp2p identity by their Filecoin address.
 type PeerLookupService interface {
 	GetPeerIDByMinerAddress(context.Context, address.Address) (peer.ID, error)
+	GetPeerIDByMinerAddressAt(context.Context, address.Address, types.SortedCidSet) (peer.ID, error)
 }
 
 // ChainLookupService is a ChainManager-backed implementation of the PeerLookupService interface.
@@ -41,7 +44,19 @@ func NewChainLookupService(chain chain.ReadStore, queryMethodFromAddr func() (ad
 // GetPeerIDByMinerAddress attempts to get a miner's libp2p identity by loading the actor from the state tree and sending
 // it a "getPeerID" message. The MinerActor is currently the only type of actor which has a peer ID.
 func (c *ChainLookupService) GetPeerIDByMinerAddress(ctx context.Context, minerAddr address.Address) (peer.ID, error) {
-	st, err := c.chainReader.LatestState(ctx)
+	return c.GetPeerIDByMinerAddressAt(ctx, minerAddr, types.SortedCidSet{})
+}
+
+// GetPeerIDByMinerAddressAt is like GetPeerIDByMinerAddress, but reads the state after the tipset with key at, or
+// after the head if at is empty.
+func (c *ChainLookupService) GetPeerIDByMinerAddressAt(ctx context.Context, minerAddr address.Address, at types.SortedCidSet) (peer.ID, error) {
+	var st state.Tree
+	var err error
+	if at.Empty() {
+		st, err = c.chainReader.LatestState(ctx)
+	} else {
+		st, err = c.chainReader.StateAt(ctx, at.String())
+	}
 	if err != nil {
 		return peer.ID(""), errors.Wrap(err, "failed to load state tree")
 	}
@@ -38,9 +38,8 @@ type Heartbeat struct {
 	Height uint64
 	// Nickname is the nickname given to the filecoin node by the user
 	Nickname string
-	// TODO: add when implemented
 	// Syncing is `true` iff the node is currently syncing its chain with the network.
-	// Syncing bool
+	Syncing bool
 
 	// Address of this node's active miner. Can be empty - will return the zero address
 	MinerAddress address.Address
@@ -57,6 +56,9 @@ type HeartbeatService struct {
 	// A function that returns the miner's address
 	MinerAddressGetter func() address.Address
 
+	// A function that returns whether the node is syncing its chain
+	SyncingGetter func() bool
+
 	streamMu sync.Mutex
 	stream   net.Stream
 }
@@ -75,6 +77,18 @@ func defaultMinerAddressGetter() address.Address {
 	return address.Address{}
 }
 
+// WithSyncingGetter returns an option that can be used to set the getter of
+// whether the node is syncing.
+func WithSyncingGetter(sg func() bool) HeartbeatServiceOption {
+	return func(service *HeartbeatService) {
+		service.SyncingGetter = sg
+	}
+}
+
+func defaultSyncingGetter() bool {
+	return false
+}
+
 // NewHeartbeatService returns a HeartbeatService
 func NewHeartbeatService(h host.Host, hbc *config.HeartbeatConfig, hg func() types.TipSet, options ...HeartbeatServiceOption) *HeartbeatService {
 	srv := &HeartbeatService{
@@ -82,6 +96,7 @@ func NewHeartbeatService(h host.Host, hbc *config.HeartbeatConfig, hg func() typ
 		Config:             hbc,
 		HeadGetter:         hg,
 		MinerAddressGetter: defaultMinerAddressGetter,
+		SyncingGetter:      defaultSyncingGetter,
 	}
 
 	for _, option := range options {
@@ -204,6 +219,7 @@ func (hbs *HeartbeatService) Beat() Heartbeat {
 		Head:         tipset,
 		Height:       height,
 		Nickname:     nick,
+		Syncing:      hbs.SyncingGetter(),
 		MinerAddress: addr,
 	}
 }
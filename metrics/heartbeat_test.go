@@ -152,6 +152,7 @@ func TestHeartbeatRunSuccess(t *testing.T) {
 		assert.Equal(uint64(444), hb.Height)
 		assert.Equal("BobHoblaw", hb.Nickname)
 		assert.Equal(addr, hb.MinerAddress)
+		assert.True(hb.Syncing)
 		cancel()
 	})
 
@@ -169,6 +170,9 @@ func TestHeartbeatRunSuccess(t *testing.T) {
 		WithMinerAddressGetter(func() address.Address {
 			return addr
 		}),
+		WithSyncingGetter(func() bool {
+			return true
+		}),
 	)
 
 	require.NoError(hbs.Connect(ctx))
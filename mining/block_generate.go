@@ -53,8 +53,7 @@ func (w *DefaultWorker) Generate(ctx context.Context,
 		return nil, errors.Wrap(err, "get base tip set ancestors")
 	}
 
-	pending := w.messageSource.Pending()
-	mq := NewMessageQueue(pending)
+	mq := NewMessageQueueFromSenders(w.messageSource.PendingBySender())
 	messages := mq.Drain()
 
 	vms := vm.NewStorageMap(w.blockstore)
@@ -23,21 +23,32 @@ type MessageQueue struct {
 	senderQueues queueHeap
 }
 
-// NewMessageQueue allocates and initializes a message queue.
+// NewMessageQueue allocates and initializes a message queue from an unordered
+// slice of messages.
 func NewMessageQueue(msgs []*types.SignedMessage) MessageQueue {
 	// Group messages by sender.
-	bySender := make(map[address.Address]nonceQueue)
+	bySender := make(map[address.Address][]*types.SignedMessage)
 	for _, m := range msgs {
 		bySender[m.From] = append(bySender[m.From], m)
 	}
 
-	// Order each sender queue by nonce and initialize heap structure.
-	addrHeap := make(queueHeap, len(bySender))
-	heapIdx := 0
+	// Order each sender queue by nonce.
 	for _, nq := range bySender {
 		sort.Slice(nq, func(i, j int) bool { return nq[i].Nonce < nq[j].Nonce })
-		addrHeap[heapIdx] = nq
-		heapIdx++
+	}
+
+	return NewMessageQueueFromSenders(bySender)
+}
+
+// NewMessageQueueFromSenders allocates and initializes a message queue from messages
+// already grouped by sender, such as those returned by core.MessagePool.PendingBySender.
+// Each sender's messages must be in increasing nonce order.
+func NewMessageQueueFromSenders(bySender map[address.Address][]*types.SignedMessage) MessageQueue {
+	addrHeap := make(queueHeap, 0, len(bySender))
+	for _, nq := range bySender {
+		if len(nq) > 0 {
+			addrHeap = append(addrHeap, nq)
+		}
 	}
 	heap.Init(&addrHeap)
 
@@ -99,4 +99,22 @@ func TestMessageQueueOrder(t *testing.T) {
 		assert.Equal(expected, actual)
 		assert.True(q.Empty())
 	})
+
+	t.Run("from senders", func(t *testing.T) {
+		msgs := []*types.SignedMessage{
+			sign(a0, to, 0, 0, 1),
+			sign(a0, to, 1, 0, 3),
+			sign(a2, to, 0, 0, 2),
+		}
+		expected := []*types.SignedMessage{msgs[2], msgs[0], msgs[1]}
+
+		q := NewMessageQueueFromSenders(map[address.Address][]*types.SignedMessage{
+			a0: {msgs[0], msgs[1]},
+			a1: {},
+			a2: {msgs[2]},
+		})
+		actual := q.Drain()
+		assert.Equal(expected, actual)
+		assert.True(q.Empty())
+	})
 }
@@ -61,8 +61,9 @@ type GetAncestors func(context.Context, types.TipSet, *types.BlockHeight) ([]typ
 
 // MessageSource provides message candidates for mining into blocks
 type MessageSource interface {
-	// Pending returns a slice of un-mined messages.
-	Pending() []*types.SignedMessage
+	// PendingBySender returns un-mined messages grouped by sender, each group in
+	// increasing nonce order.
+	PendingBySender() map[address.Address][]*types.SignedMessage
 	// Remove removes a message from the source permanently
 	Remove(message cid.Cid)
 }
@@ -78,7 +79,7 @@ type DefaultWorker struct {
 	createPoSTFunc DoSomeWorkFunc
 	minerAddr      address.Address
 	minerOwnerAddr address.Address
-	minerPubKey    []byte
+	workerPubKey   []byte
 	workerSigner   consensus.TicketSigner
 
 	// consensus things
@@ -106,7 +107,7 @@ func NewDefaultWorker(messageSource MessageSource,
 	cst *hamt.CborIpldStore,
 	miner address.Address,
 	minerOwner address.Address,
-	minerPubKey []byte,
+	workerPubKey []byte,
 	workerSigner consensus.TicketSigner,
 	bt time.Duration) *DefaultWorker {
 
@@ -120,7 +121,7 @@ func NewDefaultWorker(messageSource MessageSource,
 		cst,
 		miner,
 		minerOwner,
-		minerPubKey,
+		workerPubKey,
 		workerSigner,
 		bt,
 		func() {})
@@ -143,7 +144,7 @@ func NewDefaultWorkerWithDeps(messageSource MessageSource,
 	cst *hamt.CborIpldStore,
 	miner address.Address,
 	minerOwner address.Address,
-	minerPubKey []byte,
+	workerPubKey []byte,
 	workerSigner consensus.TicketSigner,
 	bt time.Duration,
 	createPoST DoSomeWorkFunc) *DefaultWorker {
@@ -159,7 +160,7 @@ func NewDefaultWorkerWithDeps(messageSource MessageSource,
 		createPoSTFunc: createPoST,
 		minerAddr:      miner,
 		minerOwnerAddr: minerOwner,
-		minerPubKey:    minerPubKey,
+		workerPubKey:   workerPubKey,
 		blockTime:      bt,
 		workerSigner:   workerSigner,
 	}
@@ -214,7 +215,7 @@ func (w *DefaultWorker) Mine(ctx context.Context, base types.TipSet, nullBlkCoun
 			return false
 		}
 		copy(proof[:], prChRead[:])
-		ticket, err = consensus.CreateTicket(proof, w.minerPubKey, w.workerSigner)
+		ticket, err = consensus.CreateTicket(proof, w.workerPubKey, w.workerSigner)
 		if err != nil {
 			log.Errorf("failed to create ticket: %s", err)
 			return false
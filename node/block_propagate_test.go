@@ -148,8 +148,8 @@ func makeNodes(t *testing.T, assertions *assert.Assertions, numNodes int) (addre
 		AutoSealIntervalSecondsOpt(1),
 	)
 	seed.GiveKey(t, minerNode, 0)
-	mineraddr, minerOwnerAddr := seed.GiveMiner(t, minerNode, 0)
-	_, err := storage.NewMiner(mineraddr, minerOwnerAddr, minerNode, minerNode.Repo.DealsDatastore(), minerNode.PorcelainAPI)
+	mineraddr, _ := seed.GiveMiner(t, minerNode, 0)
+	_, err := storage.NewMiner(mineraddr, minerNode, minerNode.Repo.DealsDatastore(), minerNode.PorcelainAPI)
 	assertions.NoError(err)
 
 	nodes := []*Node{minerNode}
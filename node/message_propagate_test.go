@@ -72,6 +72,7 @@ func TestMessagePropagation(t *testing.T) {
 			types.NewAttoFILFromFIL(1),
 			types.NewGasPrice(0),
 			types.NewGasUnits(0),
+			false,
 			"foo",
 		)
 		require.NoError(err)
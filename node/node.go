@@ -17,6 +17,7 @@ import (
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
 	"gx/ipfs/QmSz8kAe2JCKp2dWSG8gHSWnwSmne8YfRXTeK5HBmc9L7t/go-ipfs-exchange-offline"
+	inet "gx/ipfs/QmTGxDz2CjBucFzPNTiWwzQmTWdrBnzqbqrMucDYMsjuPb/go-libp2p-net"
 	libp2ppeer "gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
 	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
@@ -51,13 +52,16 @@ import (
 	"github.com/filecoin-project/go-filecoin/net"
 	"github.com/filecoin-project/go-filecoin/net/pubsub"
 	"github.com/filecoin-project/go-filecoin/plumbing"
+	"github.com/filecoin-project/go-filecoin/plumbing/actrstate"
 	"github.com/filecoin-project/go-filecoin/plumbing/cfg"
 	"github.com/filecoin-project/go-filecoin/plumbing/msg"
 	"github.com/filecoin-project/go-filecoin/plumbing/mthdsig"
+	"github.com/filecoin-project/go-filecoin/plumbing/stdiff"
 	"github.com/filecoin-project/go-filecoin/plumbing/strgdls"
 	"github.com/filecoin-project/go-filecoin/porcelain"
 	"github.com/filecoin-project/go-filecoin/proofs"
 	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+	"github.com/filecoin-project/go-filecoin/protocol/blocksync"
 	"github.com/filecoin-project/go-filecoin/protocol/hello"
 	"github.com/filecoin-project/go-filecoin/protocol/retrieval"
 	"github.com/filecoin-project/go-filecoin/protocol/storage"
@@ -92,6 +96,13 @@ type Node struct {
 
 	PorcelainAPI *porcelain.API
 
+	// AddressHistory indexes the history of each address. It is nil unless
+	// enabled in the config.
+	AddressHistory *chain.AddressHistory
+
+	// StatePruner deletes old state from the blockstore.
+	StatePruner *chain.StatePruner
+
 	// HeavyTipSetCh is a subscription to the heaviest tipset topic on the chain.
 	HeaviestTipSetCh chan interface{}
 	// HeavyTipSetHandled is a hook for tests because pubsub notifications
@@ -126,6 +137,7 @@ type Node struct {
 	MessageSub   pubsub.Subscription
 	Ping         *ping.PingService
 	HelloSvc     *hello.Handler
+	BlockSync    *blocksync.BlockSync
 	Bootstrapper *net.Bootstrapper
 	OnlineStore  *hamt.CborIpldStore
 
@@ -313,13 +325,29 @@ func (nc *Config) buildHost(ctx context.Context, makeDHT func(host host.Host) (r
 	)
 }
 
+// finalityDepth returns the number of tipsets a reorg of the chain may
+// replace: chain.finalityDepth, or datastore.stateRetention if it is not set,
+// as the state needed to validate deeper reorgs may have been garbage
+// collected.
+func finalityDepth(cfg *config.Config) (uint64, error) {
+	depth := cfg.Chain.FinalityDepth
+	if depth == 0 {
+		return cfg.Datastore.StateRetention, nil
+	}
+	if depth > cfg.Datastore.StateRetention {
+		return 0, errors.Errorf("chain.finalityDepth (%d) must not be larger than datastore.stateRetention (%d)", depth, cfg.Datastore.StateRetention)
+	}
+	return depth, nil
+}
+
 // Build instantiates a filecoin Node from the settings specified in the config.
 func (nc *Config) Build(ctx context.Context) (*Node, error) {
 	if nc.Repo == nil {
 		nc.Repo = repo.NewInMemoryRepo()
 	}
 
-	bs := bstore.NewBlockstore(nc.Repo.Datastore())
+	// the blockstore is guarded so that state can be pruned while the node runs
+	bs := chain.NewGuardedBlockstore(bstore.NewBlockstore(nc.Repo.Datastore()))
 
 	validator := blankValidator{}
 
@@ -372,15 +400,24 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 	}
 
 	var chainStore chain.Store = chain.NewDefaultStore(nc.Repo.ChainDatastore(), &cstOffline, genCid)
+	statePruner := chain.NewStatePruner(bs, chainStore, func() types.SortedCidSet {
+		return nc.Repo.Config().Chain.Checkpoint
+	})
 	powerTable := &consensus.MarketView{}
 
-	var processor consensus.Processor
+	var processor *consensus.DefaultProcessor
 	if nc.Rewarder == nil {
 		processor = consensus.NewDefaultProcessor()
 	} else {
 		processor = consensus.NewConfiguredProcessor(consensus.NewDefaultMessageValidator(), nc.Rewarder)
 	}
 
+	var addressHistory *chain.AddressHistory
+	if nc.Repo.Config().Chain.AddressHistory {
+		addressHistory = chain.NewAddressHistory(nc.Repo.ChainDatastore(), chainStore.GetBlocks)
+		processor.SetHistoryRecorder(addressHistory)
+	}
+
 	var nodeConsensus consensus.Protocol
 	if nc.Verifier == nil {
 		nodeConsensus = consensus.NewExpected(&cstOffline, bs, processor, powerTable, genCid, &proofs.RustVerifier{})
@@ -389,12 +426,21 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 	}
 
 	// only the syncer gets the storage which is online connected
-	chainSyncer := chain.NewDefaultSyncer(&cstOnline, &cstOffline, nodeConsensus, chainStore)
+	chainSyncer := chain.NewDefaultSyncer(&cstOnline, &cstOffline, nodeConsensus, chainStore, nc.Repo.ChainDatastore())
+	// set up blocksync, which serves our chain to peers and fetches theirs in bulk
+	blockSync := blocksync.New(peerHost, chainStore.GetBlocks)
+	chainSyncer.SetTipSetFetcher(blockSync)
+	chainSyncer.SetStateGuard(bs)
+	depth, err := finalityDepth(nc.Repo.Config())
+	if err != nil {
+		return nil, err
+	}
+	chainSyncer.SetFinalityDepth(depth)
 	chainReader, ok := chainStore.(chain.ReadStore)
 	if !ok {
 		return nil, errors.New("failed to cast chain.Store to chain.ReadStore")
 	}
-	msgPool := core.NewMessagePool()
+	msgPool := core.NewMessagePoolWithJournal(nc.Repo.Config().Mpool, core.NewMessageJournal(nc.Repo.MessageDatastore()))
 
 	// Set up libp2p pubsub
 	fsub, err := libp2pps.NewFloodSub(ctx, peerHost)
@@ -408,39 +454,49 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 	fcWallet := wallet.New(backend)
 
 	PorcelainAPI := porcelain.New(plumbing.New(&plumbing.APIDeps{
-		Chain:        chainReader,
-		Config:       cfg.NewConfig(nc.Repo),
-		Deals:        strgdls.New(nc.Repo.DealsDatastore()),
-		MsgPool:      msgPool,
-		MsgPreviewer: msg.NewPreviewer(fcWallet, chainReader, &cstOffline, bs),
-		MsgQueryer:   msg.NewQueryer(nc.Repo, fcWallet, chainReader, &cstOffline, bs),
-		MsgSender:    msg.NewSender(fcWallet, chainReader, msgPool, consensus.NewOutboundMessageValidator(), fsub.Publish),
-		MsgWaiter:    msg.NewWaiter(chainReader, bs, &cstOffline),
-		Network:      net.New(peerHost, pubsub.NewPublisher(fsub), pubsub.NewSubscriber(fsub), net.NewRouter(router), bandwidthTracker),
-		SigGetter:    mthdsig.NewGetter(chainReader),
-		Wallet:       fcWallet,
+		ActorInspector: actrstate.NewInspector(chainReader, &cstOffline, bs),
+		AddressHistory: addressHistory,
+		Blockstore:     bs,
+		Chain:          chainReader,
+		Config:         cfg.NewConfig(nc.Repo),
+		Deals:          strgdls.New(nc.Repo.DealsDatastore()),
+		MsgPool:        msgPool,
+		MsgPreviewer:   msg.NewPreviewer(fcWallet, chainReader, &cstOffline, bs),
+		MsgQueryer:     msg.NewQueryer(nc.Repo, fcWallet, chainReader, &cstOffline, bs),
+		MsgReplayer:    msg.NewReplayer(chainReader, &cstOffline, bs),
+		MsgSender:      msg.NewSender(fcWallet, chainReader, msgPool, consensus.NewOutboundMessageValidator(), fsub.Publish),
+		MsgWaiter:      msg.NewWaiter(chainReader, bs, &cstOffline),
+		Network:        net.New(peerHost, pubsub.NewPublisher(fsub), pubsub.NewSubscriber(fsub), net.NewRouter(router), bandwidthTracker),
+		SigGetter:      mthdsig.NewGetter(chainReader),
+		StateDiffer:    stdiff.NewDiffer(chainReader, &cstOffline, bs),
+		StatePruner:    statePruner,
+		Syncer:         chainSyncer,
+		Wallet:         fcWallet,
 	}))
 
 	nd := &Node{
-		blockservice: bservice,
-		Blockstore:   bs,
-		cborStore:    &cstOffline,
-		OnlineStore:  &cstOnline,
-		Consensus:    nodeConsensus,
-		ChainReader:  chainReader,
-		Syncer:       chainSyncer,
-		PowerTable:   powerTable,
-		PorcelainAPI: PorcelainAPI,
-		Exchange:     bswap,
-		host:         peerHost,
-		MsgPool:      msgPool,
-		OfflineMode:  nc.OfflineMode,
-		PeerHost:     peerHost,
-		Ping:         pinger,
-		Repo:         nc.Repo,
-		Wallet:       fcWallet,
-		blockTime:    nc.BlockTime,
-		Router:       router,
+		blockservice:   bservice,
+		Blockstore:     bs,
+		BlockSync:      blockSync,
+		cborStore:      &cstOffline,
+		OnlineStore:    &cstOnline,
+		Consensus:      nodeConsensus,
+		AddressHistory: addressHistory,
+		StatePruner:    statePruner,
+		ChainReader:    chainReader,
+		Syncer:         chainSyncer,
+		PowerTable:     powerTable,
+		PorcelainAPI:   PorcelainAPI,
+		Exchange:       bswap,
+		host:           peerHost,
+		MsgPool:        msgPool,
+		OfflineMode:    nc.OfflineMode,
+		PeerHost:       peerHost,
+		Ping:           pinger,
+		Repo:           nc.Repo,
+		Wallet:         fcWallet,
+		blockTime:      nc.BlockTime,
+		Router:         router,
 	}
 
 	// Bootstrapping network peers.
@@ -473,6 +529,15 @@ func (node *Node) Start(ctx context.Context) error {
 	if err := node.ChainReader.Load(ctx); err != nil {
 		return err
 	}
+	if checkpoint := node.Repo.Config().Chain.Checkpoint; !checkpoint.Empty() {
+		if err := node.Syncer.SetCheckpoint(ctx, checkpoint); err != nil {
+			return errors.Wrap(err, "failed to set chain checkpoint")
+		}
+	}
+
+	if err := node.restoreMessagePool(ctx); err != nil {
+		return err
+	}
 
 	// Only set these up if there is a miner configured.
 	if _, err := node.miningAddress(); err == nil {
@@ -485,14 +550,23 @@ func (node *Node) Start(ctx context.Context) error {
 	// Start up 'hello' handshake service
 	syncCallBack := func(pid libp2ppeer.ID, cids []cid.Cid, height uint64) {
 		// TODO it is possible the syncer interface should be modified to
-		// make use of the additional context not used here (from addr + height).
-		// To keep things simple for now this info is not used.
+		// make use of the additional context not used here (from addr).
+		// The height is only used to report the sync target.
+		node.Syncer.AnnounceHead(pid, types.NewSortedCidSet(cids...), height)
 		err := node.Syncer.HandleNewBlocks(context.Background(), cids)
 		if err != nil {
 			log.Infof("error handling blocks: %s", types.NewSortedCidSet(cids...).String())
 		}
 	}
 	node.HelloSvc = hello.New(node.Host(), node.ChainReader.GenesisCid(), syncCallBack, node.ChainReader.Head)
+	// Peers that go away no longer count towards the sync target.
+	node.Host().Network().Notify(&inet.NotifyBundle{
+		DisconnectedF: func(n inet.Network, c inet.Conn) {
+			if n.Connectedness(c.RemotePeer()) != inet.Connected {
+				node.Syncer.DropPeer(c.RemotePeer())
+			}
+		},
+	})
 
 	cni := storage.NewClientNodeImpl(dag.NewDAGService(node.BlockService()), node.Host(), node.Ping, node.GetBlockTime())
 	var err error
@@ -524,10 +598,25 @@ func (node *Node) Start(ctx context.Context) error {
 	go node.handleSubscription(cctx, node.processBlock, "processBlock", node.BlockSub, "BlockSub")
 	go node.handleSubscription(cctx, node.processMessage, "processMessage", node.MessageSub, "MessageSub")
 
+	// Catch the address history up with the loaded head.
+	if node.AddressHistory != nil && node.ChainReader.Head() != nil {
+		if err := node.AddressHistory.Update(ctx, node.ChainReader.Head()); err != nil {
+			log.Errorf("error updating address history: %s", err)
+		}
+	}
+
 	node.HeaviestTipSetHandled = func() {}
 	node.HeaviestTipSetCh = node.ChainReader.HeadEvents().Sub(chain.NewHeadTopic)
 	go node.handleNewHeaviestTipSet(cctx, node.ChainReader.Head())
 
+	if gcPeriod := node.Repo.Config().Datastore.GCPeriod; gcPeriod != "" {
+		period, err := time.ParseDuration(gcPeriod)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't parse gc period %s", gcPeriod)
+		}
+		go node.StatePruner.Run(cctx, period, node.Repo.Config().Datastore.StateRetention)
+	}
+
 	if !node.OfflineMode {
 		node.Bootstrapper.Start(context.Background())
 	}
@@ -550,10 +639,13 @@ func (node *Node) setupHeartbeatServices(ctx context.Context) error {
 		}
 		return addr
 	}
+	syncing := func() bool {
+		return node.Syncer.Status().Stage != chain.SyncIdle
+	}
 
 	// start the primary heartbeat service
 	if len(node.Repo.Config().Heartbeat.BeatTarget) > 0 {
-		hbs := metrics.NewHeartbeatService(node.Host(), node.Repo.Config().Heartbeat, node.ChainReader.Head, metrics.WithMinerAddressGetter(mag))
+		hbs := metrics.NewHeartbeatService(node.Host(), node.Repo.Config().Heartbeat, node.ChainReader.Head, metrics.WithMinerAddressGetter(mag), metrics.WithSyncingGetter(syncing))
 		go hbs.Start(ctx)
 	}
 
@@ -565,7 +657,7 @@ func (node *Node) setupHeartbeatServices(ctx context.Context) error {
 			BeatPeriod:      "10s",
 			ReconnectPeriod: "10s",
 			Nickname:        node.Repo.Config().Heartbeat.Nickname,
-		}, node.ChainReader.Head, metrics.WithMinerAddressGetter(mag))
+		}, node.ChainReader.Head, metrics.WithMinerAddressGetter(mag), metrics.WithSyncingGetter(syncing))
 		go ahbs.Start(ctx)
 	}
 	return nil
@@ -653,6 +745,22 @@ func (node *Node) handleNewHeaviestTipSet(ctx context.Context, head types.TipSet
 			}
 			head = newHead
 
+			if node.AddressHistory != nil {
+				if err := node.AddressHistory.Update(ctx, newHead); err != nil {
+					log.Error("error updating address history for new tipset:", err)
+				}
+			}
+
+			// Drop or park pending messages that are no longer valid against the new state.
+			if err := node.revalidateMessagePool(ctx, newHead); err != nil {
+				log.Error("error revalidating message pool for new tipset:", err)
+			}
+
+			// Republish our own messages that the network seems to have dropped.
+			if height, err := newHead.Height(); err == nil {
+				node.publishMessages(node.MsgPool.DueForRebroadcast(height))
+			}
+
 			if node.StorageMiner != nil {
 				node.StorageMiner.OnNewHeaviestTipSet(newHead)
 			}
@@ -663,6 +771,58 @@ func (node *Node) handleNewHeaviestTipSet(ctx context.Context, head types.TipSet
 	}
 }
 
+// restoreMessagePool reloads the messages persisted by a previous run into the
+// message pool, drops any that are no longer valid against the loaded head, and
+// republishes our own messages, which may never have reached the network.
+func (node *Node) restoreMessagePool(ctx context.Context) error {
+	// Bring the pool up to the loaded head first so that the TTLs of restored
+	// messages are checked against it.
+	if err := node.revalidateMessagePool(ctx, node.ChainReader.Head()); err != nil {
+		return errors.Wrap(err, "failed to revalidate message pool")
+	}
+	if err := node.MsgPool.Restore(); err != nil {
+		return errors.Wrap(err, "failed to restore message pool")
+	}
+	if err := node.revalidateMessagePool(ctx, node.ChainReader.Head()); err != nil {
+		return errors.Wrap(err, "failed to revalidate message pool")
+	}
+
+	node.publishMessages(node.MsgPool.PendingLocal())
+	return nil
+}
+
+// publishMessages publishes the given messages on the message topic.
+func (node *Node) publishMessages(msgs []*types.SignedMessage) {
+	for _, smsg := range msgs {
+		data, err := smsg.Marshal()
+		if err != nil {
+			log.Warningf("failed to marshal message for republishing: %s", err)
+			continue
+		}
+		if err := node.PorcelainAPI.PubSubPublish(msg.Topic, data); err != nil {
+			log.Warningf("failed to republish message: %s", err)
+		}
+	}
+}
+
+// revalidateMessagePool checks the pending messages in the message pool against
+// the state of the given tipset.
+func (node *Node) revalidateMessagePool(ctx context.Context, ts types.TipSet) error {
+	tsas, err := node.ChainReader.GetTipSetAndState(ctx, ts.String())
+	if err != nil {
+		return err
+	}
+	st, err := state.LoadStateTree(ctx, node.CborStore(), tsas.TipSetStateRoot, builtin.Actors)
+	if err != nil {
+		return err
+	}
+	height, err := ts.Height()
+	if err != nil {
+		return err
+	}
+	return node.MsgPool.Revalidate(ctx, st, consensus.NewDefaultMessageValidator(), height)
+}
+
 func (node *Node) cancelSubscriptions() {
 	if node.BlockSub != nil || node.MessageSub != nil {
 		node.cancelSubscriptionsCtx()
@@ -771,10 +931,16 @@ func (node *Node) StartMining(ctx context.Context) error {
 		}
 	}
 
+	// The owner receives the rewards of the blocks the node mines, and the
+	// worker signs their tickets.
 	minerOwnerAddr, err := node.miningOwnerAddress(ctx, minerAddr)
 	if err != nil {
 		return errors.Wrapf(err, "failed to get mining owner address for miner %s", minerAddr)
 	}
+	workerPubKey, err := node.miningWorkerKey(ctx, minerAddr)
+	if err != nil {
+		return err
+	}
 
 	blockTime, mineDelay := node.MiningTimes()
 
@@ -809,14 +975,8 @@ func (node *Node) StartMining(ctx context.Context) error {
 		}
 		processor := consensus.NewDefaultProcessor()
 
-		minerPubKey, err := node.PorcelainAPI.MinerGetKey(ctx, minerAddr)
-		if err != nil {
-			log.Errorf("could not getKey from miner actor")
-			return err
-		}
-
 		worker := mining.NewDefaultWorker(node.MsgPool, getState, getWeight, getAncestors, processor, node.PowerTable,
-			node.Blockstore, node.CborStore(), minerAddr, minerOwnerAddr, minerPubKey, node.Wallet, blockTime)
+			node.Blockstore, node.CborStore(), minerAddr, minerOwnerAddr, workerPubKey, node.Wallet, blockTime)
 		node.MiningScheduler = mining.NewScheduler(worker, mineDelay, node.ChainReader.Head)
 	}
 
@@ -853,11 +1013,19 @@ func (node *Node) StartMining(ctx context.Context) error {
 					gasUnits := types.NewGasUnits(300)
 
 					val := result.SealingResult
+
+					// Sectors are committed by the worker of the miner, which may have changed since mining started.
+					minerWorkerAddr, err := node.PorcelainAPI.MinerGetWorkerAddress(node.miningCtx, minerAddr)
+					if err != nil {
+						log.Errorf("failed to get worker of miner %s to commit sector with id %d: %s", minerAddr, val.SectorID, err)
+						continue
+					}
+
 					// This call can fail due to, e.g. nonce collisions. Our miners existence depends on this.
 					// We should deal with this, but MessageSendWithRetry is problematic.
-					_, err := node.PorcelainAPI.MessageSend(
+					msgCid, err := node.PorcelainAPI.MessageSend(
 						node.miningCtx,
-						minerOwnerAddr,
+						minerWorkerAddr,
 						minerAddr,
 						nil,
 						gasPrice,
@@ -870,11 +1038,11 @@ func (node *Node) StartMining(ctx context.Context) error {
 						val.Proof[:],
 					)
 					if err != nil {
-						log.Errorf("failed to send commitSector message from %s to %s for sector with id %d: %s", minerOwnerAddr, minerAddr, val.SectorID, err)
+						log.Errorf("failed to send commitSector message from %s to %s for sector with id %d: %s", minerWorkerAddr, minerAddr, val.SectorID, err)
 						continue
 					}
 
-					node.StorageMiner.OnCommitmentAddedToChain(val, nil)
+					node.StorageMiner.OnCommitmentSent(val, msgCid, nil)
 				}
 			case <-node.miningCtx.Done():
 				return
@@ -968,12 +1136,14 @@ func initStorageMinerForNode(ctx context.Context, node *Node) (*storage.Miner, e
 		return nil, errors.Wrap(err, "failed to get node's mining address")
 	}
 
-	miningOwnerAddr, err := node.miningOwnerAddress(ctx, minerAddr)
-	if err != nil {
-		return nil, errors.Wrap(err, "no mining owner available, skipping storage miner setup")
+	// The storage miner sends its messages from the worker of the miner, and
+	// is paid by the payment channels of clients to its owner, which it reads
+	// from the chain when it checks them.
+	if _, err := node.miningWorkerKey(ctx, minerAddr); err != nil {
+		return nil, errors.Wrap(err, "no mining worker available, skipping storage miner setup")
 	}
 
-	miner, err := storage.NewMiner(minerAddr, miningOwnerAddr, node, node.Repo.DealsDatastore(), node.PorcelainAPI)
+	miner, err := storage.NewMiner(minerAddr, node, node.Repo.DealsDatastore(), node.PorcelainAPI)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to instantiate storage miner")
 	}
@@ -1030,6 +1200,7 @@ func (node *Node) CreateMiner(ctx context.Context, minerOwnerAddr address.Addres
 		collateral,
 		gasPrice,
 		gasLimit,
+		false,
 		"createMiner",
 		big.NewInt(int64(pledge)),
 		pubKey,
@@ -1086,6 +1257,21 @@ func (node *Node) miningOwnerAddress(ctx context.Context, miningAddr address.Add
 	return address.NewFromBytes(res[0])
 }
 
+// miningWorkerKey returns the public key of the worker of miningAddr, which
+// operates the miner on behalf of its owner and signs its tickets. The worker
+// must be in the wallet of the node.
+func (node *Node) miningWorkerKey(ctx context.Context, miningAddr address.Address) ([]byte, error) {
+	workerAddr, err := node.PorcelainAPI.MinerGetWorkerAddress(ctx, miningAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to getWorker")
+	}
+	pubKey, err := node.Wallet.GetPubKeyForAddress(workerAddr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get key of worker %s of miner %s", workerAddr, miningAddr)
+	}
+	return pubKey, nil
+}
+
 // BlockHeight returns the current block height of the chain.
 func (node *Node) BlockHeight() (*types.BlockHeight, error) {
 	head := node.ChainReader.Head()
@@ -177,7 +177,7 @@ func TestNodeStartMining(t *testing.T) {
 	mineraddr, minerOwnerAddr := seed.GiveMiner(t, minerNode, 0)
 	require.Equal(t, provisionalOwnerAddr, minerOwnerAddr)
 
-	_, err := storage.NewMiner(mineraddr, minerOwnerAddr, minerNode, minerNode.Repo.DealsDatastore(), porcelainAPI)
+	_, err := storage.NewMiner(mineraddr, minerNode, minerNode.Repo.DealsDatastore(), porcelainAPI)
 	assert.NoError(err)
 
 	assert.NoError(minerNode.Start(ctx))
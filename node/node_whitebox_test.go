@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+
+	"github.com/filecoin-project/go-filecoin/config"
 )
 
 func TestMakePrivateKey(t *testing.T) {
@@ -25,3 +27,26 @@ func TestMakePrivateKey(t *testing.T) {
 	assert.NoError(err)
 	assert.NotNil(goodKey)
 }
+
+func TestFinalityDepth(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	cfg := config.NewDefaultConfig()
+	cfg.Datastore.StateRetention = 100
+
+	// defaults to the state retention
+	depth, err := finalityDepth(cfg)
+	assert.NoError(err)
+	assert.Equal(uint64(100), depth)
+
+	cfg.Chain.FinalityDepth = 50
+	depth, err = finalityDepth(cfg)
+	assert.NoError(err)
+	assert.Equal(uint64(50), depth)
+
+	// reorgs deeper than the retained state could not be validated
+	cfg.Chain.FinalityDepth = 101
+	_, err = finalityDepth(cfg)
+	assert.Error(err)
+}
@@ -0,0 +1,137 @@
+package actrstate
+
+import (
+	"context"
+	"math/big"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+// View is an actor in the state of a tipset, along with its decoded storage.
+type View struct {
+	Address   address.Address    `json:"address"`
+	TipSet    types.SortedCidSet `json:"tipset"`
+	ActorType string             `json:"actorType"`
+	Code      cid.Cid            `json:"code"`
+	Head      cid.Cid            `json:"head"`
+	Nonce     uint64             `json:"nonce"`
+	Balance   *types.AttoFIL     `json:"balance"`
+	// State is the decoded storage of the actor: a *miner.State for miners,
+	// a *StorageMarketState for the storage market and the payment channels
+	// by payer and channel id for the payment broker. It is nil for actors
+	// without storage or with unknown code.
+	State interface{} `json:"state"`
+}
+
+// StorageMarketState is the decoded storage of the storage market actor.
+type StorageMarketState struct {
+	Miners                []address.Address `json:"miners"`
+	TotalCommittedStorage *big.Int          `json:"totalCommittedStorage"`
+}
+
+// Inspector reads actors and decodes their storage outside of the VM.
+type Inspector struct {
+	// To get the state roots of tipsets.
+	chainReader chain.ReadStore
+	// To load the state trees and typed actor state.
+	cst *hamt.CborIpldStore
+	// For vm storage.
+	bs bstore.Blockstore
+}
+
+// NewInspector constructs an Inspector.
+func NewInspector(chainReader chain.ReadStore, cst *hamt.CborIpldStore, bs bstore.Blockstore) *Inspector {
+	return &Inspector{chainReader, cst, bs}
+}
+
+// Show returns the actor at addr in the state after tipset at, or after the
+// head if at is empty, with its storage decoded if it is a builtin actor.
+func (i *Inspector) Show(ctx context.Context, addr address.Address, at types.SortedCidSet) (*View, error) {
+	if at.Empty() {
+		at = i.chainReader.Head().ToSortedCidSet()
+	}
+	tsas, err := i.chainReader.GetTipSetAndState(ctx, at.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get state of tipset %s", at.String())
+	}
+	st, err := state.LoadStateTree(ctx, i.cst, tsas.TipSetStateRoot, builtin.Actors)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load state tree %s", tsas.TipSetStateRoot.String())
+	}
+	act, err := st.GetActor(ctx, addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get actor %s", addr.String())
+	}
+
+	view := &View{
+		Address:   addr,
+		TipSet:    at,
+		ActorType: actorType(act.Code),
+		Code:      act.Code,
+		Head:      act.Head,
+		Nonce:     uint64(act.Nonce),
+		Balance:   act.Balance,
+	}
+	view.State, err = i.decodeStorage(ctx, act)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode storage of actor %s", addr.String())
+	}
+	return view, nil
+}
+
+func (i *Inspector) decodeStorage(ctx context.Context, act *actor.Actor) (interface{}, error) {
+	if !act.Head.Defined() {
+		return nil, nil
+	}
+
+	switch {
+	case act.Code.Equals(types.MinerActorCodeCid), act.Code.Equals(types.BootstrapMinerActorCodeCid):
+		var st miner.State
+		if err := i.cst.Get(ctx, act.Head, &st); err != nil {
+			return nil, err
+		}
+		return &st, nil
+	case act.Code.Equals(types.StorageMarketActorCodeCid):
+		var st storagemarket.State
+		if err := i.cst.Get(ctx, act.Head, &st); err != nil {
+			return nil, err
+		}
+		storage := vm.NewStorage(i.bs, act)
+		miners, err := storagemarket.AllMiners(ctx, &storage)
+		if err != nil {
+			return nil, err
+		}
+		return &StorageMarketState{
+			Miners:                miners,
+			TotalCommittedStorage: st.TotalCommittedStorage,
+		}, nil
+	case act.Code.Equals(types.PaymentBrokerActorCodeCid):
+		storage := vm.NewStorage(i.bs, act)
+		return paymentbroker.AllChannels(ctx, &storage)
+	default:
+		return nil, nil
+	}
+}
+
+// actorType names the builtin actor with the given code, e.g. "MinerActor".
+func actorType(code cid.Cid) string {
+	impl, ok := builtin.Actors[code]
+	if !ok {
+		return "UnknownActor"
+	}
+	return builtin.ActorType(impl)
+}
@@ -0,0 +1,105 @@
+package actrstate
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmSz8kAe2JCKp2dWSG8gHSWnwSmne8YfRXTeK5HBmc9L7t/go-ipfs-exchange-offline"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/repo"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+func TestInspectorShow(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	require := require.New(t)
+
+	bs := bstore.NewBlockstore(datastore.NewMapDatastore())
+	cst := &hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
+	vms := vm.NewStorageMap(bs)
+
+	addrGetter := address.NewForTestGetter()
+	accountAddr, minerAddr, ownerAddr, unknownAddr := addrGetter(), addrGetter(), addrGetter(), addrGetter()
+	pid := th.RequireRandomPeerID()
+
+	minerAct := th.RequireNewMinerActor(require, vms, minerAddr, ownerAddr, []byte{}, 10, pid, types.NewZeroAttoFIL())
+
+	// The account has a different balance in the state of each tipset.
+	var tipsets []types.TipSet
+	var parent *types.Block
+	for i := 0; i < 2; i++ {
+		root, _ := th.RequireMakeStateTree(require, cst, map[address.Address]*actor.Actor{
+			accountAddr: th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(uint64(100+i))),
+			minerAddr:   minerAct,
+		})
+		blk := types.NewBlockForTest(parent, uint64(i))
+		blk.StateRoot = root
+		tipsets = append(tipsets, types.RequireNewTipSet(require, blk))
+		parent = blk
+	}
+
+	store := chain.NewDefaultStore(repo.NewInMemoryRepo().ChainDatastore(), cst, tipsets[0].ToSlice()[0].Cid())
+	for _, ts := range tipsets {
+		chain.RequirePutTsas(ctx, require, store, &chain.TipSetAndState{
+			TipSet:          ts,
+			TipSetStateRoot: ts.ToSlice()[0].StateRoot,
+		})
+	}
+	require.NoError(store.SetHead(ctx, tipsets[1]))
+
+	inspector := NewInspector(store, cst, bs)
+
+	t.Run("shows an actor in the state of the head", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		view, err := inspector.Show(ctx, accountAddr, types.SortedCidSet{})
+		require.NoError(err)
+		assert.Equal("AccountActor", view.ActorType)
+		assert.Equal(tipsets[1].ToSortedCidSet(), view.TipSet)
+		assert.Equal(types.NewAttoFILFromFIL(101), view.Balance)
+		assert.Nil(view.State)
+	})
+
+	t.Run("shows an actor in the state of an earlier tipset", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		view, err := inspector.Show(ctx, accountAddr, tipsets[0].ToSortedCidSet())
+		require.NoError(err)
+		assert.Equal(tipsets[0].ToSortedCidSet(), view.TipSet)
+		assert.Equal(types.NewAttoFILFromFIL(100), view.Balance)
+	})
+
+	t.Run("decodes the storage of a miner", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		view, err := inspector.Show(ctx, minerAddr, types.SortedCidSet{})
+		require.NoError(err)
+		assert.Equal("MinerActor", view.ActorType)
+		require.IsType(&miner.State{}, view.State)
+		st := view.State.(*miner.State)
+		assert.Equal(ownerAddr, st.Owner)
+		assert.Equal(pid, st.PeerID)
+	})
+
+	t.Run("fails for an actor that does not exist", func(t *testing.T) {
+		_, err := inspector.Show(ctx, unknownAddr, types.SortedCidSet{})
+		assert.Error(t, err)
+	})
+}
@@ -2,11 +2,15 @@ package plumbing
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 
 	ma "gx/ipfs/QmNTCey11oxhb1AxDnQBRHtdhap6Ctud872NjAYPYYXPuc/go-multiaddr"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	pstore "gx/ipfs/QmRhFARzTHcFh8wUxwN5KvyTGq73FLC65EfFAhz8Ng7aGb/go-libp2p-peerstore"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
 	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	"gx/ipfs/QmZZseAa9xcK6tT3YpaShNUAEpyRAoWmUL5ojH3uGNepAc/go-libp2p-metrics"
 	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
 
@@ -17,9 +21,11 @@ import (
 	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/net"
 	"github.com/filecoin-project/go-filecoin/net/pubsub"
+	"github.com/filecoin-project/go-filecoin/plumbing/actrstate"
 	"github.com/filecoin-project/go-filecoin/plumbing/cfg"
 	"github.com/filecoin-project/go-filecoin/plumbing/msg"
 	"github.com/filecoin-project/go-filecoin/plumbing/mthdsig"
+	"github.com/filecoin-project/go-filecoin/plumbing/stdiff"
 	"github.com/filecoin-project/go-filecoin/plumbing/strgdls"
 	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -34,32 +40,47 @@ import (
 type API struct {
 	logger logging.EventLogger
 
-	chain        chain.ReadStore
-	config       *cfg.Config
-	msgPool      *core.MessagePool
-	msgPreviewer *msg.Previewer
-	msgQueryer   *msg.Queryer
-	msgSender    *msg.Sender
-	msgWaiter    *msg.Waiter
-	network      *net.Network
-	sigGetter    *mthdsig.Getter
-	wallet       *wallet.Wallet
-	storagedeals *strgdls.Store
+	actorInspector *actrstate.Inspector
+	addressHistory *chain.AddressHistory
+	blockstore     bstore.Blockstore
+	chain          chain.ReadStore
+	config         *cfg.Config
+	msgPool        *core.MessagePool
+	msgPreviewer   *msg.Previewer
+	msgQueryer     *msg.Queryer
+	msgReplayer    *msg.Replayer
+	msgSender      *msg.Sender
+	msgWaiter      *msg.Waiter
+	network        *net.Network
+	sigGetter      *mthdsig.Getter
+	stateDiffer    *stdiff.Differ
+	statePruner    *chain.StatePruner
+	syncer         chain.Syncer
+	wallet         *wallet.Wallet
+	storagedeals   *strgdls.Store
 }
 
 // APIDeps contains all the API's dependencies
 type APIDeps struct {
-	Chain        chain.ReadStore
-	Config       *cfg.Config
-	Deals        *strgdls.Store
-	MsgPool      *core.MessagePool
-	MsgPreviewer *msg.Previewer
-	MsgQueryer   *msg.Queryer
-	MsgSender    *msg.Sender
-	MsgWaiter    *msg.Waiter
-	Network      *net.Network
-	SigGetter    *mthdsig.Getter
-	Wallet       *wallet.Wallet
+	ActorInspector *actrstate.Inspector
+	// AddressHistory is nil if address history is not enabled.
+	AddressHistory *chain.AddressHistory
+	Blockstore     bstore.Blockstore
+	Chain          chain.ReadStore
+	Config         *cfg.Config
+	Deals          *strgdls.Store
+	MsgPool        *core.MessagePool
+	MsgPreviewer   *msg.Previewer
+	MsgQueryer     *msg.Queryer
+	MsgReplayer    *msg.Replayer
+	MsgSender      *msg.Sender
+	MsgWaiter      *msg.Waiter
+	Network        *net.Network
+	SigGetter      *mthdsig.Getter
+	StateDiffer    *stdiff.Differ
+	StatePruner    *chain.StatePruner
+	Syncer         chain.Syncer
+	Wallet         *wallet.Wallet
 }
 
 // New constructs a new instance of the API.
@@ -67,20 +88,31 @@ func New(deps *APIDeps) *API {
 	return &API{
 		logger: logging.Logger("porcelain"),
 
-		chain:        deps.Chain,
-		config:       deps.Config,
-		msgPool:      deps.MsgPool,
-		msgPreviewer: deps.MsgPreviewer,
-		msgQueryer:   deps.MsgQueryer,
-		msgSender:    deps.MsgSender,
-		msgWaiter:    deps.MsgWaiter,
-		network:      deps.Network,
-		sigGetter:    deps.SigGetter,
-		wallet:       deps.Wallet,
-		storagedeals: deps.Deals,
+		actorInspector: deps.ActorInspector,
+		addressHistory: deps.AddressHistory,
+		blockstore:     deps.Blockstore,
+		chain:          deps.Chain,
+		config:         deps.Config,
+		msgPool:        deps.MsgPool,
+		msgPreviewer:   deps.MsgPreviewer,
+		msgQueryer:     deps.MsgQueryer,
+		msgReplayer:    deps.MsgReplayer,
+		msgSender:      deps.MsgSender,
+		msgWaiter:      deps.MsgWaiter,
+		network:        deps.Network,
+		sigGetter:      deps.SigGetter,
+		stateDiffer:    deps.StateDiffer,
+		statePruner:    deps.StatePruner,
+		syncer:         deps.Syncer,
+		wallet:         deps.Wallet,
+		storagedeals:   deps.Deals,
 	}
 }
 
+// ErrAddressHistoryDisabled is returned when asked for the history of an
+// address by a node that does not index it.
+var ErrAddressHistoryDisabled = errors.New("address history is not enabled, set chain.addressHistory in the config and restart the daemon")
+
 // ActorGetSignature returns the signature of the given actor's given method.
 // The function signature is typically used to enable a caller to decode the
 // output of an actor method call (message).
@@ -115,11 +147,122 @@ func (api *API) GetRecentAncestorsOfHeaviestChain(ctx context.Context, descendan
 	return chain.GetRecentAncestorsOfHeaviestChain(ctx, api.chain, descendantBlockHeight)
 }
 
+// ChainTipSetAtHeight returns the tipset of the current chain whose state is the state
+// at height h: the tipset at h, or the last one before it if h is a null round.
+func (api *API) ChainTipSetAtHeight(ctx context.Context, h uint64) (types.TipSet, error) {
+	return chain.GetTipSetAtHeight(ctx, api.chain, h)
+}
+
 // ChainLs returns a channel of tipsets from head to genesis
 func (api *API) ChainLs(ctx context.Context) <-chan interface{} {
 	return api.chain.BlockHistory(ctx, api.chain.Head())
 }
 
+// ChainGetMessageLocation returns where a message was included in the chain
+// ending at the current head, or nil if it has not been included.
+func (api *API) ChainGetMessageLocation(ctx context.Context, msgCid cid.Cid) (*chain.MessageLocation, error) {
+	return api.chain.GetMessageLocation(ctx, msgCid)
+}
+
+// ChainExport writes the chain ending at the head to out as a CAR file. If
+// height is not nil the chain ends at the highest tipset at or below it
+// instead.
+func (api *API) ChainExport(ctx context.Context, height *types.BlockHeight, out io.Writer) error {
+	head := api.chain.Head()
+	if height != nil {
+		var err error
+		if head, err = chain.GetTipSetAtHeight(ctx, api.chain, height.AsBigInt().Uint64()); err != nil {
+			return err
+		}
+	}
+	return chain.Export(ctx, api.chain, api.blockstore, head, out)
+}
+
+// ChainImport loads a chain written by ChainExport from in and adds it to
+// the chain store, switching the head to it if it is heavier. Unless trust is
+// set the chain is validated by running its state transitions. It returns
+// the head of the imported chain.
+func (api *API) ChainImport(ctx context.Context, in io.Reader, trust bool) (types.TipSet, error) {
+	snapshot, err := chain.LoadSnapshot(api.blockstore, in)
+	if err != nil {
+		return nil, err
+	}
+	if err := api.syncer.HandleSnapshot(ctx, snapshot, trust); err != nil {
+		return nil, errors.Wrap(err, "failed to import chain")
+	}
+
+	var blks []*types.Block
+	for it := snapshot.Head.Iter(); !it.Complete(); it.Next() {
+		blk, err := api.chain.GetBlock(ctx, it.Value())
+		if err != nil {
+			return nil, err
+		}
+		blks = append(blks, blk)
+	}
+	return types.NewTipSet(blks...)
+}
+
+// ChainSyncStatus returns the status of the chain syncer, which tells
+// whether the node is caught up with the heads announced by its peers.
+func (api *API) ChainSyncStatus() chain.SyncStatus {
+	return api.syncer.Status()
+}
+
+// ChainBadTipSets returns the tipsets the syncer has found to be invalid, or
+// to descend from an invalid tipset, highest first.
+func (api *API) ChainBadTipSets() []*chain.BadTipSet {
+	return api.syncer.BadTipSets()
+}
+
+// ChainRemoveBadTipSet forgets that the tipset with the given key is bad,
+// along with the tipsets that are bad because they descend from it, so that
+// they are synced again. It returns the number of tipsets forgotten.
+func (api *API) ChainRemoveBadTipSet(key types.SortedCidSet) (int, error) {
+	return api.syncer.RemoveBadTipSet(key)
+}
+
+// ChainClearBadTipSets forgets all bad tipsets and returns their number.
+func (api *API) ChainClearBadTipSets() (int, error) {
+	return api.syncer.ClearBadTipSets()
+}
+
+// ChainSetCheckpoint pins the tipset with the given key, which must be on the
+// current chain, as final: the syncer refuses chains that do not include it.
+// The checkpoint is saved in the config so that it outlives the daemon.
+func (api *API) ChainSetCheckpoint(ctx context.Context, key types.SortedCidSet) error {
+	if err := api.syncer.SetCheckpoint(ctx, key); err != nil {
+		return err
+	}
+	keyJSON, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return api.config.Set("chain.checkpoint", string(keyJSON))
+}
+
+// RepoGC deletes the state that is not reachable from the states of the
+// last keep tipsets of the chain, the genesis tipset or the checkpoint.
+func (api *API) RepoGC(ctx context.Context, keep uint64) (*chain.PruneResult, error) {
+	return api.statePruner.Prune(ctx, keep)
+}
+
+// StateDiff returns the actors added, removed or changed going from the
+// state of tipset from to the state of tipset to. If decodeStorage is set,
+// the changes in the storage of miner and payment broker actors are decoded.
+func (api *API) StateDiff(ctx context.Context, from, to types.SortedCidSet, decodeStorage bool) (*stdiff.Diff, error) {
+	return api.stateDiffer.Diff(ctx, from, to, decodeStorage)
+}
+
+// AddressHistory returns the messages and value transfers involving addr in
+// tipsets between fromHeight and toHeight inclusive, oldest first. A toHeight
+// of zero means no upper bound.
+func (api *API) AddressHistory(ctx context.Context, addr address.Address, fromHeight, toHeight uint64) ([]*chain.AddressHistoryEntry, error) {
+	if api.addressHistory == nil {
+		return nil, ErrAddressHistoryDisabled
+	}
+	return api.addressHistory.History(ctx, addr, fromHeight, toHeight)
+}
+
 // ActorGet returns an actor from the latest state on the chain
 func (api *API) ActorGet(ctx context.Context, addr address.Address) (*actor.Actor, error) {
 	state, err := api.chain.LatestState(ctx)
@@ -129,6 +272,12 @@ func (api *API) ActorGet(ctx context.Context, addr address.Address) (*actor.Acto
 	return state.GetActor(ctx, addr)
 }
 
+// ActorShow returns the actor at addr in the state after the tipset at, or
+// after the head if at is empty, with the storage of builtin actors decoded.
+func (api *API) ActorShow(ctx context.Context, addr address.Address, at types.SortedCidSet) (*actrstate.View, error) {
+	return api.actorInspector.Show(ctx, addr, at)
+}
+
 // BlockGet gets a block by CID
 func (api *API) BlockGet(ctx context.Context, id cid.Cid) (*types.Block, error) {
 	return api.chain.GetBlock(ctx, id)
@@ -149,6 +298,11 @@ func (api *API) MessagePoolPending() []*types.SignedMessage {
 	return api.msgPool.Pending()
 }
 
+// MessagePoolStatus describes the messages in the pool and why they are pending.
+func (api *API) MessagePoolStatus() []core.MessageStatus {
+	return api.msgPool.Status()
+}
+
 // MessagePoolGet fetches a message from the pool.
 func (api *API) MessagePoolGet(cid cid.Cid) (value *types.SignedMessage, ok bool) {
 	return api.msgPool.Get(cid)
@@ -172,6 +326,19 @@ func (api *API) MessageQuery(ctx context.Context, optFrom, to address.Address, m
 	return api.msgQueryer.Query(ctx, optFrom, to, method, params...)
 }
 
+// MessageQueryAt is like MessageQuery, but uses the chain state after the tipset with
+// key at, or after the head if at is empty. Use ChainTipSetAtHeight to query the state
+// at a given height.
+func (api *API) MessageQueryAt(ctx context.Context, at types.SortedCidSet, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
+	return api.msgQueryer.QueryAt(ctx, at, optFrom, to, method, params...)
+}
+
+// MessageReplay applies the message with the given CID again over the state it was
+// applied to when its tipset was processed, and returns the trace of its execution.
+func (api *API) MessageReplay(ctx context.Context, msgCid cid.Cid) (*msg.Replay, error) {
+	return api.msgReplayer.Replay(ctx, msgCid)
+}
+
 // MessageSend sends a message. It uses the default from address if none is given and signs the
 // message using the wallet. This call "sends" in the sense that it enqueues the
 // message in the msg pool and broadcasts it to the network; it does not wait for the
@@ -181,6 +348,14 @@ func (api *API) MessageSend(ctx context.Context, from, to address.Address, value
 	return api.msgSender.Send(ctx, from, to, value, gasPrice, gasLimit, method, params...)
 }
 
+// MessageSendReplacement signs and sends a message using the nonce it already
+// carries, replacing the pending message with the same sender and nonce. The
+// message pool only accepts the replacement if its gas price is higher than
+// the original's.
+func (api *API) MessageSendReplacement(ctx context.Context, msg types.Message, gasPrice types.AttoFIL, gasLimit types.GasUnits) (cid.Cid, error) {
+	return api.msgSender.Replace(ctx, msg, gasPrice, gasLimit)
+}
+
 // MessageWait invokes the callback when a message with the given cid appears on chain.
 // It will find the message in both the case that it is already on chain and
 // the case that it appears in a newly mined block. An error is returned if one is
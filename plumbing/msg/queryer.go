@@ -26,9 +26,9 @@ type Queryer struct {
 	// For getting the default address. Lame.
 	repo   repo.Repo
 	wallet *wallet.Wallet
-	// To get the head tipset state root.
+	// To get the tipset state root.
 	chainReader chain.ReadStore
-	// To load the tree for the head tipset state root.
+	// To load the tree for the tipset state root.
 	cst *hamt.CborIpldStore
 	// For vm storage.
 	bs bstore.Blockstore
@@ -41,6 +41,12 @@ func NewQueryer(repo repo.Repo, wallet *wallet.Wallet, chainReader chain.ReadSto
 
 // Query sends a read-only message to an actor.
 func (q *Queryer) Query(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
+	return q.QueryAt(ctx, types.SortedCidSet{}, optFrom, to, method, params...)
+}
+
+// QueryAt sends a read-only message to an actor, run against the state after
+// the tipset with key at, or after the head if at is empty.
+func (q *Queryer) QueryAt(ctx context.Context, at types.SortedCidSet, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
 	encodedParams, err := abi.ToEncodedValues(params...)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "couldnt encode message params")
@@ -55,16 +61,19 @@ func (q *Queryer) Query(ctx context.Context, optFrom, to address.Address, method
 		return nil, nil, errors.Wrap(err, "unable to determine return type")
 	}
 
-	headTs := q.chainReader.Head()
-	tsas, err := q.chainReader.GetTipSetAndState(ctx, headTs.String())
+	key := at.String()
+	if at.Empty() {
+		key = q.chainReader.Head().String()
+	}
+	tsas, err := q.chainReader.GetTipSetAndState(ctx, key)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "couldnt get latest state root")
+		return nil, nil, errors.Wrapf(err, "couldnt get state root of tipset %s", key)
 	}
 	st, err := state.LoadStateTree(ctx, q.cst, tsas.TipSetStateRoot, builtin.Actors)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "could load tree for latest state root")
+		return nil, nil, errors.Wrap(err, "could load tree for state root")
 	}
-	h, err := headTs.Height()
+	h, err := tsas.TipSet.Height()
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "couldnt get base tipset height")
 	}
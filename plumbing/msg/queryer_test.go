@@ -94,4 +94,37 @@ func TestQuery(t *testing.T) {
 		require.Error(err)
 		assert.Contains(err.Error(), "42")
 	})
+
+	t.Run("queries the state of a given tipset", func(t *testing.T) {
+		require := require.New(t)
+		newAddr := address.NewForTestGetter()
+		ctx := context.Background()
+		r := repo.NewInMemoryRepo()
+		bs := bstore.NewBlockstore(r.Datastore())
+
+		fakeActorCodeCid := types.NewCidForTestGetter()()
+		fakeActorAddr := newAddr()
+		fromAddr := newAddr()
+		vms := vm.NewStorageMap(bs)
+		fakeActor := th.RequireNewFakeActor(require, vms, fakeActorAddr, fakeActorCodeCid)
+		builtin.Actors[fakeActorCodeCid] = &actor.FakeActor{}
+		defer func() {
+			delete(builtin.Actors, fakeActorCodeCid)
+		}()
+		testGen := consensus.MakeGenesisFunc(
+			consensus.AddActor(fakeActorAddr, fakeActor),
+			consensus.ActorAccount(fromAddr, types.NewAttoFILFromFIL(0)),
+		)
+		deps := requireCommonDepsWithGifAndBlockstore(require, testGen, r, bs)
+
+		queryer := NewQueryer(deps.repo, deps.wallet, deps.chainStore, deps.cst, deps.blockstore)
+		genesis := deps.chainStore.Head().ToSortedCidSet()
+		returnValue, _, err := queryer.QueryAt(ctx, genesis, fromAddr, fakeActorAddr, "hasReturnValue")
+		require.NoError(err)
+		require.NotNil(returnValue)
+
+		unknown := types.NewSortedCidSet(types.NewCidForTestGetter()())
+		_, _, err = queryer.QueryAt(ctx, unknown, fromAddr, fakeActorAddr, "hasReturnValue")
+		require.Error(err)
+	})
 }
@@ -0,0 +1,137 @@
+package msg
+
+import (
+	"context"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/sampling"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+// Replay is the outcome of replaying a message included in the chain.
+type Replay struct {
+	Message  cid.Cid                `json:"message"`
+	Location *chain.MessageLocation `json:"location"`
+	// Receipt is nil if the message could not be applied.
+	Receipt *types.MessageReceipt `json:"receipt"`
+	// ExecutionError is the error the message failed with in the VM, and
+	// ApplyError the reason it could not be applied, for instance because
+	// it conflicts with a message of another block of its tipset.
+	ExecutionError string `json:"executionError,omitempty"`
+	ApplyError     string `json:"applyError,omitempty"`
+	// Trace records the execution of the message in the VM.
+	Trace *vm.Trace `json:"trace"`
+}
+
+// Replayer replays messages of the chain to trace their execution.
+type Replayer struct {
+	// To locate messages and get the tipsets including them.
+	chainReader chain.ReadStore
+	// To load the state of their parents.
+	cst *hamt.CborIpldStore
+	// For vm storage.
+	bs bstore.Blockstore
+}
+
+// NewReplayer constructs a Replayer.
+func NewReplayer(chainReader chain.ReadStore, cst *hamt.CborIpldStore, bs bstore.Blockstore) *Replayer {
+	return &Replayer{chainReader, cst, bs}
+}
+
+// Replay finds the message with the given CID in the chain ending at the
+// head, and applies it again over the state it was applied to, tracing its
+// execution. Nothing is written to the chain or its state.
+func (r *Replayer) Replay(ctx context.Context, msgCid cid.Cid) (*Replay, error) {
+	loc, err := r.chainReader.GetMessageLocation(ctx, msgCid)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to locate message")
+	}
+	if loc == nil {
+		return nil, errors.Errorf("message %s is not in the chain", msgCid.String())
+	}
+
+	tsas, err := r.chainReader.GetTipSetAndState(ctx, loc.TipSet.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get tipset %s", loc.TipSet.String())
+	}
+	ts := tsas.TipSet
+	parentKey, err := ts.Parents()
+	if err != nil {
+		return nil, err
+	}
+	parent, err := r.chainReader.GetTipSetAndState(ctx, parentKey.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get state of parent tipset %s", parentKey.String())
+	}
+	st, err := state.LoadStateTree(ctx, r.cst, parent.TipSetStateRoot, builtin.Actors)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load parent state")
+	}
+	ancestors, err := chain.GetRecentAncestors(ctx, parent.TipSet, r.chainReader, types.NewBlockHeight(loc.Height), consensus.AncestorRoundsNeeded, sampling.LookbackParameter)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get ancestors")
+	}
+
+	// Processing the whole tipset applies its blocks, rewards and messages in
+	// the order they were applied the first time, so the message executes
+	// against the same state. The storage map is never flushed, so the replay
+	// leaves the blockstore as it was.
+	tracer := &messageTracer{target: msgCid}
+	processor := consensus.NewDefaultProcessor()
+	processor.SetTracer(tracer)
+	if _, err := processor.ProcessTipSet(ctx, st, vm.NewStorageMap(r.bs), ts, ancestors); err != nil {
+		return nil, err
+	}
+	if tracer.trace == nil {
+		return nil, errors.Errorf("message %s is not in tipset %s", msgCid.String(), ts.String())
+	}
+
+	replay := &Replay{
+		Message:  msgCid,
+		Location: loc,
+		Trace:    tracer.trace,
+	}
+	if tracer.err != nil {
+		replay.ApplyError = tracer.err.Error()
+	}
+	if tracer.res != nil {
+		replay.Receipt = tracer.res.Receipt
+		if tracer.res.ExecutionError != nil {
+			replay.ExecutionError = tracer.res.ExecutionError.Error()
+		}
+	}
+	return replay, nil
+}
+
+// messageTracer traces the message with the CID target and keeps the outcome
+// of applying it.
+type messageTracer struct {
+	target cid.Cid
+	trace  *vm.Trace
+	res    *consensus.ApplicationResult
+	err    error
+}
+
+var _ consensus.MessageTracer = (*messageTracer)(nil)
+
+func (t *messageTracer) StartMessage(msg *types.SignedMessage) *vm.Trace {
+	msgCid, err := msg.Cid()
+	if err != nil || !msgCid.Equals(t.target) {
+		return nil
+	}
+	t.trace = vm.NewTrace(&msg.Message)
+	return t.trace
+}
+
+func (t *messageTracer) FinishMessage(msg *types.SignedMessage, res *consensus.ApplicationResult, err error) {
+	t.res, t.err = res, err
+}
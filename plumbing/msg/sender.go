@@ -72,7 +72,33 @@ func (s *Sender) Send(ctx context.Context, from, to address.Address, value *type
 	}
 
 	msg := types.NewMessage(from, to, nonce, value, method, encodedParams)
-	smsg, err := types.NewSignedMessage(*msg, s.signer, gasPrice, gasLimit)
+	return s.signAndPublish(ctx, *msg, fromActor, gasPrice, gasLimit)
+}
+
+// Replace signs and sends msg using the nonce it already carries, so that it
+// replaces the pending message with the same sender and nonce. The message pool
+// only accepts the replacement if its gas price is higher than the original's.
+func (s *Sender) Replace(ctx context.Context, msg types.Message, gasPrice types.AttoFIL, gasLimit types.GasUnits) (cid.Cid, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	st, err := s.chainReader.LatestState(ctx)
+	if err != nil {
+		return cid.Undef, errors.Wrap(err, "failed to load state from chain")
+	}
+
+	fromActor, err := st.GetActor(ctx, msg.From)
+	if err != nil {
+		return cid.Undef, errors.Wrapf(err, "no actor at address %s", msg.From)
+	}
+
+	return s.signAndPublish(ctx, msg, fromActor, gasPrice, gasLimit)
+}
+
+// signAndPublish signs, validates and pools msg, then publishes it to the network.
+// The caller must hold s.l.
+func (s *Sender) signAndPublish(ctx context.Context, msg types.Message, fromActor *actor.Actor, gasPrice types.AttoFIL, gasLimit types.GasUnits) (cid.Cid, error) {
+	smsg, err := types.NewSignedMessage(msg, s.signer, gasPrice, gasLimit)
 	if err != nil {
 		return cid.Undef, errors.Wrap(err, "failed to sign message")
 	}
@@ -88,7 +114,7 @@ func (s *Sender) Send(ctx context.Context, from, to address.Address, value *type
 	}
 
 	// Add to the local message pool at the last possible moment before broadcasting to network.
-	if _, err := s.msgPool.Add(smsg); err != nil {
+	if _, err := s.msgPool.AddLocal(smsg); err != nil {
 		return cid.Undef, errors.Wrap(err, "failed to add message to the message pool")
 	}
 
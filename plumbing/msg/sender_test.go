@@ -16,6 +16,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/config"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/core"
 	"github.com/filecoin-project/go-filecoin/state"
@@ -100,6 +101,34 @@ func TestSend(t *testing.T) {
 		}
 	})
 
+	t.Run("replace message keeps nonce and supersedes original", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		ctx := context.Background()
+
+		w, chainStore, msgPool := setupSendTest(require)
+		addr := w.Addresses()[0]
+		nopPublish := func(string, []byte) error { return nil }
+		s := NewSender(w, chainStore, msgPool, nullValidator{}, nopPublish)
+
+		origCid, err := s.Send(ctx, addr, address.TestAddress, types.NewAttoFILFromFIL(2), types.NewGasPrice(1), types.NewGasUnits(0), "")
+		require.NoError(err)
+		orig, ok := msgPool.Get(origCid)
+		require.True(ok)
+
+		_, err = s.Replace(ctx, orig.Message, types.NewGasPrice(1), types.NewGasUnits(0))
+		assert.Error(err)
+
+		replacementCid, err := s.Replace(ctx, orig.Message, types.NewGasPrice(2), types.NewGasUnits(0))
+		require.NoError(err)
+
+		_, ok = msgPool.Get(origCid)
+		assert.False(ok)
+		replacement, ok := msgPool.Get(replacementCid)
+		require.True(ok)
+		assert.Equal(orig.Nonce, replacement.Nonce)
+		assert.Equal(1, len(msgPool.Pending()))
+	})
 }
 
 func TestNextNonce(t *testing.T) {
@@ -114,7 +143,7 @@ func TestNextNonce(t *testing.T) {
 
 		address := address.NewForTestGetter()()
 
-		n, err := nextNonce(ctx, st, core.NewMessagePool(), address)
+		n, err := nextNonce(ctx, st, core.NewMessagePool(config.NewDefaultConfig().Mpool), address)
 		assert.NoError(err)
 		assert.Equal(uint64(0), n)
 	})
@@ -130,7 +159,7 @@ func TestNextNonce(t *testing.T) {
 		assert.NoError(err)
 		_ = state.MustSetActor(st, address, actor)
 
-		_, err = nextNonce(ctx, st, core.NewMessagePool(), address)
+		_, err = nextNonce(ctx, st, core.NewMessagePool(config.NewDefaultConfig().Mpool), address)
 		assert.Error(err)
 		assert.Contains(err.Error(), "account or empty")
 	})
@@ -146,7 +175,7 @@ func TestNextNonce(t *testing.T) {
 		actor.Nonce = 42
 		state.MustSetActor(st, address, actor)
 
-		nonce, err := nextNonce(ctx, st, core.NewMessagePool(), address)
+		nonce, err := nextNonce(ctx, st, core.NewMessagePool(config.NewDefaultConfig().Mpool), address)
 		assert.NoError(err)
 		assert.Equal(uint64(42), nonce)
 	})
@@ -156,7 +185,7 @@ func TestNextNonce(t *testing.T) {
 		assert := assert.New(t)
 		store := hamt.NewCborStore()
 		st := state.NewEmptyStateTree(store)
-		mp := core.NewMessagePool()
+		mp := core.NewMessagePool(config.NewDefaultConfig().Mpool)
 		addr := mockSigner.Addresses[0]
 		actor, err := account.NewActor(types.NewAttoFILFromFIL(0))
 		assert.NoError(err)
@@ -210,5 +239,5 @@ func setupSendTest(require *require.Assertions) (*wallet.Wallet, *chain.DefaultS
 	// Install the key in the wallet for use in signing.
 	err = d.wallet.Backends(wallet.DSBackendType)[0].(*wallet.DSBackend).ImportKey(&ki)
 	require.NoError(err)
-	return d.wallet, d.chainStore, core.NewMessagePool()
+	return d.wallet, d.chainStore, core.NewMessagePool(config.NewDefaultConfig().Mpool)
 }
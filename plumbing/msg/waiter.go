@@ -46,9 +46,9 @@ func NewWaiter(chainStore chain.ReadStore, bs bstore.Blockstore, cst *hamt.CborI
 // Something like receiptFromTipset is necessary because not every message in
 // a block will have a receipt in the tipset: it might be a duplicate message.
 //
-// TODO: This implementation will become prohibitively expensive since it
-// traverses the entire chain. We should use an index instead.
-// https://github.com/filecoin-project/go-filecoin/issues/1518
+// Messages already on chain are looked up in the chain's message index. If the
+// index does not reflect the current head Wait falls back to traversing the
+// chain.
 func (w *Waiter) Wait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error {
 	ctx = log.Start(ctx, "Waiter.Wait")
 	defer log.Finish(ctx)
@@ -57,15 +57,18 @@ func (w *Waiter) Wait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block,
 	// Blocks are either in new heaviest tipsets, or next oldest historical blocks.
 	ch := make(chan (interface{}))
 
-	// New blocks
+	// New blocks. Subscribe before consulting the index so that a message
+	// included in between is not missed.
 	newHeadCh := w.chainReader.HeadEvents().Sub(chain.NewHeadTopic)
 	defer w.chainReader.HeadEvents().Unsub(newHeadCh, chain.NewHeadTopic)
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	// Historical blocks
-	historyCh := w.chainReader.BlockHistory(ctx, w.chainReader.Head())
+	loc, err := w.chainReader.GetMessageLocation(ctx, msgCid)
+	if err == nil && loc != nil {
+		return w.notifyFromLocation(ctx, msgCid, loc, cb)
+	}
 
 	// Merge historical and new block Channels.
 	go func() {
@@ -73,11 +76,17 @@ func (w *Waiter) Wait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block,
 			ch <- raw
 		}
 	}()
-	go func() {
-		for raw := range historyCh {
-			ch <- raw
-		}
-	}()
+	if err != nil {
+		log.Infof("Waiter.Wait: searching chain for %s: %s", msgCid.String(), err)
+
+		// Historical blocks
+		historyCh := w.chainReader.BlockHistory(ctx, w.chainReader.Head())
+		go func() {
+			for raw := range historyCh {
+				ch <- raw
+			}
+		}()
+	}
 
 	for {
 		select {
@@ -117,6 +126,30 @@ func (w *Waiter) Wait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block,
 	}
 }
 
+// notifyFromLocation invokes the callback for a message found in the message index.
+func (w *Waiter) notifyFromLocation(ctx context.Context, msgCid cid.Cid, loc *chain.MessageLocation, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error {
+	blk, err := w.chainReader.GetBlock(ctx, loc.Block)
+	if err != nil {
+		return errors.Wrap(err, "error retrieving block of indexed message")
+	}
+	if loc.Index >= len(blk.Messages) {
+		return errors.Errorf("indexed message %s out of range in block %s", msgCid, loc.Block)
+	}
+
+	recpt := loc.Receipt
+	if recpt == nil {
+		tsas, err := w.chainReader.GetTipSetAndState(ctx, loc.TipSet.String())
+		if err != nil {
+			return errors.Wrap(err, "error retrieving tipset of indexed message")
+		}
+		recpt, err = w.receiptFromTipSet(ctx, msgCid, tsas.TipSet)
+		if err != nil {
+			return errors.Wrap(err, "error retrieving receipt from tipset")
+		}
+	}
+	return cb(blk, blk.Messages[loc.Index], recpt)
+}
+
 // receiptFromTipSet finds the receipt for the message with msgCid in the
 // input tipset.  This can differ from the message's receipt as stored in its
 // parent block in the case that the message is in conflict with another
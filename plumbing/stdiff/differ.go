@@ -0,0 +1,291 @@
+package stdiff
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+// Diff is the difference between the states of two tipsets.
+type Diff struct {
+	From      types.SortedCidSet `json:"from"`
+	FromState cid.Cid            `json:"fromState"`
+	To        types.SortedCidSet `json:"to"`
+	ToState   cid.Cid            `json:"toState"`
+	Actors    []*ActorDiff       `json:"actors"`
+}
+
+// ActorDiff describes how an actor differs between the two states.
+type ActorDiff struct {
+	state.ActorDiff
+	// Storage lists the differences in the decoded storage of a miner or
+	// payment broker actor. It is only filled in when asked for.
+	Storage []*StorageChange `json:"storage,omitempty"`
+}
+
+// StorageChange is a difference in the decoded storage of an actor.
+type StorageChange struct {
+	// Path names the part of the storage that changed: a field of the
+	// miner state such as "Collateral", or "SectorCommitments/<sector id>"
+	// for map fields, or "<payer>/<channel id>" for a payment channel.
+	Path string `json:"path"`
+	// Before and After are the values in each state, nil if missing.
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Differ computes the differences between the states of two tipsets.
+type Differ struct {
+	// To get the state roots of the tipsets.
+	chainReader chain.ReadStore
+	// To load the state trees.
+	cst *hamt.CborIpldStore
+	// For vm storage.
+	bs bstore.Blockstore
+}
+
+// NewDiffer constructs a Differ.
+func NewDiffer(chainReader chain.ReadStore, cst *hamt.CborIpldStore, bs bstore.Blockstore) *Differ {
+	return &Differ{chainReader, cst, bs}
+}
+
+// Diff returns the actors added, removed or changed going from the state of
+// tipset from to the state of tipset to. If decodeStorage is set, the
+// changes in the storage of builtin miner and payment broker actors are
+// decoded too.
+func (d *Differ) Diff(ctx context.Context, from, to types.SortedCidSet, decodeStorage bool) (*Diff, error) {
+	fromTree, fromRoot, err := d.loadState(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	toTree, toRoot, err := d.loadState(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+
+	actorDiffs, err := state.Diff(ctx, fromTree, toTree)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to diff state trees")
+	}
+
+	diff := &Diff{
+		From:      from,
+		FromState: fromRoot,
+		To:        to,
+		ToState:   toRoot,
+		Actors:    []*ActorDiff{},
+	}
+	for _, ad := range actorDiffs {
+		out := &ActorDiff{ActorDiff: *ad}
+		if decodeStorage {
+			out.Storage, err = d.storageChanges(ctx, ad.Before, ad.After)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to decode storage of actor %s", ad.Address.String())
+			}
+		}
+		diff.Actors = append(diff.Actors, out)
+	}
+	return diff, nil
+}
+
+func (d *Differ) loadState(ctx context.Context, key types.SortedCidSet) (state.Tree, cid.Cid, error) {
+	tsas, err := d.chainReader.GetTipSetAndState(ctx, key.String())
+	if err != nil {
+		return nil, cid.Undef, errors.Wrapf(err, "failed to get state of tipset %s", key.String())
+	}
+	st, err := state.LoadStateTree(ctx, d.cst, tsas.TipSetStateRoot, builtin.Actors)
+	if err != nil {
+		return nil, cid.Undef, errors.Wrapf(err, "failed to load state tree %s", tsas.TipSetStateRoot.String())
+	}
+	return st, tsas.TipSetStateRoot, nil
+}
+
+func (d *Differ) storageChanges(ctx context.Context, before, after *actor.Actor) ([]*StorageChange, error) {
+	if before != nil && after != nil && before.Head.Equals(after.Head) {
+		return nil, nil
+	}
+	code := codeOf(after)
+	if !code.Defined() {
+		code = codeOf(before)
+	}
+
+	switch {
+	case code.Equals(types.MinerActorCodeCid), code.Equals(types.BootstrapMinerActorCodeCid):
+		return d.minerChanges(ctx, before, after)
+	case code.Equals(types.PaymentBrokerActorCodeCid):
+		return d.channelChanges(ctx, before, after)
+	default:
+		return nil, nil
+	}
+}
+
+func codeOf(act *actor.Actor) cid.Cid {
+	if act == nil {
+		return cid.Undef
+	}
+	return act.Code
+}
+
+func (d *Differ) minerChanges(ctx context.Context, before, after *actor.Actor) ([]*StorageChange, error) {
+	b, err := d.minerState(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := d.minerState(ctx, after)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*StorageChange
+	t := reflect.TypeOf(miner.State{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		bv, av := fieldOf(b, i), fieldOf(a, i)
+
+		// Maps such as the sector commitments can be large, so they are
+		// compared entry by entry.
+		paths := map[string][2]reflect.Value{field.Name: {bv, av}}
+		if field.Type.Kind() == reflect.Map && field.Type.Key().Kind() == reflect.String {
+			paths = make(map[string][2]reflect.Value)
+			for _, v := range []reflect.Value{bv, av} {
+				if !v.IsValid() {
+					continue
+				}
+				for _, k := range v.MapKeys() {
+					paths[field.Name+"/"+k.String()] = [2]reflect.Value{mapIndex(bv, k.String()), mapIndex(av, k.String())}
+				}
+			}
+		}
+
+		for path, values := range paths {
+			change, err := newChange(path, values[0], values[1])
+			if err != nil {
+				return nil, err
+			}
+			if change != nil {
+				changes = append(changes, change)
+			}
+		}
+	}
+	sortChanges(changes)
+	return changes, nil
+}
+
+func (d *Differ) minerState(ctx context.Context, act *actor.Actor) (*miner.State, error) {
+	if act == nil || !act.Head.Defined() {
+		return nil, nil
+	}
+	var st miner.State
+	if err := d.cst.Get(ctx, act.Head, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (d *Differ) channelChanges(ctx context.Context, before, after *actor.Actor) ([]*StorageChange, error) {
+	b, err := d.channels(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := d.channels(ctx, after)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*StorageChange
+	for payer, byID := range b {
+		for id, pc := range byID {
+			if _, ok := a[payer][id]; !ok {
+				changes = append(changes, &StorageChange{Path: payer + "/" + id, Before: pc})
+			}
+		}
+	}
+	for payer, byID := range a {
+		for id, pc := range byID {
+			change, err := newChange(payer+"/"+id, reflect.ValueOf(b[payer][id]), reflect.ValueOf(pc))
+			if err != nil {
+				return nil, err
+			}
+			if change != nil {
+				changes = append(changes, change)
+			}
+		}
+	}
+	sortChanges(changes)
+	return changes, nil
+}
+
+func (d *Differ) channels(ctx context.Context, act *actor.Actor) (map[string]map[string]*paymentbroker.PaymentChannel, error) {
+	if act == nil || !act.Head.Defined() {
+		return nil, nil
+	}
+	storage := vm.NewStorage(d.bs, act)
+	return paymentbroker.AllChannels(ctx, &storage)
+}
+
+// fieldOf returns field i of st, or the zero Value if st is nil.
+func fieldOf(st *miner.State, i int) reflect.Value {
+	if st == nil {
+		return reflect.Value{}
+	}
+	return reflect.ValueOf(st).Elem().Field(i)
+}
+
+// mapIndex returns the value of m at key k, or the zero Value if m is the
+// zero Value or has no such key.
+func mapIndex(m reflect.Value, k string) reflect.Value {
+	if !m.IsValid() {
+		return reflect.Value{}
+	}
+	return m.MapIndex(reflect.ValueOf(k))
+}
+
+// newChange returns a StorageChange at path if before and after, which may
+// be missing or nil, differ, and nil otherwise.
+func newChange(path string, before, after reflect.Value) (*StorageChange, error) {
+	b, a := valueOf(before), valueOf(after)
+	bj, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	aj, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(bj, aj) {
+		return nil, nil
+	}
+	return &StorageChange{Path: path, Before: b, After: a}, nil
+}
+
+func valueOf(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+	return v.Interface()
+}
+
+func sortChanges(changes []*StorageChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+}
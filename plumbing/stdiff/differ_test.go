@@ -0,0 +1,61 @@
+package stdiff
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
+	"github.com/filecoin-project/go-filecoin/address"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestMinerStorageChanges(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	cst := hamt.NewCborStore()
+	d := NewDiffer(nil, cst, nil)
+
+	st := miner.NewState(address.NewForTestGetter()(), []byte{}, big.NewInt(10), th.RequireRandomPeerID(), types.NewAttoFILFromFIL(100))
+	beforeHead, err := cst.Put(ctx, st)
+	require.NoError(err)
+
+	st.Collateral = types.NewAttoFILFromFIL(150)
+	st.SectorCommitments["1"] = types.Commitments{}
+	afterHead, err := cst.Put(ctx, st)
+	require.NoError(err)
+
+	before := actor.NewActor(types.MinerActorCodeCid, types.NewZeroAttoFIL())
+	before.Head = beforeHead
+	after := actor.NewActor(types.MinerActorCodeCid, types.NewZeroAttoFIL())
+	after.Head = afterHead
+
+	changes, err := d.storageChanges(ctx, before, after)
+	require.NoError(err)
+	require.Len(changes, 2)
+	assert.Equal("Collateral", changes[0].Path)
+	assert.True(types.NewAttoFILFromFIL(150).Equal(changes[0].After.(*types.AttoFIL)))
+	assert.Equal("SectorCommitments/1", changes[1].Path)
+	assert.Nil(changes[1].Before)
+
+	changes, err = d.storageChanges(ctx, before, before)
+	require.NoError(err)
+	assert.Empty(changes)
+
+	// a removed miner has all of its fields removed
+	changes, err = d.storageChanges(ctx, before, nil)
+	require.NoError(err)
+	assert.NotEmpty(changes)
+	for _, change := range changes {
+		assert.Nil(change.After)
+	}
+}
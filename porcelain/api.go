@@ -71,6 +71,30 @@ func (a *API) MessagePoolWait(ctx context.Context, messageCount uint) ([]*types.
 	return MessagePoolWait(ctx, a, messageCount)
 }
 
+// MessageEstimateGasPrice suggests low, medium and high gas prices based on the
+// prices paid by recently mined and pending messages.
+func (a *API) MessageEstimateGasPrice(ctx context.Context) (*GasPriceEstimate, error) {
+	return MessageEstimateGasPrice(ctx, a)
+}
+
+// MessageReplace re-sends a pending message with a higher gas price so that it
+// supersedes the original.
+func (a *API) MessageReplace(ctx context.Context, msgCid cid.Cid, optGasPrice *types.AttoFIL) (cid.Cid, error) {
+	return MessageReplace(ctx, a, msgCid, optGasPrice)
+}
+
+// MessageCancel supersedes a pending message with a zero-value transfer to self
+// with the same nonce.
+func (a *API) MessageCancel(ctx context.Context, msgCid cid.Cid, optGasPrice *types.AttoFIL) (cid.Cid, error) {
+	return MessageCancel(ctx, a, msgCid, optGasPrice)
+}
+
+// MessageStatus reports whether a message is pending in the message pool or
+// where it was included in the chain.
+func (a *API) MessageStatus(ctx context.Context, msgCid cid.Cid) (*MessageStatusResponse, error) {
+	return MessageStatus(ctx, a, msgCid)
+}
+
 // MessageSendWithDefaultAddress calls MessageSend but with a default from
 // address if none is provided
 func (a *API) MessageSendWithDefaultAddress(
@@ -80,6 +104,7 @@ func (a *API) MessageSendWithDefaultAddress(
 	value *types.AttoFIL,
 	gasPrice types.AttoFIL,
 	gasLimit types.GasUnits,
+	autoGasLimit bool,
 	method string,
 	params ...interface{},
 ) (cid.Cid, error) {
@@ -91,6 +116,7 @@ func (a *API) MessageSendWithDefaultAddress(
 		value,
 		gasPrice,
 		gasLimit,
+		autoGasLimit,
 		method,
 		params...,
 	)
@@ -117,6 +143,11 @@ func (a *API) MinerGetOwnerAddress(ctx context.Context, minerAddr address.Addres
 	return MinerGetOwnerAddress(ctx, a, minerAddr)
 }
 
+// MinerGetWorkerAddress queries for the worker address of the given miner
+func (a *API) MinerGetWorkerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error) {
+	return MinerGetWorkerAddress(ctx, a, minerAddr)
+}
+
 // MinerGetKey queries for the public key of the given miner
 func (a *API) MinerGetKey(ctx context.Context, minerAddr address.Address) ([]byte, error) {
 	return MinerGetKey(ctx, a, minerAddr)
@@ -128,8 +159,8 @@ func (a *API) MinerGetPeerID(ctx context.Context, minerAddr address.Address) (pe
 }
 
 // MinerSetPrice configures the price of storage. See implementation for details.
-func (a *API) MinerSetPrice(ctx context.Context, from address.Address, miner address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, price *types.AttoFIL, expiry *big.Int) (MinerSetPriceResponse, error) {
-	return MinerSetPrice(ctx, a, from, miner, gasPrice, gasLimit, price, expiry)
+func (a *API) MinerSetPrice(ctx context.Context, from address.Address, miner address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, autoGasLimit bool, price *types.AttoFIL, expiry *big.Int) (MinerSetPriceResponse, error) {
+	return MinerSetPrice(ctx, a, from, miner, gasPrice, gasLimit, autoGasLimit, price, expiry)
 }
 
 // MinerPreviewSetPrice calculates the amount of Gas needed for a call to MinerSetPrice.
@@ -0,0 +1,97 @@
+package porcelain
+
+import (
+	"context"
+	"math/big"
+	"sort"
+
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// GasPriceEstimateTipSets is the number of recent tipsets inspected when
+// estimating a gas price.
+const GasPriceEstimateTipSets = 20
+
+// DefaultGasPrice is the price suggested when there is no recent message
+// activity from which to estimate one.
+var DefaultGasPrice = types.NewAttoFIL(big.NewInt(1))
+
+// GasPriceEstimate holds suggested gas prices for messages that should be
+// mined with low, medium or high priority.
+type GasPriceEstimate struct {
+	Low    types.AttoFIL `json:"low"`
+	Medium types.AttoFIL `json:"medium"`
+	High   types.AttoFIL `json:"high"`
+	// Samples is the number of messages the estimate is based on.
+	Samples int `json:"samples"`
+}
+
+// mgpPlumbing is the subset of the plumbing.API that MessageEstimateGasPrice uses.
+type mgpPlumbing interface {
+	ChainLs(ctx context.Context) <-chan interface{}
+	MessagePoolPending() []*types.SignedMessage
+}
+
+// MessageEstimateGasPrice suggests gas prices based on the prices paid by
+// messages included in the most recent tipsets and by the messages currently
+// waiting in the message pool. The low, medium and high suggestions are the
+// 25th, 50th and 75th percentiles of the observed prices, and never fall below
+// DefaultGasPrice.
+func MessageEstimateGasPrice(ctx context.Context, plumbing mgpPlumbing) (*GasPriceEstimate, error) {
+	var prices []*types.AttoFIL
+
+	lsCtx, cancelLs := context.WithCancel(ctx)
+	defer cancelLs()
+
+	tipSetCount := 0
+	for raw := range plumbing.ChainLs(lsCtx) {
+		switch v := raw.(type) {
+		case error:
+			return nil, errors.Wrap(v, "failed to walk chain")
+		case types.TipSet:
+			for _, blk := range v.ToSlice() {
+				for _, msg := range blk.Messages {
+					prices = append(prices, &msg.GasPrice)
+				}
+			}
+		default:
+			return nil, errors.Errorf("unexpected type %T in chain history", raw)
+		}
+
+		tipSetCount++
+		if tipSetCount >= GasPriceEstimateTipSets {
+			break
+		}
+	}
+
+	for _, msg := range plumbing.MessagePoolPending() {
+		prices = append(prices, &msg.GasPrice)
+	}
+
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].LessThan(prices[j])
+	})
+
+	return &GasPriceEstimate{
+		Low:     gasPricePercentile(prices, 25),
+		Medium:  gasPricePercentile(prices, 50),
+		High:    gasPricePercentile(prices, 75),
+		Samples: len(prices),
+	}, nil
+}
+
+// gasPricePercentile returns the pth percentile of the sorted prices, or
+// DefaultGasPrice if it is greater.
+func gasPricePercentile(sorted []*types.AttoFIL, p int) types.AttoFIL {
+	if len(sorted) == 0 {
+		return *DefaultGasPrice
+	}
+
+	price := sorted[(len(sorted)-1)*p/100]
+	if price.LessThan(DefaultGasPrice) {
+		return *DefaultGasPrice
+	}
+	return *price
+}
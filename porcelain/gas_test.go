@@ -0,0 +1,124 @@
+package porcelain_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+type fakeEstimateGasPricePlumbing struct {
+	tipSets []types.TipSet
+	pending []*types.SignedMessage
+}
+
+func (p *fakeEstimateGasPricePlumbing) ChainLs(ctx context.Context) <-chan interface{} {
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		for _, ts := range p.tipSets {
+			select {
+			case <-ctx.Done():
+				return
+			case out <- ts:
+			}
+		}
+	}()
+	return out
+}
+
+func (p *fakeEstimateGasPricePlumbing) MessagePoolPending() []*types.SignedMessage {
+	return p.pending
+}
+
+func newGasPriceTestMessages(require *require.Assertions, signer types.MockSigner, prices ...int64) []*types.SignedMessage {
+	var out []*types.SignedMessage
+	for i, price := range prices {
+		msg := types.NewMessage(signer.Addresses[0], address.TestAddress, uint64(i), types.NewZeroAttoFIL(), "", nil)
+		smsg, err := types.NewSignedMessage(*msg, &signer, types.NewGasPrice(price), types.NewGasUnits(0))
+		require.NoError(err)
+		out = append(out, smsg)
+	}
+	return out
+}
+
+func TestMessageEstimateGasPrice(t *testing.T) {
+	t.Parallel()
+
+	ki := types.MustGenerateKeyInfo(1, types.GenerateKeyInfoSeed())
+	signer := types.NewMockSigner(ki)
+
+	t.Run("defaults without any messages", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		plumbing := &fakeEstimateGasPricePlumbing{}
+		estimate, err := porcelain.MessageEstimateGasPrice(context.Background(), plumbing)
+		require.NoError(err)
+
+		assert.Equal(0, estimate.Samples)
+		assert.True(estimate.Low.Equal(porcelain.DefaultGasPrice))
+		assert.True(estimate.Medium.Equal(porcelain.DefaultGasPrice))
+		assert.True(estimate.High.Equal(porcelain.DefaultGasPrice))
+	})
+
+	t.Run("percentiles of chain and pool", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		b1 := &types.Block{Height: 2, Messages: newGasPriceTestMessages(require, signer, 10, 20, 30)}
+		b2 := &types.Block{Height: 1, Messages: newGasPriceTestMessages(require, signer, 40, 50, 60)}
+		plumbing := &fakeEstimateGasPricePlumbing{
+			tipSets: []types.TipSet{types.RequireNewTipSet(require, b1), types.RequireNewTipSet(require, b2)},
+			pending: newGasPriceTestMessages(require, signer, 70, 80, 90),
+		}
+
+		estimate, err := porcelain.MessageEstimateGasPrice(context.Background(), plumbing)
+		require.NoError(err)
+
+		assert.Equal(9, estimate.Samples)
+		assert.True(estimate.Low.Equal(types.NewAttoFIL(big.NewInt(30))))
+		assert.True(estimate.Medium.Equal(types.NewAttoFIL(big.NewInt(50))))
+		assert.True(estimate.High.Equal(types.NewAttoFIL(big.NewInt(70))))
+	})
+
+	t.Run("only looks at recent tipsets", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		var tipSets []types.TipSet
+		for i := 0; i < porcelain.GasPriceEstimateTipSets+5; i++ {
+			price := int64(100)
+			if i >= porcelain.GasPriceEstimateTipSets {
+				price = 1000
+			}
+			blk := &types.Block{Height: types.Uint64(1000 - i), Messages: newGasPriceTestMessages(require, signer, price)}
+			tipSets = append(tipSets, types.RequireNewTipSet(require, blk))
+		}
+
+		estimate, err := porcelain.MessageEstimateGasPrice(context.Background(), &fakeEstimateGasPricePlumbing{tipSets: tipSets})
+		require.NoError(err)
+
+		assert.Equal(porcelain.GasPriceEstimateTipSets, estimate.Samples)
+		assert.True(estimate.High.Equal(types.NewAttoFIL(big.NewInt(100))))
+	})
+
+	t.Run("never suggests less than the default", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		plumbing := &fakeEstimateGasPricePlumbing{
+			pending: newGasPriceTestMessages(require, signer, 0, 0, 0),
+		}
+		estimate, err := porcelain.MessageEstimateGasPrice(context.Background(), plumbing)
+		require.NoError(err)
+
+		assert.True(estimate.Medium.Equal(porcelain.DefaultGasPrice))
+	})
+}
@@ -2,11 +2,14 @@ package porcelain
 
 import (
 	"context"
+	"math/big"
+
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -17,13 +20,17 @@ var log = logging.Logger("porcelain") // nolint: deadcode
 
 // mswdaAPI is the subset of the plumbing.API that MessageSendWithDefaultAddress uses.
 type mswdaAPI interface {
+	ConfigGet(dottedPath string) (interface{}, error)
 	GetAndMaybeSetDefaultSenderAddress() (address.Address, error)
+	MessagePreview(ctx context.Context, from, to address.Address, method string, params ...interface{}) (types.GasUnits, error)
 	MessageSend(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error)
 }
 
 // MessageSendWithDefaultAddress calls MessageSend but with a default from
 // address if none is provided. If you don't need a default address provided,
-// use MessageSend instead.
+// use MessageSend instead. If autoGasLimit is true gasLimit is ignored and the
+// limit is set to the previewed gas usage of the message plus the configured
+// safety margin.
 func MessageSendWithDefaultAddress(
 	ctx context.Context,
 	plumbing mswdaAPI,
@@ -32,6 +39,7 @@ func MessageSendWithDefaultAddress(
 	value *types.AttoFIL,
 	gasPrice types.AttoFIL,
 	gasLimit types.GasUnits,
+	autoGasLimit bool,
 	method string,
 	params ...interface{},
 ) (cid.Cid, error) {
@@ -44,9 +52,69 @@ func MessageSendWithDefaultAddress(
 		from = ret
 	}
 
+	if autoGasLimit {
+		var err error
+		gasLimit, err = deriveGasLimit(ctx, plumbing, from, to, method, params...)
+		if err != nil {
+			return cid.Undef, err
+		}
+	}
+
 	return plumbing.MessageSend(ctx, from, to, value, gasPrice, gasLimit, method, params...)
 }
 
+// deriveGasLimit previews the message and returns its gas usage plus the
+// configured safety margin. A plain value transfer runs no actor code and so
+// is not previewed.
+func deriveGasLimit(ctx context.Context, plumbing mswdaAPI, from, to address.Address, method string, params ...interface{}) (types.GasUnits, error) {
+	if method == "" {
+		return types.NewGasUnits(0), nil
+	}
+
+	usedGas, err := plumbing.MessagePreview(ctx, from, to, method, params...)
+	if err != nil {
+		return types.NewGasUnits(0), errors.Wrap(err, "failed to preview message to determine gas limit")
+	}
+
+	margin, err := GasLimitMargin(plumbing)
+	if err != nil {
+		return types.NewGasUnits(0), err
+	}
+
+	return GasLimitWithMargin(usedGas, margin), nil
+}
+
+// glmAPI is the subset of the plumbing.API that GasLimitMargin uses.
+type glmAPI interface {
+	ConfigGet(dottedPath string) (interface{}, error)
+}
+
+// GasLimitMargin returns the configured percentage added to a message's
+// previewed gas usage when deriving its gas limit.
+func GasLimitMargin(plumbing glmAPI) (uint, error) {
+	value, err := plumbing.ConfigGet("wallet.gasLimitMargin")
+	if err != nil {
+		return 0, err
+	}
+	margin, ok := value.(uint)
+	if !ok {
+		return 0, errors.Errorf("wallet.gasLimitMargin is not an unsigned integer: %v", value)
+	}
+	return margin, nil
+}
+
+// GasLimitWithMargin returns usedGas increased by marginPercent percent, capped
+// at the block gas limit.
+func GasLimitWithMargin(usedGas types.GasUnits, marginPercent uint) types.GasUnits {
+	limit := new(big.Int).SetUint64(uint64(usedGas))
+	limit.Mul(limit, big.NewInt(int64(100+marginPercent)))
+	limit.Div(limit, big.NewInt(100))
+	if !limit.IsUint64() || limit.Uint64() > uint64(types.BlockGasLimit) {
+		return types.BlockGasLimit
+	}
+	return types.NewGasUnits(limit.Uint64())
+}
+
 // gamsdsaAPI is the subset of the plumbing.API that GetAndMaybeSetDefaultSenderAddress uses.
 type gamsdsaAPI interface {
 	ConfigGet(dottedPath string) (interface{}, error)
@@ -78,3 +146,120 @@ func GetAndMaybeSetDefaultSenderAddress(plumbing gamsdsaAPI) (address.Address, e
 
 	return address.Address{}, ErrNoDefaultFromAddress
 }
+
+// ReplaceGasPriceBump is the percentage by which MessageReplace and MessageCancel
+// raise the gas price of the original message when no price is given.
+const ReplaceGasPriceBump = 10
+
+// ErrMessageNotPending is returned when asked to replace a message that is not
+// in the message pool.
+var ErrMessageNotPending = errors.New("message is not pending in the message pool")
+
+// mrAPI is the subset of the plumbing.API that MessageReplace and MessageCancel use.
+type mrAPI interface {
+	MessagePoolGet(cid cid.Cid) (*types.SignedMessage, bool)
+	MessageSendReplacement(ctx context.Context, msg types.Message, gasPrice types.AttoFIL, gasLimit types.GasUnits) (cid.Cid, error)
+}
+
+// MessageReplace re-sends a pending message with a higher gas price so that it
+// supersedes the original, which has the same sender and nonce. If optGasPrice is
+// nil the original price is raised by ReplaceGasPriceBump percent.
+func MessageReplace(ctx context.Context, plumbing mrAPI, msgCid cid.Cid, optGasPrice *types.AttoFIL) (cid.Cid, error) {
+	orig, ok := plumbing.MessagePoolGet(msgCid)
+	if !ok {
+		return cid.Undef, errors.Wrapf(ErrMessageNotPending, "cannot replace message %s", msgCid)
+	}
+
+	gasPrice, err := replacementGasPrice(orig, optGasPrice)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	return plumbing.MessageSendReplacement(ctx, orig.Message, gasPrice, orig.GasLimit)
+}
+
+// MessageCancel supersedes a pending message with a zero-value transfer from its
+// sender to itself with the same nonce, so that the original can no longer be
+// mined. If optGasPrice is nil the original price is raised by
+// ReplaceGasPriceBump percent.
+func MessageCancel(ctx context.Context, plumbing mrAPI, msgCid cid.Cid, optGasPrice *types.AttoFIL) (cid.Cid, error) {
+	orig, ok := plumbing.MessagePoolGet(msgCid)
+	if !ok {
+		return cid.Undef, errors.Wrapf(ErrMessageNotPending, "cannot cancel message %s", msgCid)
+	}
+
+	gasPrice, err := replacementGasPrice(orig, optGasPrice)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	cancel := types.NewMessage(orig.From, orig.From, uint64(orig.Nonce), types.NewZeroAttoFIL(), "", nil)
+	return plumbing.MessageSendReplacement(ctx, *cancel, gasPrice, types.NewGasUnits(0))
+}
+
+// replacementGasPrice returns the gas price for a message replacing orig. The
+// price must be higher than the original's for the message pool to accept it.
+func replacementGasPrice(orig *types.SignedMessage, optGasPrice *types.AttoFIL) (types.AttoFIL, error) {
+	if optGasPrice != nil {
+		if !optGasPrice.GreaterThan(&orig.GasPrice) {
+			return types.AttoFIL{}, errors.Errorf("gas price must be higher than the original price of %s", orig.GasPrice.String())
+		}
+		return *optGasPrice, nil
+	}
+
+	bumped := orig.GasPrice.MulBigInt(big.NewInt(100 + ReplaceGasPriceBump)).DivCeil(types.NewAttoFIL(big.NewInt(100)))
+	if !bumped.GreaterThan(&orig.GasPrice) {
+		bumped = orig.GasPrice.Add(types.NewAttoFIL(big.NewInt(1)))
+	}
+	return *bumped, nil
+}
+
+// MessageStatusResponse describes whether a message is pending in the message
+// pool or has been included in the chain.
+type MessageStatusResponse struct {
+	Cid cid.Cid `json:"cid"`
+	// InPool is true if the message is waiting in the message pool.
+	InPool bool `json:"inPool"`
+	// Message is the message itself if it is known to this node.
+	Message *types.SignedMessage `json:"message"`
+	// Location is where the message was included in the chain, or nil if it
+	// has not been included.
+	Location *chain.MessageLocation `json:"location"`
+}
+
+// msAPI is the subset of the plumbing.API that MessageStatus uses.
+type msAPI interface {
+	BlockGet(ctx context.Context, id cid.Cid) (*types.Block, error)
+	ChainGetMessageLocation(ctx context.Context, msgCid cid.Cid) (*chain.MessageLocation, error)
+	MessagePoolGet(cid cid.Cid) (*types.SignedMessage, bool)
+}
+
+// MessageStatus reports whether the message with the given CID is pending in
+// the message pool or where it was included in the chain.
+func MessageStatus(ctx context.Context, plumbing msAPI, msgCid cid.Cid) (*MessageStatusResponse, error) {
+	status := &MessageStatusResponse{Cid: msgCid}
+	if msg, ok := plumbing.MessagePoolGet(msgCid); ok {
+		status.InPool = true
+		status.Message = msg
+	}
+
+	loc, err := plumbing.ChainGetMessageLocation(ctx, msgCid)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to look up message %s in chain", msgCid)
+	}
+	if loc == nil {
+		return status, nil
+	}
+	status.Location = loc
+
+	if status.Message == nil {
+		blk, err := plumbing.BlockGet(ctx, loc.Block)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load block %s", loc.Block)
+		}
+		if loc.Index < len(blk.Messages) {
+			status.Message = blk.Messages[loc.Index]
+		}
+	}
+	return status, nil
+}
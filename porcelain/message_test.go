@@ -1,12 +1,17 @@
 package porcelain_test
 
 import (
+	"context"
+	"math/big"
 	"testing"
 
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/plumbing/cfg"
 	"github.com/filecoin-project/go-filecoin/porcelain"
 	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/wallet"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
@@ -93,3 +98,164 @@ func isInList(needle address.Address, haystack []address.Address) bool {
 	}
 	return false
 }
+
+type fakeMessageSendPlumbing struct {
+	*fakeGetAndMaybeSetDefaultSenderAddressPlumbing
+	usedGas  types.GasUnits
+	previews int
+	gasLimit types.GasUnits
+}
+
+func (p *fakeMessageSendPlumbing) GetAndMaybeSetDefaultSenderAddress() (address.Address, error) {
+	return porcelain.GetAndMaybeSetDefaultSenderAddress(p)
+}
+
+func (p *fakeMessageSendPlumbing) MessagePreview(ctx context.Context, from, to address.Address, method string, params ...interface{}) (types.GasUnits, error) {
+	p.previews++
+	return p.usedGas, nil
+}
+
+func (p *fakeMessageSendPlumbing) MessageSend(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error) {
+	p.gasLimit = gasLimit
+	return types.SomeCid(), nil
+}
+
+func TestMessageSendWithDefaultAddress(t *testing.T) {
+	t.Parallel()
+
+	newPlumbing := func(require *require.Assertions) *fakeMessageSendPlumbing {
+		fp := &fakeMessageSendPlumbing{
+			fakeGetAndMaybeSetDefaultSenderAddressPlumbing: newFakeGetAndMaybeSetDefaultSenderAddressPlumbing(require),
+			usedGas: types.NewGasUnits(1000),
+		}
+		_, err := fp.WalletNewAddress()
+		require.NoError(err)
+		return fp
+	}
+
+	t.Run("uses the given gas limit", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		fp := newPlumbing(require)
+		_, err := porcelain.MessageSendWithDefaultAddress(context.Background(), fp, address.Address{}, address.TestAddress, types.NewZeroAttoFIL(), types.NewGasPrice(0), types.NewGasUnits(300), false, "method")
+		require.NoError(err)
+		assert.Equal(0, fp.previews)
+		assert.Equal(types.NewGasUnits(300), fp.gasLimit)
+	})
+
+	t.Run("derives the gas limit from a preview", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		fp := newPlumbing(require)
+		require.NoError(fp.ConfigSet("wallet.gasLimitMargin", "50"))
+		_, err := porcelain.MessageSendWithDefaultAddress(context.Background(), fp, address.Address{}, address.TestAddress, types.NewZeroAttoFIL(), types.NewGasPrice(0), types.NewGasUnits(0), true, "method")
+		require.NoError(err)
+		assert.Equal(1, fp.previews)
+		assert.Equal(types.NewGasUnits(1500), fp.gasLimit)
+	})
+
+	t.Run("does not preview a value transfer", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		fp := newPlumbing(require)
+		_, err := porcelain.MessageSendWithDefaultAddress(context.Background(), fp, address.Address{}, address.TestAddress, types.NewZeroAttoFIL(), types.NewGasPrice(0), types.NewGasUnits(0), true, "")
+		require.NoError(err)
+		assert.Equal(0, fp.previews)
+		assert.Equal(types.NewGasUnits(0), fp.gasLimit)
+	})
+}
+
+func TestGasLimitWithMargin(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	assert.Equal(types.NewGasUnits(120), porcelain.GasLimitWithMargin(types.NewGasUnits(100), 20))
+	assert.Equal(types.NewGasUnits(100), porcelain.GasLimitWithMargin(types.NewGasUnits(100), 0))
+	assert.Equal(types.BlockGasLimit, porcelain.GasLimitWithMargin(types.BlockGasLimit, 20))
+}
+
+type fakeMessageReplacePlumbing struct {
+	pending map[cid.Cid]*types.SignedMessage
+	sent    *types.Message
+	price   types.AttoFIL
+	limit   types.GasUnits
+}
+
+func (p *fakeMessageReplacePlumbing) MessagePoolGet(c cid.Cid) (*types.SignedMessage, bool) {
+	msg, ok := p.pending[c]
+	return msg, ok
+}
+
+func (p *fakeMessageReplacePlumbing) MessageSendReplacement(ctx context.Context, msg types.Message, gasPrice types.AttoFIL, gasLimit types.GasUnits) (cid.Cid, error) {
+	p.sent = &msg
+	p.price = gasPrice
+	p.limit = gasLimit
+	return types.SomeCid(), nil
+}
+
+func TestMessageReplace(t *testing.T) {
+	t.Parallel()
+
+	ki := types.MustGenerateKeyInfo(1, types.GenerateKeyInfoSeed())
+	signer := types.NewMockSigner(ki)
+	from := signer.Addresses[0]
+
+	newPlumbing := func(require *require.Assertions) (*fakeMessageReplacePlumbing, cid.Cid, *types.SignedMessage) {
+		msg := types.NewMessage(from, address.TestAddress, 7, types.NewAttoFILFromFIL(3), "method", nil)
+		smsg, err := types.NewSignedMessage(*msg, &signer, types.NewGasPrice(100), types.NewGasUnits(300))
+		require.NoError(err)
+		c, err := smsg.Cid()
+		require.NoError(err)
+		return &fakeMessageReplacePlumbing{pending: map[cid.Cid]*types.SignedMessage{c: smsg}}, c, smsg
+	}
+
+	t.Run("replace keeps the message and raises the price", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		fp, c, orig := newPlumbing(require)
+		_, err := porcelain.MessageReplace(context.Background(), fp, c, nil)
+		require.NoError(err)
+
+		assert.Equal(orig.Message, *fp.sent)
+		assert.Equal(orig.GasLimit, fp.limit)
+		assert.True(fp.price.Equal(types.NewAttoFIL(big.NewInt(110))))
+	})
+
+	t.Run("replace rejects a price that is not higher", func(t *testing.T) {
+		require := require.New(t)
+
+		fp, c, _ := newPlumbing(require)
+		_, err := porcelain.MessageReplace(context.Background(), fp, c, types.NewAttoFIL(big.NewInt(100)))
+		require.Error(err)
+		require.Nil(fp.sent)
+	})
+
+	t.Run("replace fails for a message that is not pending", func(t *testing.T) {
+		require := require.New(t)
+
+		fp, _, _ := newPlumbing(require)
+		_, err := porcelain.MessageReplace(context.Background(), fp, types.SomeCid(), nil)
+		require.Error(err)
+		require.Contains(err.Error(), porcelain.ErrMessageNotPending.Error())
+	})
+
+	t.Run("cancel sends a zero-value transfer to self with the same nonce", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		fp, c, orig := newPlumbing(require)
+		_, err := porcelain.MessageCancel(context.Background(), fp, c, types.NewAttoFIL(big.NewInt(200)))
+		require.NoError(err)
+
+		assert.Equal(from, fp.sent.From)
+		assert.Equal(from, fp.sent.To)
+		assert.Equal(orig.Nonce, fp.sent.Nonce)
+		assert.True(fp.sent.Value.IsZero())
+		assert.Equal("", fp.sent.Method)
+		assert.True(fp.price.Equal(types.NewAttoFIL(big.NewInt(200))))
+	})
+}
@@ -95,7 +95,7 @@ func newMinerSetPricePlumbing(assert *assert.Assertions, require *require.Assert
 	}
 }
 
-func (mtp *minerSetPricePlumbing) MessageSendWithDefaultAddress(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error) {
+func (mtp *minerSetPricePlumbing) MessageSendWithDefaultAddress(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, autoGasLimit bool, method string, params ...interface{}) (cid.Cid, error) {
 	if mtp.failSend {
 		return cid.Cid{}, errors.New("Test error in MessageSend")
 	}
@@ -155,7 +155,7 @@ func TestMinerSetPrice(t *testing.T) {
 
 		ctx := context.Background()
 		price := types.NewAttoFILFromFIL(50)
-		_, err := MinerSetPrice(ctx, plumbing, address.Address{}, address.Address{}, types.NewGasPrice(0), types.NewGasUnits(0), price, big.NewInt(0))
+		_, err := MinerSetPrice(ctx, plumbing, address.Address{}, address.Address{}, types.NewGasPrice(0), types.NewGasUnits(0), false, price, big.NewInt(0))
 		require.Error(err)
 		assert.Contains(err.Error(), "Test error in ConfigGet")
 	})
@@ -169,7 +169,7 @@ func TestMinerSetPrice(t *testing.T) {
 
 		ctx := context.Background()
 		price := types.NewAttoFILFromFIL(50)
-		_, err := MinerSetPrice(ctx, plumbing, address.Address{}, address.Address{}, types.NewGasPrice(0), types.NewGasUnits(0), price, big.NewInt(0))
+		_, err := MinerSetPrice(ctx, plumbing, address.Address{}, address.Address{}, types.NewGasPrice(0), types.NewGasUnits(0), false, price, big.NewInt(0))
 		require.Error(err)
 		assert.Contains(err.Error(), "Test error in ConfigSet")
 	})
@@ -182,7 +182,7 @@ func TestMinerSetPrice(t *testing.T) {
 
 		ctx := context.Background()
 		price := types.NewAttoFILFromFIL(50)
-		_, err := MinerSetPrice(ctx, plumbing, address.Address{}, address.Address{}, types.NewGasPrice(0), types.NewGasUnits(0), price, big.NewInt(0))
+		_, err := MinerSetPrice(ctx, plumbing, address.Address{}, address.Address{}, types.NewGasPrice(0), types.NewGasUnits(0), false, price, big.NewInt(0))
 		require.NoError(err)
 
 		configPrice, err := plumbing.config.Get("mining.storagePrice")
@@ -200,7 +200,7 @@ func TestMinerSetPrice(t *testing.T) {
 
 		ctx := context.Background()
 		price := types.NewAttoFILFromFIL(50)
-		_, err := MinerSetPrice(ctx, plumbing, address.Address{}, address.Address{}, types.NewGasPrice(0), types.NewGasUnits(0), price, big.NewInt(0))
+		_, err := MinerSetPrice(ctx, plumbing, address.Address{}, address.Address{}, types.NewGasPrice(0), types.NewGasUnits(0), false, price, big.NewInt(0))
 		require.Error(err)
 		assert.Contains(err.Error(), "Test error in MessageSend")
 
@@ -225,7 +225,7 @@ func TestMinerSetPrice(t *testing.T) {
 			return types.NewCidForTestGetter()(), nil
 		}
 
-		_, err := MinerSetPrice(ctx, plumbing, address.Address{}, minerAddr, types.NewGasPrice(0), types.NewGasUnits(0), price, big.NewInt(0))
+		_, err := MinerSetPrice(ctx, plumbing, address.Address{}, minerAddr, types.NewGasPrice(0), types.NewGasUnits(0), false, price, big.NewInt(0))
 		require.NoError(err)
 	})
 
@@ -246,7 +246,7 @@ func TestMinerSetPrice(t *testing.T) {
 			return types.NewCidForTestGetter()(), nil
 		}
 
-		_, err := MinerSetPrice(ctx, plumbing, address.Address{}, address.Address{}, types.NewGasPrice(0), types.NewGasUnits(0), price, big.NewInt(0))
+		_, err := MinerSetPrice(ctx, plumbing, address.Address{}, address.Address{}, types.NewGasPrice(0), types.NewGasUnits(0), false, price, big.NewInt(0))
 		require.NoError(err)
 	})
 
@@ -267,7 +267,7 @@ func TestMinerSetPrice(t *testing.T) {
 			return types.NewCidForTestGetter()(), nil
 		}
 
-		_, err := MinerSetPrice(ctx, plumbing, address.Address{}, address.Address{}, types.NewGasPrice(0), types.NewGasUnits(0), price, expiry)
+		_, err := MinerSetPrice(ctx, plumbing, address.Address{}, address.Address{}, types.NewGasPrice(0), types.NewGasUnits(0), false, price, expiry)
 		require.NoError(err)
 	})
 
@@ -281,7 +281,7 @@ func TestMinerSetPrice(t *testing.T) {
 		ctx := context.Background()
 		price := types.NewAttoFILFromFIL(50)
 
-		_, err := MinerSetPrice(ctx, plumbing, address.Address{}, address.Address{}, types.NewGasPrice(0), types.NewGasUnits(0), price, big.NewInt(0))
+		_, err := MinerSetPrice(ctx, plumbing, address.Address{}, address.Address{}, types.NewGasPrice(0), types.NewGasUnits(0), false, price, big.NewInt(0))
 		require.Error(err)
 		assert.Contains(err.Error(), "Test error in MessageWait")
 	})
@@ -303,7 +303,7 @@ func TestMinerSetPrice(t *testing.T) {
 			return messageCid, nil
 		}
 
-		res, err := MinerSetPrice(ctx, plumbing, address.Address{}, minerAddr, types.NewGasPrice(0), types.NewGasUnits(0), price, expiry)
+		res, err := MinerSetPrice(ctx, plumbing, address.Address{}, minerAddr, types.NewGasPrice(0), types.NewGasUnits(0), false, price, expiry)
 		require.NoError(err)
 
 		assert.Equal(price, res.Price)
@@ -365,6 +365,23 @@ func TestMinerGetOwnerAddress(t *testing.T) {
 	assert.Equal(address.TestAddress, addr)
 }
 
+type minerGetWorkerPlumbing struct{}
+
+func (mgwp *minerGetWorkerPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
+	if method != "getWorker" {
+		return nil, nil, errors.New("unexpected method " + method)
+	}
+	return [][]byte{address.TestAddress.Bytes()}, nil, nil
+}
+
+func TestMinerGetWorkerAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, err := MinerGetWorkerAddress(context.Background(), &minerGetWorkerPlumbing{}, address.TestAddress2)
+	assert.NoError(err)
+	assert.Equal(address.TestAddress, addr)
+}
+
 type minerGetPeerIDPlumbing struct{}
 
 func (mgop *minerGetPeerIDPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
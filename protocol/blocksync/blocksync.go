@@ -0,0 +1,336 @@
+package blocksync
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	net "gx/ipfs/QmTGxDz2CjBucFzPNTiWwzQmTWdrBnzqbqrMucDYMsjuPb/go-libp2p-net"
+	peer "gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+	host "gx/ipfs/Qmd52WKRSwrBK5gUaJKawryZQ5by6UbNB8KVW2Zy6JtbyW/go-libp2p-host"
+
+	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func init() {
+	cbor.RegisterCborType(Request{})
+	cbor.RegisterCborType(Response{})
+}
+
+// protocol is the libp2p protocol identifier for the blocksync protocol.
+const protocol = "/fil/blocksync/1.0.0"
+
+// MaxRequestLength is the largest number of tipsets served in response to a
+// single request. Longer requests are answered with this many tipsets.
+const MaxRequestLength = 500
+
+// maxResponseTipSetsSize bounds the encoded size of the tipsets in a response
+// so that the response can be read as a single message. Responses stop at
+// the last tipset that fits, leaving room for the rest of the response.
+const maxResponseTipSetsSize = cbu.MaxMessageSize - 1<<10
+
+// requestTimeout bounds the time spent on a request to a single peer.
+const requestTimeout = 30 * time.Second
+
+// maxConcurrentFetches is the number of peers FetchTipSets asks at once.
+const maxConcurrentFetches = 3
+
+var log = logging.Logger("/fil/blocksync")
+
+// Status communicates whether a request could be served.
+type Status int
+
+const (
+	// Unset is the default status
+	Unset = Status(iota)
+
+	// Success means that the response holds the requested tipsets, or as
+	// many of them as exist or are served.
+	Success
+
+	// NotFound means that the peer does not have the start tipset.
+	NotFound
+
+	// BadRequest means that the request was malformed.
+	BadRequest
+
+	// TooLarge means that the start tipset is too large to be sent in a
+	// response.
+	TooLarge
+)
+
+// Request asks a peer for a tipset and its ancestors.
+type Request struct {
+	// Start is the key of the first tipset requested.
+	Start []cid.Cid
+	// Length is the number of tipsets requested, counting Start and then
+	// going back through its parents.
+	Length uint64
+	// IncludeMessages asks for complete blocks. Otherwise the blocks are
+	// sent as headers with their messages and receipts removed, which means
+	// they no longer hash to their CIDs.
+	IncludeMessages bool
+}
+
+// Response answers a Request.
+type Response struct {
+	Status       Status
+	ErrorMessage string
+	// TipSets holds the blocks of the served tipsets in the order they were
+	// requested, from Start backwards. It stops short of the requested
+	// length if more tipsets would make the response too large to read.
+	TipSets [][]*types.Block
+}
+
+type getBlocksFunc func(ctx context.Context, ids types.SortedCidSet) ([]*types.Block, error)
+
+// BlockSync implements the blocksync protocol, which lets a node fetch a run
+// of tipsets from a peer with a single request instead of resolving them one
+// tipset at a time over bitswap. It serves the tipsets of its node's chain
+// store and fetches tipsets from connected peers.
+type BlockSync struct {
+	host host.Host
+
+	// getBlocks loads blocks that are served to peers.
+	getBlocks getBlocksFunc
+
+	// lastPeer is the peer that most recently served a request and is the
+	// first asked for the next one.
+	lastPeerLk sync.Mutex
+	lastPeer   peer.ID
+}
+
+var _ chain.TipSetFetcher = (*BlockSync)(nil)
+
+// New creates a new instance of the blocksync protocol and registers it to
+// the given host. It serves blocks loaded with getBlocks.
+func New(h host.Host, getBlocks getBlocksFunc) *BlockSync {
+	bsync := &BlockSync{
+		host:      h,
+		getBlocks: getBlocks,
+	}
+	h.SetStreamHandler(protocol, bsync.handleNewStream)
+	return bsync
+}
+
+func (bsync *BlockSync) handleNewStream(s net.Stream) {
+	defer s.Close() // nolint: errcheck
+
+	from := s.Conn().RemotePeer()
+
+	var req Request
+	if err := cbu.NewMsgReader(s).ReadMsg(&req); err != nil {
+		log.Warningf("bad blocksync request from peer %s: %s", from, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	resp := bsync.processRequest(ctx, &req)
+
+	if err := cbu.NewMsgWriter(s).WriteMsg(resp); err != nil {
+		log.Warningf("failed to send blocksync response to peer %s: %s", from, err)
+	}
+}
+
+func (bsync *BlockSync) processRequest(ctx context.Context, req *Request) *Response {
+	if len(req.Start) == 0 || req.Length == 0 {
+		return &Response{Status: BadRequest, ErrorMessage: "request must have a start tipset and a length"}
+	}
+	length := req.Length
+	if length > MaxRequestLength {
+		length = MaxRequestLength
+	}
+
+	var tipsets [][]*types.Block
+	size := 0
+	next := types.NewSortedCidSet(req.Start...)
+	for uint64(len(tipsets)) < length && !next.Empty() {
+		blks, err := bsync.getBlocks(ctx, next)
+		if err != nil {
+			if len(tipsets) == 0 {
+				return &Response{Status: NotFound, ErrorMessage: err.Error()}
+			}
+			break
+		}
+		ts, err := types.NewTipSet(blks...)
+		if err != nil {
+			log.Errorf("stored blocks %s do not form a tipset: %s", next.String(), err)
+			break
+		}
+		if next, err = ts.Parents(); err != nil {
+			break
+		}
+
+		if !req.IncludeMessages {
+			blks = headers(blks)
+		}
+		encoded, err := cbor.DumpObject(blks)
+		if err != nil {
+			log.Errorf("failed to encode blocks %s: %s", ts.String(), err)
+			break
+		}
+		if size+len(encoded) > maxResponseTipSetsSize {
+			if len(tipsets) == 0 {
+				return &Response{Status: TooLarge, ErrorMessage: "tipset is too large to send"}
+			}
+			break
+		}
+		size += len(encoded)
+		tipsets = append(tipsets, blks)
+	}
+
+	return &Response{Status: Success, TipSets: tipsets}
+}
+
+// headers returns copies of blks without their messages and receipts.
+func headers(blks []*types.Block) []*types.Block {
+	out := make([]*types.Block, len(blks))
+	for i, blk := range blks {
+		hdr := *blk
+		hdr.Messages = nil
+		hdr.MessageReceipts = nil
+		out[i] = &hdr
+	}
+	return out
+}
+
+// GetTipSets asks peer p for the tipset with key start and up to length-1 of
+// its ancestors, ordered from start backwards. Fewer tipsets are returned if
+// the chain reaches genesis or the peer serves fewer. If includeMessages is
+// true the blocks are complete and checked to form the requested chain;
+// otherwise they are headers and only checked to link to one another.
+func (bsync *BlockSync) GetTipSets(ctx context.Context, p peer.ID, start types.SortedCidSet, length uint64, includeMessages bool) ([]types.TipSet, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	s, err := bsync.host.NewStream(ctx, p, protocol)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open blocksync stream")
+	}
+	defer s.Close() // nolint: errcheck
+
+	req := Request{
+		Start:           start.ToSlice(),
+		Length:          length,
+		IncludeMessages: includeMessages,
+	}
+	if err := cbu.NewMsgWriter(s).WriteMsg(&req); err != nil {
+		return nil, errors.Wrap(err, "failed to write blocksync request")
+	}
+
+	var resp Response
+	if err := cbu.NewMsgReader(s).ReadMsg(&resp); err != nil {
+		return nil, errors.Wrap(err, "failed to read blocksync response")
+	}
+	if resp.Status != Success {
+		return nil, errors.Errorf("peer %s could not serve tipsets from %s: %s", p, start.String(), resp.ErrorMessage)
+	}
+	if len(resp.TipSets) == 0 || uint64(len(resp.TipSets)) > length {
+		return nil, errors.Errorf("peer %s sent %d tipsets for a request of %d", p, len(resp.TipSets), length)
+	}
+
+	tipsets := make([]types.TipSet, len(resp.TipSets))
+	var parents types.SortedCidSet
+	for i, blks := range resp.TipSets {
+		ts, err := types.NewTipSet(blks...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "peer %s sent an invalid tipset", p)
+		}
+		if i > 0 {
+			if err := checkLink(ts, parents, includeMessages); err != nil {
+				return nil, errors.Wrapf(err, "peer %s sent a broken chain", p)
+			}
+		} else if includeMessages && !ts.ToSortedCidSet().Equals(start) {
+			return nil, errors.Errorf("peer %s sent tipset %s instead of %s", p, ts.String(), start.String())
+		}
+		if parents, err = ts.Parents(); err != nil {
+			return nil, err
+		}
+		tipsets[i] = ts
+	}
+	return tipsets, nil
+}
+
+// checkLink checks that ts is the parent of a tipset whose parents are
+// parents. Headers can only be checked to have one block per parent.
+func checkLink(ts types.TipSet, parents types.SortedCidSet, complete bool) error {
+	if complete && !ts.ToSortedCidSet().Equals(parents) {
+		return errors.Errorf("tipset %s is not the expected parent %s", ts.String(), parents.String())
+	}
+	if len(ts) != parents.Len() {
+		return errors.Errorf("tipset %s does not have a block per parent in %s", ts.String(), parents.String())
+	}
+	return nil
+}
+
+// FetchTipSets fetches the complete tipset with key start and up to length-1
+// of its ancestors from a connected peer. Up to maxConcurrentFetches peers
+// are asked at once, starting with the one that served the last request, and
+// the first response that checks out is returned.
+func (bsync *BlockSync) FetchTipSets(ctx context.Context, start types.SortedCidSet, length uint64) ([]types.TipSet, error) {
+	peers := bsync.host.Network().Peers()
+	if len(peers) == 0 {
+		return nil, errors.New("no peers to fetch tipsets from")
+	}
+	bsync.lastPeerLk.Lock()
+	last := bsync.lastPeer
+	bsync.lastPeerLk.Unlock()
+	for i, p := range peers {
+		if p == last {
+			peers[0], peers[i] = peers[i], peers[0]
+			break
+		}
+	}
+
+	// Canceling ctx stops the requests still running once one succeeds.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type fetchResult struct {
+		peer    peer.ID
+		tipsets []types.TipSet
+		err     error
+	}
+	results := make(chan fetchResult, len(peers))
+	slots := make(chan struct{}, maxConcurrentFetches)
+	go func() {
+		for _, p := range peers {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(p peer.ID) {
+				defer func() { <-slots }()
+				tipsets, err := bsync.GetTipSets(ctx, p, start, length, true)
+				results <- fetchResult{peer: p, tipsets: tipsets, err: err}
+			}(p)
+		}
+	}()
+
+	var err error
+	for range peers {
+		select {
+		case r := <-results:
+			if r.err != nil {
+				log.Debugf("failed to fetch tipsets from peer %s: %s", r.peer, r.err)
+				err = r.err
+				continue
+			}
+			bsync.lastPeerLk.Lock()
+			bsync.lastPeer = r.peer
+			bsync.lastPeerLk.Unlock()
+			return r.tipsets, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return nil, errors.Wrapf(err, "no peer served tipsets from %s", start.String())
+}
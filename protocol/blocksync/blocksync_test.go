@@ -0,0 +1,201 @@
+package blocksync
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	"gx/ipfs/QmcNGX5RaxPPCYwa6yGXM1EcUbrreTTinixLcYGmMwf1sx/go-libp2p/p2p/net/mock"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+type fakeBlocks map[cid.Cid]*types.Block
+
+func (f fakeBlocks) add(blks ...*types.Block) {
+	for _, b := range blks {
+		f[b.Cid()] = b
+	}
+}
+
+func (f fakeBlocks) GetBlocks(ctx context.Context, ids types.SortedCidSet) ([]*types.Block, error) {
+	var blks []*types.Block
+	for it := ids.Iter(); !it.Complete(); it.Next() {
+		b, ok := f[it.Value()]
+		if !ok {
+			return nil, errors.Errorf("block %s not found", it.Value())
+		}
+		blks = append(blks, b)
+	}
+	return blks, nil
+}
+
+func TestBlockSync(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockSigner, _ := types.NewMockSignersAndKeyInfo(1)
+	newMsg := types.NewSignedMessageForTestGetter(mockSigner)
+
+	// gen <- b1 <- {b2a, b2b} <- b3
+	gen := types.NewBlockForTest(nil, 0)
+	b1 := types.NewBlockForTest(gen, 1)
+	b1.Messages = []*types.SignedMessage{newMsg()}
+	b1.MessageReceipts = []*types.MessageReceipt{{ExitCode: 0}}
+	b2a := types.NewBlockForTest(b1, 2)
+	b2b := types.NewBlockForTest(b1, 3)
+	b3 := types.NewBlockForTest(b2a, 4)
+	b3.Parents.Add(b2b.Cid())
+
+	served := fakeBlocks{}
+	served.add(gen, b1, b2a, b2b, b3)
+
+	setup := func(t *testing.T) (*BlockSync, *BlockSync) {
+		require := require.New(t)
+
+		mn, err := mocknet.WithNPeers(ctx, 2)
+		require.NoError(err)
+		server := New(mn.Hosts()[0], served.GetBlocks)
+		client := New(mn.Hosts()[1], fakeBlocks{}.GetBlocks)
+		require.NoError(mn.LinkAll())
+		require.NoError(mn.ConnectAllButSelf())
+		return server, client
+	}
+
+	t.Run("fetches complete tipsets back to genesis", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		server, client := setup(t)
+
+		head := types.RequireNewTipSet(require, b3)
+		tipsets, err := client.GetTipSets(ctx, server.host.ID(), head.ToSortedCidSet(), 10, true)
+		require.NoError(err)
+		require.Len(tipsets, 4)
+		assert.True(tipsets[0].Equals(head))
+		assert.True(tipsets[1].Equals(types.RequireNewTipSet(require, b2a, b2b)))
+		assert.True(tipsets[2].Equals(types.RequireNewTipSet(require, b1)))
+		assert.True(tipsets[3].Equals(types.RequireNewTipSet(require, gen)))
+		assert.Len(tipsets[2].ToSlice()[0].Messages, 1)
+	})
+
+	t.Run("serves at most the requested length", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		server, client := setup(t)
+
+		start := types.RequireNewTipSet(require, b2a, b2b)
+		tipsets, err := client.GetTipSets(ctx, server.host.ID(), start.ToSortedCidSet(), 2, true)
+		require.NoError(err)
+		require.Len(tipsets, 2)
+		assert.True(tipsets[0].Equals(start))
+		assert.True(tipsets[1].Equals(types.RequireNewTipSet(require, b1)))
+	})
+
+	t.Run("headers leave out messages", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		server, client := setup(t)
+
+		start := types.RequireNewTipSet(require, b1)
+		tipsets, err := client.GetTipSets(ctx, server.host.ID(), start.ToSortedCidSet(), 2, false)
+		require.NoError(err)
+		require.Len(tipsets, 2)
+		hdr := tipsets[0].ToSlice()[0]
+		assert.Empty(hdr.Messages)
+		assert.Equal(b1.Nonce, hdr.Nonce)
+		assert.True(b1.Parents.Equals(hdr.Parents))
+	})
+
+	t.Run("unknown start tipset is an error", func(t *testing.T) {
+		require := require.New(t)
+		server, client := setup(t)
+
+		unknown := types.NewBlockForTest(b3, 5)
+		_, err := client.GetTipSets(ctx, server.host.ID(), types.NewSortedCidSet(unknown.Cid()), 10, true)
+		require.Error(err)
+	})
+
+	t.Run("stops responses before they grow too large to read", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		// Each block holds a 100KB message, so a response of more than two
+		// of them would exceed the message size limit.
+		var blks []*types.Block
+		parent := gen
+		for i := 0; i < 5; i++ {
+			msg := newMsg()
+			msg.Params = make([]byte, 100<<10)
+			blk := types.NewBlockForTest(parent, uint64(10+i))
+			blk.Messages = []*types.SignedMessage{msg}
+			blk.MessageReceipts = []*types.MessageReceipt{{ExitCode: 0}}
+			blks = append(blks, blk)
+			parent = blk
+		}
+		large := fakeBlocks{}
+		large.add(gen)
+		large.add(blks...)
+
+		mn, err := mocknet.WithNPeers(ctx, 2)
+		require.NoError(err)
+		server := New(mn.Hosts()[0], large.GetBlocks)
+		client := New(mn.Hosts()[1], fakeBlocks{}.GetBlocks)
+		require.NoError(mn.LinkAll())
+		require.NoError(mn.ConnectAllButSelf())
+
+		head := types.RequireNewTipSet(require, blks[4])
+		tipsets, err := client.GetTipSets(ctx, server.host.ID(), head.ToSortedCidSet(), 5, true)
+		require.NoError(err)
+		require.Len(tipsets, 2)
+		assert.True(tipsets[0].Equals(head))
+		assert.True(tipsets[1].Equals(types.RequireNewTipSet(require, blks[3])))
+
+		// A tipset that cannot be sent on its own is an error.
+		huge := newMsg()
+		huge.Params = make([]byte, 300<<10)
+		blks[0].Messages = []*types.SignedMessage{huge}
+		large.add(blks[0])
+		_, err = client.GetTipSets(ctx, server.host.ID(), types.NewSortedCidSet(blks[0].Cid()), 1, true)
+		assert.Error(err)
+	})
+
+	t.Run("fetches from connected peers", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		_, client := setup(t)
+
+		head := types.RequireNewTipSet(require, b3)
+		tipsets, err := client.FetchTipSets(ctx, head.ToSortedCidSet(), 2)
+		require.NoError(err)
+		require.Len(tipsets, 2)
+		assert.True(tipsets[0].Equals(head))
+	})
+
+	t.Run("fetches from the peers that have the tipsets", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		mn, err := mocknet.WithNPeers(ctx, 5)
+		require.NoError(err)
+		for _, h := range mn.Hosts()[:3] {
+			New(h, fakeBlocks{}.GetBlocks)
+		}
+		New(mn.Hosts()[3], served.GetBlocks)
+		client := New(mn.Hosts()[4], fakeBlocks{}.GetBlocks)
+		require.NoError(mn.LinkAll())
+		require.NoError(mn.ConnectAllButSelf())
+
+		head := types.RequireNewTipSet(require, b3)
+		tipsets, err := client.FetchTipSets(ctx, head.ToSortedCidSet(), 2)
+		require.NoError(err)
+		require.Len(tipsets, 2)
+		assert.True(tipsets[0].Equals(head))
+		assert.Equal(mn.Hosts()[3].ID(), client.lastPeer)
+	})
+}
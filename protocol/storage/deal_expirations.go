@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// expiringDeal is a deal with data in a committed sector.
+type expiringDeal struct {
+	dealCid  cid.Cid
+	sectorID uint64
+}
+
+// dealExpirations indexes the deals of a miner with data in committed sectors
+// by the height at which they expire, so that a new head only visits the
+// deals that expire by it. It also tracks the sectors that must be extended
+// to outlast the deals with data in them.
+type dealExpirations struct {
+	lk sync.Mutex
+
+	// heights are the heights at which deals expire, in ascending order.
+	heights []uint64
+	// byHeight maps heights to the deals that expire at them.
+	byHeight map[uint64][]expiringDeal
+	// sectorsEnd maps sectors to the latest expiration of the deals with
+	// data in them that have not expired yet.
+	sectorsEnd map[uint64]*types.BlockHeight
+	// toExtend are the sectors that may expire before sectorsEnd, until the
+	// chain shows they do not.
+	toExtend map[uint64]bool
+	// inProcess maps the cids of the extendSectors messages that have not
+	// been included in the chain yet to the sector they extend.
+	inProcess map[string]uint64
+	// permanent are the sectors that never expire, which were committed
+	// before sectors had expirations.
+	permanent map[uint64]bool
+}
+
+func newDealExpirations() *dealExpirations {
+	return &dealExpirations{
+		byHeight:   make(map[uint64][]expiringDeal),
+		sectorsEnd: make(map[uint64]*types.BlockHeight),
+		toExtend:   make(map[uint64]bool),
+		inProcess:  make(map[string]uint64),
+		permanent:  make(map[uint64]bool),
+	}
+}
+
+// add indexes a deal with data in the sector that expires at end.
+func (de *dealExpirations) add(dealCid cid.Cid, sectorID uint64, end *types.BlockHeight) {
+	de.lk.Lock()
+	defer de.lk.Unlock()
+
+	height := end.AsBigInt().Uint64()
+	i := sort.Search(len(de.heights), func(i int) bool { return de.heights[i] >= height })
+	if i == len(de.heights) || de.heights[i] != height {
+		de.heights = append(de.heights, 0)
+		copy(de.heights[i+1:], de.heights[i:])
+		de.heights[i] = height
+	}
+	de.byHeight[height] = append(de.byHeight[height], expiringDeal{dealCid: dealCid, sectorID: sectorID})
+
+	if sectorEnd, ok := de.sectorsEnd[sectorID]; !ok || end.GreaterThan(sectorEnd) {
+		de.sectorsEnd[sectorID] = end
+		if !de.permanent[sectorID] {
+			de.toExtend[sectorID] = true
+		}
+	}
+}
+
+// popExpired removes and returns the deals that expire by height h, and the
+// sectors all the deals with data in which have expired.
+func (de *dealExpirations) popExpired(h *types.BlockHeight) ([]expiringDeal, []uint64) {
+	de.lk.Lock()
+	defer de.lk.Unlock()
+
+	var deals []expiringDeal
+	height := h.AsBigInt().Uint64()
+	n := 0
+	for ; n < len(de.heights) && de.heights[n] <= height; n++ {
+		deals = append(deals, de.byHeight[de.heights[n]]...)
+		delete(de.byHeight, de.heights[n])
+	}
+	de.heights = de.heights[n:]
+
+	var drained []uint64
+	for _, deal := range deals {
+		end, ok := de.sectorsEnd[deal.sectorID]
+		if ok && end.LessEqual(h) {
+			drained = append(drained, deal.sectorID)
+			delete(de.sectorsEnd, deal.sectorID)
+			delete(de.toExtend, deal.sectorID)
+		}
+	}
+	return deals, drained
+}
+
+// sectorsToExtend returns the sectors that may need to be extended and have
+// no extension in process, with the height they must be extended to.
+func (de *dealExpirations) sectorsToExtend() map[uint64]*types.BlockHeight {
+	de.lk.Lock()
+	defer de.lk.Unlock()
+
+	extending := make(map[uint64]bool)
+	for _, sectorID := range de.inProcess {
+		extending[sectorID] = true
+	}
+
+	sectors := make(map[uint64]*types.BlockHeight)
+	for sectorID := range de.toExtend {
+		if !extending[sectorID] {
+			sectors[sectorID] = de.sectorsEnd[sectorID]
+		}
+	}
+	return sectors
+}
+
+// extended records that the sector needs no extension, unless a deal that
+// expires later is added.
+func (de *dealExpirations) extended(sectorID uint64) {
+	de.lk.Lock()
+	defer de.lk.Unlock()
+
+	delete(de.toExtend, sectorID)
+}
+
+// neverExpires records that the sector never expires, so it is never
+// extended.
+func (de *dealExpirations) neverExpires(sectorID uint64) {
+	de.lk.Lock()
+	defer de.lk.Unlock()
+
+	de.permanent[sectorID] = true
+	delete(de.toExtend, sectorID)
+}
+
+// startExtension records that the extendSectors message with the given cid
+// extends the sector.
+func (de *dealExpirations) startExtension(msgCid cid.Cid, sectorID uint64) {
+	de.lk.Lock()
+	defer de.lk.Unlock()
+
+	de.inProcess[msgCid.String()] = sectorID
+}
+
+// finishExtension records that the extendSectors message with the given cid
+// was included in the chain, or is no longer waited for.
+func (de *dealExpirations) finishExtension(msgCid cid.Cid) {
+	de.lk.Lock()
+	defer de.lk.Unlock()
+
+	delete(de.inProcess, msgCid.String())
+}
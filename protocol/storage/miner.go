@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
 	"math/big"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -44,21 +45,26 @@ const queryDealProtocol = protocol.ID("/fil/storage/qry/1.0.0")
 // TODO: replace this with a queries to pick reasonable gas price and limits.
 const submitPostGasPrice = 0
 const submitPostGasLimit = 300
+const extendSectorsGasPrice = 0
+const extendSectorsGasLimit = 300
 
 const waitForPaymentChannelDuration = 2 * time.Minute
+const waitForCommitDuration = 10 * time.Minute
+const waitForExtensionDuration = 10 * time.Minute
 
 const dealsAwatingSealDatastorePrefix = "dealsAwaitingSeal"
 
 // Miner represents a storage miner.
 type Miner struct {
-	minerAddr      address.Address
-	minerOwnerAddr address.Address
+	minerAddr address.Address
 
 	dealsAwaitingSealDs repo.Datastore
 
 	postInProcessLk sync.Mutex
 	postInProcess   *types.BlockHeight
 
+	dealExpirations *dealExpirations
+
 	dealsAwaitingSeal *dealsAwaitingSealStruct
 
 	porcelainAPI minerPorcelain
@@ -107,12 +113,12 @@ func init() {
 }
 
 // NewMiner is
-func NewMiner(minerAddr, minerOwnerAddr address.Address, nd node, dealsDs repo.Datastore, porcelainAPI minerPorcelain) (*Miner, error) {
+func NewMiner(minerAddr address.Address, nd node, dealsDs repo.Datastore, porcelainAPI minerPorcelain) (*Miner, error) {
 	sm := &Miner{
 		minerAddr:           minerAddr,
-		minerOwnerAddr:      minerOwnerAddr,
 		porcelainAPI:        porcelainAPI,
 		dealsAwaitingSealDs: dealsDs,
+		dealExpirations:     newDealExpirations(),
 		node:                nd,
 		proposalAcceptor:    acceptProposal,
 		proposalRejector:    rejectProposal,
@@ -124,6 +130,10 @@ func NewMiner(minerAddr, minerOwnerAddr address.Address, nd node, dealsDs repo.D
 	sm.dealsAwaitingSeal.onSuccess = sm.onCommitSuccess
 	sm.dealsAwaitingSeal.onFail = sm.onCommitFail
 
+	if err := sm.loadDealExpirations(); err != nil {
+		return nil, errors.Wrap(err, "failed to load deal expirations when creating miner")
+	}
+
 	nd.Host().SetStreamHandler(makeDealProtocol, sm.handleMakeDeal)
 	nd.Host().SetStreamHandler(queryDealProtocol, sm.handleQueryDeal)
 
@@ -196,9 +206,13 @@ func (sm *Miner) validateDealPayment(ctx context.Context, p *storagedeal.Proposa
 		return err
 	}
 
-	// confirm we are target of channel
-	if channel.Target != sm.minerOwnerAddr {
-		return fmt.Errorf("miner account (%s) is not target of payment channel (%s)", sm.minerOwnerAddr.String(), channel.Target.String())
+	// confirm we are target of channel, which pays the current owner
+	ownerAddr, err := sm.getOwner()
+	if err != nil {
+		return errors.Wrap(err, "failed to get owner of miner")
+	}
+	if channel.Target != ownerAddr {
+		return fmt.Errorf("miner account (%s) is not target of payment channel (%s)", ownerAddr.String(), channel.Target.String())
 	}
 
 	// confirm channel contains enough funds
@@ -472,10 +486,12 @@ type dealsAwaitingSealStruct struct {
 	SectorsToDeals map[uint64][]cid.Cid
 	// Maps from sector id to sector.
 	SuccessfulSectors map[uint64]*sectorbuilder.SealedSectorMetadata
+	// Maps from sector id to the height at which the sector was committed.
+	CommitHeights map[uint64]*types.BlockHeight
 	// Maps from sector id to seal failure error string.
 	FailedSectors map[uint64]string
 
-	onSuccess func(dealCid cid.Cid, sector *sectorbuilder.SealedSectorMetadata)
+	onSuccess func(dealCid cid.Cid, sector *sectorbuilder.SealedSectorMetadata, commitHeight *types.BlockHeight)
 	onFail    func(dealCid cid.Cid, message string)
 }
 
@@ -483,6 +499,7 @@ func (sm *Miner) loadDealsAwaitingSeal() error {
 	sm.dealsAwaitingSeal = &dealsAwaitingSealStruct{
 		SectorsToDeals:    make(map[uint64][]cid.Cid),
 		SuccessfulSectors: make(map[uint64]*sectorbuilder.SealedSectorMetadata),
+		CommitHeights:     make(map[uint64]*types.BlockHeight),
 		FailedSectors:     make(map[uint64]string),
 	}
 
@@ -516,7 +533,7 @@ func (dealsAwaitingSeal *dealsAwaitingSealStruct) add(sectorID uint64, dealCid c
 	defer dealsAwaitingSeal.l.Unlock()
 
 	if sector, ok := dealsAwaitingSeal.SuccessfulSectors[sectorID]; ok {
-		dealsAwaitingSeal.onSuccess(dealCid, sector)
+		dealsAwaitingSeal.onSuccess(dealCid, sector, dealsAwaitingSeal.CommitHeights[sectorID])
 		// Don't keep references to sectors around forever. Assume that at most
 		// one success-before-add call will happen (eg, in a test). Sector sealing
 		// outside of tests is so slow that it shouldn't happen in practice.
@@ -525,6 +542,7 @@ func (dealsAwaitingSeal *dealsAwaitingSealStruct) add(sectorID uint64, dealCid c
 		// sectors we hang onto, eg keep a fixed-length slice of successes
 		// and failures and shift the oldest off and the newest on.
 		delete(dealsAwaitingSeal.SuccessfulSectors, sectorID)
+		delete(dealsAwaitingSeal.CommitHeights, sectorID)
 	} else if message, ok := dealsAwaitingSeal.FailedSectors[sectorID]; ok {
 		dealsAwaitingSeal.onFail(dealCid, message)
 		// Same as above.
@@ -539,14 +557,15 @@ func (dealsAwaitingSeal *dealsAwaitingSealStruct) add(sectorID uint64, dealCid c
 	}
 }
 
-func (dealsAwaitingSeal *dealsAwaitingSealStruct) success(sector *sectorbuilder.SealedSectorMetadata) {
+func (dealsAwaitingSeal *dealsAwaitingSealStruct) success(sector *sectorbuilder.SealedSectorMetadata, commitHeight *types.BlockHeight) {
 	dealsAwaitingSeal.l.Lock()
 	defer dealsAwaitingSeal.l.Unlock()
 
 	dealsAwaitingSeal.SuccessfulSectors[sector.SectorID] = sector
+	dealsAwaitingSeal.CommitHeights[sector.SectorID] = commitHeight
 
 	for _, dealCid := range dealsAwaitingSeal.SectorsToDeals[sector.SectorID] {
-		dealsAwaitingSeal.onSuccess(dealCid, sector)
+		dealsAwaitingSeal.onSuccess(dealCid, sector, commitHeight)
 	}
 	delete(dealsAwaitingSeal.SectorsToDeals, sector.SectorID)
 }
@@ -563,8 +582,55 @@ func (dealsAwaitingSeal *dealsAwaitingSealStruct) fail(sectorID uint64, message
 	delete(dealsAwaitingSeal.SectorsToDeals, sectorID)
 }
 
-// OnCommitmentAddedToChain is a callback, called when a sector seal message was posted to the chain.
-func (sm *Miner) OnCommitmentAddedToChain(sector *sectorbuilder.SealedSectorMetadata, err error) {
+// OnCommitmentSent is a callback, called when the commitSector message with
+// the given cid was sent for a sealed sector. It waits for the message to be
+// included in the chain before the deals with data in the sector are posted.
+func (sm *Miner) OnCommitmentSent(sector *sectorbuilder.SealedSectorMetadata, msgCid cid.Cid, err error) {
+	if err != nil {
+		sm.OnCommitmentAddedToChain(sector, nil, err)
+		return
+	}
+
+	go sm.waitForCommitment(sector, msgCid)
+}
+
+// waitForCommitment waits for the commitSector message with the given cid to
+// be included in the chain, for as long as it takes: mining may be slow, so
+// the deals with data in the sector only fail if the message fails.
+func (sm *Miner) waitForCommitment(sector *sectorbuilder.SealedSectorMetadata, msgCid cid.Cid) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), waitForCommitDuration)
+		var receipt *types.MessageReceipt
+		var commitHeight *types.BlockHeight
+		err := sm.porcelainAPI.MessageWait(ctx, msgCid, func(blk *types.Block, smsg *types.SignedMessage, r *types.MessageReceipt) error {
+			receipt = r
+			commitHeight = types.NewBlockHeight(uint64(blk.Height))
+			return nil
+		})
+		if receipt == nil {
+			if err == context.DeadlineExceeded {
+				log.Warningf("commitSector message %s for sector %d is not in the chain after %s, still waiting", msgCid.String(), sector.SectorID, waitForCommitDuration)
+			} else {
+				log.Warningf("failed to wait for commitSector message %s for sector %d, retrying: %v", msgCid.String(), sector.SectorID, err)
+				<-ctx.Done()
+			}
+			cancel()
+			continue
+		}
+		cancel()
+
+		if receipt.ExitCode != 0 {
+			sm.OnCommitmentAddedToChain(sector, nil, errors.Errorf("commitSector failed with exit code %d", receipt.ExitCode))
+			return
+		}
+		sm.OnCommitmentAddedToChain(sector, commitHeight, nil)
+		return
+	}
+}
+
+// OnCommitmentAddedToChain is a callback, called when a sector seal message was posted to the chain
+// at commitHeight.
+func (sm *Miner) OnCommitmentAddedToChain(sector *sectorbuilder.SealedSectorMetadata, commitHeight *types.BlockHeight, err error) {
 	sectorID := sector.SectorID
 	log.Debug("Miner.OnCommitmentAddedToChain")
 
@@ -573,7 +639,7 @@ func (sm *Miner) OnCommitmentAddedToChain(sector *sectorbuilder.SealedSectorMeta
 		errMsg := fmt.Sprintf("failed sealing sector: %d", sectorID)
 		sm.dealsAwaitingSeal.fail(sector.SectorID, errMsg)
 	} else {
-		sm.dealsAwaitingSeal.success(sector)
+		sm.dealsAwaitingSeal.success(sector, commitHeight)
 	}
 	if err := sm.saveDealsAwaitingSeal(); err != nil {
 		log.Errorf("failed persisting deals awaiting seal: %s", err)
@@ -581,7 +647,15 @@ func (sm *Miner) OnCommitmentAddedToChain(sector *sectorbuilder.SealedSectorMeta
 	}
 }
 
-func (sm *Miner) onCommitSuccess(dealCid cid.Cid, sector *sectorbuilder.SealedSectorMetadata) {
+func (sm *Miner) onCommitSuccess(dealCid cid.Cid, sector *sectorbuilder.SealedSectorMetadata, commitHeight *types.BlockHeight) {
+	d := sm.porcelainAPI.DealGet(dealCid)
+	if d == nil {
+		log.Errorf("commit succeeded but deal %s was not found", dealCid.String())
+		return
+	}
+	// the deal lasts for its duration from the commitment of its data
+	expiration := commitHeight.Add(types.NewBlockHeight(d.Proposal.Duration))
+
 	err := sm.updateDealResponse(dealCid, func(resp *storagedeal.Response) {
 		resp.State = storagedeal.Posted
 		resp.ProofInfo = &storagedeal.ProofInfo{
@@ -589,10 +663,14 @@ func (sm *Miner) onCommitSuccess(dealCid cid.Cid, sector *sectorbuilder.SealedSe
 			CommR:    sector.CommR[:],
 			CommD:    sector.CommD[:],
 		}
+		resp.Expiration = expiration
 	})
 	if err != nil {
 		log.Errorf("commit succeeded but could not update to deal 'Posted' state: %s", err)
+		return
 	}
+
+	sm.dealExpirations.add(dealCid, sector.SectorID, expiration)
 }
 
 func (sm *Miner) onCommitFail(dealCid cid.Cid, message string) {
@@ -625,6 +703,15 @@ func (sm *Miner) currentProvingPeriodPoStChallengeSeed(ctx context.Context) (pro
 func (sm *Miner) OnNewHeaviestTipSet(ts types.TipSet) {
 	ctx := context.Background()
 
+	height, err := ts.Height()
+	if err != nil {
+		log.Errorf("failed to get block height: %s", err)
+		return
+	}
+	h := types.NewBlockHeight(height)
+
+	sm.handleDealExpirations(h)
+
 	rets, sig, err := sm.porcelainAPI.MessageQuery(
 		ctx,
 		address.Address{},
@@ -668,6 +755,8 @@ func (sm *Miner) OnNewHeaviestTipSet(ts types.TipSet) {
 		// no sector sealed, nothing to do
 		return
 	}
+	// the miner actor verifies PoSts over the comm-rs in order of sector id
+	sort.Slice(inputs, func(i, j int) bool { return inputs[i].sectorID < inputs[j].sectorID })
 
 	provingPeriodStart, err := sm.getProvingPeriodStart()
 	if err != nil {
@@ -683,18 +772,15 @@ func (sm *Miner) OnNewHeaviestTipSet(ts types.TipSet) {
 		return
 	}
 
-	height, err := ts.Height()
-	if err != nil {
-		log.Errorf("failed to get block height: %s", err)
-		return
-	}
-
-	h := types.NewBlockHeight(height)
 	provingPeriodEnd := provingPeriodStart.Add(miner.ProvingPeriodBlocks)
 
 	if h.GreaterEqual(provingPeriodStart) {
-		if h.LessThan(provingPeriodEnd) {
-			// we are in a new proving period, lets get this post going
+		if h.LessThan(provingPeriodEnd.Add(miner.GracePeriodBlocks)) {
+			// we are in a new proving period, or late but still within the
+			// grace period and paying a fee, lets get this post going
+			if h.GreaterEqual(provingPeriodEnd) {
+				log.Warningf("late to start PoSt, a fee will be charged start=%s end=%s current=%s", provingPeriodStart, provingPeriodEnd, h)
+			}
 			sm.postInProcess = provingPeriodStart
 
 			seed, err := sm.currentProvingPeriodPoStChallengeSeed(ctx)
@@ -705,8 +791,7 @@ func (sm *Miner) OnNewHeaviestTipSet(ts types.TipSet) {
 
 			go sm.submitPoSt(provingPeriodStart, provingPeriodEnd, seed, inputs)
 		} else {
-			// we are too late
-			// TODO: figure out faults and payments here
+			// we are too late, and can be slashed
 			log.Errorf("too late start=%s  end=%s current=%s", provingPeriodStart, provingPeriodEnd, h)
 		}
 	}
@@ -753,9 +838,19 @@ func (sm *Miner) submitPoSt(start, end *types.BlockHeight, seed proofs.PoStChall
 		log.Errorf("failed to generate PoSts: %s", err)
 		return
 	}
-	if len(faults) != 0 {
-		log.Warningf("some faults when generating PoSt: %v", faults)
-		// TODO: proper fault handling
+	// faults are indexes into commRs
+	faultySectorIDs := make([]uint64, len(faults))
+	for i, fault := range faults {
+		faultySectorIDs[i] = inputs[fault].sectorID
+	}
+	if len(faultySectorIDs) != 0 {
+		log.Warningf("some faults when generating PoSt, declaring sectors faulty: %v", faultySectorIDs)
+	}
+
+	declaredFaulty, err := sm.getFaultySectors()
+	if err != nil {
+		log.Errorf("failed to get faulty sectors: %s", err)
+		return
 	}
 
 	height, err := sm.node.BlockHeight()
@@ -770,11 +865,13 @@ func (sm *Miner) submitPoSt(start, end *types.BlockHeight, seed proofs.PoStChall
 		return
 	}
 
-	if height.GreaterEqual(end) {
-		// TODO: we are too late, figure out faults and decide if we want to still submit
+	if height.GreaterEqual(end.Add(miner.GracePeriodBlocks)) {
 		log.Errorf("PoSt generation was too slow height=%s end=%s", height, end)
 		return
 	}
+	if height.GreaterEqual(end) {
+		log.Warningf("PoSt generation was slow, submitting late for a fee height=%s end=%s", height, end)
+	}
 
 	// TODO: figure out a more sensible timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
@@ -784,13 +881,307 @@ func (sm *Miner) submitPoSt(start, end *types.BlockHeight, seed proofs.PoStChall
 	gasPrice := types.NewGasPrice(submitPostGasPrice)
 	gasLimit := types.NewGasUnits(submitPostGasLimit)
 
-	_, err = sm.porcelainAPI.MessageSend(ctx, sm.minerOwnerAddr, sm.minerAddr, types.ZeroAttoFIL, gasPrice, gasLimit, "submitPoSt", proofs)
+	// PoSts are submitted by the worker of the miner, so that the node does
+	// not need the owner key that controls its funds.
+	workerAddr, err := sm.getWorker()
+	if err != nil {
+		log.Errorf("failed to get worker of miner %s: %s", sm.minerAddr, err)
+		return
+	}
+
+	postCid, err := sm.porcelainAPI.MessageSend(ctx, workerAddr, sm.minerAddr, types.ZeroAttoFIL, gasPrice, gasLimit, "submitPoSt", proofs, faultySectorIDs)
 	if err != nil {
 		log.Errorf("failed to submit PoSt: %s", err)
 		return
 	}
+	receipt, err := sm.waitForReceipt(ctx, postCid)
+	if err != nil {
+		log.Errorf("failed to wait for PoSt %s: %s", postCid.String(), err)
+		return
+	}
+	if receipt.ExitCode != 0 {
+		log.Errorf("PoSt %s failed with exit code %d", postCid.String(), receipt.ExitCode)
+		return
+	}
 
 	log.Debug("submitted PoSt")
+	sm.onSectorsFaulted(faultySectorIDs)
+
+	// sectors declared recovered before are no longer faulty once this PoSt
+	// proves them
+	stillFaulty, err := sm.getFaultySectors()
+	if err != nil {
+		log.Errorf("failed to get faulty sectors: %s", err)
+		return
+	}
+	isStillFaulty := make(map[uint64]bool)
+	for _, sectorID := range stillFaulty {
+		isStillFaulty[sectorID] = true
+	}
+	var restored []uint64
+	for _, sectorID := range declaredFaulty {
+		if !isStillFaulty[sectorID] {
+			restored = append(restored, sectorID)
+		}
+	}
+	sm.onSectorsRecovered(restored)
+
+	// faulty sectors proven by this PoSt are stored again, and regain their
+	// power if the next PoSt proves them too
+	isFaulty := make(map[uint64]bool)
+	for _, sectorID := range faultySectorIDs {
+		isFaulty[sectorID] = true
+	}
+	var recovered []uint64
+	for _, sectorID := range stillFaulty {
+		if !isFaulty[sectorID] {
+			recovered = append(recovered, sectorID)
+		}
+	}
+	if len(recovered) == 0 {
+		return
+	}
+
+	_, err = sm.porcelainAPI.MessageSend(ctx, workerAddr, sm.minerAddr, types.ZeroAttoFIL, gasPrice, gasLimit, "declareRecovery", recovered)
+	if err != nil {
+		log.Errorf("failed to declare recovery of sectors %v: %s", recovered, err)
+		return
+	}
+
+	log.Debugf("declared recovery of sectors %v", recovered)
+}
+
+// waitForReceipt waits for the message with the given cid to be included in
+// the chain and returns its receipt.
+func (sm *Miner) waitForReceipt(ctx context.Context, msgCid cid.Cid) (*types.MessageReceipt, error) {
+	var receipt *types.MessageReceipt
+	err := sm.porcelainAPI.MessageWait(ctx, msgCid, func(blk *types.Block, smsg *types.SignedMessage, r *types.MessageReceipt) error {
+		receipt = r
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+func (sm *Miner) getOwner() (address.Address, error) {
+	res, _, err := sm.porcelainAPI.MessageQuery(
+		context.Background(),
+		address.Address{},
+		sm.minerAddr,
+		"getOwner",
+	)
+	if err != nil {
+		return address.Address{}, err
+	}
+
+	return address.NewFromBytes(res[0])
+}
+
+func (sm *Miner) getWorker() (address.Address, error) {
+	res, _, err := sm.porcelainAPI.MessageQuery(
+		context.Background(),
+		address.Address{},
+		sm.minerAddr,
+		"getWorker",
+	)
+	if err != nil {
+		return address.Address{}, err
+	}
+
+	return address.NewFromBytes(res[0])
+}
+
+func (sm *Miner) getFaultySectors() ([]uint64, error) {
+	res, _, err := sm.porcelainAPI.MessageQuery(
+		context.Background(),
+		address.Address{},
+		sm.minerAddr,
+		"getFaultySectors",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	faultyVal, err := abi.Deserialize(res[0], abi.UintArray)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert returned ABI value")
+	}
+	faulty, ok := faultyVal.Val.([]uint64)
+	if !ok {
+		return nil, errors.New("failed to convert returned ABI value to []uint64")
+	}
+	return faulty, nil
+}
+
+// onSectorsFaulted notifies the deals with data in the given sectors, which
+// were declared faulty, by moving them to the Faulted state.
+func (sm *Miner) onSectorsFaulted(sectorIDs []uint64) {
+	sm.updateSectorDeals(sectorIDs, storagedeal.Posted, func(resp *storagedeal.Response) {
+		resp.State = storagedeal.Faulted
+		resp.Message = fmt.Sprintf("sector %d faulted", resp.ProofInfo.SectorID)
+	})
+}
+
+// onSectorsRecovered moves the deals with data in the given sectors, which
+// were declared recovered and proven again, back to the Posted state.
+func (sm *Miner) onSectorsRecovered(sectorIDs []uint64) {
+	sm.updateSectorDeals(sectorIDs, storagedeal.Faulted, func(resp *storagedeal.Response) {
+		resp.State = storagedeal.Posted
+		resp.Message = ""
+	})
+}
+
+// updateSectorDeals updates the responses of the deals in state with data in
+// the given sectors.
+func (sm *Miner) updateSectorDeals(sectorIDs []uint64, state storagedeal.State, f func(*storagedeal.Response)) {
+	if len(sectorIDs) == 0 {
+		return
+	}
+	inSectors := make(map[uint64]bool)
+	for _, sectorID := range sectorIDs {
+		inSectors[sectorID] = true
+	}
+
+	deals, err := sm.porcelainAPI.DealsLs()
+	if err != nil {
+		log.Errorf("failed to list deals to update for sectors %v: %s", sectorIDs, err)
+		return
+	}
+	for _, deal := range deals {
+		resp := deal.Response
+		if resp.State != state || resp.ProofInfo == nil || !inSectors[resp.ProofInfo.SectorID] {
+			continue
+		}
+		if err := sm.updateDealResponse(resp.ProposalCid, f); err != nil {
+			log.Errorf("failed to update deal %s for sector %d: %s", resp.ProposalCid.String(), resp.ProofInfo.SectorID, err)
+		}
+	}
+}
+
+// loadDealExpirations indexes the expirations of the deals of the miner with
+// data in committed sectors.
+func (sm *Miner) loadDealExpirations() error {
+	deals, err := sm.porcelainAPI.DealsLs()
+	if err != nil {
+		return err
+	}
+
+	for _, deal := range deals {
+		resp := deal.Response
+		if deal.Miner != sm.minerAddr || resp.ProofInfo == nil || resp.Expiration == nil {
+			continue
+		}
+		if resp.State != storagedeal.Posted && resp.State != storagedeal.Faulted {
+			continue
+		}
+		sm.dealExpirations.add(resp.ProposalCid, resp.ProofInfo.SectorID, resp.Expiration)
+	}
+	return nil
+}
+
+// handleDealExpirations moves the deals of the miner that expire by height h
+// to the Expired state, and extends the sectors with data of deals that
+// outlast them.
+func (sm *Miner) handleDealExpirations(h *types.BlockHeight) {
+	deals, drained := sm.dealExpirations.popExpired(h)
+	for _, deal := range deals {
+		err := sm.updateDealResponse(deal.dealCid, func(resp *storagedeal.Response) {
+			resp.State = storagedeal.Expired
+			resp.Message = fmt.Sprintf("deal expired at block %s", resp.Expiration)
+		})
+		if err != nil {
+			log.Errorf("failed to update expired deal %s: %s", deal.dealCid.String(), err)
+		}
+	}
+
+	for _, sectorID := range drained {
+		// The sector builder cannot delete sealed sectors, so the data stays
+		// around until the sector expires on chain.
+		log.Infof("all deals with data in sector %d expired, its sealed data is no longer needed", sectorID)
+	}
+
+	for sectorID, end := range sm.dealExpirations.sectorsToExtend() {
+		sm.extendSector(sectorID, end, h)
+	}
+}
+
+// extendSector sends an extendSectors message to make the sector expire at
+// end, unless it already expires at end or later, or has expired at height h.
+// If the message fails or is not included in the chain in time, the sector is
+// extended again at a later head.
+func (sm *Miner) extendSector(sectorID uint64, end, h *types.BlockHeight) {
+	expiration, err := sm.getSectorExpiration(sectorID)
+	if errors.Cause(err) == miner.Errors[miner.ErrInvalidSector] {
+		// sectors committed before expirations existed never expire
+		log.Infof("sector %d has no expiration, it does not need to be extended", sectorID)
+		sm.dealExpirations.neverExpires(sectorID)
+		return
+	}
+	if err != nil {
+		log.Warningf("failed to get expiration of sector %d: %s", sectorID, err)
+		return
+	}
+	if expiration.GreaterEqual(end) {
+		sm.dealExpirations.extended(sectorID)
+		return
+	}
+	if expiration.LessEqual(h) {
+		log.Errorf("sector %d expired at %s before the deals with data in it, which end at %s", sectorID, expiration, end)
+		sm.dealExpirations.extended(sectorID)
+		return
+	}
+
+	workerAddr, err := sm.getWorker()
+	if err != nil {
+		log.Errorf("failed to get worker of miner %s: %s", sm.minerAddr, err)
+		return
+	}
+
+	// TODO: algorithmically determine appropriate values for these
+	gasPrice := types.NewGasPrice(extendSectorsGasPrice)
+	gasLimit := types.NewGasUnits(extendSectorsGasLimit)
+
+	msgCid, err := sm.porcelainAPI.MessageSend(context.Background(), workerAddr, sm.minerAddr, types.ZeroAttoFIL, gasPrice, gasLimit, "extendSectors", []uint64{sectorID}, end)
+	if err != nil {
+		log.Errorf("failed to extend sector %d to %s: %s", sectorID, end, err)
+		return
+	}
+	sm.dealExpirations.startExtension(msgCid, sectorID)
+
+	go func() {
+		defer sm.dealExpirations.finishExtension(msgCid)
+
+		ctx, cancel := context.WithTimeout(context.Background(), waitForExtensionDuration)
+		defer cancel()
+
+		receipt, err := sm.waitForReceipt(ctx, msgCid)
+		if err != nil {
+			log.Errorf("failed to wait for extension %s of sector %d: %s", msgCid.String(), sectorID, err)
+			return
+		}
+		if receipt.ExitCode != 0 {
+			log.Errorf("extension %s of sector %d failed with exit code %d", msgCid.String(), sectorID, receipt.ExitCode)
+			return
+		}
+		log.Debugf("extended sector %d to %s", sectorID, end)
+	}()
+}
+
+func (sm *Miner) getSectorExpiration(sectorID uint64) (*types.BlockHeight, error) {
+	res, _, err := sm.porcelainAPI.MessageQuery(
+		context.Background(),
+		address.Address{},
+		sm.minerAddr,
+		"getSectorExpiration",
+		sectorID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return types.NewBlockHeightFromBytes(res[0]), nil
 }
 
 // Query responds to a query for the proposal referenced by the given cid
@@ -3,13 +3,17 @@ package storage
 import (
 	"context"
 	"crypto/rand"
+	"sync"
 	"testing"
+	"time"
 
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 
 	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
@@ -35,8 +39,7 @@ func TestReceiveStorageProposal(t *testing.T) {
 
 		porcelainAPI := newMinerTestPorcelain(require)
 		miner := Miner{
-			porcelainAPI:   porcelainAPI,
-			minerOwnerAddr: porcelainAPI.targetAddress,
+			porcelainAPI: porcelainAPI,
 			proposalAcceptor: func(m *Miner, p *storagedeal.Proposal) (*storagedeal.Response, error) {
 				accepted = true
 				return &storagedeal.Response{State: storagedeal.Accepted}, nil
@@ -94,9 +97,10 @@ func TestReceiveStorageProposal(t *testing.T) {
 		assert := assert.New(t)
 		require := require.New(t)
 
-		_, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
 
-		miner.minerOwnerAddr = address.TestAddress
+		// the owner changed since the miner started
+		porcelainAPI.ownerAddress = address.TestAddress
 
 		res, err := miner.receiveStorageProposal(context.Background(), proposal)
 		require.NoError(err)
@@ -227,6 +231,7 @@ func TestDealsAwaitingSeal(t *testing.T) {
 
 	wantSectorID := uint64(42)
 	wantSector := &sectorbuilder.SealedSectorMetadata{SectorID: wantSectorID}
+	wantCommitHeight := types.NewBlockHeight(773)
 	someOtherSectorID := uint64(100)
 
 	wantMessage := "boom"
@@ -240,6 +245,7 @@ func TestDealsAwaitingSeal(t *testing.T) {
 			dealsAwaitingSeal: &dealsAwaitingSealStruct{
 				SectorsToDeals:    make(map[uint64][]cid.Cid),
 				SuccessfulSectors: make(map[uint64]*sectorbuilder.SealedSectorMetadata),
+				CommitHeights:     make(map[uint64]*types.BlockHeight),
 				FailedSectors:     make(map[uint64]string),
 			},
 			dealsAwaitingSealDs: repo.NewInMemoryRepo().DealsDatastore(),
@@ -261,18 +267,20 @@ func TestDealsAwaitingSeal(t *testing.T) {
 		dealsAwaitingSeal := &dealsAwaitingSealStruct{
 			SectorsToDeals:    make(map[uint64][]cid.Cid),
 			SuccessfulSectors: make(map[uint64]*sectorbuilder.SealedSectorMetadata),
+			CommitHeights:     make(map[uint64]*types.BlockHeight),
 			FailedSectors:     make(map[uint64]string),
 		}
 		gotCids := []cid.Cid{}
-		dealsAwaitingSeal.onSuccess = func(dealCid cid.Cid, sector *sectorbuilder.SealedSectorMetadata) {
+		dealsAwaitingSeal.onSuccess = func(dealCid cid.Cid, sector *sectorbuilder.SealedSectorMetadata, commitHeight *types.BlockHeight) {
 			assert.Equal(sector, wantSector)
+			assert.Equal(wantCommitHeight, commitHeight)
 			gotCids = append(gotCids, dealCid)
 		}
 
 		dealsAwaitingSeal.add(wantSectorID, cid0)
 		dealsAwaitingSeal.add(wantSectorID, cid1)
 		dealsAwaitingSeal.add(someOtherSectorID, cid2)
-		dealsAwaitingSeal.success(wantSector)
+		dealsAwaitingSeal.success(wantSector, wantCommitHeight)
 
 		assert.Len(gotCids, 2, "onSuccess should've been called twice")
 	})
@@ -284,15 +292,17 @@ func TestDealsAwaitingSeal(t *testing.T) {
 		dealsAwaitingSeal := &dealsAwaitingSealStruct{
 			SectorsToDeals:    make(map[uint64][]cid.Cid),
 			SuccessfulSectors: make(map[uint64]*sectorbuilder.SealedSectorMetadata),
+			CommitHeights:     make(map[uint64]*types.BlockHeight),
 			FailedSectors:     make(map[uint64]string),
 		}
 		gotCids := []cid.Cid{}
-		dealsAwaitingSeal.onSuccess = func(dealCid cid.Cid, sector *sectorbuilder.SealedSectorMetadata) {
+		dealsAwaitingSeal.onSuccess = func(dealCid cid.Cid, sector *sectorbuilder.SealedSectorMetadata, commitHeight *types.BlockHeight) {
 			assert.Equal(sector, wantSector)
+			assert.Equal(wantCommitHeight, commitHeight)
 			gotCids = append(gotCids, dealCid)
 		}
 
-		dealsAwaitingSeal.success(wantSector)
+		dealsAwaitingSeal.success(wantSector, wantCommitHeight)
 		dealsAwaitingSeal.add(wantSectorID, cid0)
 		dealsAwaitingSeal.add(wantSectorID, cid1) // Shouldn't trigger a call, see add().
 		dealsAwaitingSeal.add(someOtherSectorID, cid2)
@@ -351,6 +361,7 @@ type minerTestPorcelain struct {
 	config        *cfg.Config
 	payerAddress  address.Address
 	targetAddress address.Address
+	ownerAddress  address.Address
 	channelID     *types.ChannelID
 	messageCid    *cid.Cid
 	signer        types.MockSigner
@@ -360,6 +371,24 @@ type minerTestPorcelain struct {
 	paymentStart  *types.BlockHeight
 	deals         map[cid.Cid]*storagedeal.Deal
 
+	// sectorExpirations are the expirations of the sectors of the miner,
+	// updated by the extendSectors messages it sends.
+	sectorExpirations map[uint64]*types.BlockHeight
+	sentMethods       []string
+	newMessageCid     func() cid.Cid
+
+	// failExtensions makes the extendSectors messages fail, and holdWaits,
+	// if set, holds MessageWait until it is closed. timedOutWaits is the
+	// number of calls to MessageWait that time out before waits succeed.
+	failExtensions bool
+	holdWaits      chan struct{}
+	timedOutWaits  int
+
+	// receipts are the receipts of the messages sent, guarded by receiptsLk
+	// as messages are waited for concurrently.
+	receiptsLk sync.Mutex
+	receipts   map[cid.Cid]*types.MessageReceipt
+
 	require *require.Assertions
 }
 
@@ -381,6 +410,7 @@ func newMinerTestPorcelain(require *require.Assertions) *minerTestPorcelain {
 	cidGetter := types.NewCidForTestGetter()
 
 	messageCid := cidGetter()
+	targetAddress := addressGetter()
 
 	config := cfg.NewConfig(repo.NewInMemoryRepo())
 	config.Set("mining.storagePrice", `".00025"`)
@@ -389,7 +419,8 @@ func newMinerTestPorcelain(require *require.Assertions) *minerTestPorcelain {
 	return &minerTestPorcelain{
 		config:        config,
 		payerAddress:  payerAddr,
-		targetAddress: addressGetter(),
+		targetAddress: targetAddress,
+		ownerAddress:  targetAddress,
 		channelID:     types.NewChannelID(73),
 		messageCid:    &messageCid,
 		signer:        mockSigner,
@@ -399,14 +430,47 @@ func newMinerTestPorcelain(require *require.Assertions) *minerTestPorcelain {
 		paymentStart:  blockHeight,
 		require:       require,
 		deals:         make(map[cid.Cid]*storagedeal.Deal),
+
+		sectorExpirations: make(map[uint64]*types.BlockHeight),
+		newMessageCid:     cidGetter,
+		receipts:          make(map[cid.Cid]*types.MessageReceipt),
 	}
 }
 
 func (mtp *minerTestPorcelain) MessageSend(ctx context.Context, from, to address.Address, val *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error) {
-	return cid.Cid{}, nil
+	mtp.sentMethods = append(mtp.sentMethods, method)
+	receipt := &types.MessageReceipt{}
+	if method == "extendSectors" {
+		if mtp.failExtensions {
+			receipt.ExitCode = 1
+		} else {
+			for _, sectorID := range params[0].([]uint64) {
+				mtp.sectorExpirations[sectorID] = params[1].(*types.BlockHeight)
+			}
+		}
+	}
+
+	msgCid := mtp.newMessageCid()
+	mtp.receiptsLk.Lock()
+	defer mtp.receiptsLk.Unlock()
+	mtp.receipts[msgCid] = receipt
+	return msgCid, nil
 }
 
 func (mtp *minerTestPorcelain) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
+	switch method {
+	case "getOwner":
+		return [][]byte{mtp.ownerAddress.Bytes()}, nil, nil
+	case "getWorker":
+		return [][]byte{mtp.targetAddress.Bytes()}, nil, nil
+	case "getSectorExpiration":
+		expiration, ok := mtp.sectorExpirations[params[0].(uint64)]
+		if !ok {
+			return nil, nil, errors.Wrap(miner.Errors[miner.ErrInvalidSector], "querymethod returned an error")
+		}
+		return [][]byte{expiration.Bytes()}, nil, nil
+	}
+
 	channels := map[string]*paymentbroker.PaymentChannel{}
 
 	if !mtp.noChannels {
@@ -433,13 +497,34 @@ func (mtp *minerTestPorcelain) ChainBlockHeight(ctx context.Context) (*types.Blo
 }
 
 func (mtp *minerTestPorcelain) MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error {
-	return nil
+	mtp.receiptsLk.Lock()
+	receipt, ok := mtp.receipts[msgCid]
+	timedOut := mtp.timedOutWaits > 0
+	if timedOut {
+		mtp.timedOutWaits--
+	}
+	mtp.receiptsLk.Unlock()
+	if timedOut {
+		return context.DeadlineExceeded
+	}
+	if !ok {
+		return nil
+	}
+
+	if mtp.holdWaits != nil {
+		select {
+		case <-mtp.holdWaits:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return cb(&types.Block{Height: types.Uint64(mtp.blockHeight.AsBigInt().Uint64())}, nil, receipt)
 }
 
 func newTestMiner(api *minerTestPorcelain) *Miner {
 	return &Miner{
-		porcelainAPI:   api,
-		minerOwnerAddr: api.targetAddress,
+		porcelainAPI:    api,
+		dealExpirations: newDealExpirations(),
 		proposalAcceptor: func(m *Miner, p *storagedeal.Proposal) (*storagedeal.Response, error) {
 			return &storagedeal.Response{State: storagedeal.Accepted}, nil
 		},
@@ -524,3 +609,209 @@ func (mtp *minerTestPorcelain) DealPut(storageDeal *storagedeal.Deal) error {
 	mtp.deals[storageDeal.Response.ProposalCid] = storageDeal
 	return nil
 }
+
+func TestSectorFaultsUpdateDeals(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	porcelainAPI := newMinerTestPorcelain(require)
+	miner := newTestMiner(porcelainAPI)
+
+	newCid := types.NewCidForTestGetter()
+	putDeal := func(state storagedeal.State, sectorID uint64) cid.Cid {
+		proposalCid := newCid()
+		require.NoError(porcelainAPI.DealPut(&storagedeal.Deal{
+			Response: &storagedeal.Response{
+				State:       state,
+				ProposalCid: proposalCid,
+				ProofInfo:   &storagedeal.ProofInfo{SectorID: sectorID},
+			},
+		}))
+		return proposalCid
+	}
+	inFaultySector := putDeal(storagedeal.Posted, 1)
+	inOtherSector := putDeal(storagedeal.Posted, 2)
+	staged := putDeal(storagedeal.Staged, 1)
+
+	miner.onSectorsFaulted([]uint64{1})
+	assert.Equal(storagedeal.Faulted, porcelainAPI.DealGet(inFaultySector).Response.State)
+	assert.Equal("sector 1 faulted", porcelainAPI.DealGet(inFaultySector).Response.Message)
+	assert.Equal(storagedeal.Posted, porcelainAPI.DealGet(inOtherSector).Response.State)
+	assert.Equal(storagedeal.Staged, porcelainAPI.DealGet(staged).Response.State)
+
+	miner.onSectorsRecovered([]uint64{1})
+	assert.Equal(storagedeal.Posted, porcelainAPI.DealGet(inFaultySector).Response.State)
+	assert.Equal("", porcelainAPI.DealGet(inFaultySector).Response.Message)
+	assert.Equal(storagedeal.Staged, porcelainAPI.DealGet(staged).Response.State)
+}
+
+func TestOnCommitSuccess(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	porcelainAPI := newMinerTestPorcelain(require)
+	miner := newTestMiner(porcelainAPI)
+
+	proposalCid := types.NewCidForTestGetter()()
+	require.NoError(porcelainAPI.DealPut(&storagedeal.Deal{
+		Proposal: &storagedeal.Proposal{Duration: 100},
+		Response: &storagedeal.Response{State: storagedeal.Staged, ProposalCid: proposalCid},
+	}))
+
+	// the deal lasts for its duration from the height of the commitment, not
+	// from the head when the commitment is noticed
+	miner.onCommitSuccess(proposalCid, &sectorbuilder.SealedSectorMetadata{SectorID: 1}, types.NewBlockHeight(500))
+	resp := porcelainAPI.DealGet(proposalCid).Response
+	assert.Equal(storagedeal.Posted, resp.State)
+	assert.Equal(types.NewBlockHeight(600), resp.Expiration)
+
+	miner.handleDealExpirations(types.NewBlockHeight(599))
+	assert.Equal(storagedeal.Posted, porcelainAPI.DealGet(proposalCid).Response.State)
+	miner.handleDealExpirations(types.NewBlockHeight(600))
+	assert.Equal(storagedeal.Expired, porcelainAPI.DealGet(proposalCid).Response.State)
+}
+
+func TestDealExpirations(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	porcelainAPI := newMinerTestPorcelain(require)
+	miner := newTestMiner(porcelainAPI)
+	porcelainAPI.sectorExpirations[1] = types.NewBlockHeight(1000)
+	porcelainAPI.sectorExpirations[2] = types.NewBlockHeight(1000)
+
+	newCid := types.NewCidForTestGetter()
+	putDeal := func(sectorID, expiration uint64) cid.Cid {
+		proposalCid := newCid()
+		require.NoError(porcelainAPI.DealPut(&storagedeal.Deal{
+			Response: &storagedeal.Response{
+				State:       storagedeal.Posted,
+				ProposalCid: proposalCid,
+				ProofInfo:   &storagedeal.ProofInfo{SectorID: sectorID},
+				Expiration:  types.NewBlockHeight(expiration),
+			},
+		}))
+		return proposalCid
+	}
+	shortDeal := putDeal(1, 900)
+	longDeal := putDeal(1, 1500)
+	otherDeal := putDeal(2, 950)
+	require.NoError(miner.loadDealExpirations())
+
+	waitForExtensions := func() {
+		extending := func() int {
+			miner.dealExpirations.lk.Lock()
+			defer miner.dealExpirations.lk.Unlock()
+			return len(miner.dealExpirations.inProcess)
+		}
+		for i := 0; i < 100 && extending() > 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		require.Equal(0, extending())
+	}
+
+	// expire the ended deal, and extend its sector for the longer one
+	porcelainAPI.failExtensions = true
+	porcelainAPI.holdWaits = make(chan struct{})
+	miner.handleDealExpirations(types.NewBlockHeight(920))
+	assert.Equal(storagedeal.Expired, porcelainAPI.DealGet(shortDeal).Response.State)
+	assert.Equal("deal expired at block 900", porcelainAPI.DealGet(shortDeal).Response.Message)
+	assert.Equal(storagedeal.Posted, porcelainAPI.DealGet(longDeal).Response.State)
+	assert.Equal(storagedeal.Posted, porcelainAPI.DealGet(otherDeal).Response.State)
+	assert.Equal([]string{"extendSectors"}, porcelainAPI.sentMethods)
+
+	// the sector is not extended again while the extension is in process
+	miner.handleDealExpirations(types.NewBlockHeight(930))
+	assert.Equal([]string{"extendSectors"}, porcelainAPI.sentMethods)
+
+	// a failed extension is retried
+	close(porcelainAPI.holdWaits)
+	waitForExtensions()
+	assert.Equal(types.NewBlockHeight(1000), porcelainAPI.sectorExpirations[1])
+	porcelainAPI.failExtensions = false
+	miner.handleDealExpirations(types.NewBlockHeight(940))
+	waitForExtensions()
+	assert.Equal(types.NewBlockHeight(1500), porcelainAPI.sectorExpirations[1])
+	assert.Equal(types.NewBlockHeight(1000), porcelainAPI.sectorExpirations[2])
+	assert.Equal([]string{"extendSectors", "extendSectors"}, porcelainAPI.sentMethods)
+
+	// sectors are extended once they succeed
+	miner.handleDealExpirations(types.NewBlockHeight(960))
+	assert.Equal(storagedeal.Expired, porcelainAPI.DealGet(otherDeal).Response.State)
+	assert.Equal(storagedeal.Posted, porcelainAPI.DealGet(longDeal).Response.State)
+	assert.Equal([]string{"extendSectors", "extendSectors"}, porcelainAPI.sentMethods)
+}
+
+func TestWaitForCommitment(t *testing.T) {
+	newMiner := func(porcelainAPI *minerTestPorcelain) (*Miner, *[]cid.Cid, *[]cid.Cid) {
+		var posted, failed []cid.Cid
+		m := newTestMiner(porcelainAPI)
+		m.dealsAwaitingSealDs = repo.NewInMemoryRepo().DealsDatastore()
+		m.dealsAwaitingSeal = &dealsAwaitingSealStruct{
+			SectorsToDeals:    make(map[uint64][]cid.Cid),
+			SuccessfulSectors: make(map[uint64]*sectorbuilder.SealedSectorMetadata),
+			CommitHeights:     make(map[uint64]*types.BlockHeight),
+			FailedSectors:     make(map[uint64]string),
+			onSuccess: func(dealCid cid.Cid, sector *sectorbuilder.SealedSectorMetadata, commitHeight *types.BlockHeight) {
+				posted = append(posted, dealCid)
+			},
+			onFail: func(dealCid cid.Cid, message string) {
+				failed = append(failed, dealCid)
+			},
+		}
+		return m, &posted, &failed
+	}
+	sector := &sectorbuilder.SealedSectorMetadata{SectorID: 1}
+	dealCid := types.NewCidForTestGetter()()
+
+	t.Run("deals are posted once the commitment is mined, however long it takes", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI := newMinerTestPorcelain(require)
+		m, posted, failed := newMiner(porcelainAPI)
+		m.dealsAwaitingSeal.add(sector.SectorID, dealCid)
+
+		msgCid, err := porcelainAPI.MessageSend(context.Background(), address.Address{}, address.Address{}, types.ZeroAttoFIL, types.NewGasPrice(0), types.NewGasUnits(0), "commitSector")
+		require.NoError(err)
+		porcelainAPI.timedOutWaits = 2
+
+		m.waitForCommitment(sector, msgCid)
+		assert.Equal([]cid.Cid{dealCid}, *posted)
+		assert.Empty(*failed)
+	})
+
+	t.Run("deals fail when the commitment fails", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI := newMinerTestPorcelain(require)
+		m, posted, failed := newMiner(porcelainAPI)
+		m.dealsAwaitingSeal.add(sector.SectorID, dealCid)
+
+		msgCid, err := porcelainAPI.MessageSend(context.Background(), address.Address{}, address.Address{}, types.ZeroAttoFIL, types.NewGasPrice(0), types.NewGasUnits(0), "commitSector")
+		require.NoError(err)
+		porcelainAPI.receipts[msgCid].ExitCode = 1
+
+		m.waitForCommitment(sector, msgCid)
+		assert.Empty(*posted)
+		assert.Equal([]cid.Cid{dealCid}, *failed)
+	})
+}
+
+func TestSectorsWithoutExpirationAreNotExtended(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	porcelainAPI := newMinerTestPorcelain(require)
+	miner := newTestMiner(porcelainAPI)
+
+	miner.dealExpirations.add(types.NewCidForTestGetter()(), 3, types.NewBlockHeight(1500))
+	miner.handleDealExpirations(types.NewBlockHeight(900))
+	assert.Empty(porcelainAPI.sentMethods)
+	assert.Empty(miner.dealExpirations.sectorsToExtend())
+
+	// a deal that ends later does not make the sector extendable again
+	miner.dealExpirations.add(types.NewCidForTestGetter()(), 3, types.NewBlockHeight(2000))
+	assert.Empty(miner.dealExpirations.sectorsToExtend())
+}
@@ -32,6 +32,14 @@ const (
 
 	// Staged means that the data in the deal has been staged into a sector
 	Staged
+
+	// Faulted means that the sector with the data in the deal was declared
+	// faulty by the miner, and is no longer proven until it recovers
+	Faulted
+
+	// Expired means that the deal ended, and the miner no longer stores its
+	// data
+	Expired
 )
 
 func (s State) String() string {
@@ -52,6 +60,10 @@ func (s State) String() string {
 		return "complete"
 	case Staged:
 		return "staged"
+	case Faulted:
+		return "faulted"
+	case Expired:
+		return "expired"
 	default:
 		return fmt.Sprintf("<unrecognized %d>", s)
 	}
@@ -113,6 +113,10 @@ type Response struct {
 	// the miner has sealed the data into a sector.
 	ProofInfo *ProofInfo
 
+	// Expiration is the block height at which the deal ends, set when its
+	// data is committed to the chain.
+	Expiration *types.BlockHeight
+
 	// Signature is a signature from the miner over the response
 	Signature types.Signature
 }
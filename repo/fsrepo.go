@@ -32,6 +32,7 @@ const (
 	walletDatastorePrefix  = "wallet"
 	chainDatastorePrefix   = "chain"
 	dealsDatastorePrefix   = "deals"
+	messageDatastorePrefix = "messages"
 	snapshotStorePrefix    = "snapshots"
 	snapshotFilenamePrefix = "snapshot"
 )
@@ -60,6 +61,7 @@ type FSRepo struct {
 	walletDs Datastore
 	chainDs  Datastore
 	dealsDs  Datastore
+	msgDs    Datastore
 
 	// lockfile is the file system lock to prevent others from opening the same repo.
 	lockfile io.Closer
@@ -133,6 +135,10 @@ func (r *FSRepo) loadFromDisk() error {
 	if err := r.openDealsDatastore(); err != nil {
 		return errors.Wrap(err, "failed to open deals datastore")
 	}
+
+	if err := r.openMessageDatastore(); err != nil {
+		return errors.Wrap(err, "failed to open message datastore")
+	}
 	return nil
 }
 
@@ -227,6 +233,11 @@ func (r *FSRepo) DealsDatastore() Datastore {
 	return r.dealsDs
 }
 
+// MessageDatastore returns the message datastore.
+func (r *FSRepo) MessageDatastore() Datastore {
+	return r.msgDs
+}
+
 // Version returns the version of the repo
 func (r *FSRepo) Version() uint {
 	return r.version
@@ -255,6 +266,10 @@ func (r *FSRepo) Close() error {
 		return errors.Wrap(err, "failed to close miner deals datastore")
 	}
 
+	if err := r.msgDs.Close(); err != nil {
+		return errors.Wrap(err, "failed to close message datastore")
+	}
+
 	if err := r.removeAPIFile(); err != nil {
 		return errors.Wrap(err, "error removing API file")
 	}
@@ -377,6 +392,17 @@ func (r *FSRepo) openDealsDatastore() error {
 	return nil
 }
 
+func (r *FSRepo) openMessageDatastore() error {
+	ds, err := badgerds.NewDatastore(filepath.Join(r.path, messageDatastorePrefix), badgerOptions())
+	if err != nil {
+		return err
+	}
+
+	r.msgDs = ds
+
+	return nil
+}
+
 func initVersion(p string, version uint) error {
 	return ioutil.WriteFile(filepath.Join(p, versionFilename), []byte(strconv.Itoa(int(version))), 0644)
 }
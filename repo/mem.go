@@ -23,6 +23,7 @@ type MemRepo struct {
 	W          Datastore
 	Chain      Datastore
 	DealsDs    Datastore
+	MessageDs  Datastore
 	version    uint
 	apiAddress string
 	stagingDir string
@@ -57,6 +58,7 @@ func NewInMemoryRepoWithSectorDirectories(staging, sealedDir string) *MemRepo {
 		W:          dss.MutexWrap(datastore.NewMapDatastore()),
 		Chain:      dss.MutexWrap(datastore.NewMapDatastore()),
 		DealsDs:    dss.MutexWrap(datastore.NewMapDatastore()),
+		MessageDs:  dss.MutexWrap(datastore.NewMapDatastore()),
 		version:    Version,
 		stagingDir: staging,
 		sealedDir:  sealedDir,
@@ -106,6 +108,11 @@ func (mr *MemRepo) DealsDatastore() Datastore {
 	return mr.DealsDs
 }
 
+// MessageDatastore returns the message datastore.
+func (mr *MemRepo) MessageDatastore() Datastore {
+	return mr.MessageDs
+}
+
 // Version returns the version of the repo.
 func (mr *MemRepo) Version() uint {
 	return mr.version
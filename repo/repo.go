@@ -37,6 +37,9 @@ type Repo interface {
 	// DealsDatastore holds deals data.
 	DealsDatastore() Datastore
 
+	// MessageDatastore holds pending messages that should survive restarts.
+	MessageDatastore() Datastore
+
 	// SetAPIAddr sets the address of the running API.
 	SetAPIAddr(string) error
 
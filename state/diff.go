@@ -0,0 +1,130 @@
+package state
+
+import (
+	"context"
+	"sort"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// ActorChange is the way an actor differs between two state trees.
+type ActorChange string
+
+const (
+	// ActorAdded means that the actor is only in the second tree.
+	ActorAdded = ActorChange("added")
+	// ActorRemoved means that the actor is only in the first tree.
+	ActorRemoved = ActorChange("removed")
+	// ActorChanged means that the actor is in both trees, with different
+	// fields.
+	ActorChanged = ActorChange("changed")
+)
+
+// ActorDiff describes how an actor differs between two state trees.
+type ActorDiff struct {
+	Address address.Address `json:"address"`
+	Change  ActorChange     `json:"change"`
+	// Before is the actor in the first tree, nil if it was added, and After
+	// the actor in the second tree, nil if it was removed.
+	Before *actor.Actor `json:"before"`
+	After  *actor.Actor `json:"after"`
+	// Fields lists the fields of a changed actor that differ, among "code",
+	// "head", "nonce" and "balance".
+	Fields []string `json:"fields,omitempty"`
+	// BalanceDelta is the balance of After minus the balance of Before,
+	// counting the balance of a missing actor as zero.
+	BalanceDelta *types.AttoFIL `json:"balanceDelta"`
+	// NonceDelta is the nonce of After minus the nonce of Before.
+	NonceDelta int64 `json:"nonceDelta"`
+}
+
+// Diff returns the actors that were added, removed or changed going from
+// the state tree from to the state tree to, sorted by address.
+func Diff(ctx context.Context, from, to Tree) ([]*ActorDiff, error) {
+	before, err := actorsByAddress(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := actorsByAddress(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []*ActorDiff
+	for addr, b := range before {
+		a, ok := after[addr]
+		if !ok {
+			diffs = append(diffs, newActorDiff(addr, ActorRemoved, b, nil))
+			continue
+		}
+		if fields := changedFields(b, a); len(fields) > 0 {
+			diff := newActorDiff(addr, ActorChanged, b, a)
+			diff.Fields = fields
+			diffs = append(diffs, diff)
+		}
+	}
+	for addr, a := range after {
+		if _, ok := before[addr]; !ok {
+			diffs = append(diffs, newActorDiff(addr, ActorAdded, nil, a))
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Address.String() < diffs[j].Address.String()
+	})
+	return diffs, nil
+}
+
+func actorsByAddress(ctx context.Context, t Tree) (map[address.Address]*actor.Actor, error) {
+	actors := make(map[address.Address]*actor.Actor)
+	err := t.ForEachActor(ctx, func(addr address.Address, act *actor.Actor) error {
+		actors[addr] = act
+		return nil
+	})
+	return actors, err
+}
+
+func newActorDiff(addr address.Address, change ActorChange, before, after *actor.Actor) *ActorDiff {
+	diff := &ActorDiff{
+		Address:      addr,
+		Change:       change,
+		Before:       before,
+		After:        after,
+		BalanceDelta: balanceOf(after).Sub(balanceOf(before)),
+	}
+	var beforeNonce, afterNonce int64
+	if before != nil {
+		beforeNonce = int64(before.Nonce)
+	}
+	if after != nil {
+		afterNonce = int64(after.Nonce)
+	}
+	diff.NonceDelta = afterNonce - beforeNonce
+	return diff
+}
+
+func balanceOf(act *actor.Actor) *types.AttoFIL {
+	if act == nil || act.Balance == nil {
+		return types.NewZeroAttoFIL()
+	}
+	return act.Balance
+}
+
+func changedFields(before, after *actor.Actor) []string {
+	var fields []string
+	if !before.Code.Equals(after.Code) {
+		fields = append(fields, "code")
+	}
+	if !before.Head.Equals(after.Head) {
+		fields = append(fields, "head")
+	}
+	if before.Nonce != after.Nonce {
+		fields = append(fields, "nonce")
+	}
+	if !balanceOf(before).Equal(balanceOf(after)) {
+		fields = append(fields, "balance")
+	}
+	return fields
+}
@@ -0,0 +1,71 @@
+package state
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestDiff(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+
+	addrGetter := address.NewForTestGetter()
+	kept, changed, removed, added := addrGetter(), addrGetter(), addrGetter(), addrGetter()
+
+	from := NewEmptyStateTree(cst)
+	require.NoError(from.SetActor(ctx, kept, actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(1))))
+	require.NoError(from.SetActor(ctx, changed, actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(10))))
+	require.NoError(from.SetActor(ctx, removed, actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(3))))
+	fromRoot, err := from.Flush(ctx)
+	require.NoError(err)
+
+	to := NewEmptyStateTree(cst)
+	require.NoError(to.SetActor(ctx, kept, actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(1))))
+	changedAfter := actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(7))
+	changedAfter.IncNonce()
+	require.NoError(to.SetActor(ctx, changed, changedAfter))
+	require.NoError(to.SetActor(ctx, added, actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(2))))
+	toRoot, err := to.Flush(ctx)
+	require.NoError(err)
+
+	from, err = LoadStateTree(ctx, cst, fromRoot, nil)
+	require.NoError(err)
+	to, err = LoadStateTree(ctx, cst, toRoot, nil)
+	require.NoError(err)
+
+	diffs, err := Diff(ctx, from, to)
+	require.NoError(err)
+	require.Len(diffs, 3)
+
+	byAddr := make(map[address.Address]*ActorDiff)
+	for _, d := range diffs {
+		byAddr[d.Address] = d
+	}
+
+	assert.Equal(ActorChanged, byAddr[changed].Change)
+	assert.Equal([]string{"nonce", "balance"}, byAddr[changed].Fields)
+	assert.True(types.NewZeroAttoFIL().Sub(types.NewAttoFILFromFIL(3)).Equal(byAddr[changed].BalanceDelta))
+	assert.Equal(int64(1), byAddr[changed].NonceDelta)
+
+	assert.Equal(ActorRemoved, byAddr[removed].Change)
+	assert.Nil(byAddr[removed].After)
+	assert.True(types.NewZeroAttoFIL().Sub(types.NewAttoFILFromFIL(3)).Equal(byAddr[removed].BalanceDelta))
+
+	assert.Equal(ActorAdded, byAddr[added].Change)
+	assert.Nil(byAddr[added].Before)
+	assert.True(types.NewAttoFILFromFIL(2).Equal(byAddr[added].BalanceDelta))
+
+	diffs, err = Diff(ctx, to, to)
+	require.NoError(err)
+	assert.Empty(diffs)
+}
@@ -118,17 +118,19 @@ func (ms MockSigner) CreateTicket(proof proofs.PoStProof, signerPubKey []byte) (
 // The message is unique wrt the closure returned, not globally. You can use this function
 // in tests instead of manually creating messages -- it both reduces duplication and gives us
 // exactly one place to create valid messages for tests if messages require validation in the
-// future.
+// future. Successive messages are given successive nonces so that they do not
+// collide in a message pool.
 // TODO support chosing from address
 func NewSignedMessageForTestGetter(ms MockSigner) func() *SignedMessage {
 	i := 0
 	return func() *SignedMessage {
 		s := fmt.Sprintf("smsg%d", i)
+		nonce := uint64(i)
 		i++
 		msg := NewMessage(
 			ms.Addresses[0], // from needs to be an address from the signer
 			address.NewMainnet([]byte(s+"-to")),
-			0,
+			nonce,
 			NewAttoFILFromFIL(0),
 			s,
 			[]byte("params"))
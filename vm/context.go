@@ -29,9 +29,19 @@ type Context struct {
 	blockHeight *types.BlockHeight
 	ancestors   []types.TipSet
 
+	transferObserver TransferObserver
+	// trace, if not nil, records the execution of the message.
+	trace *Trace
+	// sentByActor is true if the message was sent by an actor rather than
+	// being included in a block.
+	sentByActor bool
+
 	deps *deps // Inject external dependencies so we can unit test robustly.
 }
 
+// TransferObserver is notified of a value transfer between two actors.
+type TransferObserver func(from, to address.Address, value *types.AttoFIL)
+
 var _ exec.VMContext = (*Context)(nil)
 
 // NewContextParams is passed to NewVMContext to construct a new context.
@@ -44,6 +54,14 @@ type NewContextParams struct {
 	GasTracker  *GasTracker
 	BlockHeight *types.BlockHeight
 	Ancestors   []types.TipSet
+	// TransferObserver, if set, is notified of the value transferred by
+	// messages that actors send while the message executes, once the send
+	// that made the transfer has succeeded. The transfer of the message's own
+	// value is not observed.
+	TransferObserver TransferObserver
+	// Trace, if set, records the execution of the message, including the
+	// messages that actors send while it executes. It is filled in by Send.
+	Trace *Trace
 }
 
 // NewVMContext returns an initialized context.
@@ -57,7 +75,11 @@ func NewVMContext(params NewContextParams) *Context {
 		gasTracker:  params.GasTracker,
 		blockHeight: params.BlockHeight,
 		ancestors:   params.Ancestors,
-		deps:        makeDeps(params.State),
+
+		transferObserver: params.TransferObserver,
+		trace:            params.Trace,
+
+		deps: makeDeps(params.State),
 	}
 }
 
@@ -65,7 +87,11 @@ var _ exec.VMContext = (*Context)(nil)
 
 // Storage returns an implementation of the storage module for this context.
 func (ctx *Context) Storage() exec.Storage {
-	return ctx.storageMap.NewStorage(ctx.message.To, ctx.to)
+	storage := ctx.storageMap.NewStorage(ctx.message.To, ctx.to)
+	if ctx.trace != nil {
+		return &tracingStorage{Storage: storage, trace: ctx.trace}
+	}
+	return storage
 }
 
 // Message retrieves the message associated with this context.
@@ -93,7 +119,9 @@ func (ctx *Context) ReadStorage() ([]byte, error) {
 
 // Charge attempts to add the given cost to the accrued gas cost of this transaction
 func (ctx *Context) Charge(cost types.GasUnits) error {
-	return ctx.gasTracker.Charge(cost)
+	err := ctx.gasTracker.Charge(cost)
+	ctx.trace.add(&TraceEvent{Kind: TraceCharge, Gas: cost}, err)
+	return err
 }
 
 // GasUnits retrieves the gas cost so far
@@ -170,12 +198,31 @@ func (ctx *Context) Send(to address.Address, method string, value *types.AttoFIL
 		BlockHeight: ctx.blockHeight,
 		Ancestors:   ctx.ancestors,
 	}
+	// Transfers made by the send, including by the messages it sends in turn,
+	// are held back until it is known to have succeeded.
+	var transfers []func()
+	if ctx.transferObserver != nil {
+		observe := ctx.transferObserver
+		innerParams.TransferObserver = func(from, to address.Address, value *types.AttoFIL) {
+			transfers = append(transfers, func() { observe(from, to, value) })
+		}
+	}
+	if ctx.trace != nil {
+		innerParams.Trace = NewTrace(msg)
+		ctx.trace.add(&TraceEvent{Kind: TraceSend, Call: innerParams.Trace}, nil)
+	}
 	innerCtx := NewVMContext(innerParams)
+	innerCtx.sentByActor = true
 
 	out, ret, err := deps.Send(context.Background(), innerCtx)
 	if err != nil {
 		return nil, ret, err
 	}
+	if ret == 0 {
+		for _, observe := range transfers {
+			observe()
+		}
+	}
 
 	return out, ret, nil
 }
@@ -207,6 +254,12 @@ func computeActorAddress(creator address.Address, nonce uint64) (address.Address
 // CreateNewActor creates and initializes an actor at the given address.
 // If the address is occupied by a non-empty actor, this method will fail.
 func (ctx *Context) CreateNewActor(addr address.Address, code cid.Cid, initializerData interface{}) error {
+	err := ctx.createNewActor(addr, code, initializerData)
+	ctx.trace.add(&TraceEvent{Kind: TraceCreateActor, Cid: definedCid(code), Address: &addr}, err)
+	return err
+}
+
+func (ctx *Context) createNewActor(addr address.Address, code cid.Cid, initializerData interface{}) error {
 	// Check existing address. If nothing there, create empty actor.
 	newActor, err := ctx.state.GetOrCreateActor(context.TODO(), addr, func() (*actor.Actor, error) {
 		return &actor.Actor{}, nil
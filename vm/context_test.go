@@ -272,6 +272,53 @@ func TestVMContextSendFailures(t *testing.T) {
 
 }
 
+func TestVMContextSendObservesTransfersOfSuccessfulSends(t *testing.T) {
+	assert := assert.New(t)
+
+	newAddress := address.NewForTestGetter()
+	from, to := newAddress(), newAddress()
+
+	var observed []*types.AttoFIL
+	sendDeps := func(code uint8, err error) *deps {
+		return &deps{
+			EncodeValues: func(_ []*abi.Value) ([]byte, error) { return nil, nil },
+			GetOrCreateActor: func(_ context.Context, _ address.Address, f func() (*actor.Actor, error)) (*actor.Actor, error) {
+				return f()
+			},
+			Send: func(ctx context.Context, vmCtx *Context) ([][]byte, uint8, error) {
+				// The send transfers value and then completes with the given result.
+				vmCtx.transferObserver(from, to, types.NewAttoFILFromFIL(1))
+				return nil, code, err
+			},
+			ToValues: func(_ []interface{}) ([]*abi.Value, error) { return nil, nil },
+		}
+	}
+	newCtx := func(d *deps) *Context {
+		ctx := NewVMContext(NewContextParams{
+			From:        actor.NewActor(cid.Undef, types.NewAttoFILFromFIL(100)),
+			To:          actor.NewActor(cid.Undef, types.NewAttoFILFromFIL(50)),
+			Message:     types.NewMessage(from, newAddress(), 0, nil, "foo", nil),
+			State:       state.NewCachedStateTree(&state.MockStateTree{NoMocks: true}),
+			GasTracker:  NewGasTracker(),
+			BlockHeight: types.NewBlockHeight(0),
+			TransferObserver: func(from, to address.Address, value *types.AttoFIL) {
+				observed = append(observed, value)
+			},
+		})
+		ctx.deps = d
+		return ctx
+	}
+
+	_, _, err := newCtx(sendDeps(1, xerrors.New("reverted"))).Send(to, "foo", nil, nil)
+	assert.Error(err)
+	assert.Empty(observed)
+
+	_, code, err := newCtx(sendDeps(0, nil)).Send(to, "foo", nil, nil)
+	assert.NoError(err)
+	assert.Equal(0, int(code))
+	assert.Equal([]*types.AttoFIL{types.NewAttoFILFromFIL(1)}, observed)
+}
+
 func TestVMContextIsAccountActor(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -377,3 +424,59 @@ func TestVMContextRand(t *testing.T) {
 		assert.Equal([]byte(strconv.Itoa(0)), r)
 	})
 }
+
+func TestVMContextTrace(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	addrGetter := address.NewForTestGetter()
+	ctx := context.Background()
+
+	cst := hamt.NewCborStore()
+	st := state.NewEmptyStateTree(cst)
+	cstate := state.NewCachedStateTree(st)
+	vms := NewStorageMap(blockstore.NewBlockstore(datastore.NewMapDatastore()))
+
+	toActor, err := account.NewActor(nil)
+	require.NoError(err)
+	toAddr := addrGetter()
+	require.NoError(st.SetActor(ctx, toAddr, toActor))
+
+	msg := types.NewMessage(addrGetter(), toAddr, 0, nil, "hello", nil)
+	trace := NewTrace(msg)
+	vmCtx := NewVMContext(NewContextParams{
+		To:          toActor,
+		Message:     msg,
+		State:       cstate,
+		StorageMap:  vms,
+		GasTracker:  NewGasTracker(),
+		BlockHeight: types.NewBlockHeight(0),
+		Trace:       trace,
+	})
+
+	node, err := cbor.WrapObject([]byte("hello"), types.DefaultHashFunction, -1)
+	require.NoError(err)
+	require.NoError(vmCtx.Charge(10))
+	require.NoError(vmCtx.WriteStorage(node.RawData()))
+
+	assert.Equal(toAddr, trace.To)
+	assert.Equal("hello", trace.Method)
+	require.Len(trace.Events, 3)
+	assert.Equal(TraceCharge, trace.Events[0].Kind)
+	assert.Equal(types.GasUnits(10), trace.Events[0].Gas)
+	assert.Equal(TraceStoragePut, trace.Events[1].Kind)
+	assert.True(node.Cid().Equals(*trace.Events[1].Cid))
+	assert.Equal(TraceStorageCommit, trace.Events[2].Kind)
+	assert.True(node.Cid().Equals(*trace.Events[2].Cid))
+
+	// without a trace nothing is recorded
+	vmCtx = NewVMContext(NewContextParams{
+		To:          toActor,
+		Message:     msg,
+		State:       cstate,
+		StorageMap:  vms,
+		GasTracker:  NewGasTracker(),
+		BlockHeight: types.NewBlockHeight(0),
+	})
+	assert.NoError(vmCtx.Charge(10))
+	assert.Len(trace.Events, 3)
+}
@@ -0,0 +1,129 @@
+package vm
+
+import (
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// TraceEventKind identifies what a TraceEvent records.
+type TraceEventKind string
+
+const (
+	// TraceCharge is a gas charge.
+	TraceCharge = TraceEventKind("charge")
+	// TraceStorageGet is a read of a chunk of actor storage.
+	TraceStorageGet = TraceEventKind("storage-get")
+	// TraceStoragePut is a write of a chunk of actor storage.
+	TraceStoragePut = TraceEventKind("storage-put")
+	// TraceStorageCommit is a change of the head of actor storage.
+	TraceStorageCommit = TraceEventKind("storage-commit")
+	// TraceCreateActor is the creation of an actor.
+	TraceCreateActor = TraceEventKind("create-actor")
+	// TraceSend is a message sent by an actor.
+	TraceSend = TraceEventKind("send")
+)
+
+// Trace records the execution of a message by the VM: the message, its
+// result and, in order, what the actor it was sent to did while executing it.
+// Messages sent by the actor are recorded as nested traces.
+type Trace struct {
+	From     address.Address `json:"from"`
+	To       address.Address `json:"to"`
+	Method   string          `json:"method"`
+	Value    *types.AttoFIL  `json:"value"`
+	Params   []byte          `json:"params"`
+	Return   [][]byte        `json:"return"`
+	ExitCode uint8           `json:"exitCode"`
+	Error    string          `json:"error,omitempty"`
+	Events   []*TraceEvent   `json:"events"`
+}
+
+// TraceEvent is something an actor did while executing a message.
+type TraceEvent struct {
+	Kind TraceEventKind `json:"kind"`
+	// Gas is the amount charged by a TraceCharge.
+	Gas types.GasUnits `json:"gas,omitempty"`
+	// Cid is the chunk read or written, the new head of the storage for a
+	// TraceStorageCommit, or the code of the actor for a TraceCreateActor.
+	Cid *cid.Cid `json:"cid,omitempty"`
+	// Address is the address of the actor for a TraceCreateActor.
+	Address *address.Address `json:"address,omitempty"`
+	// Call is the trace of the message for a TraceSend.
+	Call *Trace `json:"call,omitempty"`
+	// Error is set if the operation failed.
+	Error string `json:"error,omitempty"`
+}
+
+// NewTrace returns a trace of msg, to be filled in as it executes by passing
+// it to NewVMContext.
+func NewTrace(msg *types.Message) *Trace {
+	return &Trace{
+		From:   msg.From,
+		To:     msg.To,
+		Method: msg.Method,
+		Value:  msg.Value,
+		Params: msg.Params,
+	}
+}
+
+// add appends an event to t. It does nothing if t is nil.
+func (t *Trace) add(event *TraceEvent, err error) {
+	if t == nil {
+		return
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	t.Events = append(t.Events, event)
+}
+
+// setResult records the result of the message. It does nothing if t is nil.
+func (t *Trace) setResult(ret [][]byte, exitCode uint8, err error) {
+	if t == nil {
+		return
+	}
+	t.Return = ret
+	t.ExitCode = exitCode
+	if err != nil {
+		t.Error = err.Error()
+	}
+}
+
+// tracingStorage is a Storage that records the operations on it in a trace.
+type tracingStorage struct {
+	exec.Storage
+	trace *Trace
+}
+
+var _ exec.Storage = (*tracingStorage)(nil)
+
+// Put implements exec.Storage.
+func (s *tracingStorage) Put(v interface{}) (cid.Cid, error) {
+	c, err := s.Storage.Put(v)
+	s.trace.add(&TraceEvent{Kind: TraceStoragePut, Cid: definedCid(c)}, err)
+	return c, err
+}
+
+// Get implements exec.Storage.
+func (s *tracingStorage) Get(c cid.Cid) ([]byte, error) {
+	out, err := s.Storage.Get(c)
+	s.trace.add(&TraceEvent{Kind: TraceStorageGet, Cid: definedCid(c)}, err)
+	return out, err
+}
+
+// Commit implements exec.Storage.
+func (s *tracingStorage) Commit(newHead, oldHead cid.Cid) error {
+	err := s.Storage.Commit(newHead, oldHead)
+	s.trace.add(&TraceEvent{Kind: TraceStorageCommit, Cid: definedCid(newHead)}, err)
+	return err
+}
+
+func definedCid(c cid.Cid) *cid.Cid {
+	if !c.Defined() {
+		return nil
+	}
+	return &c
+}
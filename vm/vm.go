@@ -18,7 +18,9 @@ func Send(ctx context.Context, vmCtx *Context) ([][]byte, uint8, error) {
 	deps := sendDeps{
 		transfer: Transfer,
 	}
-	return send(ctx, deps, vmCtx)
+	ret, exitCode, err := send(ctx, deps, vmCtx)
+	vmCtx.trace.setResult(ret, exitCode, err)
+	return ret, exitCode, err
 }
 
 type sendDeps struct {
@@ -34,6 +36,9 @@ func send(ctx context.Context, deps sendDeps, vmCtx *Context) ([][]byte, uint8,
 			}
 			return nil, 1, err
 		}
+		if vmCtx.sentByActor && vmCtx.transferObserver != nil {
+			vmCtx.transferObserver(vmCtx.message.From, vmCtx.message.To, vmCtx.message.Value)
+		}
 	}
 
 	if vmCtx.message.Method == "" {
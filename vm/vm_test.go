@@ -10,6 +10,7 @@ import (
 	xerrors "gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 
 	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -142,3 +143,45 @@ func TestSendErrorHandling(t *testing.T) {
 		assert.True(errors.ShouldRevert(sendErr))
 	})
 }
+
+func TestSendTransferObserver(t *testing.T) {
+	assert := assert.New(t)
+
+	actor1 := actor.NewActor(types.SomeCid(), types.NewAttoFILFromFIL(100))
+	actor2 := actor.NewActor(types.SomeCid(), types.NewAttoFILFromFIL(50))
+	newMsg := types.NewMessageForTestGetter()
+
+	var observed []*types.AttoFIL
+	observer := func(from, to address.Address, value *types.AttoFIL) {
+		observed = append(observed, value)
+	}
+	deps := sendDeps{transfer: Transfer}
+
+	newCtx := func() *Context {
+		msg := newMsg()
+		msg.Value = types.NewAttoFILFromFIL(1)
+		return NewVMContext(NewContextParams{
+			From:             actor1,
+			To:               actor2,
+			Message:          msg,
+			State:            state.NewCachedStateTree(&state.MockStateTree{NoMocks: true}),
+			GasTracker:       NewGasTracker(),
+			BlockHeight:      types.NewBlockHeight(0),
+			TransferObserver: observer,
+		})
+	}
+
+	// The value of the message itself is not observed.
+	_, code, err := send(context.Background(), deps, newCtx())
+	assert.NoError(err)
+	assert.Equal(0, int(code))
+	assert.Empty(observed)
+
+	// The value of a message sent by an actor is.
+	vmCtx := newCtx()
+	vmCtx.sentByActor = true
+	_, code, err = send(context.Background(), deps, vmCtx)
+	assert.NoError(err)
+	assert.Equal(0, int(code))
+	assert.Equal([]*types.AttoFIL{types.NewAttoFILFromFIL(1)}, observed)
+}